@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/jwt"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for access token related items stored in the Gin Context
+const (
+	cAccessToken   = "access_token"
+	cAccessTokenID = "access_token_id"
+)
+
+// AccessTokenController manages the personal access tokens of the logged in user
+type AccessTokenController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes access_token_id parameter from Gin Context and retrieves the token
+// of the logged in user and store it under key access_token in Gin Context
+func (ctrl AccessTokenController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cAccessTokenID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Access token does not exist"})
+		return
+	}
+
+	var token common.AccessToken
+	if err := db.AccessTokens().Find(bson.M{
+		"_id":     bson.ObjectIdHex(objectID),
+		"user_id": user.ID,
+	}).One(&token); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Access token does not exist",
+			Log: logrus.Fields{
+				"Access Token ID": objectID,
+				"Error":           err.Error(),
+			},
+		})
+		return
+	}
+
+	c.Set(cAccessToken, token)
+	c.Next()
+}
+
+// One returns the access token as a JSON object, the token itself is not returned
+func (ctrl AccessTokenController) One(c *gin.Context) {
+	token := c.MustGet(cAccessToken).(common.AccessToken)
+	metadata.AccessTokenMetadata(&token)
+	c.JSON(http.StatusOK, token)
+}
+
+// All returns the access tokens of the logged in user
+func (ctrl AccessTokenController) All(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match := parser.Match([]string{"scope"}, bson.M{"user_id": user.ID})
+	match = parser.Lookups([]string{"description"}, match)
+	query := db.AccessTokens().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("-created")
+	}
+
+	var tokens []common.AccessToken
+	if err := query.All(&tokens); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Access Tokens",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range tokens {
+		metadata.AccessTokenMetadata(&tokens[i])
+	}
+
+	count := len(tokens)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     tokens[pgi.Skip():pgi.End()],
+	})
+}
+
+// Create creates an access token for the logged in user. The token is returned
+// in the response and cannot be retrieved afterwards, only its hash is stored
+func (ctrl AccessTokenController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	var req common.AccessToken
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if req.Expires != nil && !req.Expires.After(time.Now()) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Expiry of the access token must be in the future.",
+		})
+		return
+	}
+
+	plain, hash, err := jwt.NewAccessToken()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
+			Message: "Error while creating Access Token",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	token := common.AccessToken{
+		ID:          bson.NewObjectId(),
+		UserID:      user.ID,
+		Description: req.Description,
+		Scope:       req.Scope,
+		Hash:        hash,
+		Expires:     req.Expires,
+		Created:     time.Now(),
+	}
+	if err := db.AccessTokens().Insert(token); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Access Token",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Create, user.ID, token, nil)
+	token.Token = plain
+	metadata.AccessTokenMetadata(&token)
+	c.JSON(http.StatusCreated, token)
+}
+
+// Delete revokes the access token, requests made with it are refused right away
+func (ctrl AccessTokenController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	token := c.MustGet(cAccessToken).(common.AccessToken)
+
+	if err := db.AccessTokens().RemoveId(token.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while revoking Access Token",
+			Log:     logrus.Fields{"Access Token ID": token.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, token, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
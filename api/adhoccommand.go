@@ -0,0 +1,469 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/launch"
+	"github.com/pearsonappeng/tensor/jwt"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for ad hoc command related items stored in the Gin Context
+const (
+	cAdHocCommand   = "ad_hoc_command"
+	cAdHocCommandID = "ad_hoc_command_id"
+)
+
+type AdHocCommandController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes ad_hoc_command_id parameter from Gin Context and retrieves the ad hoc command
+// and store it under key ad_hoc_command in Gin Context.
+// Reading an ad hoc command requires read permissions on its inventory, modifying requires
+// permissions to run ad hoc commands on the inventory
+func (ctrl AdHocCommandController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cAdHocCommandID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Ad Hoc Command does not exist"})
+		return
+	}
+
+	var cmd ansible.AdHocCommand
+	if err := db.AdHocCommands().FindId(bson.ObjectIdHex(objectID)).One(&cmd); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Ad Hoc Command does not exist",
+			Log: logrus.Fields{
+				"Ad Hoc Command ID": objectID,
+				"Error":             err.Error(),
+			},
+		})
+		return
+	}
+
+	// the token middleware only allows the job token of the command for its events
+	if id, ok := jwt.JobTokenID(c); ok && id == cmd.ID {
+		c.Set(cAdHocCommand, cmd)
+		c.Next()
+		return
+	}
+
+	roles := new(rbac.Inventory)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.ReadByID(user, cmd.InventoryID) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "POST", "DELETE":
+		{
+			var inventory ansible.Inventory
+			if err := db.Inventories().FindId(cmd.InventoryID).One(&inventory); err != nil || !roles.AdHoc(user, inventory) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cAdHocCommand, cmd)
+	c.Next()
+}
+
+// One returns the ad hoc command as a JSON object
+func (ctrl AdHocCommandController) One(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+	metadata.AdHocCommandMetadata(&cmd)
+	c.JSON(http.StatusOK, cmd)
+}
+
+// All returns the ad hoc commands of the inventories the user can read.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl AdHocCommandController) All(c *gin.Context) {
+	listAdHocCommands(c, bson.M{})
+}
+
+// Create runs an ad hoc command on the inventory given in the request payload
+func (ctrl AdHocCommandController) Create(c *gin.Context) {
+	var req ansible.AdHocCommand
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if !req.InventoryID.Valid() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory is required.",
+		})
+		return
+	}
+
+	var inventory ansible.Inventory
+	if err := db.Inventories().FindId(req.InventoryID).One(&inventory); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory does not exists.",
+		})
+		return
+	}
+
+	createAdHocCommand(c, inventory, req)
+}
+
+// Delete removes a finished ad hoc command, its events and its output
+func (ctrl AdHocCommandController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	if canCancel(cmd.Status) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Ad Hoc Command is active, cancel it before removing.",
+		})
+		return
+	}
+
+	if _, err := db.AdHocCommandEvents().RemoveAll(bson.M{"ad_hoc_command_id": cmd.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Ad Hoc Command Events",
+			Log:     logrus.Fields{"Ad Hoc Command ID": cmd.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if _, err := db.JobStdout().RemoveAll(bson.M{"job_id": cmd.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Ad Hoc Command output",
+			Log:     logrus.Fields{"Ad Hoc Command ID": cmd.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := db.AdHocCommands().RemoveId(cmd.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Ad Hoc Command",
+			Log:     logrus.Fields{"Ad Hoc Command ID": cmd.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, cmd, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// CancelInfo to determine if the ad hoc command can be cancelled.
+// The response will include the following field:
+// can_cancel: [boolean] Indicates whether this ad hoc command can be canceled
+func (ctrl AdHocCommandController) CancelInfo(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	c.JSON(http.StatusOK, gin.H{"can_cancel": canCancel(cmd.Status)})
+}
+
+// Cancel cancels the pending or running ad hoc command.
+// The response status code will be 202 if successful, or 405 if the ad hoc command
+// cannot be canceled
+func (ctrl AdHocCommandController) Cancel(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	if !canCancel(cmd.Status) {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := cancel(db.AdHocCommands(), cmd.ID, cmd.Status); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while canceling Ad Hoc Command",
+			Log:     logrus.Fields{"Ad Hoc Command ID": cmd.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusAccepted)
+}
+
+// StdOut returns ANSI standard output of an ad hoc command
+func (ctrl AdHocCommandController) StdOut(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	out, err := jobStdout(cmd.ID, cmd.ResultStdout)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting output",
+			Log:     logrus.Fields{"Job ID": cmd.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// StdOutStream streams the standard output of an ad hoc command as Server-Sent Events
+// until the command is finished
+func (ctrl AdHocCommandController) StdOutStream(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	streamStdout(c, db.AdHocCommands(), cmd.ID)
+}
+
+// Events returns the events of an ad hoc command recorded by the callback plugin
+func (ctrl AdHocCommandController) Events(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	parser := util.NewQueryParser(c)
+	match := bson.M{"ad_hoc_command_id": cmd.ID}
+	match = parser.Match([]string{"event", "host_name"}, match)
+	match = parser.Lookups([]string{"host_name"}, match)
+	match = matchBool(c, []string{"failed", "changed"}, match)
+	query := db.AdHocCommandEvents().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("counter")
+	}
+
+	var events []ansible.AdHocCommandEvent
+	iter := query.Iter()
+	var tmpEvent ansible.AdHocCommandEvent
+	for iter.Next(&tmpEvent) {
+		metadata.AdHocCommandEventMetadata(&tmpEvent)
+		events = append(events, tmpEvent)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Ad Hoc Command Events",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(events)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     events[pgi.Skip():pgi.End()],
+	})
+}
+
+// AddEvent records an event of an ad hoc command sent by the callback plugin,
+// events are only accepted with the job token of the command, events of finished commands are refused
+func (ctrl AdHocCommandController) AddEvent(c *gin.Context) {
+	cmd := c.MustGet(cAdHocCommand).(ansible.AdHocCommand)
+
+	if id, ok := jwt.JobTokenID(c); !ok || id != cmd.ID {
+		AbortWithError(LogFields{Context: c, Status: http.StatusForbidden,
+			Message: "Events can only be added by the ad hoc command.",
+		})
+		return
+	}
+
+	if blocking.IsFinished(cmd.Status) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Ad Hoc Command is finished, events can no longer be added.",
+		})
+		return
+	}
+
+	var req ansible.AdHocCommandEvent
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.AdHocCommandID = cmd.ID
+	req.Created = time.Now()
+	req.HostID = nil
+	if len(req.HostName) > 0 {
+		var host ansible.Host
+		if err := db.Hosts().Find(bson.M{"name": req.HostName, "inventory_id": cmd.InventoryID}).One(&host); err == nil {
+			req.HostID = &host.ID
+		}
+	}
+
+	if err := db.AdHocCommandEvents().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Could not create Ad Hoc Command Event",
+			Log:     logrus.Fields{"Ad Hoc Command ID": cmd.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	metadata.AdHocCommandEventMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// AdHocCommands returns the ad hoc commands run on the inventory
+func (ctrl InventoryController) AdHocCommands(c *gin.Context) {
+	inventory := c.MustGet(cInventory).(ansible.Inventory)
+
+	listAdHocCommands(c, bson.M{"inventory_id": inventory.ID})
+}
+
+// CreateAdHocCommand runs an ad hoc command on the hosts of the inventory
+func (ctrl InventoryController) CreateAdHocCommand(c *gin.Context) {
+	inventory := c.MustGet(cInventory).(ansible.Inventory)
+
+	var req ansible.AdHocCommand
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.InventoryID = inventory.ID
+	createAdHocCommand(c, inventory, req)
+}
+
+// createAdHocCommand checks the permissions of the user and the module allow-list of the
+// inventory's organization, then stores the ad hoc command and publishes it to the queue
+func createAdHocCommand(c *gin.Context, inventory ansible.Inventory, req ansible.AdHocCommand) {
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.Inventory).AdHoc(user, inventory) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	var organization common.Organization
+	if err := db.Organizations().FindId(inventory.OrganizationID).One(&organization); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Organization",
+			Log:     logrus.Fields{"Organization ID": inventory.OrganizationID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if !organization.AdHocModuleAllowed(req.ModuleName) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Module " + req.ModuleName + " is not allowed to be used in ad hoc commands.",
+		})
+		return
+	}
+
+	// the limit is the first argument of ansible, it must not be parsed as an option
+	if strings.HasPrefix(req.Limit, "-") {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Limit must not start with -.",
+		})
+		return
+	}
+
+	credential := common.Credential{ID: req.CredentialID}
+	if !credential.MachineCredentialExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Machine Credential does not exists.",
+		})
+		return
+	}
+
+	if !new(rbac.Credential).ReadByID(user, req.CredentialID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Name = req.ModuleName
+	req.LaunchType = ansible.JOB_LAUNCH_TYPE_MANUAL
+	req.CancelFlag = false
+	req.Status = "new"
+	req.CreatedByID = user.ID
+	req.ModifiedByID = user.ID
+	req.Created = time.Now()
+	req.Modified = time.Now()
+
+	if err := launch.AdHoc(&req); err != nil {
+		abortLaunch(c, err)
+		return
+	}
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.AdHocCommandMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// listAdHocCommands writes a paginated list of the ad hoc commands matching the given query
+// that the user can read
+func listAdHocCommands(c *gin.Context, match bson.M) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"status", "module_name", "failed"}, match)
+	match = parser.Lookups([]string{"id", "name", "limit"}, match)
+	query := db.AdHocCommands().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var commands []ansible.AdHocCommand
+
+	roles := new(rbac.Inventory)
+	iter := query.Iter()
+	var tmpCommand ansible.AdHocCommand
+	for iter.Next(&tmpCommand) {
+		if !roles.ReadByID(user, tmpCommand.InventoryID) {
+			continue
+		}
+		metadata.AdHocCommandMetadata(&tmpCommand)
+		commands = append(commands, tmpCommand)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Ad Hoc Commands",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(commands)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     commands[pgi.Skip():pgi.End()],
+	})
+}
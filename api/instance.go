@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for instance related items stored in the Gin Context
+const (
+	cInstance   = "instance"
+	cInstanceID = "instance_id"
+)
+
+type InstanceController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes instance_id parameter from Gin Context and retrieves the instance
+// and store it under key instance in Gin Context
+func (ctrl InstanceController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cInstanceID)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Instance does not exist"})
+		return
+	}
+
+	var instance common.Instance
+	if err := db.Instances().FindId(bson.ObjectIdHex(objectID)).One(&instance); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Instance does not exist",
+			Log: logrus.Fields{
+				"Instance ID": objectID,
+				"Error":       err.Error(),
+			},
+		})
+		return
+	}
+
+	c.Set(cInstance, instance)
+	c.Next()
+}
+
+// One returns the instance as a JSON object
+func (ctrl InstanceController) One(c *gin.Context) {
+	instance := c.MustGet(cInstance).(common.Instance)
+	metadata.InstanceMetadata(&instance)
+	c.JSON(http.StatusOK, instance)
+}
+
+// All returns the registered instances.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl InstanceController) All(c *gin.Context) {
+	parser := util.NewQueryParser(c)
+	match := parser.Match([]string{"status", "role", "version"}, bson.M{})
+	match = parser.Lookups([]string{"hostname"}, match)
+	query := db.Instances().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("hostname")
+	}
+
+	var instances []common.Instance
+	if err := query.All(&instances); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Instances",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range instances {
+		metadata.InstanceMetadata(&instances[i])
+	}
+
+	count := len(instances)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     instances[pgi.Skip():pgi.End()],
+	})
+}
+
+// getCapacity returns the capacity of the active instances running jobs,
+// the consumed capacity of an instance is updated with its heartbeat
+func getCapacity(c *gin.Context) {
+	var instances []common.Instance
+	if err := db.Instances().Find(bson.M{
+		"status":   common.InstanceActive,
+		"capacity": bson.M{"$gt": 0},
+	}).Sort("hostname").All(&instances); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Instances",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	capacity, used := 0, 0
+	nodes := []gin.H{}
+	for _, i := range instances {
+		capacity += i.Capacity
+		used += i.ConsumedCapacity
+		nodes = append(nodes, gin.H{
+			"hostname":           i.Hostname,
+			"capacity":           i.Capacity,
+			"consumed_capacity":  i.ConsumedCapacity,
+			"remaining_capacity": i.Capacity - i.ConsumedCapacity,
+			"workers":            i.Workers,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"capacity":           capacity,
+		"consumed_capacity":  used,
+		"remaining_capacity": capacity - used,
+		"instances":          nodes,
+	})
+}
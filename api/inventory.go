@@ -14,6 +14,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/jwt"
 	"github.com/pearsonappeng/tensor/log/activity"
 	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
@@ -53,6 +54,13 @@ func (ctrl InventoryController) Middleware(c *gin.Context) {
 		return
 	}
 
+	// the token middleware only allows job tokens for the script of the inventory of the job
+	if _, ok := jwt.JobTokenID(c); ok {
+		c.Set(cInventory, inventory)
+		c.Next()
+		return
+	}
+
 	roles := new(rbac.Inventory)
 	switch c.Request.Method {
 	case "GET":
@@ -773,6 +781,19 @@ func (ctrl InventoryController) ObjectRoles(c *gin.Context) {
 			"name":        "update",
 			"description": "May update project or inventory or group using the configured source update system",
 		},
+		{
+			"type": "role",
+			"links": gin.H{
+				"inventory": "/v1/inventories/" + inventory.ID.Hex(),
+			},
+			"meta": gin.H{
+				"resource_name":              inventory.Name,
+				"resource_type":              "inventory",
+				"resource_type_display_name": "Inventory",
+			},
+			"name":        "ad_hoc",
+			"description": "May run ad hoc commands on the inventory",
+		},
 	}
 
 	count := len(roles)
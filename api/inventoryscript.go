@@ -0,0 +1,298 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for inventory script related items stored in the Gin Context
+const (
+	cInventoryScript   = "inventory_script"
+	cInventoryScriptID = "inventory_script_id"
+)
+
+type InventoryScriptController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes inventory_script_id parameter from Gin Context and retrieves the inventory script
+// and store it under key inventory_script in Gin Context
+func (ctrl InventoryScriptController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cInventoryScriptID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Inventory Script does not exist"})
+		return
+	}
+
+	var script ansible.InventoryScript
+	if err := db.InventoryScripts().FindId(bson.ObjectIdHex(objectID)).One(&script); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Inventory Script does not exist",
+			Log: logrus.Fields{
+				"Inventory Script ID": objectID,
+				"Error":               err.Error(),
+			},
+		})
+		return
+	}
+
+	roles := new(rbac.InventoryScript)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.Read(user, script) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "POST", "DELETE":
+		{
+			// Reject the request if the user doesn't have write permissions
+			if !roles.Write(user, script) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cInventoryScript, script)
+	c.Next()
+}
+
+// One returns the inventory script as a JSON object
+func (ctrl InventoryScriptController) One(c *gin.Context) {
+	script := c.MustGet(cInventoryScript).(ansible.InventoryScript)
+	metadata.InventoryScriptMetadata(&script)
+	c.JSON(http.StatusOK, script)
+}
+
+// All returns the inventory scripts the user has read access to.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl InventoryScriptController) All(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match := bson.M{}
+	match = parser.Match([]string{"organization_id"}, match)
+	match = parser.Lookups([]string{"name", "description"}, match)
+	query := db.InventoryScripts().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	roles := new(rbac.InventoryScript)
+	var scripts []ansible.InventoryScript
+	iter := query.Iter()
+	var tmpScript ansible.InventoryScript
+	for iter.Next(&tmpScript) {
+		if !roles.Read(user, tmpScript) {
+			continue
+		}
+		metadata.InventoryScriptMetadata(&tmpScript)
+		scripts = append(scripts, tmpScript)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Inventory Scripts",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(scripts)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     scripts[pgi.Skip():pgi.End()],
+	})
+}
+
+// Create creates a new inventory script using request payload.
+// Only organization admins can create inventory scripts
+func (ctrl InventoryScriptController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	var req ansible.InventoryScript
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if !req.OrganizationExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Organization does not exists.",
+		})
+		return
+	}
+
+	if !rbac.HasGlobalWrite(user) && !rbac.IsOrganizationAdmin(req.OrganizationID, user.ID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Script with this Name already exists.",
+		})
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+	req.Roles = nil
+	req.Created = time.Now()
+	req.Modified = time.Now()
+	req.CreatedByID = user.ID
+	req.ModifiedByID = user.ID
+	if err := db.InventoryScripts().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Inventory Script",
+			Log:     logrus.Fields{"Inventory Script ID": req.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.InventoryScriptMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update updates the inventory script using request payload.
+// The organization of an inventory script can not be changed while
+// inventory sources use the script
+func (ctrl InventoryScriptController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	script := c.MustGet(cInventoryScript).(ansible.InventoryScript)
+	tmpScript := script
+
+	var req ansible.InventoryScript
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if req.OrganizationID != script.OrganizationID {
+		if !req.OrganizationExist() {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Organization does not exists.",
+			})
+			return
+		}
+
+		if !rbac.HasGlobalWrite(user) && !rbac.IsOrganizationAdmin(req.OrganizationID, user.ID) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+
+		if inventoryScriptInUse(c, script) {
+			return
+		}
+	}
+
+	if (req.Name != script.Name || req.OrganizationID != script.OrganizationID) && !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Script with this Name already exists.",
+		})
+		return
+	}
+
+	script.Name = strings.Trim(req.Name, " ")
+	script.Description = strings.Trim(req.Description, " ")
+	script.Script = req.Script
+	script.OrganizationID = req.OrganizationID
+	script.Modified = time.Now()
+	script.ModifiedByID = user.ID
+
+	if err := db.InventoryScripts().UpdateId(script.ID, script); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Inventory Script",
+			Log:     logrus.Fields{"Inventory Script ID": script.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpScript, script)
+	metadata.InventoryScriptMetadata(&script)
+	c.JSON(http.StatusOK, script)
+}
+
+// Delete removes the inventory script.
+// The response status code will be 409 if inventory sources use the script
+func (ctrl InventoryScriptController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	script := c.MustGet(cInventoryScript).(ansible.InventoryScript)
+
+	if inventoryScriptInUse(c, script) {
+		return
+	}
+
+	if err := db.InventoryScripts().RemoveId(script.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Script",
+			Log:     logrus.Fields{"Inventory Script ID": script.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, script, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// inventoryScriptInUse aborts the request and returns true if
+// inventory sources use the inventory script
+func inventoryScriptInUse(c *gin.Context, script ansible.InventoryScript) bool {
+	count, err := db.InventorySources().Find(bson.M{"source_script_id": script.ID}).Count()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Inventory Sources",
+			Log:     logrus.Fields{"Inventory Script ID": script.ID.Hex(), "Error": err.Error()},
+		})
+		return true
+	}
+
+	if count > 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Inventory Script is used by " + strconv.Itoa(count) + " Inventory Sources.",
+		})
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,737 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/launch"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for inventory source related items stored in the Gin Context
+const (
+	cInventorySource   = "inventory_source"
+	cInventorySourceID = "inventory_source_id"
+	cInventoryUpdate   = "inventory_update"
+	cInventoryUpdateID = "inventory_update_id"
+)
+
+type InventorySourceController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes inventory_source_id parameter from Gin Context and retrieves the inventory source
+// and store it under key inventory_source in Gin Context.
+// Permissions of an inventory source are the permissions of its inventory
+func (ctrl InventorySourceController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cInventorySourceID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Inventory Source does not exist"})
+		return
+	}
+
+	var source ansible.InventorySource
+	if err := db.InventorySources().FindId(bson.ObjectIdHex(objectID)).One(&source); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Inventory Source does not exist",
+			Log: logrus.Fields{
+				"Inventory Source ID": objectID,
+				"Error":               err.Error(),
+			},
+		})
+		return
+	}
+
+	roles := new(rbac.Inventory)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.ReadByID(user, source.InventoryID) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "POST", "DELETE":
+		{
+			// Reject the request if the user doesn't have inventory write permissions
+			if !roles.WriteByID(user, source.InventoryID) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cInventorySource, source)
+	c.Next()
+}
+
+// One returns the inventory source as a JSON object
+func (ctrl InventorySourceController) One(c *gin.Context) {
+	source := c.MustGet(cInventorySource).(ansible.InventorySource)
+	metadata.InventorySourceMetadata(&source)
+	c.JSON(http.StatusOK, source)
+}
+
+// All returns the inventory sources of the inventories the user can read.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl InventorySourceController) All(c *gin.Context) {
+	listInventorySources(c, bson.M{})
+}
+
+// Create creates a new inventory source using request payload
+func (ctrl InventorySourceController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	var req ansible.InventorySource
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if !new(rbac.Inventory).WriteByID(user, req.InventoryID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Source with this Name already exists.",
+		})
+		return
+	}
+
+	if !validateInventorySource(c, user, req) {
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+	req.Status = "never updated"
+	req.LastUpdateID = nil
+	req.LastUpdateFailed = false
+	req.LastUpdated = time.Time{}
+	req.Created = time.Now()
+	req.Modified = time.Now()
+	req.CreatedByID = user.ID
+	req.ModifiedByID = user.ID
+	if err := db.InventorySources().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Inventory Source",
+			Log:     logrus.Fields{"Inventory Source ID": req.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	updateInventorySourceCount(req.InventoryID)
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.InventorySourceMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update updates the inventory source using request payload.
+// The inventory of a source can not be changed
+func (ctrl InventorySourceController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	source := c.MustGet(cInventorySource).(ansible.InventorySource)
+	tmpSource := source
+
+	var req ansible.InventorySource
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if req.InventoryID != source.InventoryID {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory of an Inventory Source can not be changed.",
+		})
+		return
+	}
+
+	if req.Name != source.Name && !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Source with this Name already exists.",
+		})
+		return
+	}
+
+	if !validateInventorySource(c, user, req) {
+		return
+	}
+
+	source.Name = strings.Trim(req.Name, " ")
+	source.Description = strings.Trim(req.Description, " ")
+	source.Source = req.Source
+	source.SourceVars = req.SourceVars
+	source.SourceRegions = req.SourceRegions
+	source.InstanceFilters = req.InstanceFilters
+	source.GroupBy = req.GroupBy
+	source.Overwrite = req.Overwrite
+	source.OverwriteVars = req.OverwriteVars
+	source.UpdateOnLaunch = req.UpdateOnLaunch
+	source.UpdateCacheTimeout = req.UpdateCacheTimeout
+	source.CredentialID = req.CredentialID
+	source.GroupID = req.GroupID
+	source.SourceScriptID = req.SourceScriptID
+	source.TerraformJobTemplateID = req.TerraformJobTemplateID
+	source.TerraformImport = req.TerraformImport
+	source.HostnameAttributes = req.HostnameAttributes
+	source.HostVarAttributes = req.HostVarAttributes
+	source.ModifiedByID = user.ID
+	source.Modified = time.Now()
+
+	if err := db.InventorySources().UpdateId(source.ID, source); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Inventory Source",
+			Log:     logrus.Fields{"Inventory Source ID": source.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpSource, source)
+	metadata.InventorySourceMetadata(&source)
+	c.JSON(http.StatusOK, source)
+}
+
+// Delete removes the inventory source and its updates.
+// Hosts and groups imported by the source are kept
+func (ctrl InventorySourceController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	source := c.MustGet(cInventorySource).(ansible.InventorySource)
+
+	if canCancel(source.Status) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Inventory Source is being updated, cancel the update before removing.",
+		})
+		return
+	}
+
+	var updates []bson.ObjectId
+	if err := db.InventoryUpdates().Find(bson.M{"inventory_source_id": source.ID}).Distinct("_id", &updates); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Updates",
+			Log:     logrus.Fields{"Inventory Source ID": source.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if _, err := db.JobStdout().RemoveAll(bson.M{"job_id": bson.M{"$in": updates}}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Updates",
+			Log:     logrus.Fields{"Inventory Source ID": source.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if _, err := db.InventoryUpdates().RemoveAll(bson.M{"inventory_source_id": source.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Updates",
+			Log:     logrus.Fields{"Inventory Source ID": source.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := db.InventorySources().RemoveId(source.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Source",
+			Log:     logrus.Fields{"Inventory Source ID": source.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	updateInventorySourceCount(source.InventoryID)
+
+	activity.AddActivity(activity.Delete, user.ID, source, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// UpdateInfo to determine if the inventory source can be updated.
+// The response will include the following field:
+// can_update: [boolean] Indicates whether the inventory source can be updated
+func (ctrl InventorySourceController) UpdateInfo(c *gin.Context) {
+	source := c.MustGet(cInventorySource).(ansible.InventorySource)
+
+	c.JSON(http.StatusOK, gin.H{"can_update": !canCancel(source.Status)})
+}
+
+// LaunchUpdate starts an update of the inventory source.
+// The response status code will be 202 if successful, or 405 if an update
+// of the source is already active
+func (ctrl InventorySourceController) LaunchUpdate(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	source := c.MustGet(cInventorySource).(ansible.InventorySource)
+
+	if canCancel(source.Status) {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	update := launch.NewInventoryUpdate(source, user, ansible.JOB_LAUNCH_TYPE_MANUAL)
+	if err := launch.InventoryUpdate(&update, source); err != nil {
+		abortLaunch(c, err)
+		return
+	}
+
+	metadata.InventoryUpdateMetadata(&update)
+	c.JSON(http.StatusAccepted, update)
+}
+
+// InventoryUpdates returns the updates of the inventory source
+func (ctrl InventorySourceController) InventoryUpdates(c *gin.Context) {
+	source := c.MustGet(cInventorySource).(ansible.InventorySource)
+
+	listInventoryUpdates(c, bson.M{"inventory_source_id": source.ID})
+}
+
+// InventorySources returns the inventory sources of the inventory
+func (ctrl InventoryController) InventorySources(c *gin.Context) {
+	inventory := c.MustGet(cInventory).(ansible.Inventory)
+
+	listInventorySources(c, bson.M{"inventory_id": inventory.ID})
+}
+
+// InventorySources returns the inventory source which imported the host
+func (ctrl HostController) InventorySources(c *gin.Context) {
+	host := c.MustGet(cHost).(ansible.Host)
+
+	if host.InventorySourceID == nil {
+		listInventorySources(c, bson.M{"_id": bson.M{"$in": []bson.ObjectId{}}})
+		return
+	}
+	listInventorySources(c, bson.M{"_id": *host.InventorySourceID})
+}
+
+type InventoryUpdateController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes inventory_update_id parameter from Gin Context and retrieves the inventory update
+// and store it under key inventory_update in Gin Context.
+// Permissions of an inventory update are the permissions of its inventory
+func (ctrl InventoryUpdateController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cInventoryUpdateID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Inventory Update does not exist"})
+		return
+	}
+
+	var update ansible.InventoryUpdate
+	if err := db.InventoryUpdates().FindId(bson.ObjectIdHex(objectID)).One(&update); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Inventory Update does not exist",
+			Log: logrus.Fields{
+				"Inventory Update ID": objectID,
+				"Error":               err.Error(),
+			},
+		})
+		return
+	}
+
+	roles := new(rbac.Inventory)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.ReadByID(user, update.InventoryID) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "POST", "DELETE":
+		{
+			if !roles.WriteByID(user, update.InventoryID) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cInventoryUpdate, update)
+	c.Next()
+}
+
+// One returns the inventory update as a JSON object
+func (ctrl InventoryUpdateController) One(c *gin.Context) {
+	update := c.MustGet(cInventoryUpdate).(ansible.InventoryUpdate)
+	metadata.InventoryUpdateMetadata(&update)
+	c.JSON(http.StatusOK, update)
+}
+
+// All returns the inventory updates of the inventories the user can read
+func (ctrl InventoryUpdateController) All(c *gin.Context) {
+	listInventoryUpdates(c, bson.M{})
+}
+
+// Delete removes a finished inventory update
+func (ctrl InventoryUpdateController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	update := c.MustGet(cInventoryUpdate).(ansible.InventoryUpdate)
+
+	if canCancel(update.Status) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Inventory Update is active, cancel it before removing.",
+		})
+		return
+	}
+
+	if _, err := db.JobStdout().RemoveAll(bson.M{"job_id": update.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Update output",
+			Log:     logrus.Fields{"Inventory Update ID": update.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := db.InventoryUpdates().RemoveId(update.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Inventory Update",
+			Log:     logrus.Fields{"Inventory Update ID": update.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, update, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// CancelInfo to determine if the inventory update can be cancelled.
+// The response will include the following field:
+// can_cancel: [boolean] Indicates whether this inventory update can be canceled
+func (ctrl InventoryUpdateController) CancelInfo(c *gin.Context) {
+	update := c.MustGet(cInventoryUpdate).(ansible.InventoryUpdate)
+
+	c.JSON(http.StatusOK, gin.H{"can_cancel": canCancel(update.Status)})
+}
+
+// Cancel cancels the pending or running inventory update.
+// The response status code will be 202 if successful, or 405 if the inventory update
+// cannot be canceled
+func (ctrl InventoryUpdateController) Cancel(c *gin.Context) {
+	update := c.MustGet(cInventoryUpdate).(ansible.InventoryUpdate)
+
+	if !canCancel(update.Status) {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := cancel(db.InventoryUpdates(), update.ID, update.Status); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while canceling Inventory Update",
+			Log:     logrus.Fields{"Inventory Update ID": update.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	// an update which is not started yet will not be picked up by a runner,
+	// so the status of its source is updated here
+	if update.Status != "running" {
+		if err := db.InventorySources().Update(bson.M{"_id": update.InventorySourceID, "last_update_id": update.ID},
+			bson.M{"$set": bson.M{"status": "canceled"}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Inventory Source ID": update.InventorySourceID.Hex(),
+				"Error":               err.Error(),
+			}).Warningln("Could not update inventory source status")
+		}
+	}
+
+	c.AbortWithStatus(http.StatusAccepted)
+}
+
+// StdOut returns ANSI standard output of an inventory update
+func (ctrl InventoryUpdateController) StdOut(c *gin.Context) {
+	update := c.MustGet(cInventoryUpdate).(ansible.InventoryUpdate)
+
+	out, err := jobStdout(update.ID, update.ResultStdout)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting output",
+			Log:     logrus.Fields{"Job ID": update.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// StdOutStream streams the standard output of an inventory update as Server-Sent Events
+// until the update is finished
+func (ctrl InventoryUpdateController) StdOutStream(c *gin.Context) {
+	update := c.MustGet(cInventoryUpdate).(ansible.InventoryUpdate)
+
+	streamStdout(c, db.InventoryUpdates(), update.ID)
+}
+
+// validateInventorySource checks the credential and the group of the inventory source,
+// it aborts the request and returns false if they are invalid
+func validateInventorySource(c *gin.Context, user common.User, req ansible.InventorySource) bool {
+	if req.GroupID != nil && !req.GroupExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Group does not exists in the Inventory.",
+		})
+		return false
+	}
+
+	if req.Source == ansible.InventorySourceCustom && !validateSourceScript(c, user, req) {
+		return false
+	}
+
+	if req.Source != ansible.InventorySourceCustom && req.SourceScriptID != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Script can only be used by custom sources.",
+		})
+		return false
+	}
+
+	if req.Source == ansible.InventorySourceTerraform && !validateTerraformSource(c, user, req) {
+		return false
+	}
+
+	if req.Source != ansible.InventorySourceTerraform && req.TerraformJobTemplateID != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Terraform Job Template can only be used by terraform sources.",
+		})
+		return false
+	}
+
+	if req.CredentialID == nil {
+		return true
+	}
+
+	if !req.CredentialExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Cloud Credential of the " + req.Source + " source does not exists.",
+		})
+		return false
+	}
+
+	if !new(rbac.Credential).ReadByID(user, *req.CredentialID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return false
+	}
+
+	return true
+}
+
+// validateSourceScript checks that the inventory script of a custom source exists
+// in the organization of the inventory and the user can read it
+func validateSourceScript(c *gin.Context, user common.User, req ansible.InventorySource) bool {
+	if req.SourceScriptID == nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Script is required for custom sources.",
+		})
+		return false
+	}
+
+	var inventory ansible.Inventory
+	if err := db.Inventories().FindId(req.InventoryID).One(&inventory); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory does not exists.",
+		})
+		return false
+	}
+
+	var script ansible.InventoryScript
+	if err := db.InventoryScripts().FindId(*req.SourceScriptID).One(&script); err != nil ||
+		script.OrganizationID != inventory.OrganizationID {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Inventory Script does not exists in the organization of the Inventory.",
+		})
+		return false
+	}
+
+	if !new(rbac.InventoryScript).Read(user, script) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return false
+	}
+
+	return true
+}
+
+// validateTerraformSource checks that the terraform job template of a terraform source exists
+// and the user can read it. Importing the state requires the permission to read the state
+// since resource attributes are imported as host variables
+func validateTerraformSource(c *gin.Context, user common.User, req ansible.InventorySource) bool {
+	if req.TerraformJobTemplateID == nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Terraform Job Template is required for terraform sources.",
+		})
+		return false
+	}
+
+	var template terraform.JobTemplate
+	if err := db.TerrafromJobTemplates().FindId(*req.TerraformJobTemplateID).One(&template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Terraform Job Template does not exists.",
+		})
+		return false
+	}
+
+	roles := new(rbac.TerraformJobTemplate)
+	allowed := roles.Read(user, template)
+	if req.TerraformImport != ansible.TerraformImportOutputs {
+		allowed = roles.ReadState(user, template)
+	}
+	if !allowed {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return false
+	}
+
+	return true
+}
+
+// updateInventorySourceCount updates the inventory source counters of the inventory
+func updateInventorySourceCount(inventoryID bson.ObjectId) {
+	total, err := db.InventorySources().Find(bson.M{"inventory_id": inventoryID}).Count()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory ID": inventoryID.Hex(),
+			"Error":        err.Error(),
+		}).Errorln("Could not count inventory sources")
+		return
+	}
+
+	if err := db.Inventories().UpdateId(inventoryID, bson.M{"$set": bson.M{
+		"has_inventory_sources":   total > 0,
+		"total_inventory_sources": total,
+	}}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory ID": inventoryID.Hex(),
+			"Error":        err.Error(),
+		}).Errorln("Could not update inventory")
+	}
+}
+
+// listInventorySources writes a paginated list of the inventory sources matching the given query
+// that the user can read
+func listInventorySources(c *gin.Context, match bson.M) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"source", "status", "update_on_launch"}, match)
+	match = parser.Lookups([]string{"id", "name"}, match)
+	query := db.InventorySources().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var sources []ansible.InventorySource
+
+	roles := new(rbac.Inventory)
+	iter := query.Iter()
+	var tmpSource ansible.InventorySource
+	for iter.Next(&tmpSource) {
+		if !roles.ReadByID(user, tmpSource.InventoryID) {
+			continue
+		}
+		metadata.InventorySourceMetadata(&tmpSource)
+		sources = append(sources, tmpSource)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Inventory Sources",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(sources)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     sources[pgi.Skip():pgi.End()],
+	})
+}
+
+// listInventoryUpdates writes a paginated list of the inventory updates matching the given query
+// that the user can read
+func listInventoryUpdates(c *gin.Context, match bson.M) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"source", "status", "failed", "launch_type"}, match)
+	match = parser.Lookups([]string{"id", "name"}, match)
+	query := db.InventoryUpdates().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var updates []ansible.InventoryUpdate
+
+	roles := new(rbac.Inventory)
+	iter := query.Iter()
+	var tmpUpdate ansible.InventoryUpdate
+	for iter.Next(&tmpUpdate) {
+		if !roles.ReadByID(user, tmpUpdate.InventoryID) {
+			continue
+		}
+		metadata.InventoryUpdateMetadata(&tmpUpdate)
+		updates = append(updates, tmpUpdate)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Inventory Updates",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(updates)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     updates[pgi.Skip():pgi.End()],
+	})
+}
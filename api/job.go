@@ -3,16 +3,20 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/pearsonappeng/tensor/api/metadata"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/jwt"
 	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -47,6 +51,13 @@ func (ctrl JobController) Middleware(c *gin.Context) {
 		return
 	}
 
+	// the token middleware only allows the job token of the job for its events
+	if id, ok := jwt.JobTokenID(c); ok && id == job.ID {
+		c.Set(cJob, job)
+		c.Next()
+		return
+	}
+
 	roles := new(rbac.JobTemplate)
 	switch c.Request.Method {
 	case "GET":
@@ -58,7 +69,7 @@ func (ctrl JobController) Middleware(c *gin.Context) {
 				return
 			}
 		}
-	case "PUT", "DELETE":
+	case "PUT", "POST", "DELETE":
 		{
 			// Reject the request if the user doesn't have write permissions
 			if !roles.WriteByID(user, job.JobTemplateID) {
@@ -138,19 +149,94 @@ func (ctrl JobController) All(c *gin.Context) {
 // The response will include the following field:
 // can_cancel: [boolean] Indicates whether this job can be canceled
 func (ctrl JobController) CancelInfo(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"can_cancel": false})
+	job := c.MustGet(cJob).(ansible.Job)
+
+	c.JSON(http.StatusOK, gin.H{"can_cancel": canCancel(job.Status)})
 }
 
-// Cancel cancels the pending job.
+// Cancel cancels the pending or running job.
 // The response status code will be 202 if successful, or 405 if the job cannot be
 // canceled.
+// A job that has not been started yet is marked as canceled immediately, a running
+// job is flagged and the runner kills its process group
 func (ctrl JobController) Cancel(c *gin.Context) {
-	c.AbortWithStatus(http.StatusMethodNotAllowed)
+	job := c.MustGet(cJob).(ansible.Job)
+
+	if !canCancel(job.Status) {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := cancel(db.Jobs(), job.ID, job.Status); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while canceling Job",
+			Log:     logrus.Fields{"Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusAccepted)
+}
+
+// canCancel returns true if a job with the given status can be canceled
+func canCancel(status string) bool {
+	switch status {
+	case "new", "pending", "waiting", "running":
+		return true
+	}
+	return false
+}
+
+// cancel sets the cancel flag of the job stored in the given collection.
+// A job canceled before it runs is skipped by the runner without being finished,
+// so its locks and the jobs blocked by it are released here
+func cancel(c *mgo.Collection, id bson.ObjectId, status string) error {
+	if err := c.UpdateId(id, cancelUpdate(status)); err != nil {
+		return err
+	}
+	if status != "running" {
+		blocking.Finish(id)
+	}
+	return nil
+}
+
+// cancelUpdate returns the update document that sets the cancel flag of a job.
+// Jobs that are not started yet are marked as canceled right away since no runner
+// is tracking them, the runner skips them when the queued message is received
+func cancelUpdate(status string) bson.M {
+	if status == "running" {
+		return bson.M{"$set": bson.M{"cancel_flag": true}}
+	}
+	return bson.M{"$set": bson.M{
+		"cancel_flag":     true,
+		"status":          "canceled",
+		"failed":          false,
+		"finished":        time.Now(),
+		"result_stdout":   "stdout capture is missing",
+		"job_explanation": "Job Cancelled",
+	}}
 }
 
 // StdOut returns ANSI standard output of a Job
 func (ctrl JobController) StdOut(c *gin.Context) {
 	job := c.MustGet(cJob).(ansible.Job)
 
-	c.JSON(http.StatusOK, job.ResultStdout)
+	out, err := jobStdout(job.ID, job.ResultStdout)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting output",
+			Log:     logrus.Fields{"Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// StdOutStream streams the standard output of a Job as Server-Sent Events
+// until the job is finished
+func (ctrl JobController) StdOutStream(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	streamStdout(c, db.Jobs(), job.ID)
 }
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/suite"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type JobCancelTestSuite struct {
+	suite.Suite
+	blockerID bson.ObjectId
+	blockedID bson.ObjectId
+}
+
+func (suite *JobCancelTestSuite) SetupSuite() {
+	suite.Require().NoError(db.Connect(), "Unable to initialize a connection to database")
+
+	util.Config.Queue = queue.BackendMemory
+	util.Config.Role = util.RoleAll
+	suite.Require().NoError(queue.Connect(), "Unable to connect the queue")
+}
+
+func (suite *JobCancelTestSuite) TearDownSuite() {
+	db.Jobs().RemoveId(suite.blockerID)
+	db.Jobs().RemoveId(suite.blockedID)
+	db.BlockedJobs().RemoveId(suite.blockedID)
+	queue.Close()
+}
+
+func (suite *JobCancelTestSuite) TestCancelReleasesBlockedJobs() {
+	suite.blockerID = bson.NewObjectId()
+	suite.blockedID = bson.NewObjectId()
+	suite.Require().NoError(db.Jobs().Insert(bson.M{"_id": suite.blockerID, "name": "blocker", "status": "pending"}))
+	suite.Require().NoError(db.Jobs().Insert(bson.M{"_id": suite.blockedID, "name": "blocked", "status": "waiting"}))
+
+	body := []byte(`{"job_id": "` + suite.blockedID.Hex() + `"}`)
+	parked, err := blocking.Wait(db.Jobs(), suite.blockedID, queue.Ansible, body, blocking.Blocker{
+		ID:         suite.blockerID,
+		Type:       blocking.TypeJob,
+		Name:       "blocker",
+		Collection: db.CJobs,
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(parked, "job should be parked while the blocker is pending")
+
+	msgs, err := queue.Consume(queue.Ansible, 1)
+	suite.Require().NoError(err)
+
+	// the blocker is canceled before a runner received it
+	suite.Require().NoError(cancel(db.Jobs(), suite.blockerID, "pending"))
+
+	count, err := db.BlockedJobs().FindId(suite.blockedID).Count()
+	suite.NoError(err)
+	suite.Equal(0, count, "blocked job should not be parked anymore")
+
+	select {
+	case d := <-msgs:
+		suite.Equal(body, d.Body(), "blocked job should be published again")
+		d.Ack()
+	case <-time.After(time.Second):
+		suite.Fail("blocked job was not published")
+	}
+}
+
+func TestJobCancelTestSuite(t *testing.T) {
+	suite.Run(t, new(JobCancelTestSuite))
+}
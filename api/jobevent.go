@@ -0,0 +1,546 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/jwt"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// JobEvents returns the events of a Job recorded by the callback plugin.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl JobController) JobEvents(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	listJobEvents(c, bson.M{"job_id": job.ID})
+}
+
+// AddJobEvent records a playbook event sent by the callback plugin.
+// When the playbook stats are received the host summaries of the job are created
+// and the failure status of hosts and groups in the job's inventory is updated.
+// Events are only accepted with the job token of the job, events of finished jobs are refused,
+// late events must not change their summaries
+func (ctrl JobController) AddJobEvent(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	if id, ok := jwt.JobTokenID(c); !ok || id != job.ID {
+		AbortWithError(LogFields{Context: c, Status: http.StatusForbidden,
+			Message: "Events can only be added by the job.",
+		})
+		return
+	}
+
+	if blocking.IsFinished(job.Status) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Job is finished, events can no longer be added.",
+		})
+		return
+	}
+
+	var req ansible.JobEvent
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.JobID = job.ID
+	req.Created = time.Now()
+	req.HostID = nil
+	if len(req.HostName) > 0 {
+		var host ansible.Host
+		if err := db.Hosts().Find(bson.M{"name": req.HostName, "inventory_id": job.InventoryID}).One(&host); err == nil {
+			req.HostID = &host.ID
+		}
+	}
+
+	if err := db.JobEvents().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Could not create Job Event",
+			Log:     logrus.Fields{"Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if req.Event == ansible.EventPlaybookOnStats {
+		updateHostSummaries(job, req)
+	}
+
+	metadata.JobEventMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// JobPlays returns the plays of a Job derived from the job events
+func (ctrl JobController) JobPlays(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	var events []ansible.JobEvent
+	if err := db.JobEvents().Find(bson.M{"job_id": job.ID}).Sort("counter").All(&events); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Job Plays",
+			Log:     logrus.Fields{"Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	plays, _ := jobPlaysAndTasks(events)
+
+	count := len(plays)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     plays[pgi.Skip():pgi.End()],
+	})
+}
+
+// JobTasks returns the tasks of a Job derived from the job events.
+// The tasks of a single play can be selected using the play parameter
+func (ctrl JobController) JobTasks(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	var events []ansible.JobEvent
+	if err := db.JobEvents().Find(bson.M{"job_id": job.ID}).Sort("counter").All(&events); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Job Tasks",
+			Log:     logrus.Fields{"Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	_, all := jobPlaysAndTasks(events)
+
+	tasks := all
+	if play := c.Query("play"); play != "" {
+		tasks = []ansible.JobTask{}
+		for _, v := range all {
+			if v.Play == play {
+				tasks = append(tasks, v)
+			}
+		}
+	}
+
+	count := len(tasks)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     tasks[pgi.Skip():pgi.End()],
+	})
+}
+
+// JobHostSummaries returns the per host summaries of a Job
+func (ctrl JobController) JobHostSummaries(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	listJobHostSummaries(c, bson.M{"job_id": job.ID})
+}
+
+// JobEvents returns the job events of a Host
+func (ctrl HostController) JobEvents(c *gin.Context) {
+	host := c.MustGet(cHost).(ansible.Host)
+
+	listJobEvents(c, bson.M{"host_id": host.ID})
+}
+
+// JobHostSummaries returns the job host summaries of a Host
+func (ctrl HostController) JobHostSummaries(c *gin.Context) {
+	host := c.MustGet(cHost).(ansible.Host)
+
+	listJobHostSummaries(c, bson.M{"host_id": host.ID})
+}
+
+// JobHostSummaries returns the job host summaries of the hosts in a Group
+func (ctrl GroupController) JobHostSummaries(c *gin.Context) {
+	group := c.MustGet(cGroup).(ansible.Group)
+
+	var hosts []ansible.Host
+	if err := db.Hosts().Find(bson.M{"group_id": group.ID}).Select(bson.M{"_id": 1}).All(&hosts); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Job Host Summaries",
+			Log:     logrus.Fields{"Group ID": group.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	ids := []bson.ObjectId{}
+	for _, v := range hosts {
+		ids = append(ids, v.ID)
+	}
+
+	listJobHostSummaries(c, bson.M{"host_id": bson.M{"$in": ids}})
+}
+
+// listJobEvents writes a paginated list of the job events matching the given query
+func listJobEvents(c *gin.Context, match bson.M) {
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"event", "host_name", "play", "task", "role"}, match)
+	match = parser.Lookups([]string{"host_name", "play", "task", "role"}, match)
+	match = matchBool(c, []string{"failed", "changed"}, match)
+	query := db.JobEvents().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("counter")
+	}
+
+	var events []ansible.JobEvent
+	iter := query.Iter()
+	var tmpEvent ansible.JobEvent
+	for iter.Next(&tmpEvent) {
+		metadata.JobEventMetadata(&tmpEvent)
+		events = append(events, tmpEvent)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Job Events",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(events)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     events[pgi.Skip():pgi.End()],
+	})
+}
+
+// listJobHostSummaries writes a paginated list of the job host summaries
+// matching the given query
+func listJobHostSummaries(c *gin.Context, match bson.M) {
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"host_name"}, match)
+	match = parser.Lookups([]string{"host_name"}, match)
+	match = matchBool(c, []string{"failed"}, match)
+	query := db.JobHostSummaries().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var summaries []ansible.JobHostSummary
+	iter := query.Iter()
+	var tmpSummary ansible.JobHostSummary
+	for iter.Next(&tmpSummary) {
+		metadata.JobHostSummaryMetadata(&tmpSummary)
+		summaries = append(summaries, tmpSummary)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Job Host Summaries",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(summaries)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     summaries[pgi.Skip():pgi.End()],
+	})
+}
+
+// matchBool adds an equality condition for boolean query parameters,
+// values that cannot be parsed are ignored
+func matchBool(c *gin.Context, fields []string, query bson.M) bson.M {
+	for _, v := range fields {
+		if b, err := strconv.ParseBool(c.Query(v)); err == nil {
+			query[v] = b
+		}
+	}
+	return query
+}
+
+// jobPlaysAndTasks derives plays and tasks from job events ordered by counter
+func jobPlaysAndTasks(events []ansible.JobEvent) ([]ansible.JobPlay, []ansible.JobTask) {
+	plays := []ansible.JobPlay{}
+	tasks := []ansible.JobTask{}
+
+	var play *ansible.JobPlay
+	var task *ansible.JobTask
+
+	for _, v := range events {
+		switch v.Event {
+		case ansible.EventPlaybookOnPlayStart:
+			plays = append(plays, ansible.JobPlay{
+				ID:       v.ID,
+				Play:     v.Play,
+				Started:  v.Created,
+				Finished: v.Created,
+			})
+			play = &plays[len(plays)-1]
+			task = nil
+			continue
+		case ansible.EventPlaybookOnTaskStart:
+			tasks = append(tasks, ansible.JobTask{
+				ID:       v.ID,
+				Play:     v.Play,
+				Task:     v.Task,
+				Role:     v.Role,
+				Started:  v.Created,
+				Finished: v.Created,
+			})
+			task = &tasks[len(tasks)-1]
+		case ansible.EventRunnerOnOk, ansible.EventRunnerOnFailed,
+			ansible.EventRunnerOnSkipped, ansible.EventRunnerOnUnreachable:
+			if task == nil {
+				break
+			}
+			task.Finished = v.Created
+			task.HostCount++
+			switch v.Event {
+			case ansible.EventRunnerOnOk:
+				task.SuccessfulCount++
+			case ansible.EventRunnerOnFailed:
+				task.FailedCount++
+			case ansible.EventRunnerOnSkipped:
+				task.SkippedCount++
+			case ansible.EventRunnerOnUnreachable:
+				task.UnreachableCount++
+			}
+			if v.Changed {
+				task.ChangedCount++
+				task.Changed = true
+			}
+			if v.Failed {
+				task.Failed = true
+			}
+		}
+
+		if play != nil {
+			play.Finished = v.Created
+			play.Failed = play.Failed || v.Failed
+			play.Changed = play.Changed || v.Changed
+		}
+	}
+
+	return plays, tasks
+}
+
+// updateHostSummaries stores the playbook stats of each host as job host summaries
+// and updates the last job and failure fields of the hosts and their groups
+func updateHostSummaries(job ansible.Job, event ansible.JobEvent) {
+	stats, ok := event.EventData["hosts"].(map[string]interface{})
+	if !ok {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": job.ID.Hex(),
+		}).Warningln("Playbook stats event does not contain host stats")
+		return
+	}
+
+	for name, v := range stats {
+		s, _ := v.(map[string]interface{})
+
+		summary := ansible.JobHostSummary{
+			JobID:    job.ID,
+			HostName: name,
+			Changed:  intValue(s["changed"]),
+			Dark:     intValue(s["unreachable"]),
+			Failures: intValue(s["failures"]),
+			Ok:       intValue(s["ok"]),
+			Skipped:  intValue(s["skipped"]),
+			Created:  time.Now(),
+			Modified: time.Now(),
+		}
+		summary.Processed = summary.Ok + summary.Changed + summary.Skipped + summary.Failures + summary.Dark
+		summary.Failed = summary.Failures > 0 || summary.Dark > 0
+
+		var host ansible.Host
+		if err := db.Hosts().Find(bson.M{"name": name, "inventory_id": job.InventoryID}).One(&host); err == nil {
+			summary.HostID = &host.ID
+		}
+
+		var existing ansible.JobHostSummary
+		if err := db.JobHostSummaries().Find(bson.M{"job_id": job.ID, "host_name": name}).One(&existing); err == nil {
+			summary.ID = existing.ID
+			summary.Created = existing.Created
+		} else {
+			summary.ID = bson.NewObjectId()
+		}
+
+		if _, err := db.JobHostSummaries().UpsertId(summary.ID, summary); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": job.ID.Hex(),
+				"Host":   name,
+				"Error":  err.Error(),
+			}).Errorln("Could not store job host summary")
+			continue
+		}
+
+		if summary.HostID == nil {
+			continue
+		}
+
+		if err := db.Hosts().UpdateId(host.ID, bson.M{"$set": bson.M{
+			"last_job_id":              job.ID,
+			"last_job_host_summary_id": summary.ID,
+			"has_active_failures":      summary.Failed,
+		}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Host ID": host.ID.Hex(),
+				"Error":   err.Error(),
+			}).Errorln("Could not update host")
+		}
+	}
+
+	updateGroupFailures(job.InventoryID)
+}
+
+// updateGroupFailures recalculates the failure counters of all groups in the inventory
+// from the has_active_failures field of their hosts and child groups
+func updateGroupFailures(inventoryID bson.ObjectId) {
+	var groups []ansible.Group
+	if err := db.Groups().Find(bson.M{"inventory_id": inventoryID}).All(&groups); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory ID": inventoryID.Hex(),
+			"Error":        err.Error(),
+		}).Errorln("Could not get inventory groups")
+		return
+	}
+
+	hostFailures := map[bson.ObjectId]int{}
+	for _, v := range groups {
+		count, err := db.Hosts().Find(bson.M{"group_id": v.ID, "has_active_failures": true}).Count()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Group ID": v.ID.Hex(),
+				"Error":    err.Error(),
+			}).Errorln("Could not count hosts with active failures")
+		}
+		hostFailures[v.ID] = count
+	}
+
+	for _, v := range groupFailures(groups, hostFailures) {
+		if err := db.Groups().UpdateId(v.GroupID, bson.M{"$set": bson.M{
+			"has_active_failures":         v.HasActiveFailures,
+			"hosts_with_active_failures":  v.HostsWithActiveFailures,
+			"groups_with_active_failures": v.GroupsWithActiveFailures,
+		}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Group ID": v.GroupID.Hex(),
+				"Error":    err.Error(),
+			}).Errorln("Could not update group")
+		}
+	}
+}
+
+// groupFailure holds the failure counters of a group
+type groupFailure struct {
+	GroupID                  bson.ObjectId
+	HasActiveFailures        bool
+	HostsWithActiveFailures  int
+	GroupsWithActiveFailures int
+}
+
+// groupFailures calculates the failure counters of the groups from the number of
+// hosts with active failures in each group. The failures of hosts are propagated
+// to the parent groups
+func groupFailures(groups []ansible.Group, hostFailures map[bson.ObjectId]int) []groupFailure {
+	children := map[bson.ObjectId][]bson.ObjectId{}
+	for _, v := range groups {
+		if v.ParentGroupID != nil {
+			children[*v.ParentGroupID] = append(children[*v.ParentGroupID], v.ID)
+		}
+	}
+
+	// a group has active failures if one of its hosts or child groups has
+	failed := map[bson.ObjectId]bool{}
+	var hasFailures func(id bson.ObjectId, depth int) bool
+	hasFailures = func(id bson.ObjectId, depth int) bool {
+		if f, ok := failed[id]; ok {
+			return f
+		}
+		f := hostFailures[id] > 0
+		// guard against cyclic parent references
+		if depth < len(groups) {
+			for _, child := range children[id] {
+				if hasFailures(child, depth+1) {
+					f = true
+				}
+			}
+		}
+		failed[id] = f
+		return f
+	}
+
+	failures := []groupFailure{}
+	for _, v := range groups {
+		count := 0
+		for _, child := range children[v.ID] {
+			if hasFailures(child, 1) {
+				count++
+			}
+		}
+
+		failures = append(failures, groupFailure{
+			GroupID:                  v.ID,
+			HasActiveFailures:        hasFailures(v.ID, 0),
+			HostsWithActiveFailures:  hostFailures[v.ID],
+			GroupsWithActiveFailures: count,
+		})
+	}
+	return failures
+}
+
+// intValue converts a JSON number to int
+func intValue(v interface{}) int {
+	switch n := v.(type) {
+	case float64:
+		return int(n)
+	case int:
+		return n
+	case int64:
+		return int(n)
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestJobPlaysAndTasks(t *testing.T) {
+	start := time.Now()
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	events := []ansible.JobEvent{
+		{ID: bson.NewObjectId(), Event: "playbook_on_start", Created: at(0)},
+		{ID: bson.NewObjectId(), Event: ansible.EventPlaybookOnPlayStart, Play: "web", Created: at(1)},
+		{ID: bson.NewObjectId(), Event: ansible.EventPlaybookOnTaskStart, Play: "web", Task: "install", Created: at(2)},
+		{ID: bson.NewObjectId(), Event: ansible.EventRunnerOnOk, Play: "web", Task: "install", Changed: true, Created: at(3)},
+		{ID: bson.NewObjectId(), Event: ansible.EventRunnerOnSkipped, Play: "web", Task: "install", Created: at(4)},
+		{ID: bson.NewObjectId(), Event: ansible.EventPlaybookOnTaskStart, Play: "web", Task: "start", Role: "nginx", Created: at(5)},
+		{ID: bson.NewObjectId(), Event: ansible.EventRunnerOnFailed, Play: "web", Task: "start", Failed: true, Created: at(6)},
+		{ID: bson.NewObjectId(), Event: ansible.EventRunnerOnUnreachable, Play: "web", Task: "start", Failed: true, Created: at(7)},
+		{ID: bson.NewObjectId(), Event: ansible.EventPlaybookOnPlayStart, Play: "db", Created: at(8)},
+		// results without a task are not counted
+		{ID: bson.NewObjectId(), Event: ansible.EventRunnerOnOk, Play: "db", Created: at(9)},
+	}
+
+	plays, tasks := jobPlaysAndTasks(events)
+
+	if assert.Len(t, plays, 2) {
+		assert.Equal(t, "web", plays[0].Play)
+		assert.Equal(t, at(1), plays[0].Started)
+		assert.Equal(t, at(7), plays[0].Finished)
+		assert.True(t, plays[0].Failed)
+		assert.True(t, plays[0].Changed)
+
+		assert.Equal(t, "db", plays[1].Play)
+		assert.Equal(t, at(9), plays[1].Finished)
+		assert.False(t, plays[1].Failed)
+		assert.False(t, plays[1].Changed)
+	}
+
+	if assert.Len(t, tasks, 2) {
+		assert.Equal(t, "install", tasks[0].Task)
+		assert.Equal(t, at(4), tasks[0].Finished)
+		assert.Equal(t, 2, tasks[0].HostCount)
+		assert.Equal(t, 1, tasks[0].SuccessfulCount)
+		assert.Equal(t, 1, tasks[0].SkippedCount)
+		assert.Equal(t, 1, tasks[0].ChangedCount)
+		assert.True(t, tasks[0].Changed)
+		assert.False(t, tasks[0].Failed)
+
+		assert.Equal(t, "start", tasks[1].Task)
+		assert.Equal(t, "nginx", tasks[1].Role)
+		assert.Equal(t, 2, tasks[1].HostCount)
+		assert.Equal(t, 1, tasks[1].FailedCount)
+		assert.Equal(t, 1, tasks[1].UnreachableCount)
+		assert.True(t, tasks[1].Failed)
+	}
+}
+
+func TestGroupFailures(t *testing.T) {
+	root := bson.NewObjectId()
+	web := bson.NewObjectId()
+	frontend := bson.NewObjectId()
+	database := bson.NewObjectId()
+
+	groups := []ansible.Group{
+		{ID: root},
+		{ID: web, ParentGroupID: &root},
+		{ID: frontend, ParentGroupID: &web},
+		{ID: database, ParentGroupID: &root},
+	}
+
+	failures := map[bson.ObjectId]groupFailure{}
+	for _, v := range groupFailures(groups, map[bson.ObjectId]int{frontend: 2}) {
+		failures[v.GroupID] = v
+	}
+
+	assert.Equal(t, groupFailure{GroupID: frontend, HasActiveFailures: true, HostsWithActiveFailures: 2}, failures[frontend])
+	assert.Equal(t, groupFailure{GroupID: web, HasActiveFailures: true, GroupsWithActiveFailures: 1}, failures[web])
+	assert.Equal(t, groupFailure{GroupID: root, HasActiveFailures: true, GroupsWithActiveFailures: 1}, failures[root],
+		"the failures are propagated to the ancestors")
+	assert.Equal(t, groupFailure{GroupID: database}, failures[database])
+}
+
+func TestGroupFailuresCycle(t *testing.T) {
+	a := bson.NewObjectId()
+	b := bson.NewObjectId()
+	groups := []ansible.Group{
+		{ID: a, ParentGroupID: &b},
+		{ID: b, ParentGroupID: &a},
+	}
+
+	failures := groupFailures(groups, map[bson.ObjectId]int{a: 1})
+	assert.Len(t, failures, 2)
+	for _, v := range failures {
+		assert.True(t, v.HasActiveFailures)
+	}
+}
@@ -0,0 +1,15 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// AccessTokenMetadata attach metadata to AccessToken
+func AccessTokenMetadata(t *common.AccessToken) {
+	t.Type = t.GetType()
+	t.Links = gin.H{
+		"self": "/v1/me/tokens/" + t.ID.Hex(),
+		"user": "/v1/users/" + t.UserID.Hex(),
+	}
+}
@@ -0,0 +1,35 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/ansible"
+)
+
+// AdHocCommandMetadata attach metadata to AdHocCommand
+func AdHocCommandMetadata(cmd *ansible.AdHocCommand) {
+	ID := cmd.ID.Hex()
+	cmd.Type = cmd.GetType()
+	cmd.Links = gin.H{
+		"self":        "/v1/ad_hoc_commands/" + ID,
+		"created_by":  "/v1/users/" + cmd.CreatedByID.Hex(),
+		"modified_by": "/v1/users/" + cmd.ModifiedByID.Hex(),
+		"inventory":   "/v1/inventories/" + cmd.InventoryID.Hex(),
+		"credential":  "/v1/credentials/" + cmd.CredentialID.Hex(),
+		"cancel":      "/v1/ad_hoc_commands/" + ID + "/cancel",
+		"stdout":      "/v1/ad_hoc_commands/" + ID + "/stdout",
+		"events":      "/v1/ad_hoc_commands/" + ID + "/events",
+	}
+	cmd.Meta = gin.H{}
+}
+
+// AdHocCommandEventMetadata attach metadata to AdHocCommandEvent
+func AdHocCommandEventMetadata(event *ansible.AdHocCommandEvent) {
+	event.Type = event.GetType()
+	event.Links = gin.H{
+		"ad_hoc_command": "/v1/ad_hoc_commands/" + event.AdHocCommandID.Hex(),
+	}
+
+	if event.HostID != nil {
+		event.Links["host"] = "/v1/hosts/" + (*event.HostID).Hex()
+	}
+}
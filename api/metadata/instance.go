@@ -0,0 +1,17 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// InstanceMetadata attach metadata to Instance
+func InstanceMetadata(i *common.Instance) {
+	i.Type = i.GetType()
+	i.Links = gin.H{
+		"self": "/v1/instances/" + i.ID.Hex(),
+	}
+	i.Meta = gin.H{
+		"remaining_capacity": i.Capacity - i.ConsumedCapacity,
+	}
+}
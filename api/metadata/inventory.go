@@ -60,7 +60,7 @@ func inventorySummary(i *ansible.Inventory) {
 			},
 			{
 				"description": "May run ad hoc commands on an inventory",
-				"name":        "adhoc",
+				"name":        "ad_hoc",
 			},
 			{
 				"description": "May update project or inventory or group using the configured source update system",
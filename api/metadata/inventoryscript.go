@@ -0,0 +1,19 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/ansible"
+)
+
+// InventoryScriptMetadata attach metadata to InventoryScript
+func InventoryScriptMetadata(script *ansible.InventoryScript) {
+	ID := script.ID.Hex()
+	script.Type = script.GetType()
+	script.Links = gin.H{
+		"self":         "/v1/inventory_scripts/" + ID,
+		"created_by":   "/v1/users/" + script.CreatedByID.Hex(),
+		"modified_by":  "/v1/users/" + script.ModifiedByID.Hex(),
+		"organization": "/v1/organizations/" + script.OrganizationID.Hex(),
+	}
+	script.Meta = gin.H{}
+}
@@ -0,0 +1,54 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/ansible"
+)
+
+// InventorySourceMetadata attach metadata to InventorySource
+func InventorySourceMetadata(src *ansible.InventorySource) {
+	ID := src.ID.Hex()
+	src.Type = src.GetType()
+	src.Links = gin.H{
+		"self":              "/v1/inventory_sources/" + ID,
+		"created_by":        "/v1/users/" + src.CreatedByID.Hex(),
+		"modified_by":       "/v1/users/" + src.ModifiedByID.Hex(),
+		"inventory":         "/v1/inventories/" + src.InventoryID.Hex(),
+		"update":            "/v1/inventory_sources/" + ID + "/update",
+		"inventory_updates": "/v1/inventory_sources/" + ID + "/inventory_updates",
+	}
+
+	if src.CredentialID != nil {
+		src.Links["credential"] = "/v1/credentials/" + (*src.CredentialID).Hex()
+	}
+	if src.GroupID != nil {
+		src.Links["group"] = "/v1/groups/" + (*src.GroupID).Hex()
+	}
+	if src.SourceScriptID != nil {
+		src.Links["source_script"] = "/v1/inventory_scripts/" + (*src.SourceScriptID).Hex()
+	}
+	if src.TerraformJobTemplateID != nil {
+		src.Links["terraform_job_template"] = "/v1/terraform_job_templates/" + (*src.TerraformJobTemplateID).Hex()
+	}
+	if src.LastUpdateID != nil {
+		src.Links["last_update"] = "/v1/inventory_updates/" + (*src.LastUpdateID).Hex()
+	}
+
+	src.Meta = gin.H{}
+}
+
+// InventoryUpdateMetadata attach metadata to InventoryUpdate
+func InventoryUpdateMetadata(update *ansible.InventoryUpdate) {
+	ID := update.ID.Hex()
+	update.Type = update.GetType()
+	update.Links = gin.H{
+		"self":             "/v1/inventory_updates/" + ID,
+		"created_by":       "/v1/users/" + update.CreatedByID.Hex(),
+		"modified_by":      "/v1/users/" + update.ModifiedByID.Hex(),
+		"inventory":        "/v1/inventories/" + update.InventoryID.Hex(),
+		"inventory_source": "/v1/inventory_sources/" + update.InventorySourceID.Hex(),
+		"cancel":           "/v1/inventory_updates/" + ID + "/cancel",
+		"stdout":           "/v1/inventory_updates/" + ID + "/stdout",
+	}
+	update.Meta = gin.H{}
+}
@@ -0,0 +1,30 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/ansible"
+)
+
+// JobEventMetadata attach metadata to JobEvent
+func JobEventMetadata(event *ansible.JobEvent) {
+	event.Type = event.GetType()
+	event.Links = gin.H{
+		"job": "/v1/jobs/" + event.JobID.Hex(),
+	}
+
+	if event.HostID != nil {
+		event.Links["host"] = "/v1/hosts/" + (*event.HostID).Hex()
+	}
+}
+
+// JobHostSummaryMetadata attach metadata to JobHostSummary
+func JobHostSummaryMetadata(summary *ansible.JobHostSummary) {
+	summary.Type = summary.GetType()
+	summary.Links = gin.H{
+		"job": "/v1/jobs/" + summary.JobID.Hex(),
+	}
+
+	if summary.HostID != nil {
+		summary.Links["host"] = "/v1/hosts/" + (*summary.HostID).Hex()
+	}
+}
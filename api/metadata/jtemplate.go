@@ -23,11 +23,13 @@ func JTemplateMetadata(jt *ansible.JobTemplate) {
 		"project":                        "/v1/projects/" + jt.ProjectID.Hex(),
 		"notification_templates_error":   "/v1/job_templates/" + ID + "/notification_templates_error",
 		"notification_templates_success": "/v1/job_templates/" + ID + "/notification_templates_success",
+		"notification_templates_started": "/v1/job_templates/" + ID + "/notification_templates_started",
 		"jobs":                       "/v1/job_templates/" + ID + "/jobs",
 		"object_roles":               "/v1/job_templates/" + ID + "/object_roles",
 		"notification_templates_any": "/v1/job_templates/" + ID + "/notification_templates_any",
 		"access_list":                "/v1/job_templates/" + ID + "/access_list",
 		"launch":                     "/v1/job_templates/" + ID + "/launch",
+		"survey_spec":                "/v1/job_templates/" + ID + "/survey_spec",
 		"schedules":                  "/v1/job_templates/" + ID + "/schedules",
 		"activity_stream":            "/v1/job_templates/" + ID + "/activity_stream",
 	}
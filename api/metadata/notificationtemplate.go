@@ -0,0 +1,35 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// NotificationTemplateMetadata attach metadata to NotificationTemplate
+func NotificationTemplateMetadata(n *common.NotificationTemplate) {
+	ID := n.ID.Hex()
+	n.Type = n.GetType()
+	n.Links = gin.H{
+		"self":          "/v1/notification_templates/" + ID,
+		"created_by":    "/v1/users/" + n.CreatedByID.Hex(),
+		"modified_by":   "/v1/users/" + n.ModifiedByID.Hex(),
+		"organization":  "/v1/organizations/" + n.OrganizationID.Hex(),
+		"notifications": "/v1/notification_templates/" + ID + "/notifications",
+	}
+	n.Meta = gin.H{}
+}
+
+// NotificationMetadata attach metadata to Notification
+func NotificationMetadata(n *common.Notification) {
+	n.Type = n.GetType()
+	n.Links = gin.H{
+		"self":                  "/v1/notifications/" + n.ID.Hex(),
+		"notification_template": "/v1/notification_templates/" + n.NotificationTemplateID.Hex(),
+	}
+	if n.JobType == "terraform_job" {
+		n.Links["job"] = "/v1/terraform_jobs/" + n.JobID.Hex()
+	} else {
+		n.Links["job"] = "/v1/jobs/" + n.JobID.Hex()
+	}
+	n.Meta = gin.H{}
+}
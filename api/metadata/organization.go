@@ -19,6 +19,7 @@ func OrganizationMetadata(o *common.Organization) {
 		"modified_by":                    "/v1/users/" + o.ModifiedByID.Hex(),
 		"notification_templates_error":   "/v1/organizations/" + ID + "/notification_templates_error",
 		"notification_templates_success": "/v1/organizations/" + ID + "/notification_templates_success",
+		"notification_templates_started": "/v1/organizations/" + ID + "/notification_templates_started",
 		"users":                      "/v1/organizations/" + ID + "/users",
 		"object_roles":               "/v1/organizations/" + ID + "/object_roles",
 		"notification_templates_any": "/v1/organizations/" + ID + "/notification_templates_any",
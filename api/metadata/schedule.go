@@ -0,0 +1,36 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// ScheduleMetadata attach metadata to Schedule
+func ScheduleMetadata(s *common.Schedule) {
+	ID := s.ID.Hex()
+	s.Type = s.GetType()
+	s.Links = gin.H{
+		"self":        "/v1/schedules/" + ID,
+		"created_by":  "/v1/users/" + s.CreatedByID.Hex(),
+		"modified_by": "/v1/users/" + s.ModifiedByID.Hex(),
+	}
+
+	switch s.TemplateType {
+	case common.ScheduleJobTemplate:
+		s.Links["unified_job_template"] = "/v1/job_templates/" + s.TemplateID.Hex()
+	case common.ScheduleTerraformJobTemplate:
+		s.Links["unified_job_template"] = "/v1/terraform_job_templates/" + s.TemplateID.Hex()
+	case common.ScheduleProject:
+		s.Links["unified_job_template"] = "/v1/projects/" + s.TemplateID.Hex()
+	}
+
+	if s.LastJobID != nil {
+		if s.TemplateType == common.ScheduleTerraformJobTemplate {
+			s.Links["last_job"] = "/v1/terraform_jobs/" + (*s.LastJobID).Hex()
+		} else {
+			s.Links["last_job"] = "/v1/jobs/" + (*s.LastJobID).Hex()
+		}
+	}
+
+	s.Meta = gin.H{}
+}
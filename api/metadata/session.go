@@ -0,0 +1,15 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// SessionMetadata attach metadata to Session
+func SessionMetadata(s *common.Session) {
+	s.Type = s.GetType()
+	s.Links = gin.H{
+		"self": "/v1/me/sessions/" + s.ID.Hex(),
+		"user": "/v1/users/" + s.UserID.Hex(),
+	}
+}
@@ -40,6 +40,26 @@ func JobMetadata(job *terraform.Job) {
 		related["job_template"] = "/v1/terraform_job_templates/" + job.JobTemplateID.Hex()
 	}
 
+	if job.JobType == terraform.JobTypeApply {
+		related["outputs"] = "/v1/terraform_jobs/" + ID + "/outputs"
+	}
+
+	if job.JobType == terraform.JobTypePlan {
+		related["apply"] = "/v1/terraform_jobs/" + ID + "/apply"
+	}
+
+	if job.AppliedJobID != nil {
+		related["applied_job"] = "/v1/terraform_jobs/" + (*job.AppliedJobID).Hex()
+	}
+
+	if job.PlanJobID != nil {
+		related["plan_job"] = "/v1/terraform_jobs/" + (*job.PlanJobID).Hex()
+	}
+
+	if job.ApprovedByID != nil {
+		related["approved_by"] = "/v1/users/" + (*job.ApprovedByID).Hex()
+	}
+
 	job.Links = related
 	JobSummary(job)
 }
@@ -21,11 +21,16 @@ func JTemplateMetadata(jt *terraform.JobTemplate) {
 		"project":                        "/v1/projects/" + jt.ProjectID.Hex(),
 		"notification_templates_error":   "/v1/terraform_job_templates/" + ID + "/notification_templates_error",
 		"notification_templates_success": "/v1/terraform_job_templates/" + ID + "/notification_templates_success",
+		"notification_templates_started": "/v1/terraform_job_templates/" + ID + "/notification_templates_started",
 		"jobs":                       "/v1/terraform_job_templates/" + ID + "/jobs",
 		"object_roles":               "/v1/terraform_job_templates/" + ID + "/object_roles",
 		"notification_templates_any": "/v1/terraform_job_templates/" + ID + "/notification_templates_any",
 		"access_list":                "/v1/terraform_job_templates/" + ID + "/access_list",
 		"launch":                     "/v1/terraform_job_templates/" + ID + "/launch",
+		"survey_spec":                "/v1/terraform_job_templates/" + ID + "/survey_spec",
+		"state":                      "/v1/terraform_job_templates/" + ID + "/state",
+		"state_versions":             "/v1/terraform_job_templates/" + ID + "/state_versions",
+		"outputs":                    "/v1/terraform_job_templates/" + ID + "/outputs",
 		"schedules":                  "/v1/terraform_job_templates/" + ID + "/schedules",
 		"activity_stream":            "/v1/terraform_job_templates/" + ID + "/activity_stream",
 	}
@@ -79,6 +84,7 @@ func jTemplateSummary(jt *terraform.JobTemplate) {
 		"can_copy":       true,
 		"can_edit":       true,
 		"recent_jobs":    nil,
+		"outputs":        nil,
 	}
 
 	if err := db.Users().FindId(jt.CreatedByID).One(&created); err != nil {
@@ -198,5 +204,14 @@ func jTemplateSummary(jt *terraform.JobTemplate) {
 		summary["recent_jobs"] = a
 	}
 
+	// outputs of the latest successful apply
+	if ojob, err := terraform.LatestOutputsJob(jt.ID); err == nil {
+		summary["outputs"] = gin.H{
+			"terraform_job": ojob.ID,
+			"finished":      ojob.Finished,
+			"values":        terraform.MaskOutputs(ojob.Outputs),
+		}
+	}
+
 	jt.Meta = summary
 }
@@ -0,0 +1,23 @@
+package terraform
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/terraform"
+)
+
+// StateMetadata attach metadata to State
+func StateMetadata(s *terraform.State) {
+	s.Type = s.GetType()
+	s.Links = gin.H{
+		"job_template": "/v1/terraform_job_templates/" + s.JobTemplateID.Hex(),
+		"state":        "/v1/terraform_job_templates/" + s.JobTemplateID.Hex() + "/state?workspace=" + s.Workspace + "&version=" + strconv.Itoa(s.Version),
+	}
+
+	if s.JobID != nil {
+		s.Links["job"] = "/v1/terraform_jobs/" + s.JobID.Hex()
+	}
+
+	s.Meta = gin.H{}
+}
@@ -0,0 +1,53 @@
+package metadata
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// WorkflowJobTemplateMetadata attach metadata to WorkflowJobTemplate
+func WorkflowJobTemplateMetadata(wt *common.WorkflowJobTemplate) {
+	ID := wt.ID.Hex()
+	wt.Type = wt.GetType()
+	wt.Links = gin.H{
+		"self":          "/v1/workflow_job_templates/" + ID,
+		"created_by":    "/v1/users/" + wt.CreatedByID.Hex(),
+		"modified_by":   "/v1/users/" + wt.ModifiedByID.Hex(),
+		"organization":  "/v1/organizations/" + wt.OrganizationID.Hex(),
+		"launch":        "/v1/workflow_job_templates/" + ID + "/launch",
+		"workflow_jobs": "/v1/workflow_job_templates/" + ID + "/workflow_jobs",
+	}
+
+	if wt.LastJobID != nil {
+		wt.Links["last_job"] = "/v1/workflow_jobs/" + (*wt.LastJobID).Hex()
+	}
+
+	wt.Meta = gin.H{}
+}
+
+// WorkflowJobMetadata attach metadata to WorkflowJob
+func WorkflowJobMetadata(wj *common.WorkflowJob) {
+	ID := wj.ID.Hex()
+	wj.Type = wj.GetType()
+	wj.Links = gin.H{
+		"self":                  "/v1/workflow_jobs/" + ID,
+		"created_by":            "/v1/users/" + wj.CreatedByID.Hex(),
+		"modified_by":           "/v1/users/" + wj.ModifiedByID.Hex(),
+		"organization":          "/v1/organizations/" + wj.OrganizationID.Hex(),
+		"workflow_job_template": "/v1/workflow_job_templates/" + wj.WorkflowJobTemplateID.Hex(),
+		"cancel":                "/v1/workflow_jobs/" + ID + "/cancel",
+	}
+
+	jobs := gin.H{}
+	for _, node := range wj.Nodes {
+		if node.JobID == nil {
+			continue
+		}
+		if node.JobType == common.WorkflowJobTypeTerraformJob {
+			jobs[node.ID] = "/v1/terraform_jobs/" + (*node.JobID).Hex()
+		} else {
+			jobs[node.ID] = "/v1/jobs/" + (*node.JobID).Hex()
+		}
+	}
+	wj.Meta = gin.H{"jobs": jobs}
+}
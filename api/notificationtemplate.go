@@ -0,0 +1,577 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for notification related items stored in the Gin Context
+const (
+	cNotificationTemplate   = "notification_template"
+	cNotificationTemplateID = "notification_template_id"
+	cNotification           = "notification"
+	cNotificationID         = "notification_id"
+)
+
+// notificationAttachment is the request payload to attach a notification template
+// to an organization, a job template or a terraform job template
+type notificationAttachment struct {
+	ID           bson.ObjectId `json:"id" binding:"required"`
+	Disassociate bool          `json:"disassociate"`
+}
+
+type NotificationTemplateController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes notification_template_id parameter from Gin Context and retrieves the notification template
+// and store it under key notification_template in Gin Context
+func (ctrl NotificationTemplateController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cNotificationTemplateID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Notification Template does not exist"})
+		return
+	}
+
+	var template common.NotificationTemplate
+	if err := db.NotificationTemplates().FindId(bson.ObjectIdHex(objectID)).One(&template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Notification Template does not exist",
+			Log: logrus.Fields{
+				"Notification Template ID": objectID,
+				"Error":                    err.Error(),
+			},
+		})
+		return
+	}
+
+	roles := new(rbac.NotificationTemplate)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.Read(user, template) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "POST", "DELETE":
+		{
+			// Reject the request if the user doesn't have write permissions
+			if !roles.Write(user, template) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cNotificationTemplate, template)
+	c.Next()
+}
+
+// One returns the notification template as a JSON object
+func (ctrl NotificationTemplateController) One(c *gin.Context) {
+	template := c.MustGet(cNotificationTemplate).(common.NotificationTemplate)
+	hideNotificationSecrets(&template)
+	metadata.NotificationTemplateMetadata(&template)
+	c.JSON(http.StatusOK, template)
+}
+
+// All returns the notification templates the user has read access to.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl NotificationTemplateController) All(c *gin.Context) {
+	listNotificationTemplates(c, bson.M{})
+}
+
+// Create creates a new notification template using request payload.
+// Only organization admins can create notification templates
+func (ctrl NotificationTemplateController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	var req common.NotificationTemplate
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if !req.OrganizationExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Organization does not exists.",
+		})
+		return
+	}
+
+	if !rbac.HasGlobalWrite(user) && !rbac.IsOrganizationAdmin(req.OrganizationID, user.ID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Notification Template with this Name already exists.",
+		})
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+	req.NotificationConfiguration.Password = util.Cipher(req.NotificationConfiguration.Password)
+	req.NotificationConfiguration.Secret = util.Cipher(req.NotificationConfiguration.Secret)
+	req.StartedIDs = nil
+	req.SuccessIDs = nil
+	req.ErrorIDs = nil
+	req.AnyIDs = nil
+	req.Roles = nil
+	req.Created = time.Now()
+	req.Modified = time.Now()
+	req.CreatedByID = user.ID
+	req.ModifiedByID = user.ID
+	if err := db.NotificationTemplates().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Notification Template",
+			Log:     logrus.Fields{"Notification Template ID": req.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	hideNotificationSecrets(&req)
+	metadata.NotificationTemplateMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update updates the notification template using request payload.
+// The password and the secret are kept if they are $encrypted$
+func (ctrl NotificationTemplateController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	template := c.MustGet(cNotificationTemplate).(common.NotificationTemplate)
+	tmpTemplate := template
+
+	var req common.NotificationTemplate
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if req.OrganizationID != template.OrganizationID {
+		if !req.OrganizationExist() {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Organization does not exists.",
+			})
+			return
+		}
+
+		if !rbac.HasGlobalWrite(user) && !rbac.IsOrganizationAdmin(req.OrganizationID, user.ID) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+	}
+
+	if (req.Name != template.Name || req.OrganizationID != template.OrganizationID) && !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Notification Template with this Name already exists.",
+		})
+		return
+	}
+
+	config := req.NotificationConfiguration
+	if config.Password == "$encrypted$" {
+		config.Password = template.NotificationConfiguration.Password
+	} else {
+		config.Password = util.Cipher(config.Password)
+	}
+	if config.Secret == "$encrypted$" {
+		config.Secret = template.NotificationConfiguration.Secret
+	} else {
+		config.Secret = util.Cipher(config.Secret)
+	}
+
+	template.Name = strings.Trim(req.Name, " ")
+	template.Description = strings.Trim(req.Description, " ")
+	template.OrganizationID = req.OrganizationID
+	template.NotificationsType = req.NotificationsType
+	template.NotificationConfiguration = config
+	template.Subject = req.Subject
+	template.Modified = time.Now()
+	template.ModifiedByID = user.ID
+
+	if err := db.NotificationTemplates().UpdateId(template.ID, template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Notification Template",
+			Log:     logrus.Fields{"Notification Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpTemplate, template)
+	hideNotificationSecrets(&template)
+	metadata.NotificationTemplateMetadata(&template)
+	c.JSON(http.StatusOK, template)
+}
+
+// Delete removes the notification template and its notifications
+func (ctrl NotificationTemplateController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	template := c.MustGet(cNotificationTemplate).(common.NotificationTemplate)
+
+	if _, err := db.Notifications().RemoveAll(bson.M{"notification_template_id": template.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Notifications",
+			Log:     logrus.Fields{"Notification Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := db.NotificationTemplates().RemoveId(template.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Notification Template",
+			Log:     logrus.Fields{"Notification Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, template, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// Notifications returns the notifications sent using the notification template
+func (ctrl NotificationTemplateController) Notifications(c *gin.Context) {
+	template := c.MustGet(cNotificationTemplate).(common.NotificationTemplate)
+
+	listNotifications(c, bson.M{"notification_template_id": template.ID})
+}
+
+type NotificationController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes notification_id parameter from Gin Context and retrieves the notification
+// and store it under key notification in Gin Context.
+// A notification can be read by the users who can read its notification template
+func (ctrl NotificationController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cNotificationID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Notification does not exist"})
+		return
+	}
+
+	var notification common.Notification
+	if err := db.Notifications().FindId(bson.ObjectIdHex(objectID)).One(&notification); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Notification does not exist",
+			Log: logrus.Fields{
+				"Notification ID": objectID,
+				"Error":           err.Error(),
+			},
+		})
+		return
+	}
+
+	if !new(rbac.NotificationTemplate).ReadByID(user, notification.NotificationTemplateID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	c.Set(cNotification, notification)
+	c.Next()
+}
+
+// One returns the notification as a JSON object
+func (ctrl NotificationController) One(c *gin.Context) {
+	notification := c.MustGet(cNotification).(common.Notification)
+	metadata.NotificationMetadata(&notification)
+	c.JSON(http.StatusOK, notification)
+}
+
+// All returns the notifications of the notification templates the user can read
+func (ctrl NotificationController) All(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	var ids []bson.ObjectId
+	var template common.NotificationTemplate
+	roles := new(rbac.NotificationTemplate)
+	iter := db.NotificationTemplates().Find(nil).Iter()
+	for iter.Next(&template) {
+		if roles.Read(user, template) {
+			ids = append(ids, template.ID)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Notification Templates",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	listNotifications(c, bson.M{"notification_template_id": bson.M{"$in": ids}})
+}
+
+// Notifications returns the notifications sent for the job
+func (ctrl JobController) Notifications(c *gin.Context) {
+	job := c.MustGet(cJob).(ansible.Job)
+
+	listNotifications(c, bson.M{"job_id": job.ID})
+}
+
+// Notifications returns the notifications sent for the terraform job
+func (ctrl TerraformJobController) Notifications(c *gin.Context) {
+	job := c.MustGet(cTerraformJob).(terraform.Job)
+
+	listNotifications(c, bson.M{"job_id": job.ID})
+}
+
+// NotificationTemplates returns the notification templates of the organization
+func (ctrl OrganizationController) NotificationTemplates(c *gin.Context) {
+	organization := c.MustGet(cOrganization).(common.Organization)
+
+	listNotificationTemplates(c, bson.M{"organization_id": organization.ID})
+}
+
+// AttachedNotificationTemplates returns a handler which lists the notification templates
+// attached to the organization for the event
+func (ctrl OrganizationController) AttachedNotificationTemplates(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		organization := c.MustGet(cOrganization).(common.Organization)
+
+		listNotificationTemplates(c, bson.M{common.NotificationEventField(event): organization.ID})
+	}
+}
+
+// AttachNotificationTemplate returns a handler which attaches a notification template
+// to the organization for the event, or detaches it if disassociate is true
+func (ctrl OrganizationController) AttachNotificationTemplate(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(cUser).(common.User)
+		organization := c.MustGet(cOrganization).(common.Organization)
+
+		attachNotificationTemplate(c, event, organization.ID, new(rbac.Organization).Write(user, organization))
+	}
+}
+
+// AttachedNotificationTemplates returns a handler which lists the notification templates
+// attached to the job template for the event
+func (ctrl JobTemplateController) AttachedNotificationTemplates(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+
+		listNotificationTemplates(c, bson.M{common.NotificationEventField(event): template.ID})
+	}
+}
+
+// AttachNotificationTemplate returns a handler which attaches a notification template
+// to the job template for the event, or detaches it if disassociate is true
+func (ctrl JobTemplateController) AttachNotificationTemplate(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(cUser).(common.User)
+		template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+
+		attachNotificationTemplate(c, event, template.ID, new(rbac.JobTemplate).Write(user, template))
+	}
+}
+
+// AttachedNotificationTemplates returns a handler which lists the notification templates
+// attached to the terraform job template for the event
+func (ctrl TJobTmplController) AttachedNotificationTemplates(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+
+		listNotificationTemplates(c, bson.M{common.NotificationEventField(event): template.ID})
+	}
+}
+
+// AttachNotificationTemplate returns a handler which attaches a notification template
+// to the terraform job template for the event, or detaches it if disassociate is true
+func (ctrl TJobTmplController) AttachNotificationTemplate(event string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet(cUser).(common.User)
+		template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+
+		attachNotificationTemplate(c, event, template.ID, new(rbac.TerraformJobTemplate).Write(user, template))
+	}
+}
+
+// attachNotificationTemplate adds the object to the notification template of the request payload
+// for the event, or removes it if disassociate is true.
+// canWrite is the write permission of the user on the object
+func attachNotificationTemplate(c *gin.Context, event string, objectID bson.ObjectId, canWrite bool) {
+	user := c.MustGet(cUser).(common.User)
+
+	if !canWrite {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	var req notificationAttachment
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	var template common.NotificationTemplate
+	if err := db.NotificationTemplates().FindId(req.ID).One(&template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Notification Template does not exists.",
+		})
+		return
+	}
+
+	if !new(rbac.NotificationTemplate).Read(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	op := activity.Associate
+	change := bson.M{"$addToSet": bson.M{common.NotificationEventField(event): objectID}}
+	if req.Disassociate {
+		op = activity.Disassociate
+		change = bson.M{"$pull": bson.M{common.NotificationEventField(event): objectID}}
+	}
+
+	if err := db.NotificationTemplates().UpdateId(template.ID, change); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Notification Template",
+			Log:     logrus.Fields{"Notification Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(op, user.ID, template, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// hideNotificationSecrets replaces the password and the secret by $encrypted$ string
+func hideNotificationSecrets(n *common.NotificationTemplate) {
+	if len(n.NotificationConfiguration.Password) > 0 {
+		n.NotificationConfiguration.Password = "$encrypted$"
+	}
+	if len(n.NotificationConfiguration.Secret) > 0 {
+		n.NotificationConfiguration.Secret = "$encrypted$"
+	}
+}
+
+// listNotificationTemplates writes a paginated list of the notification templates
+// matching the given query that the user can read
+func listNotificationTemplates(c *gin.Context, match bson.M) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"notification_type", "organization_id"}, match)
+	match = parser.Lookups([]string{"name", "description"}, match)
+	query := db.NotificationTemplates().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	roles := new(rbac.NotificationTemplate)
+	var templates []common.NotificationTemplate
+	iter := query.Iter()
+	var tmpTemplate common.NotificationTemplate
+	for iter.Next(&tmpTemplate) {
+		if !roles.Read(user, tmpTemplate) {
+			continue
+		}
+		hideNotificationSecrets(&tmpTemplate)
+		metadata.NotificationTemplateMetadata(&tmpTemplate)
+		templates = append(templates, tmpTemplate)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Notification Templates",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(templates)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     templates[pgi.Skip():pgi.End()],
+	})
+}
+
+// listNotifications writes a paginated list of the notifications matching the given query
+func listNotifications(c *gin.Context, match bson.M) {
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"status", "notification_type", "event"}, match)
+	query := db.Notifications().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("-created")
+	}
+
+	var notifications []common.Notification
+	if err := query.All(&notifications); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Notifications",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range notifications {
+		metadata.NotificationMetadata(&notifications[i])
+	}
+
+	count := len(notifications)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     notifications[pgi.Skip():pgi.End()],
+	})
+}
@@ -340,6 +340,7 @@ func (ctrl OrganizationController) Update(c *gin.Context) {
 	// trim strings white space
 	organization.Name = strings.Trim(req.Name, " ")
 	organization.Description = strings.Trim(req.Description, " ")
+	organization.AdHocModules = req.AdHocModules
 	organization.Modified = time.Now()
 	organization.ModifiedByID = user.ID
 
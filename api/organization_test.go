@@ -35,10 +35,17 @@ func (suite *OrganizationApiTestSuite) SetupSuite() {
 	Route(engine)
 	suite.server = httptest.NewServer(engine)
 
-	if err := jwt.NewAuthToken(&suite.authHeader); err != nil {
+	var admin common.User
+	if err := db.Users().Find(bson.M{"username": "admin"}).One(&admin); err != nil {
+		suite.Fail(err.Error(), "Unable to find the admin user")
+		return
+	}
+	token, err := jwt.NewUserToken(admin.ID.Hex())
+	if err != nil {
 		suite.Fail(err.Error(), "Unable to create auth header")
 		return
 	}
+	suite.authHeader = token
 }
 
 func (suite *OrganizationApiTestSuite) TestCreate() {
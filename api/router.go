@@ -40,15 +40,62 @@ func Route(r *gin.Engine) {
 		v1.GET("/ping", GetPing)
 		v1.POST("/authtoken", jwt.HeaderAuthMiddleware.LoginHandler)
 
-		v1.Use(jwt.HeaderAuthMiddleware.MiddlewareFunc())
+		// OpenID Connect login, the callback returns a token like /authtoken
+		oidc := v1.Group("/auth/oidc")
+		{
+			oidc.GET("/login", jwt.OIDCLogin)
+			oidc.GET("/callback", jwt.OIDCCallback)
+		}
+
+		// terraform http backend, terraform jobs authenticate with their state token
+		terraformState := v1.Group("/terraform_state/:terraform_job_template_id/:workspace")
+		{
+			ctrl := new(TerraformStateController)
+			terraformState.Use(ctrl.Middleware)
+			terraformState.GET("", ctrl.State)
+			terraformState.POST("", ctrl.UpdateState)
+			terraformState.DELETE("", ctrl.DeleteState)
+			terraformState.Handle("LOCK", "", ctrl.Lock)
+			terraformState.Handle("UNLOCK", "", ctrl.Unlock)
+		}
+
+		// running jobs authenticate with their job token, users with
+		// their personal access token or their JWT
+		v1.Use(jwt.JobTokenMiddleware(jwt.AccessTokenMiddleware(jwt.HeaderAuthMiddleware.MiddlewareFunc())))
 		{
 			dashboard := new(DashBoardController)
 			users := new(UserController)
 			v1.GET("/refresh_token", jwt.HeaderAuthMiddleware.RefreshHandler)
 			v1.GET("/config", getSystemInfo)
+			v1.GET("/capacity", getCapacity)
 			v1.GET("/dashboard", dashboard.GetInfo)
 			v1.GET("/me", users.One)
 
+			v1.POST("/logout", new(SessionController).Logout)
+
+			sessions := v1.Group("/me/sessions")
+			{
+				ctrl := new(SessionController)
+				sessions.GET("", ctrl.All)
+				session := sessions.Group("/:session_id", ctrl.Middleware)
+				{
+					session.GET("", ctrl.One)
+					session.DELETE("", ctrl.Delete)
+				}
+			}
+
+			tokens := v1.Group("/me/tokens")
+			{
+				ctrl := new(AccessTokenController)
+				tokens.GET("", ctrl.All)
+				tokens.POST("", ctrl.Create)
+				token := tokens.Group("/:access_token_id", ctrl.Middleware)
+				{
+					token.GET("", ctrl.One)
+					token.DELETE("", ctrl.Delete)
+				}
+			}
+
 			organizations := v1.Group("/organizations")
 			{
 				ctrl := new(OrganizationController)
@@ -67,11 +114,16 @@ func Route(r *gin.Engine) {
 					organization.GET("/teams", ctrl.GetTeams)
 					organization.GET("/credentials", ctrl.GetCredentials)
 					organization.GET("/object_roles", ctrl.ObjectRoles)
-					organization.GET("/access_list", notImplemented)                    //TODO: implement
-					organization.GET("/notification_templates_error", notImplemented)   //TODO: implement
-					organization.GET("/notification_templates_success", notImplemented) //TODO: implement
-					organization.GET("/notification_templates", notImplemented)         //TODO: implement
-					organization.GET("/notification_templates_any", notImplemented)     //TODO: implement
+					organization.GET("/access_list", notImplemented) //TODO: implement
+					organization.GET("/notification_templates", ctrl.NotificationTemplates)
+					organization.GET("/notification_templates_started", ctrl.AttachedNotificationTemplates(common.NotificationEventStarted))
+					organization.POST("/notification_templates_started", ctrl.AttachNotificationTemplate(common.NotificationEventStarted))
+					organization.GET("/notification_templates_success", ctrl.AttachedNotificationTemplates(common.NotificationEventSuccess))
+					organization.POST("/notification_templates_success", ctrl.AttachNotificationTemplate(common.NotificationEventSuccess))
+					organization.GET("/notification_templates_error", ctrl.AttachedNotificationTemplates(common.NotificationEventError))
+					organization.POST("/notification_templates_error", ctrl.AttachNotificationTemplate(common.NotificationEventError))
+					organization.GET("/notification_templates_any", ctrl.AttachedNotificationTemplates(common.NotificationEventAny))
+					organization.POST("/notification_templates_any", ctrl.AttachNotificationTemplate(common.NotificationEventAny))
 				}
 			}
 
@@ -114,7 +166,8 @@ func Route(r *gin.Engine) {
 					project.POST("/update", ctrl.SCMUpdate)
 					project.GET("/project_updates", ctrl.ProjectUpdates)
 					project.GET("/object_roles", ctrl.ObjectRoles)
-					project.GET("/schedules", notImplemented) //TODO: implement
+					project.GET("/schedules", ctrl.Schedules)
+					project.POST("/schedules", ctrl.CreateSchedule)
 				}
 			}
 
@@ -175,8 +228,10 @@ func Route(r *gin.Engine) {
 					inventory.GET("/groups", ctrl.Groups)
 					inventory.GET("/activity_stream", ctrl.ActivityStream)
 					inventory.GET("/object_roles", ctrl.ObjectRoles)
-					inventory.GET("/tree", ctrl.Tree)                   //TODO: implement
-					inventory.GET("/inventory_sources", notImplemented) //TODO: implement
+					inventory.GET("/ad_hoc_commands", ctrl.AdHocCommands)
+					inventory.POST("/ad_hoc_commands", ctrl.CreateAdHocCommand)
+					inventory.GET("/tree", ctrl.Tree) //TODO: implement
+					inventory.GET("/inventory_sources", ctrl.InventorySources)
 				}
 			}
 
@@ -194,9 +249,9 @@ func Route(r *gin.Engine) {
 					host.GET("/variable_data", ctrl.VariableData)
 					host.GET("/groups", ctrl.Groups)
 					host.GET("/all_groups", ctrl.AllGroups)
-					host.GET("/job_host_summaries", notImplemented) //TODO: implement
-					host.GET("/job_events", notImplemented)         //TODO: implement
-					host.GET("/inventory_sources", notImplemented)  //TODO: implement
+					host.GET("/job_host_summaries", ctrl.JobHostSummaries)
+					host.GET("/job_events", ctrl.JobEvents)
+					host.GET("/inventory_sources", ctrl.InventorySources)
 				}
 			}
 
@@ -217,7 +272,7 @@ func Route(r *gin.Engine) {
 					group.GET("/all_hosts", notImplemented)          //TODO: implement
 					group.GET("/hosts", notImplemented)              //TODO: implement
 					group.GET("/children", notImplemented)           //TODO: implement
-					group.GET("/job_host_summaries", notImplemented) //TODO: implement
+					group.GET("/job_host_summaries", ctrl.JobHostSummaries)
 				}
 			}
 
@@ -236,11 +291,20 @@ func Route(r *gin.Engine) {
 					template.GET("/access_list", ctrl.AccessList)
 					template.GET("/launch", ctrl.LaunchInfo)
 					template.POST("/launch", ctrl.Launch)
+					template.GET("/survey_spec", ctrl.SurveySpec)
+					template.POST("/survey_spec", ctrl.CreateSurveySpec)
+					template.DELETE("/survey_spec", ctrl.DeleteSurveySpec)
 					template.GET("/activity_stream", ctrl.ActivityStream)
-					template.GET("/schedules", notImplemented)                      //TODO: implement
-					template.GET("/notification_templates_error", notImplemented)   //TODO: implement
-					template.GET("/notification_templates_success", notImplemented) //TODO: implement
-					template.GET("/notification_templates_any", notImplemented)     //TODO: implement
+					template.GET("/schedules", ctrl.Schedules)
+					template.POST("/schedules", ctrl.CreateSchedule)
+					template.GET("/notification_templates_started", ctrl.AttachedNotificationTemplates(common.NotificationEventStarted))
+					template.POST("/notification_templates_started", ctrl.AttachNotificationTemplate(common.NotificationEventStarted))
+					template.GET("/notification_templates_success", ctrl.AttachedNotificationTemplates(common.NotificationEventSuccess))
+					template.POST("/notification_templates_success", ctrl.AttachNotificationTemplate(common.NotificationEventSuccess))
+					template.GET("/notification_templates_error", ctrl.AttachedNotificationTemplates(common.NotificationEventError))
+					template.POST("/notification_templates_error", ctrl.AttachNotificationTemplate(common.NotificationEventError))
+					template.GET("/notification_templates_any", ctrl.AttachedNotificationTemplates(common.NotificationEventAny))
+					template.POST("/notification_templates_any", ctrl.AttachNotificationTemplate(common.NotificationEventAny))
 				}
 			}
 
@@ -251,19 +315,34 @@ func Route(r *gin.Engine) {
 				job := ansibleJobs.Group("/:job_id", ctrl.Middleware)
 				{
 					job.GET("", ctrl.One)
-					job.GET("/cancel", ctrl.CancelInfo) //TODO: implement
-					job.POST("/cancel", ctrl.Cancel)    //TODO: implement
+					job.GET("/cancel", ctrl.CancelInfo)
+					job.POST("/cancel", ctrl.Cancel)
 					job.GET("/stdout", ctrl.StdOut)
-					job.GET("/job_tasks", notImplemented)       //TODO: implement
-					job.GET("/job_plays", notImplemented)       //TODO: implement
-					job.GET("/job_events", notImplemented)      //TODO: implement
-					job.GET("/notifications", notImplemented)   //TODO: implement
+					job.GET("/stdout/stream", ctrl.StdOutStream)
+					job.GET("/job_tasks", ctrl.JobTasks)
+					job.GET("/job_plays", ctrl.JobPlays)
+					job.GET("/job_events", ctrl.JobEvents)
+					job.POST("/job_events", ctrl.AddJobEvent)
+					job.GET("/job_host_summaries", ctrl.JobHostSummaries)
+					job.GET("/notifications", ctrl.Notifications)
 					job.GET("/activity_stream", notImplemented) //TODO: implement
 					job.GET("/start", notImplemented)           //TODO: implement
 					job.GET("/relaunch", notImplemented)        //TODO: implement
 				}
 			}
 
+			schedules := v1.Group("/schedules")
+			{
+				ctrl := new(ScheduleController)
+				schedules.GET("", ctrl.All)
+				schedule := schedules.Group("/:schedule_id", ctrl.Middleware)
+				{
+					schedule.GET("", ctrl.One)
+					schedule.PUT("", ctrl.Update)
+					schedule.DELETE("", ctrl.Delete)
+				}
+			}
+
 			terraformTemplate := v1.Group("/terraform_job_templates")
 			{
 				ctrl := new(TJobTmplController)
@@ -278,12 +357,26 @@ func Route(r *gin.Engine) {
 					template.GET("/access_list", ctrl.AccessList)
 					template.GET("/launch", ctrl.LaunchInfo)
 					template.POST("/launch", ctrl.Launch)
+					template.GET("/survey_spec", ctrl.SurveySpec)
+					template.POST("/survey_spec", ctrl.CreateSurveySpec)
+					template.DELETE("/survey_spec", ctrl.DeleteSurveySpec)
+					template.GET("/state", ctrl.State)
+					template.GET("/state_versions", ctrl.StateVersions)
+					template.GET("/outputs", ctrl.Outputs)
+					template.GET("/state_lock", ctrl.StateLock)
+					template.DELETE("/state_lock", ctrl.ForceUnlockState)
 					template.GET("/activity_stream", ctrl.ActivityStream)
 					template.GET("/object_roles", ctrl.ObjectRoles)
-					template.GET("/schedules", notImplemented)                      //TODO: implement
-					template.GET("/notification_templates_error", notImplemented)   //TODO: implement
-					template.GET("/notification_templates_success", notImplemented) //TODO: implement
-					template.GET("/notification_templates_any", notImplemented)     //TODO: implement
+					template.GET("/schedules", ctrl.Schedules)
+					template.POST("/schedules", ctrl.CreateSchedule)
+					template.GET("/notification_templates_started", ctrl.AttachedNotificationTemplates(common.NotificationEventStarted))
+					template.POST("/notification_templates_started", ctrl.AttachNotificationTemplate(common.NotificationEventStarted))
+					template.GET("/notification_templates_success", ctrl.AttachedNotificationTemplates(common.NotificationEventSuccess))
+					template.POST("/notification_templates_success", ctrl.AttachNotificationTemplate(common.NotificationEventSuccess))
+					template.GET("/notification_templates_error", ctrl.AttachedNotificationTemplates(common.NotificationEventError))
+					template.POST("/notification_templates_error", ctrl.AttachNotificationTemplate(common.NotificationEventError))
+					template.GET("/notification_templates_any", ctrl.AttachedNotificationTemplates(common.NotificationEventAny))
+					template.POST("/notification_templates_any", ctrl.AttachNotificationTemplate(common.NotificationEventAny))
 				}
 			}
 
@@ -296,13 +389,142 @@ func Route(r *gin.Engine) {
 					job.GET("", ctrl.One)
 					job.GET("/cancel", ctrl.CancelInfo)
 					job.POST("/cancel", ctrl.Cancel)
+					job.GET("/apply", ctrl.ApplyInfo)
+					job.POST("/apply", ctrl.Apply)
+					job.GET("/outputs", ctrl.Outputs)
 					job.GET("/stdout", ctrl.StdOut)
-					job.GET("/notifications", notImplemented)   //TODO: implement
+					job.GET("/stdout/stream", ctrl.StdOutStream)
+					job.GET("/notifications", ctrl.Notifications)
 					job.GET("/activity_stream", notImplemented) //TODO: implement
 					job.GET("/start", notImplemented)           //TODO: implement
 					job.GET("/relaunch", notImplemented)        //TODO: implement
 				}
 			}
+
+			workflowTemplates := v1.Group("/workflow_job_templates")
+			{
+				ctrl := new(WorkflowJobTemplateController)
+				workflowTemplates.GET("", ctrl.All)
+				workflowTemplates.POST("", ctrl.Create)
+				template := workflowTemplates.Group("/:workflow_job_template_id", ctrl.Middleware)
+				{
+					template.GET("", ctrl.One)
+					template.PUT("", ctrl.Update)
+					template.DELETE("", ctrl.Delete)
+					template.GET("/launch", ctrl.LaunchInfo)
+					template.POST("/launch", ctrl.Launch)
+					template.GET("/workflow_jobs", ctrl.WorkflowJobs)
+				}
+			}
+
+			workflowJobs := v1.Group("/workflow_jobs")
+			{
+				ctrl := new(WorkflowJobController)
+				workflowJobs.GET("", ctrl.All)
+				job := workflowJobs.Group("/:workflow_job_id", ctrl.Middleware)
+				{
+					job.GET("", ctrl.One)
+					job.DELETE("", ctrl.Delete)
+					job.GET("/cancel", ctrl.CancelInfo)
+					job.POST("/cancel", ctrl.Cancel)
+				}
+			}
+
+			adHocCommands := v1.Group("/ad_hoc_commands")
+			{
+				ctrl := new(AdHocCommandController)
+				adHocCommands.GET("", ctrl.All)
+				adHocCommands.POST("", ctrl.Create)
+				command := adHocCommands.Group("/:ad_hoc_command_id", ctrl.Middleware)
+				{
+					command.GET("", ctrl.One)
+					command.DELETE("", ctrl.Delete)
+					command.GET("/cancel", ctrl.CancelInfo)
+					command.POST("/cancel", ctrl.Cancel)
+					command.GET("/stdout", ctrl.StdOut)
+					command.GET("/stdout/stream", ctrl.StdOutStream)
+					command.GET("/events", ctrl.Events)
+					command.POST("/events", ctrl.AddEvent)
+				}
+			}
+
+			notificationTemplates := v1.Group("/notification_templates")
+			{
+				ctrl := new(NotificationTemplateController)
+				notificationTemplates.GET("", ctrl.All)
+				notificationTemplates.POST("", ctrl.Create)
+				template := notificationTemplates.Group("/:notification_template_id", ctrl.Middleware)
+				{
+					template.GET("", ctrl.One)
+					template.PUT("", ctrl.Update)
+					template.DELETE("", ctrl.Delete)
+					template.GET("/notifications", ctrl.Notifications)
+				}
+			}
+
+			notifications := v1.Group("/notifications")
+			{
+				ctrl := new(NotificationController)
+				notifications.GET("", ctrl.All)
+				notification := notifications.Group("/:notification_id", ctrl.Middleware)
+				{
+					notification.GET("", ctrl.One)
+				}
+			}
+
+			inventoryScripts := v1.Group("/inventory_scripts")
+			{
+				ctrl := new(InventoryScriptController)
+				inventoryScripts.GET("", ctrl.All)
+				inventoryScripts.POST("", ctrl.Create)
+				script := inventoryScripts.Group("/:inventory_script_id", ctrl.Middleware)
+				{
+					script.GET("", ctrl.One)
+					script.PUT("", ctrl.Update)
+					script.DELETE("", ctrl.Delete)
+				}
+			}
+
+			inventorySources := v1.Group("/inventory_sources")
+			{
+				ctrl := new(InventorySourceController)
+				inventorySources.GET("", ctrl.All)
+				inventorySources.POST("", ctrl.Create)
+				source := inventorySources.Group("/:inventory_source_id", ctrl.Middleware)
+				{
+					source.GET("", ctrl.One)
+					source.PUT("", ctrl.Update)
+					source.DELETE("", ctrl.Delete)
+					source.GET("/update", ctrl.UpdateInfo)
+					source.POST("/update", ctrl.LaunchUpdate)
+					source.GET("/inventory_updates", ctrl.InventoryUpdates)
+				}
+			}
+
+			instances := v1.Group("/instances")
+			{
+				ctrl := new(InstanceController)
+				instances.GET("", ctrl.All)
+				instance := instances.Group("/:instance_id", ctrl.Middleware)
+				{
+					instance.GET("", ctrl.One)
+				}
+			}
+
+			inventoryUpdates := v1.Group("/inventory_updates")
+			{
+				ctrl := new(InventoryUpdateController)
+				inventoryUpdates.GET("", ctrl.All)
+				update := inventoryUpdates.Group("/:inventory_update_id", ctrl.Middleware)
+				{
+					update.GET("", ctrl.One)
+					update.DELETE("", ctrl.Delete)
+					update.GET("/cancel", ctrl.CancelInfo)
+					update.POST("/cancel", ctrl.Cancel)
+					update.GET("/stdout", ctrl.StdOut)
+					update.GET("/stdout/stream", ctrl.StdOutStream)
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/scheduler"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for schedule related items stored in the Gin Context
+const (
+	cSchedule   = "schedule"
+	cScheduleID = "schedule_id"
+)
+
+type ScheduleController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes cScheduleID from Gin Context and retrieves schedule data from the collection
+// and store schedule data under key cSchedule in Gin Context.
+// Permissions of a schedule are the permissions of its template
+func (ctrl ScheduleController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cScheduleID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Schedule does not exist"})
+		return
+	}
+
+	var schedule common.Schedule
+	if err := db.Schedules().FindId(bson.ObjectIdHex(objectID)).One(&schedule); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Schedule does not exist",
+			Log: logrus.Fields{
+				"Schedule ID": objectID,
+				"Error":       err.Error(),
+			},
+		})
+		return
+	}
+
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !scheduleAccess(user, schedule, false) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "DELETE":
+		{
+			// Reject the request if the user doesn't have write permissions
+			if !scheduleAccess(user, schedule, true) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cSchedule, schedule)
+	c.Next()
+}
+
+// One returns the schedule as a JSON object
+func (ctrl ScheduleController) One(c *gin.Context) {
+	schedule := c.MustGet(cSchedule).(common.Schedule)
+	metadata.ScheduleMetadata(&schedule)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// All returns all schedules the user has read access to.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl ScheduleController) All(c *gin.Context) {
+	listSchedules(c, bson.M{})
+}
+
+// Update updates the schedule and calculates its next run
+func (ctrl ScheduleController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	schedule := c.MustGet(cSchedule).(common.Schedule)
+	tmpSchedule := schedule
+
+	var req common.Schedule
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	schedule.Name = strings.Trim(req.Name, " ")
+	schedule.Description = strings.Trim(req.Description, " ")
+	schedule.Enabled = req.Enabled
+	schedule.RRule = strings.TrimSpace(req.RRule)
+	schedule.Cron = strings.TrimSpace(req.Cron)
+	schedule.Timezone = req.Timezone
+	schedule.DtStart = req.DtStart
+	schedule.DtEnd = req.DtEnd
+	schedule.ExtraData = req.ExtraData
+	schedule.ModifiedByID = user.ID
+	schedule.Modified = time.Now()
+
+	if err := scheduler.Validate(schedule); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	schedule.NextRun = nil
+	if next, ok := scheduler.NextRun(schedule, time.Now()); ok {
+		schedule.NextRun = &next
+	}
+
+	if err := db.Schedules().UpdateId(schedule.ID, schedule); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Schedule",
+			Log:     logrus.Fields{"Schedule ID": schedule.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	scheduler.UpdateTemplate(schedule.TemplateID, schedule.TemplateType)
+
+	activity.AddActivity(activity.Update, user.ID, tmpSchedule, schedule)
+	metadata.ScheduleMetadata(&schedule)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// Delete removes the schedule
+func (ctrl ScheduleController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	schedule := c.MustGet(cSchedule).(common.Schedule)
+
+	if err := db.Schedules().RemoveId(schedule.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while deleting Schedule",
+			Log:     logrus.Fields{"Schedule ID": schedule.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	scheduler.UpdateTemplate(schedule.TemplateID, schedule.TemplateType)
+
+	activity.AddActivity(activity.Delete, user.ID, schedule, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// Schedules returns the schedules of the job template
+func (ctrl JobTemplateController) Schedules(c *gin.Context) {
+	template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+	listSchedules(c, bson.M{"template_id": template.ID})
+}
+
+// CreateSchedule creates a new schedule for the job template
+func (ctrl JobTemplateController) CreateSchedule(c *gin.Context) {
+	template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.JobTemplate).Write(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	createSchedule(c, template.ID, common.ScheduleJobTemplate)
+}
+
+// Schedules returns the schedules of the terraform job template
+func (ctrl TJobTmplController) Schedules(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	listSchedules(c, bson.M{"template_id": template.ID})
+}
+
+// CreateSchedule creates a new schedule for the terraform job template
+func (ctrl TJobTmplController) CreateSchedule(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.TerraformJobTemplate).Write(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	createSchedule(c, template.ID, common.ScheduleTerraformJobTemplate)
+}
+
+// Schedules returns the schedules of the project
+func (ctrl ProjectController) Schedules(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+	listSchedules(c, bson.M{"template_id": project.ID})
+}
+
+// CreateSchedule creates a new schedule for project updates
+func (ctrl ProjectController) CreateSchedule(c *gin.Context) {
+	project := c.MustGet(cProject).(common.Project)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.Project).Write(user, project) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	createSchedule(c, project.ID, common.ScheduleProject)
+}
+
+// createSchedule creates a schedule for the given template using request payload
+func createSchedule(c *gin.Context, templateID bson.ObjectId, templateType string) {
+	user := c.MustGet(cUser).(common.User)
+
+	// schedules are enabled unless requested otherwise
+	req := common.Schedule{Enabled: true}
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+	req.RRule = strings.TrimSpace(req.RRule)
+	req.Cron = strings.TrimSpace(req.Cron)
+	req.TemplateID = templateID
+	req.TemplateType = templateType
+	req.CreatedByID = user.ID
+	req.ModifiedByID = user.ID
+	req.Created = time.Now()
+	req.Modified = time.Now()
+	if req.DtStart.IsZero() {
+		req.DtStart = req.Created
+	}
+
+	if err := scheduler.Validate(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	if next, ok := scheduler.NextRun(req, time.Now()); ok {
+		req.NextRun = &next
+	}
+
+	if err := db.Schedules().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Schedule",
+			Log:     logrus.Fields{"Schedule ID": req.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	scheduler.UpdateTemplate(templateID, templateType)
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.ScheduleMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// listSchedules writes a paginated list of the schedules matching the given query
+// which the user has read access to
+func listSchedules(c *gin.Context, match bson.M) {
+	user := c.MustGet(cUser).(common.User)
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"template_type"}, match)
+	match = parser.Lookups([]string{"name", "description"}, match)
+	match = matchBool(c, []string{"enabled"}, match)
+	query := db.Schedules().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	var schedules []common.Schedule
+	iter := query.Iter()
+	var tmpSchedule common.Schedule
+	for iter.Next(&tmpSchedule) {
+		if !scheduleAccess(user, tmpSchedule, false) {
+			continue
+		}
+		metadata.ScheduleMetadata(&tmpSchedule)
+		schedules = append(schedules, tmpSchedule)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Schedules",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(schedules)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     schedules[pgi.Skip():pgi.End()],
+	})
+}
+
+// scheduleAccess checks the read or write permission of the user
+// on the template of the schedule
+func scheduleAccess(user common.User, s common.Schedule, write bool) bool {
+	switch s.TemplateType {
+	case common.ScheduleJobTemplate:
+		roles := new(rbac.JobTemplate)
+		if write {
+			return roles.WriteByID(user, s.TemplateID)
+		}
+		return roles.ReadByID(user, s.TemplateID)
+	case common.ScheduleTerraformJobTemplate:
+		roles := new(rbac.TerraformJobTemplate)
+		if write {
+			return roles.WriteByID(user, s.TemplateID)
+		}
+		return roles.ReadByID(user, s.TemplateID)
+	case common.ScheduleProject:
+		var project common.Project
+		if err := db.Projects().FindId(s.TemplateID).One(&project); err != nil {
+			return false
+		}
+		roles := new(rbac.Project)
+		if write {
+			return roles.Write(user, project)
+		}
+		return roles.Read(user, project)
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/jwt"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for session related items stored in the Gin Context
+const (
+	cSession   = "session"
+	cSessionID = "session_id"
+)
+
+// SessionController manages the login sessions of the logged in user
+type SessionController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes session_id parameter from Gin Context and retrieves the session
+// of the logged in user and store it under key session in Gin Context
+func (ctrl SessionController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cSessionID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Session does not exist"})
+		return
+	}
+
+	var session common.Session
+	if err := db.Sessions().Find(bson.M{
+		"_id":     bson.ObjectIdHex(objectID),
+		"user_id": user.ID,
+	}).One(&session); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Session does not exist",
+			Log: logrus.Fields{
+				"Session ID": objectID,
+				"Error":      err.Error(),
+			},
+		})
+		return
+	}
+
+	c.Set(cSession, session)
+	c.Next()
+}
+
+// One returns the session as a JSON object
+func (ctrl SessionController) One(c *gin.Context) {
+	session := c.MustGet(cSession).(common.Session)
+	current, _ := jwt.SessionID(c)
+	session.Current = session.ID == current
+	metadata.SessionMetadata(&session)
+	c.JSON(http.StatusOK, session)
+}
+
+// All returns the active sessions of the logged in user
+func (ctrl SessionController) All(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	current, _ := jwt.SessionID(c)
+
+	parser := util.NewQueryParser(c)
+	query := db.Sessions().Find(bson.M{"user_id": user.ID})
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	} else {
+		query.Sort("-created")
+	}
+
+	var sessions []common.Session
+	if err := query.All(&sessions); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Sessions",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+		metadata.SessionMetadata(&sessions[i])
+	}
+
+	count := len(sessions)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     sessions[pgi.Skip():pgi.End()],
+	})
+}
+
+// Delete terminates the session, its tokens are refused right away
+func (ctrl SessionController) Delete(c *gin.Context) {
+	session := c.MustGet(cSession).(common.Session)
+	ctrl.revoke(c, session)
+}
+
+// Logout terminates the session the request is made within
+func (ctrl SessionController) Logout(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	id, ok := jwt.SessionID(c)
+	if !ok {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Only a login session can be logged out.",
+		})
+		return
+	}
+
+	var session common.Session
+	if err := db.Sessions().Find(bson.M{"_id": id, "user_id": user.ID}).One(&session); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Session does not exist",
+			Log: logrus.Fields{
+				"Session ID": id.Hex(),
+				"Error":      err.Error(),
+			},
+		})
+		return
+	}
+
+	ctrl.revoke(c, session)
+}
+
+func (ctrl SessionController) revoke(c *gin.Context, session common.Session) {
+	if err := jwt.RevokeSession(session); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while revoking Session",
+			Log:     logrus.Fields{"Session ID": session.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusNoContent)
+}
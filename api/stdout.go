@@ -0,0 +1,105 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// stdoutPollInterval is the interval between two reads of the
+// output of a streamed job
+const stdoutPollInterval = time.Second
+
+// jobStdout returns the output of the job, result_stdout holds the output
+// of the jobs which have no stored output such as the jobs canceled before
+// they were started
+func jobStdout(jobID bson.ObjectId, resultStdout string) (string, error) {
+	out, end, err := common.ReadStdout(jobID, 0)
+	if err != nil {
+		return "", err
+	}
+	if end == 0 {
+		return resultStdout, nil
+	}
+	return out, nil
+}
+
+// streamStdout streams the output of the job stored in the given
+// collection as Server-Sent Events.
+// Streaming starts at the byte offset given by the offset query parameter.
+// Each "stdout" event carries the new output and the offset of the next
+// byte, the stream is closed with an "end" event when the job is finished
+func streamStdout(c *gin.Context, col *mgo.Collection, jobID bson.ObjectId) {
+	offset := 0
+	if o := c.Query("offset"); o != "" {
+		var err error
+		if offset, err = strconv.Atoi(o); err != nil || offset < 0 {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Invalid offset",
+			})
+			return
+		}
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	first := true
+	c.Stream(func(w io.Writer) bool {
+		if !first {
+			time.Sleep(stdoutPollInterval)
+		}
+		first = false
+
+		var job struct {
+			Status       string `bson:"status"`
+			ResultStdout string `bson:"result_stdout"`
+		}
+		if err := col.FindId(jobID).Select(bson.M{"status": 1, "result_stdout": 1}).One(&job); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": jobID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Error while retriving job output")
+			c.SSEvent("error", gin.H{"message": "Error while retriving job output"})
+			return false
+		}
+
+		out, end, err := common.ReadStdout(jobID, offset)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": jobID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Error while retriving job output")
+			c.SSEvent("error", gin.H{"message": "Error while retriving job output"})
+			return false
+		}
+
+		// a finished job without stored output has its output in result_stdout
+		if blocking.IsFinished(job.Status) && end == offset && !common.HasStdout(jobID) &&
+			len(job.ResultStdout) > offset {
+			out, end = job.ResultStdout[offset:], len(job.ResultStdout)
+		}
+
+		if end > offset {
+			c.SSEvent("stdout", gin.H{
+				"offset":  end,
+				"content": out,
+			})
+			offset = end
+		}
+
+		if blocking.IsFinished(job.Status) {
+			c.SSEvent("end", gin.H{"offset": offset, "status": job.Status})
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/launch"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SurveySpec returns the survey of the job template,
+// password defaults are masked
+func (ctrl JobTemplateController) SurveySpec(c *gin.Context) {
+	template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+	c.JSON(http.StatusOK, hideSurveyPasswords(template.SurveySpec))
+}
+
+// CreateSurveySpec validates and stores the survey of the job template,
+// an existing survey is replaced
+func (ctrl JobTemplateController) CreateSurveySpec(c *gin.Context) {
+	template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.JobTemplate).Write(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	spec, ok := bindSurveySpec(c, template.SurveySpec)
+	if !ok {
+		return
+	}
+
+	if err := db.JobTemplates().UpdateId(template.ID, bson.M{"$set": bson.M{"survey_spec": spec}}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating job template survey",
+			Log:     logrus.Fields{"Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	updated := template
+	updated.SurveySpec = &spec
+	activity.AddActivity(activity.Update, user.ID, template, updated)
+	c.JSON(http.StatusOK, hideSurveyPasswords(&spec))
+}
+
+// DeleteSurveySpec removes the survey of the job template
+func (ctrl JobTemplateController) DeleteSurveySpec(c *gin.Context) {
+	template := c.MustGet(cJobTemplate).(ansible.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if err := db.JobTemplates().UpdateId(template.ID, bson.M{"$unset": bson.M{"survey_spec": ""}}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while deleting job template survey",
+			Log:     logrus.Fields{"Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	updated := template
+	updated.SurveySpec = nil
+	activity.AddActivity(activity.Update, user.ID, template, updated)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// SurveySpec returns the survey of the terraform job template,
+// password defaults are masked
+func (ctrl TJobTmplController) SurveySpec(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	c.JSON(http.StatusOK, hideSurveyPasswords(template.SurveySpec))
+}
+
+// CreateSurveySpec validates and stores the survey of the terraform job template,
+// an existing survey is replaced
+func (ctrl TJobTmplController) CreateSurveySpec(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.TerraformJobTemplate).Write(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	spec, ok := bindSurveySpec(c, template.SurveySpec)
+	if !ok {
+		return
+	}
+
+	if err := db.TerrafromJobTemplates().UpdateId(template.ID, bson.M{"$set": bson.M{"survey_spec": spec}}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating terraform job template survey",
+			Log:     logrus.Fields{"Terraform Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	updated := template
+	updated.SurveySpec = &spec
+	activity.AddActivity(activity.Update, user.ID, template, updated)
+	c.JSON(http.StatusOK, hideSurveyPasswords(&spec))
+}
+
+// DeleteSurveySpec removes the survey of the terraform job template
+func (ctrl TJobTmplController) DeleteSurveySpec(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if err := db.TerrafromJobTemplates().UpdateId(template.ID, bson.M{"$unset": bson.M{"survey_spec": ""}}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while deleting terraform job template survey",
+			Log:     logrus.Fields{"Terraform Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	updated := template
+	updated.SurveySpec = nil
+	activity.AddActivity(activity.Update, user.ID, template, updated)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// bindSurveySpec binds and validates the survey in the request body.
+// Password defaults are encrypted, a $encrypted$ default keeps the
+// default of the current survey. If the survey is invalid the request is aborted
+func bindSurveySpec(c *gin.Context, current *common.SurveySpec) (common.SurveySpec, bool) {
+	var req common.SurveySpec
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return req, false
+	}
+
+	for i, q := range req.Spec {
+		if q.Type != common.SurveyTypePassword || q.Default == nil {
+			continue
+		}
+
+		def, ok := q.Default.(string)
+		if !ok {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Invalid default of survey variable " + q.Variable + ": must be a string",
+			})
+			return req, false
+		}
+
+		if def == "$encrypted$" {
+			req.Spec[i].Default = currentSurveyDefault(current, q.Variable)
+			continue
+		}
+		// validate the plain text default before it is encrypted
+		q.Type = common.SurveyTypeText
+		if err := launch.ValidateSurvey(common.SurveySpec{Spec: []common.SurveyQuestion{q}}); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: err.Error(),
+			})
+			return req, false
+		}
+		req.Spec[i].Default = util.Cipher(def)
+	}
+
+	if err := launch.ValidateSurvey(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return req, false
+	}
+
+	return req, true
+}
+
+// currentSurveyDefault returns the default of the variable in the survey
+func currentSurveyDefault(spec *common.SurveySpec, variable string) interface{} {
+	if spec == nil {
+		return nil
+	}
+	for _, q := range spec.Spec {
+		if q.Variable == variable {
+			return q.Default
+		}
+	}
+	return nil
+}
+
+// hideSurveyPasswords returns a copy of the survey
+// with masked password defaults
+func hideSurveyPasswords(spec *common.SurveySpec) common.SurveySpec {
+	if spec == nil {
+		return common.SurveySpec{Spec: []common.SurveyQuestion{}}
+	}
+
+	hidden := *spec
+	hidden.Spec = make([]common.SurveyQuestion, len(spec.Spec))
+	for i, q := range spec.Spec {
+		if q.Type == common.SurveyTypePassword && q.Default != nil && q.Default != "" {
+			q.Default = "$encrypted$"
+		}
+		hidden.Spec[i] = q
+	}
+	return hidden
+}
+
+// surveyVariablesNeeded returns the names of the required survey
+// variables without a default
+func surveyVariablesNeeded(enabled bool, spec *common.SurveySpec) []string {
+	variables := []string{}
+	if !enabled || spec == nil {
+		return variables
+	}
+	for _, q := range spec.Spec {
+		if q.Required && (q.Default == nil || q.Default == "") {
+			variables = append(variables, q.Variable)
+		}
+	}
+	return variables
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"io"
 	"net/http"
 	"strconv"
@@ -10,18 +9,13 @@ import (
 
 	"github.com/pearsonappeng/tensor/api/metadata"
 	"github.com/pearsonappeng/tensor/db"
-	"github.com/pearsonappeng/tensor/jwt"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
 
-	"os"
-
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
-	"github.com/pearsonappeng/tensor/exec/sync"
-	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/exec/launch"
 	"github.com/pearsonappeng/tensor/log/activity"
-	"github.com/pearsonappeng/tensor/queue"
 	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
 	"github.com/pearsonappeng/tensor/validate"
@@ -473,6 +467,7 @@ func (ctrl JobTemplateController) Update(c *gin.Context) {
 	jobTemplate.PromptTags = req.PromptTags
 	jobTemplate.PromptSkipTags = req.PromptSkipTags
 	jobTemplate.AllowSimultaneous = req.AllowSimultaneous
+	jobTemplate.SurveyEnabled = req.SurveyEnabled
 	jobTemplate.PolymorphicCtypeID = req.PolymorphicCtypeID
 	jobTemplate.Modified = time.Now()
 	jobTemplate.ModifiedByID = user.ID
@@ -616,6 +611,7 @@ func (ctrl JobTemplateController) Jobs(c *gin.Context) {
 // be passed via POST data, with extra_vars given as a JSON string.
 // If `credential_needed_to_start` is `true` then the `credential` field is required
 // and if the `inventory_needed_to_start` is `True` then the `inventory` is required as well.
+// If the survey is enabled the answers are passed in extra_vars and validated against the survey.
 // success returns JSON serialized Job model with 201 status code
 // if the request body is invalid returns JSON serialized Error model with 400 status code
 func (ctrl JobTemplateController) Launch(c *gin.Context) {
@@ -631,43 +627,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 	}
 
 	// create new Job
-	job := ansible.Job{
-		ID:                  bson.NewObjectId(),
-		Name:                template.Name,
-		Description:         template.Description,
-		LaunchType:          "manual",
-		CancelFlag:          false,
-		Status:              "new",
-		JobType:             ansible.JOBTYPE_ANSIBLE_JOB,
-		Playbook:            template.Playbook,
-		Forks:               template.Forks,
-		Limit:               template.Limit,
-		Verbosity:           template.Verbosity,
-		ExtraVars:           template.ExtraVars,
-		JobTags:             template.JobTags,
-		SkipTags:            template.SkipTags,
-		ForceHandlers:       template.ForceHandlers,
-		StartAtTask:         template.StartAtTask,
-		MachineCredentialID: template.MachineCredentialID,
-		InventoryID:         template.InventoryID,
-		JobTemplateID:       template.ID,
-		ProjectID:           template.ProjectID,
-		BecomeEnabled:       template.BecomeEnabled,
-		NetworkCredentialID: template.NetworkCredentialID,
-		CloudCredentialID:   template.CloudCredentialID,
-		SCMCredentialID:     nil,
-		CreatedByID:         user.ID,
-		ModifiedByID:        user.ID,
-		Created:             time.Now(),
-		Modified:            time.Now(),
-		PromptCredential:    template.PromptCredential,
-		PromptInventory:     template.PromptInventory,
-		PromptJobType:       template.PromptJobType,
-		PromptLimit:         template.PromptLimit,
-		PromptTags:          template.PromptTags,
-		PromptVariables:     template.PromptVariables,
-		AllowSimultaneous:   template.AllowSimultaneous,
-	}
+	job := launch.NewAnsibleJob(template, user, ansible.JOB_LAUNCH_TYPE_MANUAL)
 
 	// if prompt is true override Job template
 	// if not provided return an error message
@@ -726,15 +686,8 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 		job.JobType = req.JobType
 	}
 
-	// create new Ansible runner Job
-	runnerJob := types.AnsibleJob{
-		Job:      job,
-		Template: template,
-		User:     user,
-	}
-
 	if template.PromptInventory {
-		if len(req.InventoryID) != 24 {
+		if !req.InventoryID.Valid() {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Inventory required.",
 			})
@@ -744,7 +697,7 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 	}
 
 	if template.PromptCredential {
-		if len(req.MachineCredentialID) != 24 {
+		if !req.MachineCredentialID.Valid() {
 			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
 				Message: "Credential required.",
 			})
@@ -753,112 +706,15 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 		job.MachineCredentialID = &req.MachineCredentialID
 	}
 
-	if job.NetworkCredentialID != nil {
-		var credential common.Credential
-		if err := db.Credentials().FindId(*job.NetworkCredentialID).One(&credential); err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while getting network credential",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-		runnerJob.Network = credential
-	}
-
-	if job.CloudCredentialID != nil {
-		var credential common.Credential
-		err := db.Credentials().FindId(*job.CloudCredentialID).One(&credential)
-		if err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while getting cloud credential",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-		runnerJob.Cloud = credential
-	}
-
-	var inventory ansible.Inventory
-	if err := db.Inventories().FindId(job.InventoryID).One(&inventory); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting inventory",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-	runnerJob.Inventory = inventory
-
-	if job.MachineCredentialID != nil {
-		var credential common.Credential
-		if err := db.Credentials().FindId(*job.MachineCredentialID).One(&credential); err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while getting machine credential",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-		runnerJob.Machine = credential
-	}
-
-	// get project information
-	var project common.Project
-	if err := db.Projects().FindId(job.ProjectID).One(&project); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting project",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-	runnerJob.Project = project
-
-	// Get jwt token for authorize Ansible inventory plugin
-	var token jwt.LocalToken
-	if err := jwt.NewAuthToken(&token); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting token",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-	runnerJob.Token = token.Token
-
-	// Insert new job into jobs collection
-	if err := db.Jobs().Insert(job); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while creating job",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-
-	// update if requested
-	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) || runnerJob.Project.ScmUpdateOnLaunch {
-		tj, err := sync.UpdateProject(project)
-		runnerJob.PreviousJob = tj
-		if err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while creating update job",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-	}
-
-	jobBytes, err := json.Marshal(runnerJob)
-	if err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
-			Message: "Error while encoding the job",
-			Log:     logrus.Fields{"Error": err.Error()},
+	if err := launch.AnsibleSurvey(&job, template, req.ExtraVars); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// publish bytes to ansible queue
-	if err := queue.Publish(queue.Ansible, jobBytes); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while publishing to Queue",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
+	if err := launch.Ansible(&job, user); err != nil {
+		abortLaunch(c, err)
 		return
 	}
 
@@ -882,6 +738,8 @@ func (ctrl JobTemplateController) Launch(c *gin.Context) {
 // If not then one should be supplied when launching the job
 // inventory_needed_to_start: Flag indicating the presence of an inventory associated with the job template.
 // If not then one should be supplied when launching the job
+// survey_enabled: Flag indicating whether the survey of the job template is answered upon launch
+// survey_spec: The survey questions, defaults of password questions are masked
 func (ctrl JobTemplateController) LaunchInfo(c *gin.Context) {
 	// get template from the gin.Context
 	jt := c.MustGet(cJobTemplate).(ansible.JobTemplate)
@@ -939,9 +797,10 @@ func (ctrl JobTemplateController) LaunchInfo(c *gin.Context) {
 		"ask_limit_on_launch":        jt.PromptInventory,
 		"ask_inventory_on_launch":    jt.PromptInventory,
 		"ask_credential_on_launch":   jt.PromptCredential,
-		"variables_needed_to_start":  []gin.H{},
+		"variables_needed_to_start":  surveyVariablesNeeded(jt.SurveyEnabled, jt.SurveySpec),
 		"credential_needed_to_start": isCredentialNeeded,
 		"inventory_needed_to_start":  isInventoryNeeded,
+		"survey_enabled":             jt.SurveyEnabled,
 		"job_template_data": gin.H{
 			"id":          jt.ID.Hex(),
 			"name":        jt.Name,
@@ -950,6 +809,10 @@ func (ctrl JobTemplateController) LaunchInfo(c *gin.Context) {
 		"defaults": defaults,
 	}
 
+	if jt.SurveyEnabled {
+		resp["survey_spec"] = hideSurveyPasswords(jt.SurveySpec)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -3,9 +3,12 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	metadata "github.com/pearsonappeng/tensor/api/metadata/terraform"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/launch"
+	"github.com/pearsonappeng/tensor/log/activity"
 	"github.com/pearsonappeng/tensor/models/common"
 	"github.com/pearsonappeng/tensor/models/terraform"
 
@@ -13,6 +16,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -136,18 +140,162 @@ func (ctrl TerraformJobController) All(c *gin.Context) {
 // The response will include the following field:
 // can_cancel: [boolean] Indicates whether this job can be canceled
 func (ctrl TerraformJobController) CancelInfo(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"can_cancel": false})
+	job := c.MustGet(cTerraformJob).(terraform.Job)
+
+	c.JSON(http.StatusOK, gin.H{"can_cancel": canCancel(job.Status)})
 }
 
-// Cancel cancels the pending job.
+// Cancel cancels the pending or running job.
 // The response status code will be 202 if successful, or 405 if the job cannot be
 // canceled.
 func (ctrl TerraformJobController) Cancel(c *gin.Context) {
-	c.AbortWithStatus(http.StatusMethodNotAllowed)
+	job := c.MustGet(cTerraformJob).(terraform.Job)
+
+	if !canCancel(job.Status) {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := cancel(db.TerrafromJobs(), job.ID, job.Status); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while canceling Terraform Job",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusAccepted)
 }
 
 // StdOut returns ANSI standard output of a Job
 func (ctrl TerraformJobController) StdOut(c *gin.Context) {
 	job := c.MustGet(cTerraformJob).(terraform.Job)
-	c.JSON(http.StatusOK, job.ResultStdout)
+	out, err := jobStdout(job.ID, job.ResultStdout)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting output",
+			Log:     logrus.Fields{"Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, out)
+}
+
+// StdOutStream streams the standard output of a Terraform Job as Server-Sent
+// Events until the job is finished
+func (ctrl TerraformJobController) StdOutStream(c *gin.Context) {
+	job := c.MustGet(cTerraformJob).(terraform.Job)
+
+	streamStdout(c, db.TerrafromJobs(), job.ID)
+}
+
+// ApplyInfo to determine if the saved plan of the job can be applied.
+// The response will include the following fields:
+// can_apply: [boolean] Indicates whether the plan can be applied
+// reason: [string] Why the plan can not be applied
+func (ctrl TerraformJobController) ApplyInfo(c *gin.Context) {
+	job := c.MustGet(cTerraformJob).(terraform.Job)
+
+	resp := gin.H{"can_apply": true, "applied_job": job.AppliedJobID}
+	if job.AppliedJobID != nil {
+		resp["can_apply"] = false
+		resp["reason"] = "Plan has already been applied"
+	} else if err := job.ValidatePlan(planMaxAge()); err != nil {
+		resp["can_apply"] = false
+		resp["reason"] = err.Error()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Apply approves the saved plan of a plan job and launches an apply job
+// which applies exactly that plan. The plan is rejected if the terraform state
+// changed since the plan was made or if it is older than the configured maximum age.
+// A plan can be applied only once
+func (ctrl TerraformJobController) Apply(c *gin.Context) {
+	plan := c.MustGet(cTerraformJob).(terraform.Job)
+	user := c.MustGet(cUser).(common.User)
+
+	if !plan.HasPlan() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Job has no saved plan",
+		})
+		return
+	}
+
+	if plan.AppliedJobID != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Plan has already been applied",
+		})
+		return
+	}
+
+	if err := plan.ValidatePlan(planMaxAge()); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	template, err := plan.GetJobTemplate()
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting terraform job template",
+			Log:     logrus.Fields{"Terraform Job ID": plan.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	// the apply job runs with the settings the plan was made with
+	job := launch.NewTerraformJob(template, user, terraform.JobLaunchTypeApproval)
+	job.JobType = terraform.JobTypeApply
+	job.Vars = plan.Vars
+	job.SurveyPasswords = plan.SurveyPasswords
+	job.MachineCredentialID = plan.MachineCredentialID
+	job.Directory = plan.Directory
+	job.Workspace = plan.Workspace
+	job.PlanJobID = &plan.ID
+	job.ApprovedByID = &user.ID
+
+	// reserve the plan, concurrent approvals of the same plan are rejected
+	err = db.TerrafromJobs().Update(bson.M{"_id": plan.ID, "applied_job_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"applied_job_id": job.ID}})
+	if err == mgo.ErrNotFound {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Plan has already been applied",
+		})
+		return
+	}
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while approving terraform plan",
+			Log:     logrus.Fields{"Terraform Job ID": plan.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := launch.Terraform(&job, user); err != nil {
+		// release the plan so that the approval can be retried
+		if err := db.TerrafromJobs().UpdateId(plan.ID, bson.M{"$unset": bson.M{"applied_job_id": ""}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Terraform Job ID": plan.ID.Hex(),
+				"Error":            err.Error(),
+			}).Errorln("Error while releasing terraform plan")
+		}
+		abortLaunch(c, err)
+		return
+	}
+
+	applied := plan
+	applied.AppliedJobID = &job.ID
+	activity.AddActivity(activity.Update, user.ID, plan, applied)
+
+	metadata.JobMetadata(&job)
+	c.JSON(http.StatusCreated, job)
+}
+
+// planMaxAge returns the maximum age of a plan that can be applied
+func planMaxAge() time.Duration {
+	return time.Duration(util.Config.TerraformPlanMaxAge) * time.Second
 }
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"gopkg.in/mgo.v2"
+)
+
+// Outputs returns the terraform outputs recorded by the job,
+// values of sensitive outputs are masked
+func (ctrl TerraformJobController) Outputs(c *gin.Context) {
+	job := c.MustGet(cTerraformJob).(terraform.Job)
+	c.JSON(http.StatusOK, terraform.MaskOutputs(job.Outputs))
+}
+
+// Outputs returns the terraform outputs of the latest successful apply job
+// of the terraform job template, values of sensitive outputs are masked
+func (ctrl TJobTmplController) Outputs(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+
+	job, err := terraform.LatestOutputsJob(template.ID)
+	if err == mgo.ErrNotFound {
+		c.JSON(http.StatusOK, gin.H{
+			"terraform_job": nil,
+			"outputs":       gin.H{},
+		})
+		return
+	}
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting terraform outputs",
+			Log:     logrus.Fields{"Terraform Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"terraform_job": job.ID,
+		"finished":      job.Finished,
+		"outputs":       terraform.MaskOutputs(job.Outputs),
+	})
+}
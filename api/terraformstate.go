@@ -0,0 +1,429 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	metadata "github.com/pearsonappeng/tensor/api/metadata/terraform"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for terraform state related items stored in the Gin Context
+const (
+	cStateJob       = "state_job"
+	cStateWorkspace = "workspace"
+)
+
+// TerraformStateController implements the terraform http backend protocol.
+// Terraform jobs authenticate with basic auth, the username is the job ID
+// and the password is the state token of the job
+type TerraformStateController struct{}
+
+// Middleware authenticates the terraform job. Only running jobs of the terraform
+// job template can access the state of the workspace of the job
+func (ctrl TerraformStateController) Middleware(c *gin.Context) {
+	templateID := c.Params.ByName(cTerraformJobTemplateID)
+	workspace := c.Params.ByName(cStateWorkspace)
+
+	username, password, ok := c.Request.BasicAuth()
+	if !ok || !bson.IsObjectIdHex(username) || !bson.IsObjectIdHex(templateID) {
+		c.Header("WWW-Authenticate", `Basic realm="terraform state"`)
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "Invalid terraform state credentials",
+		})
+		return
+	}
+
+	var job terraform.Job
+	if err := db.TerrafromJobs().FindId(bson.ObjectIdHex(username)).One(&job); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "Invalid terraform state credentials",
+			Log:     logrus.Fields{"Terraform Job ID": username, "Error": err.Error()},
+		})
+		return
+	}
+
+	if !util.TokenMatches(password, job.StateTokenHash) || job.Status != "running" ||
+		job.JobTemplateID.Hex() != templateID || terraform.Workspace(job.Workspace) != workspace {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "Invalid terraform state credentials",
+		})
+		return
+	}
+
+	c.Set(cStateJob, job)
+	c.Next()
+}
+
+// State returns the latest version of the state,
+// 204 status code is returned if the workspace has no state
+func (ctrl TerraformStateController) State(c *gin.Context) {
+	job := c.MustGet(cStateJob).(terraform.Job)
+
+	state, err := latestState(job.JobTemplateID, c.Params.ByName(cStateWorkspace))
+	if err == mgo.ErrNotFound {
+		c.AbortWithStatus(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting terraform state",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", []byte(state.State))
+}
+
+// UpdateState stores the state as a new version. If the workspace is locked
+// the lock ID must be passed in the ID query parameter
+func (ctrl TerraformStateController) UpdateState(c *gin.Context) {
+	job := c.MustGet(cStateJob).(terraform.Job)
+	workspace := c.Params.ByName(cStateWorkspace)
+
+	if stateLocked(c, job.JobTemplateID, workspace, c.Query("ID")) {
+		return
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Could not read terraform state",
+		})
+		return
+	}
+
+	var meta struct {
+		Serial  int64  `json:"serial"`
+		Lineage string `json:"lineage"`
+	}
+	if err := json.Unmarshal(body, &meta); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Invalid terraform state",
+		})
+		return
+	}
+
+	version := 1
+	latest, err := latestState(job.JobTemplateID, workspace)
+	if err == nil {
+		version = latest.Version + 1
+	} else if err != mgo.ErrNotFound {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting terraform state",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	state := terraform.State{
+		ID:            bson.NewObjectId(),
+		JobTemplateID: job.JobTemplateID,
+		Workspace:     workspace,
+		Version:       version,
+		Serial:        meta.Serial,
+		Lineage:       meta.Lineage,
+		JobID:         &job.ID,
+		State:         string(body),
+		Created:       time.Now(),
+	}
+
+	// versions are unique, a concurrent update of the same version fails
+	if err := db.TerraformStates().Insert(state); err != nil {
+		status := http.StatusGatewayTimeout
+		if mgo.IsDup(err) {
+			status = http.StatusConflict
+		}
+		AbortWithError(LogFields{Context: c, Status: status,
+			Message: "Error while storing terraform state",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// DeleteState removes all versions of the state of the workspace
+func (ctrl TerraformStateController) DeleteState(c *gin.Context) {
+	job := c.MustGet(cStateJob).(terraform.Job)
+	workspace := c.Params.ByName(cStateWorkspace)
+
+	if stateLocked(c, job.JobTemplateID, workspace, c.Query("ID")) {
+		return
+	}
+
+	if _, err := db.TerraformStates().RemoveAll(bson.M{"job_template_id": job.JobTemplateID, "workspace": workspace}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing terraform state",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// Lock locks the workspace with the lock information in the request body.
+// If the workspace is already locked 423 status code is returned
+// with the information of the current lock
+func (ctrl TerraformStateController) Lock(c *gin.Context) {
+	job := c.MustGet(cStateJob).(terraform.Job)
+	workspace := c.Params.ByName(cStateWorkspace)
+
+	info, lockID, ok := bindLockInfo(c)
+	if !ok {
+		return
+	}
+
+	lock := terraform.StateLock{
+		ID:            bson.NewObjectId(),
+		JobTemplateID: job.JobTemplateID,
+		Workspace:     workspace,
+		LockID:        lockID,
+		Info:          info,
+		JobID:         &job.ID,
+		Created:       time.Now(),
+	}
+
+	if err := db.TerraformStateLocks().Insert(lock); err != nil {
+		// the lock is already held by the same lock ID
+		if mgo.IsDup(err) {
+			if !stateLocked(c, job.JobTemplateID, workspace, lockID) {
+				c.AbortWithStatus(http.StatusOK)
+			}
+			return
+		}
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while locking terraform state",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// Unlock removes the lock of the workspace if the lock ID
+// in the request body matches the current lock
+func (ctrl TerraformStateController) Unlock(c *gin.Context) {
+	job := c.MustGet(cStateJob).(terraform.Job)
+	workspace := c.Params.ByName(cStateWorkspace)
+
+	_, lockID, ok := bindLockInfo(c)
+	if !ok {
+		return
+	}
+
+	if stateLocked(c, job.JobTemplateID, workspace, lockID) {
+		return
+	}
+
+	if err := db.TerraformStateLocks().Remove(bson.M{"job_template_id": job.JobTemplateID, "workspace": workspace}); err != nil && err != mgo.ErrNotFound {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while unlocking terraform state",
+			Log:     logrus.Fields{"Terraform Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusOK)
+}
+
+// State returns the raw terraform state of the workspace given in the workspace query parameter.
+// The latest version is returned unless a version is given in the version query parameter.
+// The state may contain secrets so it can only be read by users with write permission
+func (ctrl TJobTmplController) State(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.TerraformJobTemplate).ReadState(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	query := bson.M{"job_template_id": template.ID, "workspace": templateWorkspace(c, template)}
+	if v := c.Query("version"); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Invalid state version",
+			})
+			return
+		}
+		query["version"] = version
+	}
+
+	var state terraform.State
+	if err := db.TerraformStates().Find(query).Sort("-version").One(&state); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "Terraform state does not exist",
+			Log:     logrus.Fields{"Terraform Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", []byte(state.State))
+}
+
+// StateVersions returns the versions of the state of the workspace
+// given in the workspace query parameter, the latest version first
+func (ctrl TJobTmplController) StateVersions(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	if !new(rbac.TerraformJobTemplate).ReadState(user, template) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	query := bson.M{"job_template_id": template.ID, "workspace": templateWorkspace(c, template)}
+	var states []terraform.State
+	if err := db.TerraformStates().Find(query).Select(bson.M{"state": 0}).Sort("-version").All(&states); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting terraform state versions",
+			Log:     logrus.Fields{"Terraform Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	for i := range states {
+		metadata.StateMetadata(&states[i])
+	}
+
+	count := len(states)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     states[pgi.Skip():pgi.End()],
+	})
+}
+
+// StateLock returns the current lock of the workspace given in the workspace query parameter
+func (ctrl TJobTmplController) StateLock(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+
+	var lock terraform.StateLock
+	query := bson.M{"job_template_id": template.ID, "workspace": templateWorkspace(c, template)}
+	if err := db.TerraformStateLocks().Find(query).One(&lock); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "Terraform state is not locked",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, lock)
+}
+
+// ForceUnlockState removes the lock of the workspace given in the workspace query parameter,
+// it is used to recover from jobs that did not release the lock
+func (ctrl TJobTmplController) ForceUnlockState(c *gin.Context) {
+	template := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
+	user := c.MustGet(cUser).(common.User)
+
+	var lock terraform.StateLock
+	query := bson.M{"job_template_id": template.ID, "workspace": templateWorkspace(c, template)}
+	if err := db.TerraformStateLocks().Find(query).One(&lock); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "Terraform state is not locked",
+		})
+		return
+	}
+
+	if err := db.TerraformStateLocks().RemoveId(lock.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while unlocking terraform state",
+			Log:     logrus.Fields{"Terraform Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Terraform Job Template ID": template.ID.Hex(),
+		"Workspace":                 lock.Workspace,
+		"User ID":                   user.ID.Hex(),
+	}).Infoln("Terraform state was force unlocked")
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// latestState returns the latest version of the state of the workspace
+func latestState(templateID bson.ObjectId, workspace string) (state terraform.State, err error) {
+	err = db.TerraformStates().Find(bson.M{"job_template_id": templateID, "workspace": workspace}).
+		Sort("-version").One(&state)
+	return
+}
+
+// stateLocked returns true and writes the current lock information
+// with 423 status code if the workspace is locked with another lock ID
+func stateLocked(c *gin.Context, templateID bson.ObjectId, workspace string, lockID string) bool {
+	var lock terraform.StateLock
+	if err := db.TerraformStateLocks().Find(bson.M{"job_template_id": templateID, "workspace": workspace}).One(&lock); err != nil {
+		return false
+	}
+
+	if lock.LockID == lockID {
+		return false
+	}
+
+	c.Data(http.StatusLocked, "application/json", []byte(lock.Info))
+	c.Abort()
+	return true
+}
+
+// bindLockInfo reads the lock information sent by terraform
+// and returns it with the lock ID. If the lock information is invalid the request is aborted
+func bindLockInfo(c *gin.Context) (string, string, bool) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Could not read lock information",
+		})
+		return "", "", false
+	}
+
+	var info struct {
+		ID string `json:"ID"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil || len(info.ID) == 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Invalid lock information",
+		})
+		return "", "", false
+	}
+
+	return string(body), info.ID, true
+}
+
+// templateWorkspace returns the workspace in the workspace query parameter
+// or the workspace of the terraform job template
+func templateWorkspace(c *gin.Context, template terraform.JobTemplate) string {
+	if workspace := c.Query("workspace"); workspace != "" {
+		return workspace
+	}
+	return terraform.Workspace(template.Workspace)
+}
@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"io"
 	"net/http"
 	"strconv"
@@ -10,18 +9,13 @@ import (
 
 	metadata "github.com/pearsonappeng/tensor/api/metadata/terraform"
 	"github.com/pearsonappeng/tensor/db"
-	"github.com/pearsonappeng/tensor/exec/sync"
-	"github.com/pearsonappeng/tensor/exec/types"
-	"github.com/pearsonappeng/tensor/jwt"
 	"github.com/pearsonappeng/tensor/models/common"
 	"github.com/pearsonappeng/tensor/models/terraform"
 
-	"os"
-
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/exec/launch"
 	"github.com/pearsonappeng/tensor/log/activity"
-	"github.com/pearsonappeng/tensor/queue"
 	"github.com/pearsonappeng/tensor/rbac"
 	"github.com/pearsonappeng/tensor/util"
 	"github.com/pearsonappeng/tensor/validate"
@@ -430,6 +424,8 @@ func (ctrl TJobTmplController) Update(c *gin.Context) {
 	jobTemplate.PromptCredential = req.PromptCredential
 	jobTemplate.PromptJobType = req.PromptJobType
 	jobTemplate.AllowSimultaneous = req.AllowSimultaneous
+	jobTemplate.SurveyEnabled = req.SurveyEnabled
+	jobTemplate.Workspace = req.Workspace
 	jobTemplate.Modified = time.Now()
 	jobTemplate.ModifiedByID = user.ID
 
@@ -462,6 +458,25 @@ func (ctrl TJobTmplController) Delete(c *gin.Context) {
 	jobTemplate := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
 	user := c.MustGet(cUser).(common.User)
 
+	// remove the saved plans of the jobs
+	var plan terraform.Job
+	iter := db.TerrafromJobs().Find(bson.M{"job_template_id": jobTemplate.ID, "plan_file_id": bson.M{"$exists": true}}).Iter()
+	for iter.Next(&plan) {
+		if err := db.TerraformPlans().RemoveId(*plan.PlanFileID); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Terraform Job ID": plan.ID.Hex(),
+				"Error":            err.Error(),
+			}).Errorln("Error while removing terraform plan")
+		}
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing terraform plans",
+			Log:     logrus.Fields{"Job Template ID": jobTemplate.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
 	if _, err := db.TerrafromJobs().RemoveAll(bson.M{"job_template_id": jobTemplate.ID}); err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while removing jobs",
@@ -470,6 +485,22 @@ func (ctrl TJobTmplController) Delete(c *gin.Context) {
 		return
 	}
 
+	if _, err := db.TerraformStates().RemoveAll(bson.M{"job_template_id": jobTemplate.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing terraform state",
+			Log:     logrus.Fields{"Job Template ID": jobTemplate.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if _, err := db.TerraformStateLocks().RemoveAll(bson.M{"job_template_id": jobTemplate.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing terraform state locks",
+			Log:     logrus.Fields{"Job Template ID": jobTemplate.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
 	if err := db.TerrafromJobTemplates().RemoveId(jobTemplate.ID); err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while removing job tempalte",
@@ -587,6 +618,7 @@ func (ctrl TJobTmplController) Jobs(c *gin.Context) {
 // be passed via POST data, with extra_vars given as a JSON string.
 // If `credential_needed_to_start` is `true` then the `credential` field is required
 // and if the `inventory_needed_to_start` is `True` then the `inventory` is required as well.
+// If the survey is enabled the answers are passed in vars and validated against the survey.
 // success returns JSON serialized Job model with 201 status code
 // if the request body is invalid returns JSON serialized Error model with 400 status code
 func (ctrl TJobTmplController) Launch(c *gin.Context) {
@@ -601,34 +633,7 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 	}
 
 	// create new Job
-	job := terraform.Job{
-		ID:                  bson.NewObjectId(),
-		Name:                template.Name,
-		Description:         template.Description,
-		LaunchType:          "manual",
-		CancelFlag:          false,
-		Status:              "new",
-		JobType:             template.JobType,
-		Vars:                template.Vars,
-		Parallelism:         template.Parallelism,
-		UpdateOnLaunch:      template.UpdateOnLaunch,
-		MachineCredentialID: template.MachineCredentialID,
-		JobTemplateID:       template.ID,
-		Target:              template.Target,
-		ProjectID:           template.ProjectID,
-		NetworkCredentialID: template.NetworkCredentialID,
-		CloudCredentialID:   template.CloudCredentialID,
-		SCMCredentialID:     template.SCMCredentialID,
-		CreatedByID:         user.ID,
-		ModifiedByID:        user.ID,
-		Created:             time.Now(),
-		Modified:            time.Now(),
-		PromptCredential:    template.PromptCredential,
-		PromptJobType:       template.PromptJobType,
-		PromptVariables:     template.PromptVariables,
-		AllowSimultaneous:   template.AllowSimultaneous,
-		Directory:           template.Directory,
-	}
+	job := launch.NewTerraformJob(template, user, terraform.JobLaunchTypeManual)
 
 	// if prompt is true override Job template
 	// if not provided return an error message
@@ -654,13 +659,6 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 		job.JobType = req.JobType
 	}
 
-	// create new Ansible runner Job
-	runnerJob := types.TerraformJob{
-		Job:      job,
-		Template: template,
-		User:     user,
-	}
-
 	if template.PromptCredential {
 		if req.MachineCredentialID == nil {
 			c.JSON(http.StatusBadRequest, common.Error{
@@ -672,98 +670,15 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 		job.MachineCredentialID = req.MachineCredentialID
 	}
 
-	if job.NetworkCredentialID != nil {
-		var credential common.Credential
-		if err := db.Credentials().FindId(*job.NetworkCredentialID).One(&credential); err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while getting network credential",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-		runnerJob.Network = credential
-	}
-
-	if job.CloudCredentialID != nil {
-		var credential common.Credential
-		if err := db.Credentials().FindId(*job.CloudCredentialID).One(&credential); err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while getting cloud credential",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-		runnerJob.Cloud = credential
-	}
-
-	if job.MachineCredentialID != nil {
-		var credential common.Credential
-		if err := db.Credentials().FindId(*job.MachineCredentialID).One(&credential); err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while getting machine credential",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-		runnerJob.Machine = credential
-	}
-
-	var project common.Project
-	if err := db.Projects().FindId(job.ProjectID).One(&project); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting project",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-	runnerJob.Project = project
-
-	// Get jwt token for authorize API
-	var token jwt.LocalToken
-	if err := jwt.NewAuthToken(&token); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while getting token",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-	runnerJob.Token = token.Token
-
-	if err := db.TerrafromJobs().Insert(job); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while creating job",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
-		return
-	}
-
-	if _, err := os.Stat(project.LocalPath); os.IsNotExist(err) || runnerJob.Project.ScmUpdateOnLaunch {
-		tj, err := sync.UpdateProject(project)
-		runnerJob.PreviousJob = tj
-		if err != nil {
-			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-				Message: "Error while creating update job",
-				Log:     logrus.Fields{"Error": err.Error()},
-			})
-			return
-		}
-	}
-
-	jobBytes, err := json.Marshal(runnerJob)
-	if err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusInternalServerError,
-			Message: "Error while encoding the job",
-			Log:     logrus.Fields{"Error": err.Error()},
+	if err := launch.TerraformSurvey(&job, template, req.Vars); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// publish bytes to terraform queue
-	if err := queue.Publish(queue.Terraform, jobBytes); err != nil {
-		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
-			Message: "Error while publishing to Queue",
-			Log:     logrus.Fields{"Error": err.Error()},
-		})
+	if err := launch.Terraform(&job, user); err != nil {
+		abortLaunch(c, err)
 		return
 	}
 
@@ -787,6 +702,8 @@ func (ctrl TJobTmplController) Launch(c *gin.Context) {
 // If not then one should be supplied when launching the job
 // inventory_needed_to_start: Flag indicating the presence of an inventory associated with the job template.
 // If not then one should be supplied when launching the job
+// survey_enabled: Flag indicating whether the survey of the job template is answered upon launch
+// survey_spec: The survey questions, defaults of password questions are masked
 func (ctrl TJobTmplController) LaunchInfo(c *gin.Context) {
 	// get template from the gin.Context
 	jt := c.MustGet(cTerraformJobTemplate).(terraform.JobTemplate)
@@ -818,8 +735,9 @@ func (ctrl TJobTmplController) LaunchInfo(c *gin.Context) {
 		"ask_variables_on_launch":    jt.PromptVariables,
 		"ask_job_type_on_launch":     jt.PromptJobType,
 		"ask_credential_on_launch":   jt.PromptCredential,
-		"variables_needed_to_start":  []gin.H{},
+		"variables_needed_to_start":  surveyVariablesNeeded(jt.SurveyEnabled, jt.SurveySpec),
 		"credential_needed_to_start": isCredentialNeeded,
+		"survey_enabled":             jt.SurveyEnabled,
 		"job_template_data": gin.H{
 			"id":          jt.ID.Hex(),
 			"name":        jt.Name,
@@ -828,6 +746,10 @@ func (ctrl TJobTmplController) LaunchInfo(c *gin.Context) {
 		"defaults": defaults,
 	}
 
+	if jt.SurveyEnabled {
+		resp["survey_spec"] = hideSurveyPasswords(jt.SurveySpec)
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -7,6 +7,7 @@ import (
 
 	"github.com/pearsonappeng/tensor/api/metadata"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/jwt"
 	"github.com/pearsonappeng/tensor/models/common"
 
 	"github.com/Sirupsen/logrus"
@@ -180,6 +181,9 @@ func (ctrl UserController) Create(c *gin.Context) {
 	}
 
 	req.ID = bson.NewObjectId()
+	// only the LDAP and OpenID Connect logins create external users
+	req.LDAPDN = ""
+	req.OIDCSubject = ""
 	pwdHash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), 11)
 	req.Password = string(pwdHash)
 	req.Created = time.Now()
@@ -231,6 +235,12 @@ func (ctrl UserController) Update(c *gin.Context) {
 	user.LastName = req.LastName
 	user.Email = req.Email
 
+	// SuperUsers only can grant and revoke the superuser and auditor flags
+	if actor.IsSuperUser {
+		user.IsSuperUser = req.IsSuperUser
+		user.IsSystemAuditor = req.IsSystemAuditor
+	}
+
 	if req.Password != "$encrypted$" {
 		pwdHash, _ := bcrypt.GenerateFromPassword([]byte(req.Password), 11)
 		user.Password = string(pwdHash)
@@ -244,6 +254,18 @@ func (ctrl UserController) Update(c *gin.Context) {
 		return
 	}
 
+	// the tokens issued before the password or the flags changed are refused
+	if user.Password != tmpUser.Password || user.IsSuperUser != tmpUser.IsSuperUser ||
+		user.IsSystemAuditor != tmpUser.IsSystemAuditor {
+		if err := jwt.RevokeUserSessions(user.ID); err != nil {
+			AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+				Message: "Error while revoking sessions of user.",
+				Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+			})
+			return
+		}
+	}
+
 	activity.AddActivity(activity.Update, actor.ID, tmpUser, user)
 	user.Password = "$encrypted$"
 	metadata.UserMetadata(&user)
@@ -292,6 +314,22 @@ func (ctrl UserController) Delete(c *gin.Context) {
 		return
 	}
 
+	if _, err := db.AccessTokens().RemoveAll(bson.M{"user_id": user.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing user",
+			Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := jwt.RevokeUserSessions(user.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing user",
+			Log:     logrus.Fields{"User ID": user.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
 	if err := db.Users().RemoveId(user.ID); err != nil {
 		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
 			Message: "Error while removing user",
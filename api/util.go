@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/exec/launch"
 	"github.com/pearsonappeng/tensor/models/common"
 	"github.com/pearsonappeng/tensor/util"
 	"net/http"
@@ -33,6 +34,19 @@ func AbortWithError(lg LogFields) {
 	lg.Context.Abort()
 }
 
+// abortLaunch aborts the request with the error returned by a launch function
+func abortLaunch(c *gin.Context, err error) {
+	msg := "Error while launching job"
+	if e, ok := err.(*launch.Error); ok {
+		msg = e.Message
+	}
+
+	AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+		Message: msg,
+		Log:     logrus.Fields{"Error": err.Error()},
+	})
+}
+
 func AbortWithCode(c *gin.Context, status int, code int, message string) {
 	c.JSON(status, common.Error{
 		Code:    code,
@@ -80,6 +94,8 @@ func GetAPIInfo(c *gin.Context) {
 		"authtoken":               "/v1/authtoken",
 		"ping":                    "/v1/ping",
 		"config":                  "/v1/config",
+		"capacity":                "/v1/capacity",
+		"instances":               "/v1/instances",
 		"queue":                   "/v1/queue",
 		"me":                      "/v1/me",
 		"dashboard":               "/v1/dashboard",
@@ -102,6 +118,8 @@ func GetAPIInfo(c *gin.Context) {
 		"terraform_jobs":          "/v1/terraform_jobs",
 		"terraform_job_templates": "/v1/terraform_job_templates",
 		"schedules":               "/v1/schedules",
+		"workflow_job_templates":  "/v1/workflow_job_templates",
+		"workflow_jobs":           "/v1/workflow_jobs",
 		"roles":                   "/v1/roles",
 		"notification_templates":  "/v1/notification_templates",
 		"notifications":           "/v1/notifications",
@@ -0,0 +1,602 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/api/metadata"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/workflow"
+	"github.com/pearsonappeng/tensor/log/activity"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/pearsonappeng/tensor/validate"
+	"gopkg.in/gin-gonic/gin.v1/binding"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Keys for workflow related items stored in the Gin Context
+const (
+	cWorkflowJobTemplate   = "workflow_job_template"
+	cWorkflowJobTemplateID = "workflow_job_template_id"
+	cWorkflowJob           = "workflow_job"
+	cWorkflowJobID         = "workflow_job_id"
+)
+
+type WorkflowJobTemplateController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes cWorkflowJobTemplateID from Gin Context and retrieves workflow job template data from the collection
+// and store workflow job template data under key cWorkflowJobTemplate in Gin Context
+func (ctrl WorkflowJobTemplateController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cWorkflowJobTemplateID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Workflow job template does not exist"})
+		return
+	}
+
+	var template common.WorkflowJobTemplate
+	if err := db.WorkflowJobTemplates().FindId(bson.ObjectIdHex(objectID)).One(&template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Workflow job template does not exist",
+			Log: logrus.Fields{
+				"Workflow Job Template ID": objectID,
+				"Error":                    err.Error(),
+			},
+		})
+		return
+	}
+
+	roles := new(rbac.WorkflowJobTemplate)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.Read(user, template) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "PUT", "POST", "DELETE":
+		{
+			// Reject the request if the user doesn't have write permissions
+			if !roles.Write(user, template) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cWorkflowJobTemplate, template)
+	c.Next()
+}
+
+// One returns the workflow job template as a JSON object
+func (ctrl WorkflowJobTemplateController) One(c *gin.Context) {
+	template := c.MustGet(cWorkflowJobTemplate).(common.WorkflowJobTemplate)
+	metadata.WorkflowJobTemplateMetadata(&template)
+	c.JSON(http.StatusOK, template)
+}
+
+// All returns the workflow job templates the user has read access to.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl WorkflowJobTemplateController) All(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match := bson.M{}
+	match = parser.Match([]string{"organization_id", "status"}, match)
+	match = parser.Lookups([]string{"name", "description"}, match)
+	query := db.WorkflowJobTemplates().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	roles := new(rbac.WorkflowJobTemplate)
+	var templates []common.WorkflowJobTemplate
+	iter := query.Iter()
+	var tmpTemplate common.WorkflowJobTemplate
+	for iter.Next(&tmpTemplate) {
+		if !roles.Read(user, tmpTemplate) {
+			continue
+		}
+		metadata.WorkflowJobTemplateMetadata(&tmpTemplate)
+		templates = append(templates, tmpTemplate)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting workflow job templates",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(templates)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     templates[pgi.Skip():pgi.End()],
+	})
+}
+
+// Create creates a new workflow job template using request payload.
+// The nodes must form a directed acyclic graph and the user must be able
+// to run the template of every node
+func (ctrl WorkflowJobTemplateController) Create(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+
+	var req common.WorkflowJobTemplate
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if !req.OrganizationExist() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Organization does not exists.",
+		})
+		return
+	}
+
+	if !rbac.HasGlobalWrite(user) && !rbac.HasOrganizationRead(req.OrganizationID, user.ID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to perform this action.",
+		})
+		return
+	}
+
+	if !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Workflow Job Template with this Name already exists.",
+		})
+		return
+	}
+
+	if !validateWorkflowNodes(c, user, req.Nodes) {
+		return
+	}
+
+	req.ID = bson.NewObjectId()
+	req.Name = strings.Trim(req.Name, " ")
+	req.Description = strings.Trim(req.Description, " ")
+	req.Created = time.Now()
+	req.Modified = time.Now()
+	req.CreatedByID = user.ID
+	req.ModifiedByID = user.ID
+	if err := db.WorkflowJobTemplates().Insert(req); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while creating Workflow Job Template",
+			Log:     logrus.Fields{"Workflow Job Template ID": req.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if !rbac.HasGlobalWrite(user) && !rbac.IsOrganizationAdmin(req.OrganizationID, user.ID) {
+		new(rbac.WorkflowJobTemplate).Associate(req.ID, user.ID, rbac.RoleTypeUser, rbac.WorkflowJobTemplateAdmin)
+		activity.AddActivity(activity.Associate, user.ID, req, user)
+	}
+
+	activity.AddActivity(activity.Create, user.ID, req, nil)
+	metadata.WorkflowJobTemplateMetadata(&req)
+	c.JSON(http.StatusCreated, req)
+}
+
+// Update updates the workflow job template using request payload
+func (ctrl WorkflowJobTemplateController) Update(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	template := c.MustGet(cWorkflowJobTemplate).(common.WorkflowJobTemplate)
+	tmpTemplate := template
+
+	var req common.WorkflowJobTemplate
+	if err := binding.JSON.Bind(c.Request, &req); err != nil {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	if req.OrganizationID != template.OrganizationID {
+		if !req.OrganizationExist() {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Organization does not exists.",
+			})
+			return
+		}
+
+		if !rbac.HasGlobalWrite(user) && !rbac.HasOrganizationRead(req.OrganizationID, user.ID) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+				Message: "You don't have sufficient permissions to perform this action.",
+			})
+			return
+		}
+	}
+
+	if (req.Name != template.Name || req.OrganizationID != template.OrganizationID) && !req.IsUnique() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Workflow Job Template with this Name already exists.",
+		})
+		return
+	}
+
+	if !validateWorkflowNodes(c, user, req.Nodes) {
+		return
+	}
+
+	template.Name = strings.Trim(req.Name, " ")
+	template.Description = strings.Trim(req.Description, " ")
+	template.OrganizationID = req.OrganizationID
+	template.Nodes = req.Nodes
+	template.ExtraVars = req.ExtraVars
+	template.PromptVariables = req.PromptVariables
+	template.Modified = time.Now()
+	template.ModifiedByID = user.ID
+
+	if err := db.WorkflowJobTemplates().UpdateId(template.ID, template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while updating Workflow Job Template",
+			Log:     logrus.Fields{"Workflow Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Update, user.ID, tmpTemplate, template)
+	metadata.WorkflowJobTemplateMetadata(&template)
+	c.JSON(http.StatusOK, template)
+}
+
+// Delete removes the workflow job template and its workflow jobs
+func (ctrl WorkflowJobTemplateController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	template := c.MustGet(cWorkflowJobTemplate).(common.WorkflowJobTemplate)
+
+	if _, err := db.WorkflowJobs().RemoveAll(bson.M{"workflow_job_template_id": template.ID}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing workflow jobs",
+			Log:     logrus.Fields{"Workflow Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	if err := db.WorkflowJobTemplates().RemoveId(template.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Workflow Job Template",
+			Log:     logrus.Fields{"Workflow Job Template ID": template.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, template, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// LaunchInfo returns whether the workflow job template requires variables to launch
+func (ctrl WorkflowJobTemplateController) LaunchInfo(c *gin.Context) {
+	template := c.MustGet(cWorkflowJobTemplate).(common.WorkflowJobTemplate)
+
+	c.JSON(http.StatusOK, gin.H{
+		"ask_variables_on_launch":      template.PromptVariables,
+		"can_start_without_user_input": !template.PromptVariables,
+		"node_templates_missing":       missingNodeTemplates(template.Nodes),
+		"workflow_job_template_data": gin.H{
+			"id":          template.ID.Hex(),
+			"name":        template.Name,
+			"description": template.Description,
+		},
+		"defaults": gin.H{
+			"extra_vars": template.ExtraVars,
+		},
+	})
+}
+
+// Launch creates a new workflow job.
+// The workflow manager launches the nodes of the workflow job in the background.
+// success returns JSON serialized WorkflowJob model with 201 status code
+// if the request body is invalid returns JSON serialized Error model with 400 status code
+func (ctrl WorkflowJobTemplateController) Launch(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	template := c.MustGet(cWorkflowJobTemplate).(common.WorkflowJobTemplate)
+
+	var req common.WorkflowLaunch
+	if err := binding.JSON.Bind(c.Request, &req); err != nil && err != io.EOF {
+		AbortWithErrors(c, http.StatusBadRequest,
+			"Invalid JSON body",
+			validate.GetValidationErrors(err)...)
+		return
+	}
+
+	// node templates might have changed after the workflow was saved
+	if missing := missingNodeTemplates(template.Nodes); len(missing) > 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Templates of nodes " + strings.Join(missing, ", ") + " do not exist.",
+		})
+		return
+	}
+
+	if !new(rbac.WorkflowJobTemplate).Nodes(user, template.Nodes) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to run the nodes of the workflow.",
+		})
+		return
+	}
+
+	job := workflow.NewJob(template, user, ansible.JOB_LAUNCH_TYPE_MANUAL)
+
+	if template.PromptVariables {
+		if !(len(req.ExtraVars) > 0) {
+			AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+				Message: "Additional variables required.",
+			})
+			return
+		}
+
+		job.ExtraVars = req.ExtraVars
+	}
+
+	if err := workflow.Launch(&job); err != nil {
+		abortLaunch(c, err)
+		return
+	}
+
+	activity.AddActivity(activity.Create, user.ID, job, nil)
+	metadata.WorkflowJobMetadata(&job)
+	c.JSON(http.StatusCreated, job)
+}
+
+// WorkflowJobs returns the workflow jobs of the workflow job template
+func (ctrl WorkflowJobTemplateController) WorkflowJobs(c *gin.Context) {
+	template := c.MustGet(cWorkflowJobTemplate).(common.WorkflowJobTemplate)
+	listWorkflowJobs(c, bson.M{"workflow_job_template_id": template.ID})
+}
+
+type WorkflowJobController struct{}
+
+// Middleware generates a middleware handler function that works inside of a Gin request.
+// This function takes cWorkflowJobID from Gin Context and retrieves workflow job data from the collection
+// and store workflow job data under key cWorkflowJob in Gin Context.
+// Permissions of a workflow job are the permissions of its workflow job template
+func (ctrl WorkflowJobController) Middleware(c *gin.Context) {
+	objectID := c.Params.ByName(cWorkflowJobID)
+	user := c.MustGet(cUser).(common.User)
+
+	if !bson.IsObjectIdHex(objectID) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Workflow job does not exist"})
+		return
+	}
+
+	var job common.WorkflowJob
+	if err := db.WorkflowJobs().FindId(bson.ObjectIdHex(objectID)).One(&job); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Workflow job does not exist",
+			Log: logrus.Fields{
+				"Workflow Job ID": objectID,
+				"Error":           err.Error(),
+			},
+		})
+		return
+	}
+
+	var template common.WorkflowJobTemplate
+	if err := db.WorkflowJobTemplates().FindId(job.WorkflowJobTemplateID).One(&template); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound, Message: "Workflow job template does not exist",
+			Log: logrus.Fields{
+				"Workflow Job Template ID": job.WorkflowJobTemplateID.Hex(),
+				"Error":                    err.Error(),
+			},
+		})
+		return
+	}
+
+	roles := new(rbac.WorkflowJobTemplate)
+	switch c.Request.Method {
+	case "GET":
+		{
+			if !roles.Read(user, template) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	case "POST", "DELETE":
+		{
+			// Reject the request if the user doesn't have write permissions
+			if !roles.Write(user, template) {
+				AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+					Message: "You don't have sufficient permissions to perform this action.",
+				})
+				return
+			}
+		}
+	}
+
+	c.Set(cWorkflowJob, job)
+	c.Next()
+}
+
+// One returns the workflow job as a JSON object.
+// The nodes of the workflow job carry the status and the id of their jobs
+func (ctrl WorkflowJobController) One(c *gin.Context) {
+	job := c.MustGet(cWorkflowJob).(common.WorkflowJob)
+	metadata.WorkflowJobMetadata(&job)
+	c.JSON(http.StatusOK, job)
+}
+
+// All returns the workflow jobs the user has read access to.
+// This takes lookup parameters and order parameters to filter and sort output data
+func (ctrl WorkflowJobController) All(c *gin.Context) {
+	listWorkflowJobs(c, bson.M{})
+}
+
+// Delete removes the workflow job.
+// Jobs launched by the workflow job are kept
+func (ctrl WorkflowJobController) Delete(c *gin.Context) {
+	user := c.MustGet(cUser).(common.User)
+	job := c.MustGet(cWorkflowJob).(common.WorkflowJob)
+
+	if canCancel(job.Status) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusConflict,
+			Message: "Workflow job is active, cancel it before removing.",
+		})
+		return
+	}
+
+	if err := db.WorkflowJobs().RemoveId(job.ID); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while removing Workflow Job",
+			Log:     logrus.Fields{"Workflow Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	activity.AddActivity(activity.Delete, user.ID, job, nil)
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+// CancelInfo returns whether the workflow job can be canceled
+func (ctrl WorkflowJobController) CancelInfo(c *gin.Context) {
+	job := c.MustGet(cWorkflowJob).(common.WorkflowJob)
+
+	c.JSON(http.StatusOK, gin.H{"can_cancel": canCancel(job.Status) && !job.CancelFlag})
+}
+
+// Cancel cancels the workflow job.
+// The workflow manager cancels the jobs of the running nodes and does not launch further nodes.
+// The response status code will be 202 if successful, or 405 if the workflow job cannot be canceled
+func (ctrl WorkflowJobController) Cancel(c *gin.Context) {
+	job := c.MustGet(cWorkflowJob).(common.WorkflowJob)
+
+	if !canCancel(job.Status) || job.CancelFlag {
+		c.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := db.WorkflowJobs().UpdateId(job.ID, bson.M{"$set": bson.M{"cancel_flag": true}}); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while canceling Workflow Job",
+			Log:     logrus.Fields{"Workflow Job ID": job.ID.Hex(), "Error": err.Error()},
+		})
+		return
+	}
+
+	c.AbortWithStatus(http.StatusAccepted)
+}
+
+// listWorkflowJobs writes a paginated list of the workflow jobs matching the given query
+// which the user has read access to
+func listWorkflowJobs(c *gin.Context, match bson.M) {
+	user := c.MustGet(cUser).(common.User)
+
+	parser := util.NewQueryParser(c)
+	match = parser.Match([]string{"status", "launch_type"}, match)
+	match = parser.Lookups([]string{"name", "description"}, match)
+	match = matchBool(c, []string{"failed"}, match)
+	query := db.WorkflowJobs().Find(match)
+	if order := parser.OrderBy(); order != "" {
+		query.Sort(order)
+	}
+
+	roles := new(rbac.WorkflowJobTemplate)
+	var jobs []common.WorkflowJob
+	iter := query.Iter()
+	var tmpJob common.WorkflowJob
+	for iter.Next(&tmpJob) {
+		if !roles.ReadByID(user, tmpJob.WorkflowJobTemplateID) {
+			continue
+		}
+		metadata.WorkflowJobMetadata(&tmpJob)
+		jobs = append(jobs, tmpJob)
+	}
+	if err := iter.Close(); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusGatewayTimeout,
+			Message: "Error while getting Workflow Jobs",
+			Log:     logrus.Fields{"Error": err.Error()},
+		})
+		return
+	}
+
+	count := len(jobs)
+	pgi := util.NewPagination(c, count)
+	if pgi.HasPage() {
+		AbortWithError(LogFields{Context: c, Status: http.StatusNotFound,
+			Message: "#" + strconv.Itoa(pgi.Page()) + " page contains no results.",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, common.Response{
+		Count:    count,
+		Next:     pgi.NextPage(),
+		Previous: pgi.PreviousPage(),
+		Data:     jobs[pgi.Skip():pgi.End()],
+	})
+}
+
+// validateWorkflowNodes checks the graph of the workflow, the existence of the
+// node templates and whether the user can run them.
+// The request is aborted and false is returned if the nodes are not valid
+func validateWorkflowNodes(c *gin.Context, user common.User, nodes []common.WorkflowNode) bool {
+	if err := workflow.Validate(nodes); err != nil {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return false
+	}
+
+	if missing := missingNodeTemplates(nodes); len(missing) > 0 {
+		AbortWithError(LogFields{Context: c, Status: http.StatusBadRequest,
+			Message: "Templates of nodes " + strings.Join(missing, ", ") + " do not exist.",
+		})
+		return false
+	}
+
+	if !new(rbac.WorkflowJobTemplate).Nodes(user, nodes) {
+		AbortWithError(LogFields{Context: c, Status: http.StatusUnauthorized,
+			Message: "You don't have sufficient permissions to run the nodes of the workflow.",
+		})
+		return false
+	}
+
+	return true
+}
+
+// missingNodeTemplates returns the ids of the nodes whose templates do not exist
+func missingNodeTemplates(nodes []common.WorkflowNode) []string {
+	missing := []string{}
+	for _, node := range nodes {
+		var count int
+		var err error
+		switch node.TemplateType {
+		case common.WorkflowNodeJobTemplate:
+			count, err = db.JobTemplates().FindId(node.TemplateID).Count()
+		case common.WorkflowNodeTerraformJobTemplate:
+			count, err = db.TerrafromJobTemplates().FindId(node.TemplateID).Count()
+		case common.WorkflowNodeProject:
+			count, err = db.Projects().FindId(node.TemplateID).Count()
+		}
+		if err != nil || count == 0 {
+			missing = append(missing, node.ID)
+		}
+	}
+	return missing
+}
@@ -15,23 +15,40 @@ var MongoDb *mgo.Database
 // MongoDB collection names
 const (
 	CAdHocCommands         = "ad_hoc_commands"
+	CAdHocCommandEvents    = "ad_hoc_command_events"
 	CCredentials           = "credentials"
 	CGroups                = "groups"
 	CHosts                 = "hosts"
 	CInventories           = "inventories"
 	CInventoryScripts      = "inventory_scripts"
 	CInventorySources      = "inventory_sources"
+	CInventoryUpdates      = "inventory_updates"
 	CJobs                  = "jobs"
+	CJobEvents             = "job_events"
+	CJobStdout             = "job_stdout"
+	CJobHostSummaries      = "job_host_summaries"
 	CJobTemplates          = "job_templates"
 	CTerraformJobTemplates = "terrafrom_job_templates"
 	CTerraformJobs         = "terraform_jobs"
+	CTerraformStates       = "terraform_states"
+	CTerraformStateLocks   = "terraform_state_locks"
+	CTerraformPlans        = "terraform_plans"
 	CNotifications         = "notifications"
 	CNotificationTemplates = "notification_templates"
 	COrganizations         = "organizations"
 	CProjects              = "projects"
+	CSchedules             = "schedules"
 	CTeams                 = "teams"
 	CUsers                 = "users"
+	CWorkflowJobTemplates  = "workflow_job_templates"
+	CWorkflowJobs          = "workflow_jobs"
 	CActivityStream        = "activity_stream"
+	CBlockedJobs           = "blocked_jobs"
+	CJobLocks              = "job_locks"
+	CInstances             = "instances"
+	CAccessTokens          = "access_tokens"
+	CSessions              = "sessions"
+	CRevokedTokens         = "revoked_tokens"
 )
 
 // Connect will create a session to Mongodb database given in the Config file or env
@@ -106,6 +123,159 @@ func createIndexes() {
 		logrus.Errorln("Failed to create Unique Index for username of ", CUsers, "Collection")
 	}
 
+	// Job events are always read by job in the order they occurred
+	if err := MongoDb.C(CJobEvents).EnsureIndex(mgo.Index{
+		Key:        []string{"job_id", "counter"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for job_id of ", CJobEvents, "Collection")
+	}
+
+	if err := MongoDb.C(CJobEvents).EnsureIndex(mgo.Index{
+		Key:        []string{"host_id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for host_id of ", CJobEvents, "Collection")
+	}
+
+	// One summary per host and job
+	// Output chunks are appended and read in order per job
+	if err := MongoDb.C(CJobStdout).EnsureIndex(mgo.Index{
+		Key:        []string{"job_id", "seq"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for job_id of ", CJobStdout, "Collection")
+	}
+
+	if err := MongoDb.C(CJobHostSummaries).EnsureIndex(mgo.Index{
+		Key:        []string{"job_id", "host_name"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for job_id of ", CJobHostSummaries, "Collection")
+	}
+
+	if err := MongoDb.C(CJobHostSummaries).EnsureIndex(mgo.Index{
+		Key:        []string{"host_id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for host_id of ", CJobHostSummaries, "Collection")
+	}
+
+	if err := MongoDb.C(CAdHocCommandEvents).EnsureIndex(mgo.Index{
+		Key:        []string{"ad_hoc_command_id", "counter"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for ad_hoc_command_id of ", CAdHocCommandEvents, "Collection")
+	}
+
+	// The scheduler looks up due schedules by next_run
+	if err := MongoDb.C(CSchedules).EnsureIndex(mgo.Index{
+		Key:        []string{"enabled", "next_run"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for next_run of ", CSchedules, "Collection")
+	}
+
+	// The workflow manager looks up workflow jobs by status
+	if err := MongoDb.C(CWorkflowJobs).EnsureIndex(mgo.Index{
+		Key:        []string{"status"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for status of ", CWorkflowJobs, "Collection")
+	}
+
+	// Notifications are listed by job
+	if err := MongoDb.C(CNotifications).EnsureIndex(mgo.Index{
+		Key:        []string{"job_id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for job_id of ", CNotifications, "Collection")
+	}
+
+	// State versions are numbered per terraform job template workspace
+	if err := MongoDb.C(CTerraformStates).EnsureIndex(mgo.Index{
+		Key:        []string{"job_template_id", "workspace", "version"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for job_template_id of ", CTerraformStates, "Collection")
+	}
+
+	// A terraform job template workspace can only have one lock
+	if err := MongoDb.C(CTerraformStateLocks).EnsureIndex(mgo.Index{
+		Key:        []string{"job_template_id", "workspace"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for job_template_id of ", CTerraformStateLocks, "Collection")
+	}
+
+	// Blocked jobs are released by the job blocking them
+	if err := MongoDb.C(CBlockedJobs).EnsureIndex(mgo.Index{
+		Key:        []string{"blocker_id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for blocker_id of ", CBlockedJobs, "Collection")
+	}
+
+	// Locks are released by the job holding them
+	if err := MongoDb.C(CJobLocks).EnsureIndex(mgo.Index{
+		Key:        []string{"holder._id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for holder of ", CJobLocks, "Collection")
+	}
+
+	// An instance is registered once per hostname
+	if err := MongoDb.C(CInstances).EnsureIndex(mgo.Index{
+		Key:        []string{"hostname"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for hostname of ", CInstances, "Collection")
+	}
+
+	// Access tokens are looked up by their hash
+	if err := MongoDb.C(CAccessTokens).EnsureIndex(mgo.Index{
+		Key:        []string{"hash"},
+		Unique:     true,
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Unique Index for hash of ", CAccessTokens, "Collection")
+	}
+
+	if err := MongoDb.C(CAccessTokens).EnsureIndex(mgo.Index{
+		Key:        []string{"user_id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for user_id of ", CAccessTokens, "Collection")
+	}
+
+	if err := MongoDb.C(CSessions).EnsureIndex(mgo.Index{
+		Key:        []string{"user_id"},
+		Background: true,
+	}); err != nil {
+		logrus.Errorln("Failed to create Index for user_id of ", CSessions, "Collection")
+	}
+
+	// Sessions and revoked tokens are removed once the tokens expire
+	if err := MongoDb.C(CSessions).EnsureIndex(mgo.Index{
+		Key:         []string{"expires"},
+		ExpireAfter: time.Second,
+		Background:  true,
+	}); err != nil {
+		logrus.Errorln("Failed to create TTL Index for expires of ", CSessions, "Collection")
+	}
+
+	if err := MongoDb.C(CRevokedTokens).EnsureIndex(mgo.Index{
+		Key:         []string{"expires"},
+		ExpireAfter: time.Second,
+		Background:  true,
+	}); err != nil {
+		logrus.Errorln("Failed to create TTL Index for expires of ", CRevokedTokens, "Collection")
+	}
 }
 
 // Organizations returns a mgo.Collection for organizations
@@ -133,6 +303,21 @@ func Jobs() *mgo.Collection {
 	return MongoDb.C(CJobs)
 }
 
+// JobEvents returns a mgo.Collection for job_events
+func JobEvents() *mgo.Collection {
+	return MongoDb.C(CJobEvents)
+}
+
+// JobStdout returns a mgo.Collection for the output chunks of the running and finished jobs
+func JobStdout() *mgo.Collection {
+	return MongoDb.C(CJobStdout)
+}
+
+// JobHostSummaries returns a mgo.Collection for job_host_summaries
+func JobHostSummaries() *mgo.Collection {
+	return MongoDb.C(CJobHostSummaries)
+}
+
 // JobTemplates returns mgo.Collection for job_templates
 func JobTemplates() *mgo.Collection {
 	return MongoDb.C(CJobTemplates)
@@ -148,6 +333,21 @@ func TerrafromJobTemplates() *mgo.Collection {
 	return MongoDb.C(CTerraformJobTemplates)
 }
 
+// TerraformStates returns mgo.Collection for terraform_states
+func TerraformStates() *mgo.Collection {
+	return MongoDb.C(CTerraformStates)
+}
+
+// TerraformStateLocks returns mgo.Collection for terraform_state_locks
+func TerraformStateLocks() *mgo.Collection {
+	return MongoDb.C(CTerraformStateLocks)
+}
+
+// TerraformPlans returns mgo.GridFS for the saved plans of terraform jobs
+func TerraformPlans() *mgo.GridFS {
+	return MongoDb.GridFS(CTerraformPlans)
+}
+
 // Hosts returns mgo.Collection for hosts
 func Hosts() *mgo.Collection {
 	return MongoDb.C(CHosts)
@@ -163,12 +363,92 @@ func Groups() *mgo.Collection {
 	return MongoDb.C(CGroups)
 }
 
+// InventorySources returns mgo.Collection for inventory_sources
+func InventorySources() *mgo.Collection {
+	return MongoDb.C(CInventorySources)
+}
+
+// InventoryUpdates returns mgo.Collection for inventory_updates
+func InventoryUpdates() *mgo.Collection {
+	return MongoDb.C(CInventoryUpdates)
+}
+
+// InventoryScripts returns mgo.Collection for inventory_scripts
+func InventoryScripts() *mgo.Collection {
+	return MongoDb.C(CInventoryScripts)
+}
+
+// NotificationTemplates returns mgo.Collection for notification_templates
+func NotificationTemplates() *mgo.Collection {
+	return MongoDb.C(CNotificationTemplates)
+}
+
+// Notifications returns mgo.Collection for notifications
+func Notifications() *mgo.Collection {
+	return MongoDb.C(CNotifications)
+}
+
 // Projects returns mgo.Collection for projects
 func Projects() *mgo.Collection {
 	return MongoDb.C(CProjects)
 }
 
+// Schedules returns mgo.Collection for schedules
+func Schedules() *mgo.Collection {
+	return MongoDb.C(CSchedules)
+}
+
+// AdHocCommands returns mgo.Collection for ad_hoc_commands
+func AdHocCommands() *mgo.Collection {
+	return MongoDb.C(CAdHocCommands)
+}
+
+// AdHocCommandEvents returns mgo.Collection for ad_hoc_command_events
+func AdHocCommandEvents() *mgo.Collection {
+	return MongoDb.C(CAdHocCommandEvents)
+}
+
+// WorkflowJobTemplates returns mgo.Collection for workflow_job_templates
+func WorkflowJobTemplates() *mgo.Collection {
+	return MongoDb.C(CWorkflowJobTemplates)
+}
+
+// WorkflowJobs returns mgo.Collection for workflow_jobs
+func WorkflowJobs() *mgo.Collection {
+	return MongoDb.C(CWorkflowJobs)
+}
+
 // ActivityStream returns mgo.Collection for activity_stream
 func ActivityStream() *mgo.Collection {
 	return MongoDb.C(CActivityStream)
 }
+
+// BlockedJobs returns mgo.Collection for the jobs waiting for other jobs to finish
+func BlockedJobs() *mgo.Collection {
+	return MongoDb.C(CBlockedJobs)
+}
+
+// JobLocks returns mgo.Collection for the locks held by running jobs
+func JobLocks() *mgo.Collection {
+	return MongoDb.C(CJobLocks)
+}
+
+// Instances returns mgo.Collection for the registered tensord nodes
+func Instances() *mgo.Collection {
+	return MongoDb.C(CInstances)
+}
+
+// AccessTokens returns mgo.Collection for the personal access tokens of the users
+func AccessTokens() *mgo.Collection {
+	return MongoDb.C(CAccessTokens)
+}
+
+// Sessions returns mgo.Collection for the login sessions of the users
+func Sessions() *mgo.Collection {
+	return MongoDb.C(CSessions)
+}
+
+// RevokedTokens returns mgo.Collection for the revoked tokens of the sessions
+func RevokedTokens() *mgo.Collection {
+	return MongoDb.C(CRevokedTokens)
+}
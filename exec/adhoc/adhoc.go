@@ -0,0 +1,450 @@
+// Package adhoc runs ad hoc commands using the ansible command
+// inside the same proot sandbox used for playbook jobs.
+package adhoc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/adjust/uniuri"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/exec/worker"
+	"github.com/pearsonappeng/tensor/jwt"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/ssh"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// Run starts the workers consuming the ad hoc queue
+func Run() {
+	worker.Run(queue.AdHoc, util.Config.AdHocWorkers, handleCommand)
+}
+
+// handleCommand runs a command delivered by the queue
+func handleCommand(d queue.Delivery) {
+	var msg types.Message
+	if err := json.Unmarshal(d.Body(), &msg); err != nil {
+		logrus.Warningln("Ad hoc command delivery rejected")
+		d.DeadLetter()
+		return
+	}
+
+	// the message may be delivered again after the node was restarted
+	if misc.IsStarted(db.AdHocCommands(), msg.JobID) {
+		logrus.WithFields(logrus.Fields{
+			"Ad Hoc Command ID": msg.JobID.Hex(),
+		}).Warningln("Ad hoc command was already started, delivery skipped")
+		d.Ack()
+		return
+	}
+
+	jb := types.AdHocJob{}
+	if err := db.AdHocCommands().FindId(msg.JobID).One(&jb.Command); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Ad Hoc Command ID": msg.JobID.Hex(),
+			"Error":             err.Error(),
+		}).Warningln("Ad hoc command could not be loaded, delivery skipped")
+		d.Ack()
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Ad Hoc Command ID": jb.Command.ID.Hex(),
+		"Module":            jb.Command.ModuleName,
+	}).Infoln("Ad hoc command successfuly received")
+
+	if err := load(&jb); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Ad Hoc Command ID": jb.Command.ID.Hex(),
+			"Error":             err.Error(),
+		}).Errorln("Ad hoc command can not be started")
+		jb.Command.JobExplanation = err.Error()
+		jobError(&jb)
+		d.Ack()
+		return
+	}
+
+	// command may have been canceled while it was in the queue
+	if misc.IsCanceled(db.AdHocCommands(), jb.Command.ID) {
+		logrus.WithFields(logrus.Fields{
+			"Ad Hoc Command ID": jb.Command.ID.Hex(),
+		}).Infoln("Ad hoc command was canceled before it started")
+		jobCancel(&jb)
+		d.Ack()
+		return
+	}
+
+	status(&jb, "pending")
+	// wait for the capacity of the node
+	impact, ok := worker.Acquire(worker.AnsibleImpact(jb.Command.Forks))
+	if !ok {
+		d.Reject()
+		return
+	}
+	adHocRun(&jb)
+	worker.NodeCapacity().Release(impact)
+	d.Ack()
+}
+
+// load loads the machine credential and the inventory of the command.
+// They are loaded from the database when the command is run and are not stored in the queue
+func load(j *types.AdHocJob) error {
+	var err error
+	if j.Machine, err = misc.LoadCredential(&j.Command.CredentialID, "machine"); err != nil {
+		return err
+	}
+
+	if err = db.Inventories().FindId(j.Command.InventoryID).One(&j.Inventory); err != nil {
+		return errors.New("Error while getting inventory: " + err.Error())
+	}
+
+	j.User = misc.LoadUser(j.Command.CreatedByID)
+	return nil
+}
+
+func adHocRun(j *types.AdHocJob) {
+	// the command may have been canceled since its cancel_flag was checked
+	if !start(j) {
+		logrus.WithFields(logrus.Fields{
+			"Ad Hoc Command ID": j.Command.ID.Hex(),
+		}).Infoln("Ad hoc command was canceled or started by another node, run aborted")
+		if misc.IsCanceled(db.AdHocCommands(), j.Command.ID) {
+			jobCancel(j)
+		}
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Ad Hoc Command ID": j.Command.ID.Hex(),
+		"Module":            j.Command.ModuleName,
+	}).Infoln("Ad hoc command started")
+
+	// the job token is only valid while the command is running
+	token, err := jwt.NewJobToken(jwt.JobKindAdHocCommand, j.Command.ID, time.Duration(util.Config.AnsibleJobTimeOut)*time.Second)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while creating the job token")
+		j.Command.JobExplanation = "Error while creating the job token: " + err.Error()
+		jobError(j)
+		return
+	}
+	j.Token = token
+
+	// Start SSH agent
+	client, socket, pid, sshcleanup := ssh.StartAgent(misc.TempPrefix(j.Command.ID))
+
+	if len(j.Machine.SSHKeyData) > 0 {
+		var unlock []byte
+		if len(j.Machine.SSHKeyUnlock) > 0 {
+			unlock = util.Decipher(j.Machine.SSHKeyUnlock)
+		}
+
+		key, err := ssh.GetKey(util.Decipher(j.Machine.SSHKeyData), unlock)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Error while decyrpting Machine Credential")
+			sshcleanup()
+			j.Command.JobExplanation = err.Error()
+			jobFail(j)
+			return
+		}
+
+		if err := client.Add(key); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Error while adding decyrpted Machine Credential to SSH Agent")
+			sshcleanup()
+			j.Command.JobExplanation = err.Error()
+			jobFail(j)
+			return
+		}
+	}
+
+	cmd, cleanup := getCmd(j, socket, pid)
+
+	// cleanup credential files
+	defer func() {
+		logrus.WithFields(logrus.Fields{
+			"Ad Hoc Command ID": j.Command.ID.Hex(),
+			"Status":            j.Command.Status,
+		}).Infoln("Stopped running ad hoc command")
+		sshcleanup()
+		cleanup()
+	}()
+
+	// output is stored while the command is running
+	b := misc.NewOutputWriter(j.Command.ID)
+	cmd.Stdout = b
+	cmd.Stderr = b
+
+	// Set setsid to create a new session, The new process group has no controlling
+	// terminal which disables the stdin & will skip prompts
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Running ad hoc command failed")
+		b.Close()
+		j.Command.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	timer := time.AfterFunc(time.Duration(util.Config.AnsibleJobTimeOut)*time.Second, func() {
+		logrus.Println("Killing the process. Execution exceeded threashold value")
+		misc.KillProcessGroup(cmd)
+	})
+
+	// kill the process group when a cancel is requested
+	watcher := misc.WatchCancel(db.AdHocCommands(), j.Command.ID, cmd)
+
+	err = cmd.Wait()
+	timer.Stop()
+	watcher.Stop()
+	b.Close()
+
+	if err != nil {
+		if watcher.Canceled() {
+			jobCancel(j)
+			return
+		}
+		if watcher.Terminated() {
+			j.Command.JobExplanation = misc.TerminatedExplanation
+			jobError(j)
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Running ad hoc command failed")
+		j.Command.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	jobSuccess(j)
+}
+
+// getCmd returns the ansible command of the ad hoc command wrapped in proot
+func getCmd(j *types.AdHocJob, socket string, pid int) (*exec.Cmd, func()) {
+	// Generate directory paths and create directories
+	tmp := misc.TempPath(j.Command.ID) + "/"
+	j.Paths = types.JobPaths{
+		Etc:             filepath.Join(tmp, uniuri.New()),
+		Tmp:             filepath.Join(tmp, uniuri.New()),
+		VarLib:          filepath.Join(tmp, uniuri.New()),
+		VarLibJobStatus: filepath.Join(tmp, uniuri.New()),
+		VarLibProjects:  filepath.Join(tmp, uniuri.New()),
+		VarLog:          filepath.Join(tmp, uniuri.New()),
+		TmpRand:         misc.TempPath(j.Command.ID),
+	}
+	createTmpDirs(j)
+
+	pattern := j.Command.Limit
+	if len(pattern) == 0 {
+		pattern = "all"
+	}
+
+	// ansible parameters
+	pAnsible := []string{
+		"ansible", pattern, "-i", "/var/lib/tensor/plugins/inventory/tensorrest.py",
+		"-m", j.Command.ModuleName,
+	}
+	if len(j.Command.ModuleArgs) > 0 {
+		pAnsible = append(pAnsible, "-a", j.Command.ModuleArgs)
+	}
+	pAnsible = buildParams(*j, pAnsible)
+
+	// parameters that are hidden from output
+	pSecure := []string{}
+	if len(j.Machine.Username) > 0 {
+		uname := j.Machine.Username
+		// append domain if exist
+		if len(j.Machine.Domain) > 0 {
+			uname = j.Machine.Username + "@" + j.Machine.Domain
+		}
+		pAnsible = append(pAnsible, "-u", uname)
+		if len(j.Machine.Password) > 0 && j.Machine.Kind == common.CredentialKindSSH {
+			pSecure = append(pSecure, "-e", "ansible_ssh_pass="+string(util.Decipher(j.Machine.Password)))
+		}
+		// if credential type is windows the issue a kinit to acquire a kerberos ticket
+		if len(j.Machine.Password) > 0 && j.Machine.Kind == common.CredentialKindWIN {
+			kinit(*j)
+		}
+	}
+
+	if j.Command.BecomeEnabled {
+		pAnsible = append(pAnsible, "-b")
+		// default become method is sudo
+		if len(j.Machine.BecomeMethod) > 0 {
+			pAnsible = append(pAnsible, "--become-method="+j.Machine.BecomeMethod)
+		}
+		// default become user is root
+		if len(j.Machine.BecomeUsername) > 0 {
+			pAnsible = append(pAnsible, "--become-user="+j.Machine.BecomeUsername)
+		}
+		if len(j.Machine.BecomePassword) > 0 {
+			pSecure = append(pSecure, "-e", "ansible_become_pass="+string(util.Decipher(j.Machine.BecomePassword)))
+		}
+	}
+
+	// add proot and ansible parameters
+	pargs := []string{"-v", "0", "-r", "/",
+		"-b", j.Paths.Etc + ":/etc/tensor",
+		"-b", j.Paths.Tmp + ":/tmp",
+		"-b", j.Paths.VarLib + ":/var/lib/tensor",
+		"-b", j.Paths.VarLibJobStatus + ":/var/lib/tensor/job_status",
+		"-b", j.Paths.VarLibProjects + ":" + util.Config.ProjectsHome,
+		"-b", j.Paths.VarLog + ":/var/log",
+		"-b", j.Paths.TmpRand + ":" + j.Paths.TmpRand,
+		"-b", "/var/lib/tensor:/var/lib/tensor",
+		"-w", j.Paths.TmpRand,
+	}
+	pargs = append(pargs, misc.AgentBind(socket)...)
+	pargs = append(pargs, pAnsible...)
+	// set job arguments, exclude unencrypted passwords etc.
+	j.Command.JobARGS = []string{strings.Join(pargs, " ")}
+	j.Command.JobCWD = j.Paths.TmpRand
+	// should not included in any output
+	pargs = append(pargs, pSecure...)
+
+	cmd := exec.Command("proot", pargs...)
+	cmd.Dir = j.Paths.TmpRand
+
+	env := func(token string) []string {
+		return []string{
+			"TERM=xterm",
+			"PWD=" + j.Paths.TmpRand,
+			"SHLVL=0",
+			"HOME=" + os.Getenv("HOME"),
+			"_=/usr/bin/tensord",
+			"PROOT_NO_SECCOMP=1",
+			"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+			"REST_API_TOKEN=" + token,
+			"ANSIBLE_PARAMIKO_RECORD_HOST_KEYS=False",
+			"ANSIBLE_CALLBACK_PLUGINS=/var/lib/tensor/plugins/callback",
+			// the ansible command loads callback plugins only when requested
+			"ANSIBLE_LOAD_CALLBACK_PLUGINS=True",
+			"ANSIBLE_HOST_KEY_CHECKING=False",
+			"AD_HOC_COMMAND_ID=" + j.Command.ID.Hex(),
+			"ANSIBLE_FORCE_COLOR=True",
+			"REST_API_URL=" + util.Config.GetUrl(),
+			"INVENTORY_HOSTVARS=True",
+			"INVENTORY_ID=" + j.Inventory.ID.Hex(),
+			"SSH_AUTH_SOCK=" + socket,
+			"SSH_AGENT_PID=" + strconv.Itoa(pid),
+			"KRB5CCNAME=" + misc.KerberosCache(j.Paths.TmpRand),
+		}
+	}
+	cmd.Env = env(j.Token)
+	// Assign job env here to ensure that sensitive information will
+	// not be exposed
+	j.Command.JobENV = env(strings.Repeat("*", len(j.Token)))
+
+	return cmd, func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			logrus.Errorln("Unable to remove tmp directories")
+		}
+		if err := os.RemoveAll(j.Paths.TmpRand); err != nil {
+			logrus.Errorln("Unable to remove tmp random tmp dir")
+		}
+		if j.Machine.Kind == common.CredentialKindWIN {
+			kdestroy := exec.Command("kdestroy")
+			kdestroy.Env = append(os.Environ(), "KRB5CCNAME="+misc.KerberosCache(j.Paths.TmpRand))
+			if err := kdestroy.Run(); err != nil {
+				logrus.Errorln("kdestroy failed")
+			}
+		}
+	}
+}
+
+func buildParams(j types.AdHocJob, params []string) []string {
+	if j.Command.JobType == "check" {
+		params = append(params, "--check")
+	}
+	// forks -f NUM, --forks=NUM
+	if j.Command.Forks != 0 {
+		params = append(params, "-f", strconv.Itoa(int(j.Command.Forks)))
+	}
+	// verbosity  -v, --verbose
+	if j.Command.Verbosity > 0 {
+		v := int(j.Command.Verbosity)
+		if v > 4 {
+			v = 4
+		}
+		params = append(params, "-"+strings.Repeat("v", v))
+	}
+	// extra variables -e EXTRA_VARS, --extra-vars=EXTRA_VARS
+	if len(j.Command.ExtraVars) > 0 {
+		vars, err := json.Marshal(j.Command.ExtraVars)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+			}).Errorln("Could not marshal extra vars")
+		} else {
+			params = append(params, "-e", string(vars))
+		}
+	}
+	extras := map[string]interface{}{
+		"tensor_ad_hoc_command_id": j.Command.ID.Hex(),
+		"tensor_user_id":           j.Command.CreatedByID.Hex(),
+		"tensor_user_name":         j.User.Username,
+	}
+	// Parameters required by the system
+	rp, err := json.Marshal(extras)
+	if err != nil {
+		logrus.Errorln("Error while marshalling parameters")
+	}
+	params = append(params, "-e", string(rp))
+	return params
+}
+
+func kinit(j types.AdHocJob) error {
+	uname := j.Machine.Username
+	// if credential domain specified
+	if len(j.Machine.Domain) > 0 {
+		uname = j.Machine.Username + "@" + j.Machine.Domain
+	}
+	kinit := exec.Command("kinit", uname)
+	kinit.Env = append(os.Environ(), "KRB5CCNAME="+misc.KerberosCache(j.Paths.TmpRand))
+	stdin, err := kinit.StdinPipe()
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer stdin.Close()
+		io.WriteString(stdin, string(util.Decipher(j.Machine.Password)))
+	}()
+
+	return kinit.Start()
+}
+
+func createTmpDirs(j *types.AdHocJob) {
+	for _, dir := range []string{
+		j.Paths.Etc,
+		j.Paths.Tmp,
+		j.Paths.TmpRand,
+		j.Paths.VarLib,
+		j.Paths.VarLibJobStatus,
+		j.Paths.VarLibProjects,
+		j.Paths.VarLog,
+	} {
+		if err := os.MkdirAll(dir, 0770); err != nil {
+			logrus.Errorln("Unable to create directory: ", dir)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package adhoc
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/types"
+)
+
+// start marks the command as running, it returns false when the command
+// was canceled or started by another node in the meantime
+func start(t *types.AdHocJob) bool {
+	started := time.Now()
+
+	d := bson.M{
+		"status":         "running",
+		"failed":         false,
+		"started":        started,
+		"execution_node": instance.Hostname(),
+	}
+
+	if err := misc.Start(db.AdHocCommands(), t.Command.ID, d); err == mgo.ErrNotFound {
+		return false
+	} else if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": "running",
+			"Error":  err,
+		}).Errorln("Failed to update ad hoc command status")
+	}
+
+	t.Command.Status = "running"
+	t.Command.Started = started
+	return true
+}
+
+func status(t *types.AdHocJob, s string) {
+	t.Command.Status = s
+	d := bson.M{
+		"$set": bson.M{
+			"status": t.Command.Status,
+		},
+	}
+
+	if err := db.AdHocCommands().UpdateId(t.Command.ID, d); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": t.Command.Status,
+			"Error":  err,
+		}).Errorln("Failed to update ad hoc command status")
+	}
+}
+
+func jobFail(t *types.AdHocJob) {
+	t.Command.Failed = true
+	finish(t, "failed", t.Command.JobExplanation)
+}
+
+func jobError(t *types.AdHocJob) {
+	t.Command.Failed = true
+	finish(t, "error", t.Command.JobExplanation)
+}
+
+func jobSuccess(t *types.AdHocJob) {
+	t.Command.Failed = false
+	finish(t, "successful", t.Command.JobExplanation)
+}
+
+func jobCancel(t *types.AdHocJob) {
+	t.Command.Failed = false
+
+	// a command canceled before it was started has no elapsed time
+	// and no output
+	if t.Command.Started.IsZero() {
+		t.Command.Started = time.Now()
+	}
+	if len(t.Command.ResultStdout) == 0 {
+		t.Command.ResultStdout = "stdout capture is missing"
+	}
+
+	finish(t, "canceled", "Job Cancelled")
+}
+
+// finish stores the final status and the output of the ad hoc command
+func finish(t *types.AdHocJob, s string, explanation string) {
+	t.Command.Status = s
+	t.Command.Finished = time.Now()
+	t.Command.JobExplanation = explanation
+
+	//get elapsed time in minutes
+	diff := t.Command.Finished.Sub(t.Command.Started)
+
+	set := bson.M{
+		"status":          t.Command.Status,
+		"failed":          t.Command.Failed,
+		"finished":        t.Command.Finished,
+		"elapsed":         diff.Minutes(),
+		"result_stdout":   t.Command.ResultStdout,
+		"job_explanation": t.Command.JobExplanation,
+		"job_args":        t.Command.JobARGS,
+		"job_env":         t.Command.JobENV,
+		"job_cwd":         t.Command.JobCWD,
+	}
+	if s == "canceled" {
+		set["cancel_flag"] = true
+	}
+
+	if err := db.AdHocCommands().UpdateId(t.Command.ID, bson.M{"$set": set}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": t.Command.Status,
+			"Error":  err,
+		}).Errorln("Failed to update ad hoc command status")
+	}
+}
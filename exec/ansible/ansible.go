@@ -1,8 +1,8 @@
 package ansible
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
@@ -13,12 +13,16 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
 	"github.com/pearsonappeng/tensor/exec/misc"
 	"github.com/pearsonappeng/tensor/exec/sync"
 	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/exec/worker"
+	"github.com/pearsonappeng/tensor/jwt"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
-	"github.com/streadway/amqp"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	"path/filepath"
 
@@ -28,119 +32,114 @@ import (
 	"github.com/pearsonappeng/tensor/util"
 )
 
-// Run starts consuming jobs into a channel of size prefetchLimit
+// Run starts the workers consuming the ansible queue
 func Run() {
-	conn, err := amqp.Dial(util.Config.RabbitMQ)
+	worker.Run(queue.Ansible, util.Config.AnsibleWorkers, handleJob)
+}
 
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Ansible,
-			"Error": err.Error(),
-		}).Infoln("Could not contact RabbitMQ server")
+// handleJob runs a job delivered by the queue
+func handleJob(d queue.Delivery) {
+	var msg types.Message
+	if err := json.Unmarshal(d.Body(), &msg); err != nil {
+		// handle error
+		logrus.Warningln("Job delivery rejected")
+		d.DeadLetter()
 		return
 	}
 
-	defer conn.Close()
-
-	ch, err := conn.Channel()
-
-	if err != nil {
+	// the message may be delivered again after the node was restarted
+	if misc.IsStarted(db.Jobs(), msg.JobID) {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Ansible,
-			"Error": err.Error(),
-		}).Infoln("Failed to open a channel")
+			"Job ID": msg.JobID.Hex(),
+		}).Warningln("Job was already started, delivery skipped")
+		d.Ack()
 		return
 	}
 
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		queue.Ansible, // name
-		true,          // durable
-		false,         // delete when unused
-		false,         // exclusive
-		false,         // no-wait
-		nil,           // arguments
-	)
-
-	if err != nil {
+	jb := types.AnsibleJob{}
+	if err := db.Jobs().FindId(msg.JobID).One(&jb.Job); err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Ansible,
-			"Error": err.Error(),
-		}).Infoln("Failed to declare a queue")
+			"Job ID": msg.JobID.Hex(),
+			"Error":  err.Error(),
+		}).Warningln("Job could not be loaded, delivery skipped")
+		d.Ack()
 		return
 	}
 
-	err = ch.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
+	logrus.WithFields(logrus.Fields{
+		"Job ID": jb.Job.ID.Hex(),
+		"Name":   jb.Job.Name,
+	}).Infoln("Job successfuly received")
 
-	if err != nil {
+	if err := load(&jb, msg); err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Ansible,
-			"Error": err.Error(),
-		}).Infoln("Failed to set QoS")
+			"Job ID": jb.Job.ID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Job can not be started")
+		jb.Job.JobExplanation = err.Error()
+		jobError(&jb)
+		d.Ack()
 		return
 	}
 
-	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
-	)
-
-	if err != nil {
+	// job may have been canceled while it was in the queue
+	if misc.IsCanceled(db.Jobs(), jb.Job.ID) {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Ansible,
-			"Error": err.Error(),
-		}).Infoln("Failed to register a consumer")
+			"Job ID": jb.Job.ID.Hex(),
+			"Name":   jb.Job.Name,
+		}).Infoln("Job was canceled before it started")
+		jobCancel(&jb)
+		d.Ack()
 		return
 	}
 
-	for d := range msgs {
-		jb := types.AnsibleJob{}
-		if err := json.Unmarshal(d.Body, &jb); err != nil {
-			// handle error
-			logrus.Warningln("Job delivery rejected")
-			d.Reject(false)
-			jobFail(&jb)
-			continue
-		}
+	status(&jb, "pending")
 
-		logrus.WithFields(logrus.Fields{
-			"Job ID": jb.Job.ID.Hex(),
-			"Name":   jb.Job.Name,
-		}).Infoln("Job successfuly received")
+	logrus.WithFields(logrus.Fields{
+		"Job ID": jb.Job.ID.Hex(),
+		"Name":   jb.Job.Name,
+	}).Infoln("Job changed status to pending")
+
+	if jb.Job.JobType == ansible.JOBTYPE_UPDATE_JOB {
+		sync.Sync(types.SyncJob{
+			Job:       jb.Job,
+			ProjectID: jb.Project.ID,
+			Project:   jb.Project,
+			SCM:       jb.SCM,
+			User:      jb.User,
+		})
+		d.Ack()
+		return
+	}
+
+	// the job is started again when the jobs blocking it have finished
+	if !waitBlockers(&jb, d.Body()) {
+		d.Ack()
+		return
+	}
 
-		status(&jb, "pending")
+	// wait for the capacity of the node
+	impact, ok := worker.Acquire(worker.AnsibleImpact(jb.Job.Forks))
+	if !ok {
+		d.Reject()
+		return
+	}
 
+	// the checkout of the project is updated on the node running the job
+	if err := sync.Checkout(jb.Project); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Job ID": jb.Job.ID.Hex(),
-			"Name":   jb.Job.Name,
-		}).Infoln("Job changed status to pending")
-
-		if jb.Job.JobType == ansible.JOBTYPE_UPDATE_JOB {
-			sync.Sync(types.SyncJob{
-				Job:           jb.Job,
-				JobTemplateID: jb.Template.ID,
-				ProjectID:     jb.Project.ID,
-				SCM:           jb.SCM,
-				Token:         jb.Token,
-				User:          jb.User,
-			})
-			d.Ack(false)
-			continue
-		}
-		ansibleRun(&jb)
-		d.Ack(false)
-	}
-	logrus.Warningln("Consumer stopped")
+			"Error":  err.Error(),
+		}).Errorln("Job can not be started")
+		jb.Job.JobExplanation = err.Error()
+		jobError(&jb)
+		worker.NodeCapacity().Release(impact)
+		d.Ack()
+		return
+	}
+	ansibleRun(&jb)
+	worker.NodeCapacity().Release(impact)
+	d.Ack()
 }
 
 func ansibleRun(j *types.AnsibleJob) {
@@ -149,53 +148,36 @@ func ansibleRun(j *types.AnsibleJob) {
 		"Name":   j.Job.Name,
 	}).Infoln("Job starting")
 
-	// update if requested
-	if j.PreviousJob != nil {
-		// wait for scm update
-		status(j, "waiting")
-
+	// the job may have been canceled since its cancel_flag was checked
+	if !start(j) {
 		logrus.WithFields(logrus.Fields{
 			"Job ID": j.Job.ID.Hex(),
-			"Name":   j.Job.Name,
-		}).Infoln("Job changed status to waiting")
-
-		ticker := time.NewTicker(time.Second * 2)
-
-		for range ticker.C {
-			if err := db.Jobs().FindId(j.PreviousJob.Job.ID).One(&j.PreviousJob.Job); err != nil {
-				logrus.Warningln("Could not find Previous Job", err)
-				continue
-			}
-
-			if j.PreviousJob.Job.Status == "failed" || j.PreviousJob.Job.Status == "error" {
-				e := "Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}"
-				logrus.Errorln(e)
-				j.Job.JobExplanation = e
-				j.Job.ResultStdout = "stdout capture is missing"
-				jobError(j)
-				return
-			}
-			if j.PreviousJob.Job.Status == "successful" {
-				// stop the ticker and break the loop
-				logrus.WithFields(logrus.Fields{
-					"Job ID": j.PreviousJob.Job.ID.Hex(),
-					"Name":   j.PreviousJob.Job.Name,
-				}).Infoln("Update job successful")
-				ticker.Stop()
-				break
-			}
+		}).Infoln("Job was canceled or started by another node, run aborted")
+		if misc.IsCanceled(db.Jobs(), j.Job.ID) {
+			jobCancel(j)
 		}
+		return
 	}
 
-	start(j)
-
 	logrus.WithFields(logrus.Fields{
 		"Job ID": j.Job.ID.Hex(),
 		"Name":   j.Job.Name,
 	}).Infoln("Job started")
 
+	// the job token is only valid while the job is running
+	token, err := jwt.NewJobToken(jwt.JobKindJob, j.Job.ID, time.Duration(util.Config.AnsibleJobTimeOut)*time.Second)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while creating the job token")
+		j.Job.JobExplanation = "Error while creating the job token: " + err.Error()
+		jobError(j)
+		return
+	}
+	j.Token = token
+
 	// Start SSH agent
-	client, socket, pid, sshcleanup := ssh.StartAgent()
+	client, socket, pid, sshcleanup := ssh.StartAgent(misc.TempPrefix(j.Job.ID))
 
 	if len(j.Machine.SSHKeyData) > 0 {
 		if len(j.Machine.SSHKeyUnlock) > 0 {
@@ -303,9 +285,10 @@ func ansibleRun(j *types.AnsibleJob) {
 		cleanup()
 	}()
 
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
+	// output is stored while the job is running
+	b := misc.NewOutputWriter(j.Job.ID)
+	cmd.Stdout = b
+	cmd.Stderr = b
 
 	// Set setsid to create a new session, The new process group has no controlling
 	// terminal which disables the stdin & will skip prompts
@@ -315,8 +298,8 @@ func ansibleRun(j *types.AnsibleJob) {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running ansible job failed")
+		b.Close()
 		j.Job.JobExplanation = err.Error()
-		j.Job.ResultStdout = string(b.Bytes())
 		jobFail(j)
 		return
 	}
@@ -324,31 +307,191 @@ func ansibleRun(j *types.AnsibleJob) {
 	var timer *time.Timer
 	timer = time.AfterFunc(time.Duration(util.Config.AnsibleJobTimeOut)*time.Second, func() {
 		logrus.Println("Killing the process. Execution exceeded threashold value")
-		cmd.Process.Kill()
+		misc.KillProcessGroup(cmd)
 	})
 
+	// kill the process group when a cancel is requested
+	watcher := misc.WatchCancel(db.Jobs(), j.Job.ID, cmd)
+
 	if err := cmd.Wait(); err != nil {
+		timer.Stop()
+		watcher.Stop()
+		b.Close()
+		if watcher.Canceled() {
+			jobCancel(j)
+			return
+		}
+		if watcher.Terminated() {
+			j.Job.JobExplanation = misc.TerminatedExplanation
+			jobError(j)
+			return
+		}
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running playbook failed")
 		j.Job.JobExplanation = err.Error()
-		j.Job.ResultStdout = string(b.Bytes())
 		jobFail(j)
-		timer.Stop()
 		return
 	}
 
 	timer.Stop()
-	// set stdout
-	j.Job.ResultStdout = string(b.Bytes())
+	watcher.Stop()
+	b.Close()
 	//success
 	jobSuccess(j)
 }
 
+// load loads the template, the inventory, the project and the credentials of the job.
+// They are loaded from the database when the job is run and are not stored in the queue
+func load(j *types.AnsibleJob, msg types.Message) error {
+	var err error
+	if j.Job.JobTemplateID.Valid() {
+		if err = db.JobTemplates().FindId(j.Job.JobTemplateID).One(&j.Template); err != nil {
+			return errors.New("Error while getting job template: " + err.Error())
+		}
+	}
+
+	if j.Job.InventoryID.Valid() {
+		if err = db.Inventories().FindId(j.Job.InventoryID).One(&j.Inventory); err != nil {
+			return errors.New("Error while getting inventory: " + err.Error())
+		}
+	}
+
+	if err = db.Projects().FindId(j.Job.ProjectID).One(&j.Project); err != nil {
+		return errors.New("Error while getting project: " + err.Error())
+	}
+
+	if j.Machine, err = misc.LoadCredential(j.Job.MachineCredentialID, "machine"); err != nil {
+		return err
+	}
+	if j.Network, err = misc.LoadCredential(j.Job.NetworkCredentialID, "network"); err != nil {
+		return err
+	}
+	if j.Cloud, err = misc.LoadCredential(j.Job.CloudCredentialID, "cloud"); err != nil {
+		return err
+	}
+	if j.SCM, err = misc.LoadCredential(j.Job.SCMCredentialID, "SCM"); err != nil {
+		return err
+	}
+
+	j.User = misc.LoadUser(j.Job.CreatedByID)
+	if msg.PreviousJobID != nil {
+		j.PreviousJob = &types.SyncJob{Job: ansible.Job{ID: *msg.PreviousJobID}}
+	}
+	j.InventoryUpdates = msg.InventoryUpdates
+	return nil
+}
+
+// blocker returns the job which has to finish before the job is started. The project update and
+// the inventory updates of the job, the updates of the project and the running job of the job template
+// block the job. An error is returned if a project or inventory update has failed
+func blocker(j *types.AnsibleJob) (*blocking.Blocker, error) {
+	if j.PreviousJob != nil {
+		if err := db.Jobs().FindId(j.PreviousJob.Job.ID).One(&j.PreviousJob.Job); err != nil {
+			return nil, err
+		}
+		switch j.PreviousJob.Job.Status {
+		case "failed", "error", "canceled":
+			return nil, errors.New("Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.PreviousJob.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}")
+		case "successful":
+		default:
+			return &blocking.Blocker{
+				ID:         j.PreviousJob.Job.ID,
+				Type:       blocking.TypeProjectUpdate,
+				Name:       j.PreviousJob.Job.Name,
+				Collection: db.CJobs,
+			}, nil
+		}
+	}
+
+	var update ansible.Job
+	err := db.Jobs().Find(bson.M{
+		"project_id": j.Project.ID,
+		"job_type":   ansible.JOBTYPE_UPDATE_JOB,
+		"status":     bson.M{"$in": []string{"new", "pending", "waiting", "running"}},
+	}).One(&update)
+	if err == nil {
+		return &blocking.Blocker{
+			ID:         update.ID,
+			Type:       blocking.TypeProjectUpdate,
+			Name:       update.Name,
+			Collection: db.CJobs,
+		}, nil
+	}
+	if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	if len(j.InventoryUpdates) > 0 {
+		var updates []ansible.InventoryUpdate
+		if err := db.InventoryUpdates().Find(bson.M{"_id": bson.M{"$in": j.InventoryUpdates}}).All(&updates); err != nil {
+			return nil, err
+		}
+		for _, v := range updates {
+			switch v.Status {
+			case "failed", "error", "canceled":
+				return nil, errors.New("Previous Task Failed: {\"job_type\": \"inventory_update\", \"job_name\": \"" + v.Name + "\", \"job_id\": \"" + v.ID.Hex() + "\"}")
+			case "successful":
+			default:
+				return &blocking.Blocker{
+					ID:         v.ID,
+					Type:       blocking.TypeInventoryUpdate,
+					Name:       v.Name,
+					Collection: db.CInventoryUpdates,
+				}, nil
+			}
+		}
+	}
+
+	// only one job of the job template runs at a time
+	if !j.Job.AllowSimultaneous && j.Job.JobTemplateID.Valid() {
+		return blocking.Lock("job_template:"+j.Job.JobTemplateID.Hex(), blocking.Blocker{
+			ID:         j.Job.ID,
+			Type:       blocking.TypeJob,
+			Name:       j.Job.Name,
+			Collection: db.CJobs,
+		})
+	}
+
+	return nil, nil
+}
+
+// waitBlockers parks the job while it is blocked by other jobs,
+// it returns whether the job can be started
+func waitBlockers(j *types.AnsibleJob, body []byte) bool {
+	for {
+		b, err := blocker(j)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": j.Job.ID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Job can not be started")
+			j.Job.JobExplanation = err.Error()
+			j.Job.ResultStdout = "stdout capture is missing"
+			jobError(j)
+			return false
+		}
+		if b == nil {
+			return true
+		}
+
+		parked, err := blocking.Wait(db.Jobs(), j.Job.ID, queue.Ansible, body, *b)
+		if err != nil {
+			j.Job.JobExplanation = err.Error()
+			j.Job.ResultStdout = "stdout capture is missing"
+			jobError(j)
+			return false
+		}
+		if parked {
+			return false
+		}
+	}
+}
+
 // runPlaybook runs a Job using ansible-playbook command
 func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup func(), err error) {
 	// Generate directory paths and create directories
-	tmp := "/tmp/tensor_proot_" + uniuri.New() + "/"
+	tmp := misc.TempPath(j.Job.ID) + "/"
 	j.Paths = types.JobPaths{
 		Etc:             filepath.Join(tmp, uniuri.New()),
 		Tmp:             filepath.Join(tmp, uniuri.New()),
@@ -356,9 +499,9 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		VarLibJobStatus: filepath.Join(tmp, uniuri.New()),
 		VarLibProjects:  filepath.Join(tmp, uniuri.New()),
 		VarLog:          filepath.Join(tmp, uniuri.New()),
-		TmpRand:         "/tmp/tensor__" + uniuri.New(),
+		TmpRand:         misc.TempPath(j.Job.ID),
 		ProjectRoot:     filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-		CredentialPath:  "/tmp/tensor_" + uniuri.New(),
+		CredentialPath:  misc.TempPath(j.Job.ID),
 	}
 	// create job directories
 	createTmpDirs(j)
@@ -401,6 +544,21 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 			pSecure = append(pSecure, "-e", "'ansible_become_pass="+string(util.Decipher(j.Machine.BecomePassword))+"'")
 		}
 	}
+	// survey password answers override the masked extra variables
+	if len(j.Job.SurveyPasswords) > 0 {
+		deciphered := misc.DecipherVars(j.Job.ExtraVars, j.Job.SurveyPasswords)
+		passwords := map[string]interface{}{}
+		for _, k := range j.Job.SurveyPasswords {
+			passwords[k] = deciphered[k]
+		}
+		vars, err := json.Marshal(passwords)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+			}).Errorln("Could not marshal survey passwords")
+		}
+		pSecure = append(pSecure, "-e", string(vars))
+	}
 	// add proot and ansible parameters
 	pargs := []string{"-v", "0", "-r", "/",
 		"-b", j.Paths.Etc + ":/etc/tensor",
@@ -414,6 +572,7 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"-b", "/var/lib/tensor:/var/lib/tensor",
 		"-w", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
 	}
+	pargs = append(pargs, misc.AgentBind(socket)...)
 	pargs = append(pargs, pPlaybook...)
 	j.Job.JobARGS = pargs
 	// should not included in any output
@@ -445,6 +604,7 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"INVENTORY_ID=" + j.Inventory.ID.Hex(),
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"KRB5CCNAME=" + misc.KerberosCache(j.Paths.TmpRand),
 	}
 	// Assign job env here to ensure that sensitive information will
 	// not be exposed
@@ -469,10 +629,11 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		"INVENTORY_ID=" + j.Inventory.ID.Hex(),
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"KRB5CCNAME=" + misc.KerberosCache(j.Paths.TmpRand),
 	}
 	var f *os.File
 	if j.Cloud.Cloud {
-		cmd.Env, f, err = misc.GetCloudCredential(cmd.Env, j.Cloud)
+		cmd.Env, f, err = misc.GetCloudCredential(cmd.Env, j.Cloud, misc.TempPrefix(j.Job.ID))
 		if err != nil {
 			return nil, nil, err
 		}
@@ -500,7 +661,9 @@ func getCmd(j *types.AnsibleJob, socket string, pid int) (cmd *exec.Cmd, cleanup
 		}
 
 		if j.Machine.Kind == common.CredentialKindWIN {
-			if err := exec.Command("kdestroy").Run(); err != nil {
+			kdestroy := exec.Command("kdestroy")
+			kdestroy.Env = append(os.Environ(), "KRB5CCNAME="+misc.KerberosCache(j.Paths.TmpRand))
+			if err := kdestroy.Run(); err != nil {
 				logrus.Errorln("kdestroy failed")
 			}
 		}
@@ -537,8 +700,9 @@ func buildParams(j types.AnsibleJob, params []string) []string {
 		params = append(params, "-vvvv")
 	}
 	// extra variables -e EXTRA_VARS, --extra-vars=EXTRA_VARS
+	// survey password answers are masked, the answers are passed as a secure parameter
 	if len(j.Job.ExtraVars) > 0 {
-		vars, err := json.Marshal(j.Job.ExtraVars)
+		vars, err := json.Marshal(misc.MaskVars(j.Job.ExtraVars, j.Job.SurveyPasswords))
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err,
@@ -585,7 +749,7 @@ func kinit(j types.AnsibleJob) error {
 		uname = j.Machine.Username + "@" + j.Machine.Domain
 	}
 	kinit := exec.Command("kinit", uname)
-	kinit.Env = os.Environ()
+	kinit.Env = append(os.Environ(), "KRB5CCNAME="+misc.KerberosCache(j.Paths.TmpRand))
 	stdin, err := kinit.StdinPipe()
 	if err != nil {
 		return err
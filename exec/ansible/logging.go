@@ -3,31 +3,45 @@ package ansible
 import (
 	"time"
 
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/notification"
 	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/common"
 )
 
-func start(t *types.AnsibleJob) {
-	t.Job.Status = "running"
-	t.Job.Started = time.Now()
+// start marks the job as running, it returns false when the job
+// was canceled or started by another node in the meantime
+func start(t *types.AnsibleJob) bool {
+	started := time.Now()
 
 	d := bson.M{
-		"$set": bson.M{
-			"status":  t.Job.Status,
-			"failed":  false,
-			"started": t.Job.Started,
-		},
+		"status":          "running",
+		"failed":          false,
+		"started":         started,
+		"job_explanation": "",
+		"execution_node":  instance.Hostname(),
 	}
 
-	if err := db.Jobs().UpdateId(t.Job.ID, d); err != nil {
+	if err := misc.Start(db.Jobs(), t.Job.ID, d); err == mgo.ErrNotFound {
+		return false
+	} else if err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Status": t.Job.Status,
+			"Status": "running",
 			"Error":  err,
 		}).Errorln("Failed to update job status")
 	}
+
+	t.Job.Status = "running"
+	t.Job.Started = started
+	notify(t, common.NotificationEventStarted)
+	return true
 }
 
 func status(t *types.AnsibleJob, s string) {
@@ -75,8 +89,10 @@ func jobFail(t *types.AnsibleJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
+	notify(t, common.NotificationEventError)
 }
 
 func jobCancel(t *types.AnsibleJob) {
@@ -84,6 +100,15 @@ func jobCancel(t *types.AnsibleJob) {
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
 
+	// a job canceled before it was started has no elapsed time
+	// and no output
+	if t.Job.Started.IsZero() {
+		t.Job.Started = t.Job.Finished
+	}
+	if len(t.Job.ResultStdout) == 0 {
+		t.Job.ResultStdout = "stdout capture is missing"
+	}
+
 	//get elapsed time in minutes
 	diff := t.Job.Finished.Sub(t.Job.Started)
 
@@ -94,7 +119,7 @@ func jobCancel(t *types.AnsibleJob) {
 			"failed":          t.Job.Failed,
 			"finished":        t.Job.Finished,
 			"elapsed":         diff.Minutes(),
-			"result_stdout":   "stdout capture is missing",
+			"result_stdout":   t.Job.ResultStdout,
 			"job_explanation": "Job Cancelled",
 			"job_args":        t.Job.JobARGS,
 			"job_env":         t.Job.JobENV,
@@ -109,6 +134,7 @@ func jobCancel(t *types.AnsibleJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
 }
@@ -142,8 +168,10 @@ func jobError(t *types.AnsibleJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
+	notify(t, common.NotificationEventError)
 }
 
 func jobSuccess(t *types.AnsibleJob) {
@@ -175,8 +203,10 @@ func jobSuccess(t *types.AnsibleJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
+	notify(t, common.NotificationEventSuccess)
 }
 
 func updateProject(t *types.AnsibleJob) {
@@ -210,3 +240,17 @@ func updateJobTemplate(t *types.AnsibleJob) {
 		}).Errorln("Failed to update JobTemplate")
 	}
 }
+
+// notify sends the notifications of the job template and its organization
+func notify(t *types.AnsibleJob, event string) {
+	job := notification.Job{
+		ID:             t.Job.ID,
+		Type:           notification.JobTypeJob,
+		Name:           t.Job.Name,
+		Status:         t.Job.Status,
+		Started:        t.Job.Started,
+		Finished:       t.Job.Finished,
+		JobExplanation: t.Job.JobExplanation,
+	}
+	go notification.Send(job, event, t.Project.OrganizationID, t.Template.ID)
+}
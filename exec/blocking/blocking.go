@@ -0,0 +1,200 @@
+// Package blocking keeps jobs from starting while the jobs they depend on or
+// conflict with have not finished. A blocked job is parked in the database
+// with its queue message and published again when the job blocking it finishes,
+// so blocked jobs do not hold a worker while they are waiting.
+package blocking
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/queue"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types of the jobs blocking other jobs
+const (
+	TypeJob             = "job"
+	TypeProjectUpdate   = "project_update"
+	TypeInventoryUpdate = "inventory_update"
+	TypeTerraformJob    = "terraform_job"
+)
+
+// ErrLocked is returned when a lock could not be acquired
+var ErrLocked = errors.New("Could not acquire the job lock")
+
+// Blocker is a job which has to finish before a blocked job is started
+type Blocker struct {
+	ID         bson.ObjectId `bson:"_id"`
+	Type       string        `bson:"type"`
+	Name       string        `bson:"name"`
+	Collection string        `bson:"collection"`
+}
+
+// Explanation returns the job explanation of a job blocked by the blocker
+func (b Blocker) Explanation() string {
+	return "Blocked by: {\"job_type\": \"" + b.Type + "\", \"job_name\": \"" + b.Name + "\", \"job_id\": \"" + b.ID.Hex() + "\"}"
+}
+
+// Finished returns whether the blocker has finished,
+// a blocker that does not exist anymore has finished
+func (b Blocker) Finished() bool {
+	var job struct {
+		Status string `bson:"status"`
+	}
+	if err := db.C(b.Collection).FindId(b.ID).Select(bson.M{"status": 1}).One(&job); err != nil {
+		return err == mgo.ErrNotFound
+	}
+	return IsFinished(job.Status)
+}
+
+// IsFinished returns whether the status is the status of a finished job
+func IsFinished(status string) bool {
+	switch status {
+	case "successful", "failed", "error", "canceled":
+		return true
+	}
+	return false
+}
+
+// parked is a job waiting for its blocker to finish
+type parked struct {
+	ID        bson.ObjectId `bson:"_id"`
+	Queue     string        `bson:"queue"`
+	Body      []byte        `bson:"body"`
+	BlockerID bson.ObjectId `bson:"blocker_id"`
+	Created   time.Time     `bson:"created"`
+}
+
+// Wait parks the job until the blocker finishes, the message of the job is published to the queue
+// again when the blocker finishes. The job is pending and its explanation is set in the collection.
+// Wait returns false if the blocker has finished before the job was parked, the job must be checked again
+func Wait(c *mgo.Collection, jobID bson.ObjectId, name string, body []byte, b Blocker) (bool, error) {
+	p := parked{
+		ID:        jobID,
+		Queue:     name,
+		Body:      body,
+		BlockerID: b.ID,
+		Created:   time.Now(),
+	}
+	if _, err := db.BlockedJobs().UpsertId(jobID, p); err != nil {
+		return false, err
+	}
+
+	// a job canceled in the meantime is skipped when it is released
+	if err := c.Update(bson.M{"_id": jobID, "cancel_flag": bson.M{"$ne": true}}, bson.M{"$set": bson.M{
+		"status":          "pending",
+		"job_explanation": b.Explanation(),
+	}}); err != nil && err != mgo.ErrNotFound {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": jobID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Failed to update job status")
+	}
+
+	// the blocker may have finished and released its jobs before the job was parked
+	if b.Finished() {
+		if err := db.BlockedJobs().Remove(bson.M{"_id": jobID, "blocker_id": b.ID}); err == nil {
+			return false, nil
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Job ID":     jobID.Hex(),
+		"Blocker ID": b.ID.Hex(),
+	}).Infoln("Job is blocked")
+	return true, nil
+}
+
+// Release publishes the jobs blocked by the finished job to their queues
+func Release(id bson.ObjectId) {
+	var jobs []parked
+	if err := db.BlockedJobs().Find(bson.M{"blocker_id": id}).All(&jobs); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Blocker ID": id.Hex(),
+			"Error":      err.Error(),
+		}).Errorln("Failed to get blocked jobs")
+		return
+	}
+
+	for _, p := range jobs {
+		// a blocked job is released once
+		if err := db.BlockedJobs().Remove(bson.M{"_id": p.ID, "blocker_id": id}); err != nil {
+			continue
+		}
+
+		if err := queue.Publish(p.Queue, p.Body); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": p.ID.Hex(),
+				"Error":  err.Error(),
+			}).Errorln("Failed to publish released job")
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"Job ID":     p.ID.Hex(),
+			"Blocker ID": id.Hex(),
+		}).Infoln("Blocked job released")
+	}
+}
+
+// lock is held by a running job
+type lock struct {
+	ID      string    `bson:"_id"`
+	Holder  Blocker   `bson:"holder"`
+	Created time.Time `bson:"created"`
+}
+
+// Lock acquires the lock of the key for the job. If the lock is held by another job
+// that job is returned. Locks held by jobs which have finished are taken over
+func Lock(key string, job Blocker) (*Blocker, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		err := db.JobLocks().Insert(lock{ID: key, Holder: job, Created: time.Now()})
+		if err == nil {
+			return nil, nil
+		}
+		if !mgo.IsDup(err) {
+			return nil, err
+		}
+
+		var l lock
+		if err := db.JobLocks().FindId(key).One(&l); err != nil {
+			if err == mgo.ErrNotFound {
+				continue
+			}
+			return nil, err
+		}
+
+		// the message of the job was delivered again
+		if l.Holder.ID == job.ID {
+			return nil, nil
+		}
+
+		if !l.Holder.Finished() {
+			return &l.Holder, nil
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"Lock":      key,
+			"Holder ID": l.Holder.ID.Hex(),
+		}).Warningln("Removing lock of finished job")
+		if err := db.JobLocks().Remove(bson.M{"_id": key, "holder._id": l.Holder.ID}); err != nil && err != mgo.ErrNotFound {
+			return nil, err
+		}
+	}
+	return nil, ErrLocked
+}
+
+// Finish releases the locks held by the finished job and the jobs blocked by it
+func Finish(id bson.ObjectId) {
+	if _, err := db.JobLocks().RemoveAll(bson.M{"holder._id": id}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": id.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Failed to remove job locks")
+	}
+	Release(id)
+}
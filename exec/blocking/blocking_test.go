@@ -0,0 +1,26 @@
+package blocking
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestExplanation(t *testing.T) {
+	b := Blocker{
+		ID:   bson.ObjectIdHex("5a0c2f1e8f3b2c0001a1b2c3"),
+		Type: TypeProjectUpdate,
+		Name: "demo update Job",
+	}
+	assert.Equal(t, `Blocked by: {"job_type": "project_update", "job_name": "demo update Job", "job_id": "5a0c2f1e8f3b2c0001a1b2c3"}`, b.Explanation())
+}
+
+func TestIsFinished(t *testing.T) {
+	for _, s := range []string{"successful", "failed", "error", "canceled"} {
+		assert.True(t, IsFinished(s), s)
+	}
+	for _, s := range []string{"new", "pending", "waiting", "running"} {
+		assert.False(t, IsFinished(s), s)
+	}
+}
@@ -0,0 +1,244 @@
+// Package instance registers the tensord node in the database and sends its
+// heartbeat. Nodes that stop sending heartbeats are marked as lost by the other
+// nodes, and the jobs that were running on them are marked as error.
+package instance
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/worker"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Job types run by worker nodes
+var jobTypes = []string{"job", "project_update", "terraform_job", "ad_hoc_command", "inventory_update"}
+
+// collections of the jobs run by worker nodes
+var jobCollections = []string{db.CJobs, db.CTerraformJobs, db.CAdHocCommands, db.CInventoryUpdates}
+
+// stopped is set when the node is deregistered, no heartbeat is sent afterwards
+var (
+	mu      sync.Mutex
+	stopped bool
+)
+
+// Hostname returns the hostname of the node
+func Hostname() string {
+	return util.Config.Hostname
+}
+
+// RunsJobs returns whether the node runs jobs
+func RunsJobs() bool {
+	return util.Config.Role != util.RoleAPI
+}
+
+// Register registers the node as an active instance
+func Register() error {
+	now := time.Now()
+
+	capacity := 0
+	types := []string{}
+	if RunsJobs() {
+		capacity = worker.NodeCapacity().Max()
+		types = jobTypes
+	}
+
+	_, err := db.Instances().Upsert(bson.M{"hostname": Hostname()}, bson.M{
+		"$set": bson.M{
+			"version":           util.Version,
+			"role":              util.Config.Role,
+			"status":            common.InstanceActive,
+			"capacity":          capacity,
+			"consumed_capacity": 0,
+			"job_types":         types,
+			"started":           now,
+			"heartbeat":         now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":     bson.NewObjectId(),
+			"created": now,
+		},
+	})
+	return err
+}
+
+// Deregister marks the node as offline when it is shut down,
+// an offline node is not lost and no more heartbeats are sent
+func Deregister() error {
+	mu.Lock()
+	defer mu.Unlock()
+	stopped = true
+
+	return db.Instances().Update(bson.M{"hostname": Hostname()}, bson.M{
+		"$set": bson.M{
+			"status":            common.InstanceOffline,
+			"consumed_capacity": 0,
+			"heartbeat":         time.Now(),
+		},
+	})
+}
+
+// Reconcile marks the jobs left running or waiting by a previous run
+// of the node as error, it must be called before the node runs jobs
+func Reconcile() {
+	FailJobs(Hostname(), "Job was running on instance "+Hostname()+" when it was restarted")
+}
+
+// Run sends the heartbeat of the node and looks up lost instances
+func Run() {
+	ticker := time.NewTicker(interval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		heartbeat()
+		reap()
+	}
+}
+
+// interval returns the time between two heartbeats,
+// a node is lost after missing several heartbeats
+func interval() time.Duration {
+	if util.Config.InstanceTimeout < 1 {
+		return time.Second
+	}
+	return time.Duration(util.Config.InstanceTimeout) * time.Second / 3
+}
+
+func heartbeat() {
+	mu.Lock()
+	defer mu.Unlock()
+	if stopped {
+		return
+	}
+
+	set := bson.M{
+		"status":    common.InstanceActive,
+		"heartbeat": time.Now(),
+	}
+	if RunsJobs() {
+		set["consumed_capacity"] = worker.NodeCapacity().Used()
+		set["workers"] = workers()
+	}
+
+	if err := db.Instances().Update(bson.M{"hostname": Hostname()}, bson.M{"$set": set}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Hostname": Hostname(),
+			"Error":    err.Error(),
+		}).Errorln("Failed to send heartbeat")
+	}
+}
+
+// SetProject records the time the checkout of the project was updated on the node
+func SetProject(id bson.ObjectId, updated time.Time) error {
+	return db.Instances().Update(bson.M{"hostname": Hostname()}, bson.M{
+		"$set": bson.M{"projects." + id.Hex(): updated},
+	})
+}
+
+// ProjectUpdated returns the time the checkout of the project was updated
+// on the node, it returns nil when the node has no checkout of the project
+func ProjectUpdated(id bson.ObjectId) (*time.Time, error) {
+	var i common.Instance
+	if err := db.Instances().Find(bson.M{"hostname": Hostname()}).Select(bson.M{"projects": 1}).One(&i); err != nil {
+		return nil, err
+	}
+	updated, ok := i.Projects[id.Hex()]
+	if !ok {
+		return nil, nil
+	}
+	return &updated, nil
+}
+
+// workers returns the worker pools of the node
+func workers() []common.InstanceWorkers {
+	list := []common.InstanceWorkers{}
+	for _, p := range worker.Pools() {
+		list = append(list, common.InstanceWorkers{
+			Queue:   p.Queue,
+			Workers: p.Workers,
+			Running: p.Running(),
+		})
+	}
+	return list
+}
+
+// reap marks the instances that stopped sending heartbeats as lost
+// and the jobs running on them as error
+func reap() {
+	expired := time.Now().Add(-time.Duration(util.Config.InstanceTimeout) * time.Second)
+
+	var instances []common.Instance
+	if err := db.Instances().Find(bson.M{
+		"status":    common.InstanceActive,
+		"heartbeat": bson.M{"$lt": expired},
+	}).All(&instances); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Failed to get lost instances")
+		return
+	}
+
+	for _, i := range instances {
+		// an instance is marked as lost by a single node
+		if err := db.Instances().Update(bson.M{
+			"_id":       i.ID,
+			"status":    common.InstanceActive,
+			"heartbeat": i.Heartbeat,
+		}, bson.M{"$set": bson.M{"status": common.InstanceLost}}); err != nil {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"Hostname":  i.Hostname,
+			"Heartbeat": i.Heartbeat,
+		}).Warningln("Instance lost")
+
+		FailJobs(i.Hostname, "Job was running on instance "+i.Hostname+" which stopped sending heartbeats")
+	}
+}
+
+// FailJobs marks the jobs running on the node as error with the explanation
+// and releases the jobs blocked by them
+func FailJobs(hostname string, explanation string) {
+	active := bson.M{
+		"execution_node": hostname,
+		"status":         bson.M{"$in": []string{"waiting", "running"}},
+	}
+
+	for _, name := range jobCollections {
+		var jobs []struct {
+			ID bson.ObjectId `bson:"_id"`
+		}
+		if err := db.C(name).Find(active).Select(bson.M{"_id": 1}).All(&jobs); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Collection": name,
+				"Error":      err.Error(),
+			}).Errorln("Failed to get jobs of instance")
+			continue
+		}
+
+		for _, j := range jobs {
+			query := bson.M{"_id": j.ID, "status": active["status"]}
+			if err := db.C(name).Update(query, bson.M{"$set": bson.M{
+				"status":          "error",
+				"failed":          true,
+				"finished":        time.Now(),
+				"job_explanation": explanation,
+			}}); err != nil {
+				continue
+			}
+
+			logrus.WithFields(logrus.Fields{
+				"Job ID":   j.ID.Hex(),
+				"Hostname": hostname,
+			}).Warningln("Job of instance marked as error")
+			blocking.Finish(j.ID)
+		}
+	}
+}
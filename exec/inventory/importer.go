@@ -0,0 +1,425 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// implicit groups of an Ansible inventory, they are not imported as groups
+const (
+	groupAll       = "all"
+	groupUngrouped = "ungrouped"
+)
+
+// Data is the output of an Ansible dynamic inventory script
+type Data struct {
+	Groups   map[string]*GroupData
+	HostVars map[string]map[string]interface{}
+}
+
+// GroupData is a group of the dynamic inventory
+type GroupData struct {
+	Hosts    []string
+	Vars     map[string]interface{}
+	Children []string
+}
+
+// Parse parses and validates the output of an inventory script called with --list.
+// Groups are either a list of hosts or an object with hosts, vars and children,
+// host variables are read from _meta.hostvars. Children that are not defined
+// as groups are added as empty groups
+func Parse(b []byte) (*Data, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("inventory must be a JSON object: %s", err.Error())
+	}
+
+	data := &Data{
+		Groups:   map[string]*GroupData{},
+		HostVars: map[string]map[string]interface{}{},
+	}
+
+	for name, v := range raw {
+		if name == "_meta" {
+			var meta struct {
+				HostVars map[string]map[string]interface{} `json:"hostvars"`
+			}
+			if err := json.Unmarshal(v, &meta); err != nil {
+				return nil, fmt.Errorf("_meta must contain hostvars object of host variables: %s", err.Error())
+			}
+			if meta.HostVars != nil {
+				data.HostVars = meta.HostVars
+			}
+			continue
+		}
+
+		if len(name) == 0 {
+			return nil, fmt.Errorf("group name must not be empty")
+		}
+
+		group, err := parseGroup(name, v)
+		if err != nil {
+			return nil, err
+		}
+		data.Groups[name] = group
+	}
+
+	for name, group := range data.Groups {
+		for _, host := range group.Hosts {
+			if len(host) == 0 {
+				return nil, fmt.Errorf("group %q contains a host without name", name)
+			}
+		}
+		for _, child := range group.Children {
+			if child == name {
+				return nil, fmt.Errorf("group %q must not be a child of itself", name)
+			}
+			if len(child) == 0 {
+				return nil, fmt.Errorf("group %q contains a child without name", name)
+			}
+			if _, ok := data.Groups[child]; !ok {
+				data.Groups[child] = &GroupData{}
+			}
+		}
+	}
+
+	return data, nil
+}
+
+func parseGroup(name string, v json.RawMessage) (*GroupData, error) {
+	// legacy format, the group is a list of hosts
+	var hosts []string
+	if err := json.Unmarshal(v, &hosts); err == nil {
+		return &GroupData{Hosts: hosts}, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(v, &fields); err != nil {
+		return nil, fmt.Errorf("group %q must be a list of hosts or an object", name)
+	}
+
+	group := &GroupData{}
+	for k, f := range fields {
+		var err error
+		switch k {
+		case "hosts":
+			err = json.Unmarshal(f, &group.Hosts)
+		case "vars":
+			err = json.Unmarshal(f, &group.Vars)
+		case "children":
+			err = json.Unmarshal(f, &group.Children)
+		default:
+			return nil, fmt.Errorf("group %q contains invalid key %q", name, k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("group %q has invalid %s: %s", name, k, err.Error())
+		}
+	}
+	return group, nil
+}
+
+// changes are the modifications of an inventory required to import
+// the output of an inventory source
+type changes struct {
+	newGroups     []ansible.Group
+	updatedGroups []ansible.Group
+	removedGroups []bson.ObjectId
+	newHosts      []ansible.Host
+	updatedHosts  []ansible.Host
+	removedHosts  []bson.ObjectId
+}
+
+func (c changes) String() string {
+	return fmt.Sprintf("%d groups added, %d groups updated, %d groups removed, %d hosts added, %d hosts updated, %d hosts removed",
+		len(c.newGroups), len(c.updatedGroups), len(c.removedGroups),
+		len(c.newHosts), len(c.updatedHosts), len(c.removedHosts))
+}
+
+// plan compares the data of the inventory source with the existing groups and hosts
+// of the inventory.
+// Groups and hosts are matched by name. Since a host belongs to a single group and a
+// group has a single parent, the first group listing a host and the first parent of
+// a group in name order are used. Hosts and groups without a group are placed into
+// the group of the inventory source.
+// Unless overwrite is set, existing memberships are kept and hosts and groups missing
+// from the source are not removed. Variables are merged with the existing variables
+// unless overwrite_vars is set. Only hosts and groups imported by the source are removed
+func plan(src ansible.InventorySource, data *Data, groups []ansible.Group, hosts []ansible.Host, now time.Time) (changes, error) {
+	var c changes
+
+	existingGroups := map[string]ansible.Group{}
+	for _, v := range groups {
+		existingGroups[v.Name] = v
+	}
+	existingHosts := map[string]ansible.Host{}
+	for _, v := range hosts {
+		existingHosts[v.Name] = v
+	}
+
+	names := []string{}
+	for name := range data.Groups {
+		if name != groupAll && name != groupUngrouped {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	// first parent of each group in name order
+	parents := map[string]string{}
+	for _, name := range names {
+		for _, child := range data.Groups[name].Children {
+			if _, ok := parents[child]; !ok && child != groupAll && child != groupUngrouped {
+				parents[child] = name
+			}
+		}
+	}
+	// a cycle can not be represented by parent references
+	for _, name := range names {
+		for p, ok := parents[name]; ok; p, ok = parents[p] {
+			if p == name {
+				delete(parents, name)
+				break
+			}
+		}
+	}
+
+	ids := map[string]bson.ObjectId{}
+	for _, name := range names {
+		if g, ok := existingGroups[name]; ok {
+			ids[name] = g.ID
+		} else {
+			ids[name] = bson.NewObjectId()
+		}
+	}
+
+	for _, name := range names {
+		parent := src.GroupID
+		if p, ok := parents[name]; ok {
+			id := ids[p]
+			parent = &id
+		}
+		if parent != nil && *parent == ids[name] {
+			parent = nil
+		}
+
+		g, exists := existingGroups[name]
+		if !exists {
+			g = ansible.Group{
+				ID:                  ids[name],
+				Name:                name,
+				InventoryID:         src.InventoryID,
+				HasInventorySources: true,
+				InventorySourceID:   &src.ID,
+				CreatedByID:         src.CreatedByID,
+				ModifiedByID:        src.CreatedByID,
+				Created:             now,
+			}
+		}
+		before := g
+
+		vars, err := mergeVariables(g.Variables, data.Groups[name].Vars, src.OverwriteVars)
+		if err != nil {
+			return c, fmt.Errorf("invalid variables of group %q: %s", name, err.Error())
+		}
+		g.Variables = vars
+		if !exists || src.Overwrite || g.ParentGroupID == nil {
+			g.ParentGroupID = parent
+		}
+
+		if !exists {
+			g.Modified = now
+			c.newGroups = append(c.newGroups, g)
+		} else if g.Variables != before.Variables || !sameID(g.ParentGroupID, before.ParentGroupID) {
+			g.Modified = now
+			c.updatedGroups = append(c.updatedGroups, g)
+		}
+	}
+
+	// first group of each host in name order
+	hostGroups := map[string]bson.ObjectId{}
+	hostNames := []string{}
+	order := append(append([]string{}, names...), groupAll, groupUngrouped)
+	for _, name := range order {
+		group, ok := data.Groups[name]
+		if !ok {
+			continue
+		}
+		for _, host := range group.Hosts {
+			if _, ok := hostGroups[host]; ok {
+				continue
+			}
+			hostNames = append(hostNames, host)
+			if id, ok := ids[name]; ok {
+				hostGroups[host] = id
+			} else {
+				hostGroups[host] = ""
+			}
+		}
+	}
+	sort.Strings(hostNames)
+
+	for _, name := range hostNames {
+		group := src.GroupID
+		if id := hostGroups[name]; id != "" {
+			group = &id
+		}
+
+		h, exists := existingHosts[name]
+		if !exists {
+			h = ansible.Host{
+				ID:                  bson.NewObjectId(),
+				Name:                name,
+				InventoryID:         src.InventoryID,
+				Enabled:             true,
+				HasInventorySources: true,
+				InventorySourceID:   &src.ID,
+				CreatedByID:         src.CreatedByID,
+				ModifiedByID:        src.CreatedByID,
+				Created:             now,
+			}
+		}
+		before := h
+
+		vars, err := mergeVariables(h.Variables, data.HostVars[name], src.OverwriteVars)
+		if err != nil {
+			return c, fmt.Errorf("invalid variables of host %q: %s", name, err.Error())
+		}
+		h.Variables = vars
+		if !exists || src.Overwrite || h.GroupID == nil {
+			h.GroupID = group
+		}
+
+		if !exists {
+			h.Modified = now
+			c.newHosts = append(c.newHosts, h)
+		} else if h.Variables != before.Variables || !sameID(h.GroupID, before.GroupID) {
+			h.Modified = now
+			c.updatedHosts = append(c.updatedHosts, h)
+		}
+	}
+
+	if src.Overwrite {
+		for _, g := range groups {
+			if _, ok := ids[g.Name]; !ok && sameID(g.InventorySourceID, &src.ID) {
+				c.removedGroups = append(c.removedGroups, g.ID)
+			}
+		}
+		for _, h := range hosts {
+			if _, ok := hostGroups[h.Name]; !ok && sameID(h.InventorySourceID, &src.ID) {
+				c.removedHosts = append(c.removedHosts, h.ID)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// mergeVariables returns the JSON encoded variables of a host or group.
+// The variables of the source replace the existing variables if overwrite is set,
+// otherwise they are merged into the existing variables
+func mergeVariables(existing string, vars map[string]interface{}, overwrite bool) (string, error) {
+	merged := map[string]interface{}{}
+	if !overwrite && len(existing) > 0 {
+		if err := json.Unmarshal([]byte(existing), &merged); err != nil {
+			// existing variables which are not valid JSON are replaced
+			merged = map[string]interface{}{}
+		}
+	}
+	for k, v := range vars {
+		merged[k] = v
+	}
+
+	if len(merged) == 0 {
+		if overwrite {
+			return "", nil
+		}
+		return existing, nil
+	}
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func sameID(a, b *bson.ObjectId) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// apply writes the changes to the inventory and updates the
+// inventory counters
+func apply(src ansible.InventorySource, c changes) error {
+	for _, g := range append(c.newGroups, c.updatedGroups...) {
+		if _, err := db.Groups().UpsertId(g.ID, g); err != nil {
+			return err
+		}
+	}
+
+	for _, h := range append(c.newHosts, c.updatedHosts...) {
+		if _, err := db.Hosts().UpsertId(h.ID, h); err != nil {
+			return err
+		}
+	}
+
+	if len(c.removedHosts) > 0 {
+		if _, err := db.Hosts().RemoveAll(bson.M{"_id": bson.M{"$in": c.removedHosts}}); err != nil {
+			return err
+		}
+	}
+
+	if len(c.removedGroups) > 0 {
+		if _, err := db.Groups().RemoveAll(bson.M{"_id": bson.M{"$in": c.removedGroups}}); err != nil {
+			return err
+		}
+		// hosts and groups that were added by hand to a removed group are kept
+		if _, err := db.Hosts().UpdateAll(bson.M{"group_id": bson.M{"$in": c.removedGroups}},
+			bson.M{"$unset": bson.M{"group_id": ""}}); err != nil {
+			return err
+		}
+		if _, err := db.Groups().UpdateAll(bson.M{"parent_group_id": bson.M{"$in": c.removedGroups}},
+			bson.M{"$unset": bson.M{"parent_group_id": ""}}); err != nil {
+			return err
+		}
+	}
+
+	return updateInventory(src.InventoryID)
+}
+
+// updateInventory updates the host, group and inventory source counters of the inventory
+func updateInventory(inventoryID bson.ObjectId) error {
+	q := bson.M{"inventory_id": inventoryID}
+	totalHosts, err := db.Hosts().Find(q).Count()
+	if err != nil {
+		return err
+	}
+	totalGroups, err := db.Groups().Find(q).Count()
+	if err != nil {
+		return err
+	}
+	totalSources, err := db.InventorySources().Find(q).Count()
+	if err != nil {
+		return err
+	}
+	failedSources, err := db.InventorySources().Find(bson.M{"inventory_id": inventoryID, "last_update_failed": true}).Count()
+	if err != nil {
+		return err
+	}
+
+	return db.Inventories().UpdateId(inventoryID, bson.M{"$set": bson.M{
+		"total_hosts":                     totalHosts,
+		"total_groups":                    totalGroups,
+		"has_inventory_sources":           totalSources > 0,
+		"total_inventory_sources":         totalSources,
+		"inventory_sources_with_failures": failedSources,
+	}})
+}
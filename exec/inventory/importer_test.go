@@ -0,0 +1,203 @@
+package inventory
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// output of ec2.py --list, shortened
+const ec2Output = `{
+  "_meta": {
+    "hostvars": {
+      "10.0.0.1": {"ec2_id": "i-0001", "ec2_region": "us-east-1"},
+      "10.0.0.2": {"ec2_id": "i-0002", "ec2_region": "us-east-1"}
+    }
+  },
+  "ec2": ["10.0.0.1", "10.0.0.2"],
+  "us-east-1": {"hosts": ["10.0.0.1", "10.0.0.2"], "vars": {"region": "us-east-1"}},
+  "tag_Role_web": ["10.0.0.1"],
+  "tags": {"children": ["tag_Role_web"]},
+  "all": {"children": ["ec2", "us-east-1", "tags"]}
+}`
+
+func source() ansible.InventorySource {
+	return ansible.InventorySource{
+		ID:          bson.NewObjectId(),
+		Source:      ansible.InventorySourceEC2,
+		InventoryID: bson.NewObjectId(),
+	}
+}
+
+func vars(t *testing.T, s string) map[string]interface{} {
+	v := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestParse(t *testing.T) {
+	data, err := Parse([]byte(ec2Output))
+	assert.NoError(t, err)
+
+	assert.Len(t, data.Groups, 5)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, data.Groups["ec2"].Hosts)
+	assert.Equal(t, "us-east-1", data.Groups["us-east-1"].Vars["region"])
+	assert.Equal(t, []string{"tag_Role_web"}, data.Groups["tags"].Children)
+	assert.Equal(t, "i-0002", data.HostVars["10.0.0.2"]["ec2_id"])
+
+	// undefined children are added as empty groups
+	data, err = Parse([]byte(`{"web": {"children": ["frontend"]}}`))
+	assert.NoError(t, err)
+	assert.NotNil(t, data.Groups["frontend"])
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, output := range []string{
+		``,
+		`[]`,
+		`{"web": "10.0.0.1"}`,
+		`{"web": {"hosts": "10.0.0.1"}}`,
+		`{"web": {"hosts": [1, 2]}}`,
+		`{"web": {"vars": []}}`,
+		`{"web": {"hostvars": {}}}`,
+		`{"web": {"children": ["web"]}}`,
+		`{"_meta": {"hostvars": []}}`,
+	} {
+		_, err := Parse([]byte(output))
+		assert.Error(t, err, output)
+	}
+}
+
+func TestPlanNewInventory(t *testing.T) {
+	src := source()
+	data, err := Parse([]byte(ec2Output))
+	assert.NoError(t, err)
+
+	c, err := plan(src, data, nil, nil, time.Now())
+	assert.NoError(t, err)
+
+	assert.Len(t, c.newGroups, 4, "all is not imported")
+	assert.Len(t, c.newHosts, 2)
+	assert.Empty(t, c.updatedGroups)
+	assert.Empty(t, c.removedHosts)
+
+	groups := map[string]ansible.Group{}
+	for _, g := range c.newGroups {
+		assert.Equal(t, src.InventoryID, g.InventoryID)
+		assert.Equal(t, src.ID, *g.InventorySourceID)
+		groups[g.Name] = g
+	}
+	assert.Equal(t, groups["tags"].ID, *groups["tag_Role_web"].ParentGroupID)
+	assert.Nil(t, groups["ec2"].ParentGroupID)
+	assert.Equal(t, map[string]interface{}{"region": "us-east-1"}, vars(t, groups["us-east-1"].Variables))
+
+	// hosts are placed into the first group listing them
+	for _, h := range c.newHosts {
+		assert.Equal(t, groups["ec2"].ID, *h.GroupID)
+		assert.True(t, h.Enabled)
+	}
+	assert.Equal(t, "i-0001", vars(t, c.newHosts[0].Variables)["ec2_id"])
+}
+
+func TestPlanSourceGroup(t *testing.T) {
+	src := source()
+	group := bson.NewObjectId()
+	src.GroupID = &group
+
+	data, err := Parse([]byte(`{"web": ["10.0.0.1"], "ungrouped": ["10.0.0.2"]}`))
+	assert.NoError(t, err)
+
+	c, err := plan(src, data, nil, nil, time.Now())
+	assert.NoError(t, err)
+
+	assert.Len(t, c.newGroups, 1)
+	assert.Equal(t, group, *c.newGroups[0].ParentGroupID)
+	assert.Equal(t, "10.0.0.2", c.newHosts[1].Name)
+	assert.Equal(t, group, *c.newHosts[1].GroupID, "ungrouped hosts are placed into the source group")
+}
+
+func TestPlanMergeVariables(t *testing.T) {
+	src := source()
+	existing := ansible.Host{
+		ID:          bson.NewObjectId(),
+		Name:        "10.0.0.1",
+		InventoryID: src.InventoryID,
+		Variables:   `{"ansible_user": "centos", "ec2_id": "i-old"}`,
+	}
+
+	data, err := Parse([]byte(ec2Output))
+	assert.NoError(t, err)
+
+	c, err := plan(src, data, nil, []ansible.Host{existing}, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, c.newHosts, 1)
+	assert.Len(t, c.updatedHosts, 1)
+	assert.Equal(t, existing.ID, c.updatedHosts[0].ID)
+	assert.Equal(t, map[string]interface{}{
+		"ansible_user": "centos",
+		"ec2_id":       "i-0001",
+		"ec2_region":   "us-east-1",
+	}, vars(t, c.updatedHosts[0].Variables))
+	assert.Nil(t, c.updatedHosts[0].InventorySourceID, "hosts created by hand are not taken over")
+
+	src.OverwriteVars = true
+	c, err = plan(src, data, nil, []ansible.Host{existing}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"ec2_id":     "i-0001",
+		"ec2_region": "us-east-1",
+	}, vars(t, c.updatedHosts[0].Variables))
+}
+
+func TestPlanOverwrite(t *testing.T) {
+	src := source()
+	manual := bson.NewObjectId()
+	groups := []ansible.Group{
+		{ID: bson.NewObjectId(), Name: "ec2", InventoryID: src.InventoryID, InventorySourceID: &src.ID, ParentGroupID: &manual},
+		{ID: bson.NewObjectId(), Name: "tag_Role_db", InventoryID: src.InventoryID, InventorySourceID: &src.ID},
+		{ID: manual, Name: "datacenter", InventoryID: src.InventoryID},
+	}
+	hosts := []ansible.Host{
+		{ID: bson.NewObjectId(), Name: "10.0.0.9", InventoryID: src.InventoryID, InventorySourceID: &src.ID},
+		{ID: bson.NewObjectId(), Name: "10.0.0.10", InventoryID: src.InventoryID},
+	}
+
+	data, err := Parse([]byte(ec2Output))
+	assert.NoError(t, err)
+
+	// without overwrite nothing is removed and existing memberships are kept
+	c, err := plan(src, data, groups, hosts, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, c.removedGroups)
+	assert.Empty(t, c.removedHosts)
+	assert.Len(t, c.newGroups, 3)
+	assert.Empty(t, c.updatedGroups)
+
+	src.Overwrite = true
+	c, err = plan(src, data, groups, hosts, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, []bson.ObjectId{groups[1].ID}, c.removedGroups)
+	assert.Equal(t, []bson.ObjectId{hosts[0].ID}, c.removedHosts, "hosts created by hand are never removed")
+	assert.Len(t, c.updatedGroups, 1)
+	assert.Nil(t, c.updatedGroups[0].ParentGroupID)
+}
+
+func TestPlanCycle(t *testing.T) {
+	data, err := Parse([]byte(`{"a": {"children": ["b"]}, "b": {"children": ["a"]}}`))
+	assert.NoError(t, err)
+
+	c, err := plan(source(), data, nil, nil, time.Now())
+	assert.NoError(t, err)
+
+	roots := 0
+	for _, g := range c.newGroups {
+		if g.ParentGroupID == nil {
+			roots++
+		}
+	}
+	assert.Equal(t, 1, roots)
+}
@@ -0,0 +1,450 @@
+// Package inventory synchronizes inventory sources by running the packaged
+// cloud inventory scripts or custom inventory scripts and importing their
+// output into the inventory.
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/adjust/uniuri"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/exec/worker"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// scriptPath is the directory of the packaged inventory scripts
+const scriptPath = "/var/lib/tensor/plugins/inventory"
+
+// configEnv is the environment variable used by each inventory script
+// to locate its configuration file
+var configEnv = map[string]string{
+	ansible.InventorySourceEC2:       "EC2_INI_PATH",
+	ansible.InventorySourceGCE:       "GCE_INI_PATH",
+	ansible.InventorySourceAzureRM:   "AZURE_INI_PATH",
+	ansible.InventorySourceOpenStack: "OS_CLIENT_CONFIG_FILE",
+	ansible.InventorySourceVMware:    "VMWARE_INI",
+	ansible.InventorySourceForeman:   "FOREMAN_INI_PATH",
+}
+
+// Run starts the workers consuming the inventory update queue
+func Run() {
+	worker.Run(queue.InventoryUpdate, util.Config.InventoryWorkers, handleUpdate)
+}
+
+// handleUpdate runs a inventory update delivered by the queue
+func handleUpdate(d queue.Delivery) {
+	var msg types.Message
+	if err := json.Unmarshal(d.Body(), &msg); err != nil {
+		logrus.Warningln("Inventory update delivery rejected")
+		d.DeadLetter()
+		return
+	}
+
+	// the message may be delivered again after the node was restarted
+	if misc.IsStarted(db.InventoryUpdates(), msg.JobID) {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Update ID": msg.JobID.Hex(),
+		}).Warningln("Inventory update was already started, delivery skipped")
+		d.Ack()
+		return
+	}
+
+	jb := types.InventoryUpdateJob{}
+	if err := db.InventoryUpdates().FindId(msg.JobID).One(&jb.Update); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Update ID": msg.JobID.Hex(),
+			"Error":               err.Error(),
+		}).Warningln("Inventory update could not be loaded, delivery skipped")
+		d.Ack()
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Inventory Update ID": jb.Update.ID.Hex(),
+		"Name":                jb.Update.Name,
+	}).Infoln("Inventory update successfuly received")
+
+	if err := load(&jb); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Update ID": jb.Update.ID.Hex(),
+			"Error":               err.Error(),
+		}).Errorln("Inventory update can not be started")
+		jb.Update.JobExplanation = err.Error()
+		jobError(&jb)
+		d.Ack()
+		return
+	}
+
+	// update may have been canceled while it was in the queue
+	if misc.IsCanceled(db.InventoryUpdates(), jb.Update.ID) {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Update ID": jb.Update.ID.Hex(),
+		}).Infoln("Inventory update was canceled before it started")
+		jobCancel(&jb)
+		d.Ack()
+		return
+	}
+
+	status(&jb, "pending")
+	// wait for the capacity of the node
+	impact, ok := worker.Acquire(1)
+	if !ok {
+		d.Reject()
+		return
+	}
+	updateRun(&jb)
+	worker.NodeCapacity().Release(impact)
+	d.Ack()
+}
+
+// load loads the source, the inventory, the credential and the inventory script of the update.
+// They are loaded from the database when the update is run and are not stored in the queue
+func load(j *types.InventoryUpdateJob) error {
+	var err error
+	if err = db.InventorySources().FindId(j.Update.InventorySourceID).One(&j.Source); err != nil {
+		return errors.New("Error while getting inventory source: " + err.Error())
+	}
+
+	if err = db.Inventories().FindId(j.Source.InventoryID).One(&j.Inventory); err != nil {
+		return errors.New("Error while getting inventory: " + err.Error())
+	}
+
+	if j.Credential, err = misc.LoadCredential(j.Source.CredentialID, "cloud"); err != nil {
+		return err
+	}
+
+	if j.Source.Source == ansible.InventorySourceCustom {
+		if j.Source.SourceScriptID == nil {
+			return errors.New("Inventory source does not have an inventory script")
+		}
+		if err = db.InventoryScripts().FindId(*j.Source.SourceScriptID).One(&j.Script); err != nil {
+			return errors.New("Error while getting inventory script: " + err.Error())
+		}
+	}
+
+	j.User = misc.LoadUser(j.Update.CreatedByID)
+	return nil
+}
+
+func updateRun(j *types.InventoryUpdateJob) {
+	// the update may have been canceled since its cancel_flag was checked
+	if !start(j) {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Update ID": j.Update.ID.Hex(),
+		}).Infoln("Inventory update was canceled or started by another node, run aborted")
+		if misc.IsCanceled(db.InventoryUpdates(), j.Update.ID) {
+			jobCancel(j)
+		}
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Inventory Update ID": j.Update.ID.Hex(),
+		"Source":              j.Source.Source,
+	}).Infoln("Inventory update started")
+
+	// terraform sources are imported without an inventory script
+	if j.Source.Source == ansible.InventorySourceTerraform {
+		terraformRun(j)
+		return
+	}
+
+	cmd, cleanup, err := getCmd(j)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Running inventory script failed")
+		j.Update.ResultStdout = "stdout capture is missing"
+		j.Update.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	defer func() {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Update ID": j.Update.ID.Hex(),
+			"Status":              j.Update.Status,
+		}).Infoln("Stopped running inventory update")
+		cleanup()
+	}()
+
+	// the inventory is written to stdout, messages of the script
+	// are stored as the output of the update
+	var inventory bytes.Buffer
+	b := misc.NewOutputWriter(j.Update.ID)
+	cmd.Stdout = &inventory
+	cmd.Stderr = b
+
+	// Set setsid to create a new session, The new process group has no controlling
+	// terminal which disables the stdin & will skip prompts
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	if err := cmd.Start(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Running inventory script failed")
+		b.Close()
+		j.Update.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	timer := time.AfterFunc(time.Duration(util.Config.InventoryUpdateTimeOut)*time.Second, func() {
+		logrus.Println("Killing the process. Execution exceeded threashold value")
+		misc.KillProcessGroup(cmd)
+	})
+
+	// kill the process group when a cancel is requested
+	watcher := misc.WatchCancel(db.InventoryUpdates(), j.Update.ID, cmd)
+
+	err = cmd.Wait()
+	timer.Stop()
+	watcher.Stop()
+
+	if err != nil {
+		b.Close()
+		if watcher.Canceled() {
+			jobCancel(j)
+			return
+		}
+		if watcher.Terminated() {
+			j.Update.JobExplanation = misc.TerminatedExplanation
+			jobError(j)
+			return
+		}
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Running inventory script failed")
+		j.Update.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	if err := importInventory(j, inventory.Bytes(), b); err != nil {
+		fmt.Fprintln(b, err.Error())
+		b.Close()
+		j.Update.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	b.Close()
+	jobSuccess(j)
+}
+
+// terraformRun imports the inventory of a terraform source
+func terraformRun(j *types.InventoryUpdateJob) {
+	b := misc.NewOutputWriter(j.Update.ID)
+
+	data, err := terraformInventory(j.Source, b)
+	if err == nil {
+		err = importData(j, data, b)
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Importing terraform inventory failed")
+		fmt.Fprintln(b, err.Error())
+		b.Close()
+		j.Update.JobExplanation = err.Error()
+		jobFail(j)
+		return
+	}
+
+	b.Close()
+	jobSuccess(j)
+}
+
+// importInventory parses the output of the inventory script and imports
+// it into the inventory of the source
+func importInventory(j *types.InventoryUpdateJob, output []byte, log *misc.OutputWriter) error {
+	data, err := Parse(output)
+	if err != nil {
+		return fmt.Errorf("Invalid inventory script output: %s", err.Error())
+	}
+	return importData(j, data, log)
+}
+
+// importData imports the groups and hosts into the inventory of the source
+func importData(j *types.InventoryUpdateJob, data *Data, log *misc.OutputWriter) error {
+	fmt.Fprintf(log, "Loaded %d groups and %d host variables from %s\n",
+		len(data.Groups), len(data.HostVars), j.Source.Source)
+
+	var groups []ansible.Group
+	if err := db.Groups().Find(bson.M{"inventory_id": j.Source.InventoryID}).All(&groups); err != nil {
+		return fmt.Errorf("Error while getting inventory groups: %s", err.Error())
+	}
+	var hosts []ansible.Host
+	if err := db.Hosts().Find(bson.M{"inventory_id": j.Source.InventoryID}).All(&hosts); err != nil {
+		return fmt.Errorf("Error while getting inventory hosts: %s", err.Error())
+	}
+
+	c, err := plan(j.Source, data, groups, hosts, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if err := apply(j.Source, c); err != nil {
+		return fmt.Errorf("Error while importing inventory: %s", err.Error())
+	}
+	fmt.Fprintln(log, "Inventory import completed,", c.String())
+	return nil
+}
+
+// getCmd returns the command of the inventory script wrapped in proot
+func getCmd(j *types.InventoryUpdateJob) (cmd *exec.Cmd, cleanup func(), err error) {
+	// Generate directory paths and create directories
+	tmp := misc.TempPath(j.Update.ID) + "/"
+	j.Paths = types.JobPaths{
+		Etc:            filepath.Join(tmp, uniuri.New()),
+		Tmp:            filepath.Join(tmp, uniuri.New()),
+		VarLib:         filepath.Join(tmp, uniuri.New()),
+		VarLog:         filepath.Join(tmp, uniuri.New()),
+		TmpRand:        misc.TempPath(j.Update.ID),
+		CredentialPath: misc.TempPath(j.Update.ID),
+	}
+	createTmpDirs(j)
+
+	removeTmp := func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			logrus.Errorln("Unable to remove tmp directories")
+		}
+		if err := os.RemoveAll(j.Paths.TmpRand); err != nil {
+			logrus.Errorln("Unable to remove tmp random tmp dir")
+		}
+		if err := os.RemoveAll(j.Paths.CredentialPath); err != nil {
+			logrus.Errorln("Unable to remove credential directories")
+		}
+	}
+
+	script := filepath.Join(scriptPath, j.Source.Source+".py")
+	if j.Source.Source == ansible.InventorySourceCustom {
+		script = filepath.Join(j.Paths.TmpRand, "inventory_script")
+		if err = ioutil.WriteFile(script, []byte(j.Script.Script), 0700); err != nil {
+			removeTmp()
+			return nil, nil, err
+		}
+	}
+
+	pargs := []string{"-v", "0", "-r", "/",
+		"-b", j.Paths.Etc + ":/etc/tensor",
+		"-b", j.Paths.Tmp + ":/tmp",
+		"-b", j.Paths.VarLib + ":/var/lib/tensor",
+		"-b", j.Paths.VarLog + ":/var/log",
+		"-b", j.Paths.TmpRand + ":" + j.Paths.TmpRand,
+		"-b", j.Paths.CredentialPath + ":" + j.Paths.CredentialPath,
+		"-b", scriptPath + ":" + scriptPath,
+		"-w", j.Paths.TmpRand,
+		script, "--list",
+	}
+	j.Update.JobARGS = []string{"proot " + strings.Join(pargs, " ")}
+	j.Update.JobCWD = j.Paths.TmpRand
+
+	env := []string{
+		"TERM=xterm",
+		"PWD=" + j.Paths.TmpRand,
+		"SHLVL=0",
+		"HOME=" + os.Getenv("HOME"),
+		"_=/usr/bin/tensord",
+		"PROOT_NO_SECCOMP=1",
+		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	}
+
+	// regions are given to the scripts which read them from the environment,
+	// other scripts read the regions from their configuration file
+	if len(j.Source.SourceRegions) > 0 {
+		switch j.Source.Source {
+		case ansible.InventorySourceRAX:
+			env = append(env, "RAX_REGION="+j.Source.SourceRegions)
+		case ansible.InventorySourceGCE:
+			env = append(env, "GCE_ZONE="+j.Source.SourceRegions)
+		}
+	}
+
+	// environment without credentials
+	j.Update.JobENV = append([]string{}, env...)
+
+	config := configFile(j)
+	if len(config) > 0 {
+		if v, ok := configEnv[j.Source.Source]; ok {
+			path := filepath.Join(j.Paths.CredentialPath, j.Source.Source+".ini")
+			if err = ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+				removeTmp()
+				return nil, nil, err
+			}
+			env = append(env, v+"="+path)
+			j.Update.JobENV = append(j.Update.JobENV, v+"="+path)
+		}
+	}
+
+	var f *os.File
+	if j.Credential.Cloud {
+		env, f, err = misc.GetCloudCredential(env, j.Credential, misc.TempPrefix(j.Update.ID))
+		if err != nil {
+			removeTmp()
+			return nil, nil, err
+		}
+	}
+
+	cmd = exec.Command("proot", pargs...)
+	cmd.Dir = j.Paths.TmpRand
+	cmd.Env = env
+
+	return cmd, func() {
+		if f != nil {
+			if err := os.RemoveAll(f.Name()); err != nil {
+				logrus.Errorln("Unable to remove cloud credential")
+			}
+		}
+		removeTmp()
+	}, nil
+}
+
+// configFile returns the configuration file of the inventory script.
+// The foreman script reads its credential from the configuration file
+func configFile(j *types.InventoryUpdateJob) string {
+	if j.Source.Source != ansible.InventorySourceForeman || len(j.Credential.Host) == 0 {
+		return j.Source.SourceVars
+	}
+
+	config := "[foreman]\n" +
+		"url=" + j.Credential.Host + "\n" +
+		"user=" + j.Credential.Username + "\n" +
+		"password=" + string(util.Decipher(j.Credential.Password)) + "\n" +
+		"ssl_verify=True\n"
+	if !strings.Contains(j.Source.SourceVars, "[cache]") {
+		config += "[cache]\npath=" + j.Paths.TmpRand + "\nmax_age=0\n"
+	}
+	return config + j.Source.SourceVars
+}
+
+func createTmpDirs(j *types.InventoryUpdateJob) {
+	for _, dir := range []string{
+		j.Paths.Etc,
+		j.Paths.Tmp,
+		j.Paths.TmpRand,
+		j.Paths.VarLib,
+		j.Paths.VarLog,
+		j.Paths.CredentialPath,
+	} {
+		if err := os.MkdirAll(dir, 0770); err != nil {
+			logrus.Errorln("Unable to create directory: ", dir)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package inventory
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCmdCustomScript(t *testing.T) {
+	j := &types.InventoryUpdateJob{
+		Source: ansible.InventorySource{Source: ansible.InventorySourceCustom},
+		Script: ansible.InventoryScript{Script: "#!/bin/sh\necho '{}'\n"},
+	}
+
+	cmd, cleanup, err := getCmd(j)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	script := filepath.Join(j.Paths.TmpRand, "inventory_script")
+	assert.Equal(t, []string{script, "--list"}, cmd.Args[len(cmd.Args)-2:])
+	assert.True(t, strings.HasPrefix(j.Update.JobARGS[0], "proot "))
+
+	b, err := ioutil.ReadFile(script)
+	assert.NoError(t, err)
+	assert.Equal(t, j.Script.Script, string(b))
+	info, err := os.Stat(script)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	cleanup()
+	_, err = os.Stat(j.Paths.TmpRand)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,154 @@
+package inventory
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/types"
+)
+
+// start marks the update as running, it returns false when the update
+// was canceled or started by another node in the meantime
+func start(t *types.InventoryUpdateJob) bool {
+	started := time.Now()
+
+	d := bson.M{
+		"status":         "running",
+		"failed":         false,
+		"started":        started,
+		"execution_node": instance.Hostname(),
+	}
+
+	if err := misc.Start(db.InventoryUpdates(), t.Update.ID, d); err == mgo.ErrNotFound {
+		return false
+	} else if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": "running",
+			"Error":  err,
+		}).Errorln("Failed to update inventory update status")
+	}
+
+	t.Update.Status = "running"
+	t.Update.Started = started
+	updateSource(t)
+	return true
+}
+
+func status(t *types.InventoryUpdateJob, s string) {
+	t.Update.Status = s
+	d := bson.M{
+		"$set": bson.M{
+			"status": t.Update.Status,
+		},
+	}
+
+	if err := db.InventoryUpdates().UpdateId(t.Update.ID, d); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": t.Update.Status,
+			"Error":  err,
+		}).Errorln("Failed to update inventory update status")
+	}
+}
+
+func jobFail(t *types.InventoryUpdateJob) {
+	t.Update.Failed = true
+	finish(t, "failed", t.Update.JobExplanation)
+}
+
+func jobError(t *types.InventoryUpdateJob) {
+	t.Update.Failed = true
+	finish(t, "error", t.Update.JobExplanation)
+}
+
+func jobSuccess(t *types.InventoryUpdateJob) {
+	t.Update.Failed = false
+	finish(t, "successful", t.Update.JobExplanation)
+}
+
+func jobCancel(t *types.InventoryUpdateJob) {
+	t.Update.Failed = false
+
+	// an update canceled before it was started has no elapsed time
+	// and no output
+	if t.Update.Started.IsZero() {
+		t.Update.Started = time.Now()
+	}
+	if len(t.Update.ResultStdout) == 0 {
+		t.Update.ResultStdout = "stdout capture is missing"
+	}
+
+	finish(t, "canceled", "Job Cancelled")
+}
+
+// finish stores the final status and the output of the inventory update
+// and the result of the update in the inventory source
+func finish(t *types.InventoryUpdateJob, s string, explanation string) {
+	t.Update.Status = s
+	t.Update.Finished = time.Now()
+	t.Update.JobExplanation = explanation
+
+	//get elapsed time in minutes
+	diff := t.Update.Finished.Sub(t.Update.Started)
+
+	set := bson.M{
+		"status":          t.Update.Status,
+		"failed":          t.Update.Failed,
+		"finished":        t.Update.Finished,
+		"elapsed":         diff.Minutes(),
+		"result_stdout":   t.Update.ResultStdout,
+		"job_explanation": t.Update.JobExplanation,
+		"job_args":        t.Update.JobARGS,
+		"job_env":         t.Update.JobENV,
+		"job_cwd":         t.Update.JobCWD,
+	}
+	if s == "canceled" {
+		set["cancel_flag"] = true
+	}
+
+	if err := db.InventoryUpdates().UpdateId(t.Update.ID, bson.M{"$set": set}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Status": t.Update.Status,
+			"Error":  err,
+		}).Errorln("Failed to update inventory update status")
+	}
+
+	updateSource(t)
+	if err := updateInventory(t.Source.InventoryID); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory ID": t.Source.InventoryID.Hex(),
+			"Error":        err,
+		}).Errorln("Failed to update inventory")
+	}
+	blocking.Finish(t.Update.ID)
+}
+
+// updateSource stores the status of the update in the inventory source.
+// The last update time is only moved forward by successful updates, since
+// it is used to decide whether the cached inventory is still valid
+func updateSource(t *types.InventoryUpdateJob) {
+	set := bson.M{
+		"status":         t.Update.Status,
+		"last_update_id": t.Update.ID,
+	}
+	switch t.Update.Status {
+	case "successful":
+		set["last_updated"] = t.Update.Finished
+		set["last_update_failed"] = false
+	case "failed", "error":
+		set["last_update_failed"] = true
+	}
+
+	if err := db.InventorySources().UpdateId(t.Source.ID, bson.M{"$set": set}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Inventory Source ID": t.Source.ID.Hex(),
+			"Error":               err,
+		}).Errorln("Failed to update inventory source")
+	}
+}
@@ -0,0 +1,322 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"gopkg.in/mgo.v2"
+)
+
+// defaults of terraform sources
+const (
+	defaultHostnameAttributes = "public_ip,ipv4_address,access_ip_v4,private_ip"
+	defaultTerraformGroupBy   = "resource_type"
+)
+
+// terraform source group_by values
+const (
+	groupByResourceType = "resource_type"
+	groupByModule       = "module"
+	groupByTags         = "tags"
+)
+
+var rxUnsafeName = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// resource is a managed resource instance of a terraform state
+type resource struct {
+	Type       string
+	Module     string
+	Attributes map[string]interface{}
+	Tags       map[string]string
+}
+
+// terraformInventory returns the inventory of a terraform source from the state or the
+// outputs of the latest successful apply of the terraform job template
+func terraformInventory(src ansible.InventorySource, log io.Writer) (*Data, error) {
+	if src.TerraformJobTemplateID == nil {
+		return nil, fmt.Errorf("Inventory source does not have a terraform job template")
+	}
+
+	job, err := terraform.LatestApplyJob(*src.TerraformJobTemplateID)
+	if err == mgo.ErrNotFound {
+		return nil, fmt.Errorf("Terraform job template does not have a successful apply")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error while getting terraform job: %s", err.Error())
+	}
+
+	if src.TerraformImport == ansible.TerraformImportOutputs {
+		fmt.Fprintf(log, "Importing the outputs of terraform job %s\n", job.ID.Hex())
+		return outputsInventory(job.Outputs), nil
+	}
+
+	state, err := terraform.StateAt(job.JobTemplateID, job.Workspace, job.Finished)
+	if err == mgo.ErrNotFound {
+		return nil, fmt.Errorf("Terraform job %s did not store a state", job.ID.Hex())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error while getting terraform state: %s", err.Error())
+	}
+	fmt.Fprintf(log, "Importing version %d of the terraform state of job %s\n", state.Version, job.ID.Hex())
+
+	resources, err := parseState([]byte(state.State))
+	if err != nil {
+		return nil, err
+	}
+	return stateInventory(src, resources), nil
+}
+
+// parseState returns the managed resource instances of a terraform state.
+// Both the version 3 format with flattened attributes and the version 4 format are supported
+func parseState(b []byte) ([]resource, error) {
+	var state struct {
+		Version int `json:"version"`
+		// version 3
+		Modules []struct {
+			Path      []string `json:"path"`
+			Resources map[string]struct {
+				Type    string `json:"type"`
+				Primary *struct {
+					Attributes map[string]string `json:"attributes"`
+				} `json:"primary"`
+			} `json:"resources"`
+		} `json:"modules"`
+		// version 4
+		Resources []struct {
+			Module    string `json:"module"`
+			Mode      string `json:"mode"`
+			Type      string `json:"type"`
+			Instances []struct {
+				Attributes map[string]interface{} `json:"attributes"`
+			} `json:"instances"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("Invalid terraform state: %s", err.Error())
+	}
+
+	var resources []resource
+	if state.Version >= 4 {
+		for _, r := range state.Resources {
+			if r.Mode != "managed" {
+				continue
+			}
+			// module.a.module.b is the module b of the module a
+			var modules []string
+			parts := strings.Split(r.Module, ".")
+			for i := 1; i < len(parts); i += 2 {
+				modules = append(modules, parts[i])
+			}
+			for _, i := range r.Instances {
+				tags := map[string]string{}
+				if t, ok := i.Attributes["tags"].(map[string]interface{}); ok {
+					for k, v := range t {
+						tags[k] = fmt.Sprint(v)
+					}
+				}
+				resources = append(resources, resource{
+					Type:       r.Type,
+					Module:     strings.Join(modules, "_"),
+					Attributes: i.Attributes,
+					Tags:       tags,
+				})
+			}
+		}
+		return resources, nil
+	}
+
+	for _, m := range state.Modules {
+		var module []string
+		if len(m.Path) > 1 {
+			module = m.Path[1:]
+		}
+		for name, r := range m.Resources {
+			if strings.HasPrefix(name, "data.") || r.Primary == nil {
+				continue
+			}
+			attributes := map[string]interface{}{}
+			tags := map[string]string{}
+			for k, v := range r.Primary.Attributes {
+				attributes[k] = v
+				if strings.HasPrefix(k, "tags.") && k != "tags.%" {
+					tags[strings.TrimPrefix(k, "tags.")] = v
+				}
+			}
+			resources = append(resources, resource{
+				Type:       r.Type,
+				Module:     strings.Join(module, "_"),
+				Attributes: attributes,
+				Tags:       tags,
+			})
+		}
+	}
+	return resources, nil
+}
+
+// stateInventory maps the resources to hosts and groups using the rules of the source.
+// A resource becomes a host if it has one of the host name attributes,
+// hosts are grouped by resource type, module or tags as configured by group_by
+func stateInventory(src ansible.InventorySource, resources []resource) *Data {
+	data := &Data{
+		Groups:   map[string]*GroupData{},
+		HostVars: map[string]map[string]interface{}{},
+	}
+
+	hostnames := splitList(src.HostnameAttributes, defaultHostnameAttributes)
+	groupBy := splitList(src.GroupBy, defaultTerraformGroupBy)
+	hostVars := splitList(src.HostVarAttributes, "")
+
+	for _, r := range resources {
+		var host string
+		for _, attr := range hostnames {
+			if v, ok := attribute(r.Attributes, attr); ok && v != nil && fmt.Sprint(v) != "" {
+				host = fmt.Sprint(v)
+				break
+			}
+		}
+		if len(host) == 0 {
+			continue
+		}
+
+		vars := map[string]interface{}{}
+		for _, attr := range hostVars {
+			if v, ok := attribute(r.Attributes, attr); ok {
+				vars[safeName(attr)] = v
+			}
+		}
+		data.HostVars[host] = vars
+
+		var groups []string
+		for _, by := range groupBy {
+			switch by {
+			case groupByResourceType:
+				groups = append(groups, safeName(r.Type))
+			case groupByModule:
+				if len(r.Module) > 0 {
+					groups = append(groups, safeName("module_"+r.Module))
+				}
+			case groupByTags:
+				for k, v := range r.Tags {
+					groups = append(groups, safeName("tag_"+k+"_"+v))
+				}
+			}
+		}
+		if len(groups) == 0 {
+			groups = []string{groupUngrouped}
+		}
+		for _, name := range groups {
+			addHost(data, name, host)
+		}
+	}
+
+	return data
+}
+
+// outputsInventory maps the outputs to groups, each output with a host name or a list of
+// host names as value becomes a group of the same name. Sensitive outputs are not imported
+func outputsInventory(outputs map[string]terraform.Output) *Data {
+	data := &Data{
+		Groups:   map[string]*GroupData{},
+		HostVars: map[string]map[string]interface{}{},
+	}
+
+	for name, o := range outputs {
+		if o.Sensitive {
+			continue
+		}
+
+		var hosts []string
+		switch v := o.Value.(type) {
+		case string:
+			hosts = []string{v}
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					hosts = append(hosts, s)
+				}
+			}
+		}
+
+		for _, host := range hosts {
+			if len(host) == 0 {
+				continue
+			}
+			addHost(data, safeName(name), host)
+			if _, ok := data.HostVars[host]; !ok {
+				data.HostVars[host] = map[string]interface{}{}
+			}
+		}
+	}
+
+	return data
+}
+
+// attribute returns the value of the attribute, nested attributes are
+// looked up using a dotted path such as network_interface.0.access_config.0.nat_ip
+func attribute(attributes map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := attributes[name]; ok {
+		return v, true
+	}
+
+	var value interface{} = attributes
+	for _, key := range strings.Split(name, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			value = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func addHost(data *Data, group string, host string) {
+	g, ok := data.Groups[group]
+	if !ok {
+		g = &GroupData{}
+		data.Groups[group] = g
+	}
+	for _, h := range g.Hosts {
+		if h == host {
+			return
+		}
+	}
+	g.Hosts = append(g.Hosts, host)
+	sort.Strings(g.Hosts)
+}
+
+// safeName replaces the characters that are not valid in a group or variable name
+func safeName(name string) string {
+	return rxUnsafeName.ReplaceAllString(name, "_")
+}
+
+// splitList splits a comma separated list, def is used if the list is empty
+func splitList(list string, def string) []string {
+	if len(strings.TrimSpace(list)) == 0 {
+		list = def
+	}
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
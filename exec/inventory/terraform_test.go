@@ -0,0 +1,143 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/stretchr/testify/assert"
+)
+
+// terraform 0.11 state, shortened
+const stateV3 = `{
+  "version": 3,
+  "modules": [
+    {
+      "path": ["root"],
+      "resources": {
+        "aws_instance.web": {
+          "type": "aws_instance",
+          "primary": {"id": "i-0001", "attributes": {
+            "id": "i-0001", "public_ip": "52.0.0.1", "private_ip": "10.0.0.1",
+            "instance_type": "t2.micro", "tags.%": "1", "tags.Role": "web"}}
+        },
+        "data.aws_ami.ubuntu": {
+          "type": "aws_ami",
+          "primary": {"id": "ami-1", "attributes": {"id": "ami-1", "public_ip": "1.1.1.1"}}
+        },
+        "aws_security_group.web": {
+          "type": "aws_security_group",
+          "primary": {"id": "sg-1", "attributes": {"id": "sg-1"}}
+        }
+      }
+    },
+    {
+      "path": ["root", "db"],
+      "resources": {
+        "aws_instance.db": {
+          "type": "aws_instance",
+          "primary": {"id": "i-0002", "attributes": {"id": "i-0002", "private_ip": "10.0.0.2"}}
+        }
+      }
+    }
+  ]
+}`
+
+// terraform 0.12 state, shortened
+const stateV4 = `{
+  "version": 4,
+  "resources": [
+    {
+      "mode": "managed", "type": "google_compute_instance", "name": "app", "module": "module.app",
+      "instances": [
+        {"attributes": {"name": "app-0", "labels": {"role": "app"},
+          "network_interface": [{"network_ip": "10.1.0.1", "access_config": [{"nat_ip": "35.0.0.1"}]}]}},
+        {"attributes": {"name": "app-1",
+          "network_interface": [{"network_ip": "10.1.0.2", "access_config": []}]}}
+      ]
+    },
+    {
+      "mode": "data", "type": "google_compute_image", "name": "debian",
+      "instances": [{"attributes": {"name": "debian-9"}}]
+    }
+  ]
+}`
+
+func TestParseStateV3(t *testing.T) {
+	resources, err := parseState([]byte(stateV3))
+	assert.NoError(t, err)
+	assert.Len(t, resources, 3, "data sources are skipped")
+
+	src := source()
+	src.GroupBy = "resource_type,module,tags"
+	src.HostVarAttributes = "id,instance_type"
+	data := stateInventory(src, resources)
+
+	assert.Equal(t, []string{"10.0.0.2", "52.0.0.1"}, data.Groups["aws_instance"].Hosts)
+	assert.Equal(t, []string{"10.0.0.2"}, data.Groups["module_db"].Hosts)
+	assert.Equal(t, []string{"52.0.0.1"}, data.Groups["tag_Role_web"].Hosts)
+	assert.NotContains(t, data.Groups, "aws_security_group", "resources without host name are skipped")
+	assert.Equal(t, map[string]interface{}{"id": "i-0001", "instance_type": "t2.micro"}, data.HostVars["52.0.0.1"])
+	assert.Equal(t, map[string]interface{}{"id": "i-0002"}, data.HostVars["10.0.0.2"])
+}
+
+func TestParseStateV4(t *testing.T) {
+	resources, err := parseState([]byte(stateV4))
+	assert.NoError(t, err)
+	assert.Len(t, resources, 2)
+	assert.Equal(t, "app", resources[0].Module)
+
+	src := source()
+	src.HostnameAttributes = "network_interface.0.access_config.0.nat_ip, network_interface.0.network_ip"
+	src.GroupBy = "module"
+	src.HostVarAttributes = "name,labels.role"
+	data := stateInventory(src, resources)
+
+	assert.Equal(t, []string{"10.1.0.2", "35.0.0.1"}, data.Groups["module_app"].Hosts)
+	assert.Equal(t, map[string]interface{}{"name": "app-0", "labels_role": "app"}, data.HostVars["35.0.0.1"])
+	assert.Equal(t, map[string]interface{}{"name": "app-1"}, data.HostVars["10.1.0.2"])
+}
+
+func TestStateInventoryUngrouped(t *testing.T) {
+	resources, err := parseState([]byte(stateV3))
+	assert.NoError(t, err)
+
+	src := source()
+	src.GroupBy = "tags"
+	data := stateInventory(src, resources)
+
+	assert.Equal(t, []string{"52.0.0.1"}, data.Groups["tag_Role_web"].Hosts)
+	assert.Equal(t, []string{"10.0.0.2"}, data.Groups[groupUngrouped].Hosts)
+}
+
+func TestParseStateInvalid(t *testing.T) {
+	_, err := parseState([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestOutputsInventory(t *testing.T) {
+	data := outputsInventory(map[string]terraform.Output{
+		"web_ips":  {Value: []interface{}{"10.0.0.1", "10.0.0.2"}},
+		"db-host":  {Value: "db.example.com"},
+		"count":    {Value: float64(2)},
+		"password": {Value: "encrypted", Sensitive: true},
+	})
+
+	assert.Len(t, data.Groups, 2)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, data.Groups["web_ips"].Hosts)
+	assert.Equal(t, []string{"db.example.com"}, data.Groups["db_host"].Hosts)
+	assert.Len(t, data.HostVars, 3)
+}
+
+func TestPlanTerraformInventory(t *testing.T) {
+	resources, err := parseState([]byte(stateV3))
+	assert.NoError(t, err)
+
+	src := source()
+	src.Source = ansible.InventorySourceTerraform
+	c, err := plan(src, stateInventory(src, resources), nil, nil, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, c.newGroups, 1)
+	assert.Len(t, c.newHosts, 2)
+}
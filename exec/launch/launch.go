@@ -0,0 +1,327 @@
+// Package launch creates jobs from job templates and publishes them to the job queues.
+// It is shared by the API launch handlers and the scheduler.
+package launch
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/queue"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Error is returned when a job could not be launched.
+// Message is safe to be returned to the API client
+type Error struct {
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+// NewAnsibleJob creates a new job from the job template
+func NewAnsibleJob(template ansible.JobTemplate, user common.User, launchType string) ansible.Job {
+	return ansible.Job{
+		ID:                  bson.NewObjectId(),
+		Name:                template.Name,
+		Description:         template.Description,
+		LaunchType:          launchType,
+		CancelFlag:          false,
+		Status:              "new",
+		JobType:             ansible.JOBTYPE_ANSIBLE_JOB,
+		Playbook:            template.Playbook,
+		Forks:               template.Forks,
+		Limit:               template.Limit,
+		Verbosity:           template.Verbosity,
+		ExtraVars:           template.ExtraVars,
+		JobTags:             template.JobTags,
+		SkipTags:            template.SkipTags,
+		ForceHandlers:       template.ForceHandlers,
+		StartAtTask:         template.StartAtTask,
+		MachineCredentialID: template.MachineCredentialID,
+		InventoryID:         template.InventoryID,
+		JobTemplateID:       template.ID,
+		ProjectID:           template.ProjectID,
+		BecomeEnabled:       template.BecomeEnabled,
+		NetworkCredentialID: template.NetworkCredentialID,
+		CloudCredentialID:   template.CloudCredentialID,
+		SCMCredentialID:     nil,
+		CreatedByID:         user.ID,
+		ModifiedByID:        user.ID,
+		Created:             time.Now(),
+		Modified:            time.Now(),
+		PromptCredential:    template.PromptCredential,
+		PromptInventory:     template.PromptInventory,
+		PromptJobType:       template.PromptJobType,
+		PromptLimit:         template.PromptLimit,
+		PromptTags:          template.PromptTags,
+		PromptVariables:     template.PromptVariables,
+		AllowSimultaneous:   template.AllowSimultaneous,
+	}
+}
+
+// Ansible stores the job and publishes it to the ansible queue.
+// The inventory sources are updated first if required, the checkout of the
+// project and the credentials of the job are loaded by the worker
+func Ansible(job *ansible.Job, user common.User) error {
+	msg := types.Message{JobID: job.ID}
+
+	var inventory ansible.Inventory
+	if err := db.Inventories().FindId(job.InventoryID).One(&inventory); err != nil {
+		return &Error{Message: "Error while getting inventory", Err: err}
+	}
+
+	// inventory sources are updated before the job is started
+	updates, err := UpdateInventorySources(inventory, user)
+	if err != nil {
+		return err
+	}
+	msg.InventoryUpdates = updates
+
+	// the project must exist
+	var project common.Project
+	if err := db.Projects().FindId(job.ProjectID).One(&project); err != nil {
+		return &Error{Message: "Error while getting project", Err: err}
+	}
+
+	// Insert new job into jobs collection
+	if err := db.Jobs().Insert(*job); err != nil {
+		return &Error{Message: "Error while creating job", Err: err}
+	}
+
+	jobBytes, err := json.Marshal(msg)
+	if err != nil {
+		return &Error{Message: "Error while encoding the job", Err: err}
+	}
+
+	// publish bytes to ansible queue
+	if err := queue.Publish(queue.Ansible, jobBytes); err != nil {
+		return &Error{Message: "Error while publishing to Queue", Err: err}
+	}
+
+	return nil
+}
+
+// NewTerraformJob creates a new terraform job from the terraform job template
+func NewTerraformJob(template terraform.JobTemplate, user common.User, launchType string) terraform.Job {
+	return terraform.Job{
+		ID:                  bson.NewObjectId(),
+		Name:                template.Name,
+		Description:         template.Description,
+		LaunchType:          launchType,
+		CancelFlag:          false,
+		Status:              "new",
+		JobType:             template.JobType,
+		Vars:                template.Vars,
+		Parallelism:         template.Parallelism,
+		UpdateOnLaunch:      template.UpdateOnLaunch,
+		MachineCredentialID: template.MachineCredentialID,
+		JobTemplateID:       template.ID,
+		Target:              template.Target,
+		ProjectID:           template.ProjectID,
+		NetworkCredentialID: template.NetworkCredentialID,
+		CloudCredentialID:   template.CloudCredentialID,
+		SCMCredentialID:     template.SCMCredentialID,
+		CreatedByID:         user.ID,
+		ModifiedByID:        user.ID,
+		Created:             time.Now(),
+		Modified:            time.Now(),
+		PromptCredential:    template.PromptCredential,
+		PromptJobType:       template.PromptJobType,
+		PromptVariables:     template.PromptVariables,
+		AllowSimultaneous:   template.AllowSimultaneous,
+		Directory:           template.Directory,
+		Workspace:           template.Workspace,
+	}
+}
+
+// Terraform stores the terraform job and publishes it to the terraform queue.
+// The checkout of the project and the credentials of the job
+// are loaded by the worker
+func Terraform(job *terraform.Job, user common.User) error {
+	msg := types.Message{JobID: job.ID}
+
+	var project common.Project
+	if err := db.Projects().FindId(job.ProjectID).One(&project); err != nil {
+		return &Error{Message: "Error while getting project", Err: err}
+	}
+
+	if err := db.TerrafromJobs().Insert(*job); err != nil {
+		return &Error{Message: "Error while creating job", Err: err}
+	}
+
+	jobBytes, err := json.Marshal(msg)
+	if err != nil {
+		return &Error{Message: "Error while encoding the job", Err: err}
+	}
+
+	// publish bytes to terraform queue
+	if err := queue.Publish(queue.Terraform, jobBytes); err != nil {
+		return &Error{Message: "Error while publishing to Queue", Err: err}
+	}
+
+	return nil
+}
+
+// AdHoc stores the ad hoc command and publishes it to the ad hoc queue.
+// The machine credential and the inventory are loaded by the worker
+func AdHoc(command *ansible.AdHocCommand) error {
+	if err := db.AdHocCommands().Insert(*command); err != nil {
+		return &Error{Message: "Error while creating ad hoc command", Err: err}
+	}
+
+	jobBytes, err := json.Marshal(types.Message{JobID: command.ID})
+	if err != nil {
+		return &Error{Message: "Error while encoding the ad hoc command", Err: err}
+	}
+
+	// publish bytes to ad hoc queue
+	if err := queue.Publish(queue.AdHoc, jobBytes); err != nil {
+		return &Error{Message: "Error while publishing to Queue", Err: err}
+	}
+
+	return nil
+}
+
+// NewInventoryUpdate creates a new inventory update of the inventory source
+func NewInventoryUpdate(source ansible.InventorySource, user common.User, launchType string) ansible.InventoryUpdate {
+	return ansible.InventoryUpdate{
+		ID:                bson.NewObjectId(),
+		Name:              source.Name,
+		InventorySourceID: source.ID,
+		InventoryID:       source.InventoryID,
+		Source:            source.Source,
+		LaunchType:        launchType,
+		CancelFlag:        false,
+		Status:            "new",
+		CreatedByID:       user.ID,
+		ModifiedByID:      user.ID,
+		Created:           time.Now(),
+		Modified:          time.Now(),
+	}
+}
+
+// InventoryUpdate stores the inventory update and publishes it to the inventory update queue.
+// The source, its credential and its inventory script are loaded by the worker
+func InventoryUpdate(update *ansible.InventoryUpdate, source ansible.InventorySource) error {
+	if source.Source == ansible.InventorySourceCustom && source.SourceScriptID == nil {
+		return &Error{Message: "Inventory source does not have an inventory script"}
+	}
+
+	if err := db.InventoryUpdates().Insert(*update); err != nil {
+		return &Error{Message: "Error while creating inventory update", Err: err}
+	}
+
+	if err := db.InventorySources().UpdateId(source.ID, bson.M{"$set": bson.M{
+		"status":         update.Status,
+		"last_update_id": update.ID,
+	}}); err != nil {
+		return &Error{Message: "Error while updating inventory source", Err: err}
+	}
+
+	jobBytes, err := json.Marshal(types.Message{JobID: update.ID})
+	if err != nil {
+		return &Error{Message: "Error while encoding the inventory update", Err: err}
+	}
+
+	// publish bytes to inventory update queue
+	if err := queue.Publish(queue.InventoryUpdate, jobBytes); err != nil {
+		return &Error{Message: "Error while publishing to Queue", Err: err}
+	}
+
+	return nil
+}
+
+// UpdateInventorySources starts an update of the inventory sources of the inventory
+// which are updated on launch and whose cache timeout has expired.
+// Updates that are already active are reused. The ids of the updates are returned
+func UpdateInventorySources(inventory ansible.Inventory, user common.User) ([]bson.ObjectId, error) {
+	var sources []ansible.InventorySource
+	q := bson.M{"inventory_id": inventory.ID, "update_on_launch": true}
+	if err := db.InventorySources().Find(q).All(&sources); err != nil {
+		return nil, &Error{Message: "Error while getting inventory sources", Err: err}
+	}
+
+	ids := []bson.ObjectId{}
+	for _, source := range sources {
+		if active, ok := activeInventoryUpdate(source); ok {
+			ids = append(ids, active.ID)
+			continue
+		}
+
+		if !source.NeedsUpdate() {
+			continue
+		}
+
+		update := NewInventoryUpdate(source, user, ansible.JOB_LAUNCH_TYPE_DEPENDENCY)
+		if err := InventoryUpdate(&update, source); err != nil {
+			return nil, err
+		}
+		ids = append(ids, update.ID)
+	}
+
+	return ids, nil
+}
+
+// UpdateTerraformSources starts an update of the terraform inventory sources
+// which import the terraform job template, sources with an active update are skipped.
+// The ids of the started updates are returned
+func UpdateTerraformSources(templateID bson.ObjectId, user common.User) ([]bson.ObjectId, error) {
+	var sources []ansible.InventorySource
+	q := bson.M{"source": ansible.InventorySourceTerraform, "terraform_job_template_id": templateID}
+	if err := db.InventorySources().Find(q).All(&sources); err != nil {
+		return nil, &Error{Message: "Error while getting inventory sources", Err: err}
+	}
+
+	ids := []bson.ObjectId{}
+	for _, source := range sources {
+		if _, ok := activeInventoryUpdate(source); ok {
+			continue
+		}
+
+		update := NewInventoryUpdate(source, user, ansible.JOB_LAUNCH_TYPE_SYSTEM)
+		if err := InventoryUpdate(&update, source); err != nil {
+			return nil, err
+		}
+		ids = append(ids, update.ID)
+	}
+
+	return ids, nil
+}
+
+// activeInventoryUpdate returns the update of the inventory source that has not finished yet
+func activeInventoryUpdate(source ansible.InventorySource) (ansible.InventoryUpdate, bool) {
+	var active ansible.InventoryUpdate
+	err := db.InventoryUpdates().Find(bson.M{
+		"inventory_source_id": source.ID,
+		"status":              bson.M{"$in": []string{"new", "pending", "waiting", "running"}},
+	}).One(&active)
+	return active, err == nil
+}
+
+// MergeVars returns the variables with the overrides applied.
+// The given variables are not modified
+func MergeVars(vars map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	if len(overrides) == 0 {
+		return vars
+	}
+
+	merged := map[string]interface{}{}
+	for k, v := range vars {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
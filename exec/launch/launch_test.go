@@ -0,0 +1,16 @@
+package launch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeVars(t *testing.T) {
+	vars := map[string]interface{}{"a": 1, "b": 2}
+	merged := MergeVars(vars, map[string]interface{}{"b": 3, "c": 4})
+
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": 3, "c": 4}, merged)
+	assert.Equal(t, 2, vars["b"], "template variables must not be modified")
+	assert.Equal(t, vars, MergeVars(vars, nil))
+}
@@ -0,0 +1,225 @@
+package launch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// ValidateSurvey checks that the questions of the survey are consistent.
+// The returned error message is safe to be returned to the API client
+func ValidateSurvey(spec common.SurveySpec) error {
+	variables := map[string]bool{}
+	for _, q := range spec.Spec {
+		if variables[q.Variable] {
+			return fmt.Errorf("Duplicate survey variable %s", q.Variable)
+		}
+		variables[q.Variable] = true
+
+		if q.Min != nil && q.Max != nil && *q.Min > *q.Max {
+			return fmt.Errorf("Minimum of survey variable %s is greater than the maximum", q.Variable)
+		}
+
+		switch q.Type {
+		case common.SurveyTypeMultipleChoice, common.SurveyTypeMultiSelect:
+			if len(q.Choices) == 0 {
+				return fmt.Errorf("Survey variable %s requires choices", q.Variable)
+			}
+		}
+
+		// password defaults are encrypted when the survey is stored
+		if q.Default != nil && q.Type != common.SurveyTypePassword {
+			if _, err := answer(q, q.Default); err != nil {
+				return fmt.Errorf("Invalid default of survey variable %s: %s", q.Variable, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+// Survey validates the answers against the survey of a job template.
+// It returns the variables to merge into the job variables and the names
+// of the variables holding password answers. Questions that are not answered
+// get their default value, password answers are encrypted.
+// A password answered with $encrypted$ gets the stored default.
+// The returned error message is safe to be returned to the API client
+func Survey(spec *common.SurveySpec, answers map[string]interface{}) (map[string]interface{}, []string, error) {
+	vars := map[string]interface{}{}
+	var passwords []string
+	if spec == nil {
+		return vars, passwords, nil
+	}
+
+	for _, q := range spec.Spec {
+		value, ok := answers[q.Variable]
+		// clients send back the masked password to keep the default
+		if q.Type == common.SurveyTypePassword && value == "$encrypted$" {
+			value = nil
+		}
+		if !ok || value == nil || value == "" {
+			if q.Default == nil || q.Default == "" {
+				if q.Required {
+					return nil, nil, fmt.Errorf("Survey variable %s is required", q.Variable)
+				}
+				continue
+			}
+
+			if q.Type == common.SurveyTypePassword {
+				vars[q.Variable] = q.Default
+				passwords = append(passwords, q.Variable)
+				continue
+			}
+			value = q.Default
+		}
+
+		v, err := answer(q, value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid value of survey variable %s: %s", q.Variable, err.Error())
+		}
+
+		if q.Type == common.SurveyTypePassword {
+			v = util.Cipher(v.(string))
+			passwords = append(passwords, q.Variable)
+		}
+		vars[q.Variable] = v
+	}
+
+	return vars, passwords, nil
+}
+
+// AnsibleSurvey applies the survey of the job template to the job
+// if the survey is enabled, answers are looked up in the given variables
+func AnsibleSurvey(job *ansible.Job, template ansible.JobTemplate, answers map[string]interface{}) error {
+	if !template.SurveyEnabled {
+		return nil
+	}
+
+	vars, passwords, err := Survey(template.SurveySpec, answers)
+	if err != nil {
+		return err
+	}
+	job.ExtraVars = MergeVars(job.ExtraVars, vars)
+	job.SurveyPasswords = passwords
+	return nil
+}
+
+// TerraformSurvey applies the survey of the job template to the job
+// if the survey is enabled, answers are looked up in the given variables
+func TerraformSurvey(job *terraform.Job, template terraform.JobTemplate, answers map[string]interface{}) error {
+	if !template.SurveyEnabled {
+		return nil
+	}
+
+	vars, passwords, err := Survey(template.SurveySpec, answers)
+	if err != nil {
+		return err
+	}
+	job.Vars = MergeVars(job.Vars, vars)
+	job.SurveyPasswords = passwords
+	return nil
+}
+
+// answer validates a single answer and converts it to the type of the question
+func answer(q common.SurveyQuestion, value interface{}) (interface{}, error) {
+	switch q.Type {
+	case common.SurveyTypeText, common.SurveyTypePassword:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a string")
+		}
+		if err := inRange(q, float64(len(s)), "length"); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case common.SurveyTypeInteger:
+		n, ok := number(value)
+		if !ok || n != math.Trunc(n) {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		if err := inRange(q, n, "value"); err != nil {
+			return nil, err
+		}
+		return int(n), nil
+	case common.SurveyTypeFloat:
+		n, ok := number(value)
+		if !ok {
+			return nil, fmt.Errorf("must be a number")
+		}
+		if err := inRange(q, n, "value"); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case common.SurveyTypeMultipleChoice:
+		s, ok := value.(string)
+		if !ok || !choice(q, s) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(q.Choices, ","))
+		}
+		return s, nil
+	case common.SurveyTypeMultiSelect:
+		var selected []string
+		switch v := value.(type) {
+		case []string:
+			selected = v
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("must be a list of strings")
+				}
+				selected = append(selected, s)
+			}
+		default:
+			return nil, fmt.Errorf("must be a list of strings")
+		}
+		for _, s := range selected {
+			if !choice(q, s) {
+				return nil, fmt.Errorf("must be a subset of %s", strings.Join(q.Choices, ","))
+			}
+		}
+		return selected, nil
+	}
+
+	return nil, fmt.Errorf("unknown survey type %s", q.Type)
+}
+
+func inRange(q common.SurveyQuestion, n float64, what string) error {
+	if q.Min != nil && n < *q.Min {
+		return fmt.Errorf("%s must be at least %v", what, *q.Min)
+	}
+	if q.Max != nil && n > *q.Max {
+		return fmt.Errorf("%s must be at most %v", what, *q.Max)
+	}
+	return nil
+}
+
+func choice(q common.SurveyQuestion, s string) bool {
+	for _, c := range q.Choices {
+		if c == s {
+			return true
+		}
+	}
+	return false
+}
+
+// number converts numbers decoded from JSON or BSON to float64
+func number(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,108 @@
+package launch
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func limit(n float64) *float64 {
+	return &n
+}
+
+func survey() *common.SurveySpec {
+	return &common.SurveySpec{
+		Spec: []common.SurveyQuestion{
+			{Variable: "name", Type: common.SurveyTypeText, Required: true, Max: limit(8)},
+			{Variable: "count", Type: common.SurveyTypeInteger, Min: limit(1), Max: limit(10), Default: 2},
+			{Variable: "ratio", Type: common.SurveyTypeFloat},
+			{Variable: "region", Type: common.SurveyTypeMultipleChoice, Choices: []string{"eu", "us"}},
+			{Variable: "zones", Type: common.SurveyTypeMultiSelect, Choices: []string{"a", "b", "c"}},
+			{Variable: "secret", Type: common.SurveyTypePassword},
+		},
+	}
+}
+
+func TestValidateSurvey(t *testing.T) {
+	assert.NoError(t, ValidateSurvey(*survey()))
+
+	duplicate := survey()
+	duplicate.Spec[1].Variable = "name"
+	assert.Error(t, ValidateSurvey(*duplicate))
+
+	choices := survey()
+	choices.Spec[3].Choices = nil
+	assert.Error(t, ValidateSurvey(*choices))
+
+	bounds := survey()
+	bounds.Spec[1].Min = limit(11)
+	assert.Error(t, ValidateSurvey(*bounds))
+
+	def := survey()
+	def.Spec[1].Default = 20
+	assert.Error(t, ValidateSurvey(*def), "default is out of range")
+}
+
+func TestSurvey(t *testing.T) {
+	vars, passwords, err := Survey(survey(), map[string]interface{}{
+		"name":   "web",
+		"ratio":  0.5,
+		"region": "eu",
+		"zones":  []interface{}{"a", "c"},
+		"secret": "hunter2",
+		"other":  "ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "web", vars["name"])
+	assert.Equal(t, 2, vars["count"], "default is applied")
+	assert.Equal(t, 0.5, vars["ratio"])
+	assert.Equal(t, []string{"a", "c"}, vars["zones"])
+	assert.NotContains(t, vars, "other")
+
+	assert.Equal(t, []string{"secret"}, passwords)
+	assert.NotEqual(t, "hunter2", vars["secret"], "passwords are encrypted")
+	assert.Equal(t, "hunter2", string(util.Decipher(vars["secret"].(string))))
+
+	// JSON numbers are decoded as float64
+	vars, _, err = Survey(survey(), map[string]interface{}{"name": "web", "count": float64(3)})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, vars["count"])
+	assert.NotContains(t, vars, "secret", "optional questions without a default are skipped")
+}
+
+func TestSurveyInvalid(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{},
+		{"name": "too long name"},
+		{"name": 1},
+		{"name": "web", "count": 1.5},
+		{"name": "web", "count": float64(11)},
+		{"name": "web", "ratio": "half"},
+		{"name": "web", "region": "ap"},
+		{"name": "web", "zones": []interface{}{"a", "d"}},
+		{"name": "web", "zones": "a"},
+	}
+
+	for _, answers := range invalid {
+		_, _, err := Survey(survey(), answers)
+		assert.Error(t, err, "%v", answers)
+	}
+}
+
+func TestSurveyEncryptedPassword(t *testing.T) {
+	spec := survey()
+	spec.Spec[5].Default = util.Cipher("hunter2")
+
+	vars, passwords, err := Survey(spec, map[string]interface{}{"name": "web", "secret": "$encrypted$"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"secret"}, passwords)
+	assert.Equal(t, spec.Spec[5].Default, vars["secret"], "the stored default is kept")
+	assert.Equal(t, "hunter2", string(util.Decipher(vars["secret"].(string))))
+
+	spec.Spec[5].Default = nil
+	spec.Spec[5].Required = true
+	_, _, err = Survey(spec, map[string]interface{}{"name": "web", "secret": "$encrypted$"})
+	assert.Error(t, err, "the masked value is not a password")
+}
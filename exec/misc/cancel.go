@@ -0,0 +1,181 @@
+package misc
+
+import (
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// cancelPollInterval is the interval between two cancel_flag checks
+// of a running job
+const cancelPollInterval = 2 * time.Second
+
+// killGracePeriod is the time given to a process group to exit
+// after SIGTERM before it receives SIGKILL
+const killGracePeriod = 10 * time.Second
+
+// TerminatedExplanation is the job explanation of the jobs terminated
+// because the node was shut down
+const TerminatedExplanation = "Job was terminated because the instance was shut down"
+
+// watchers are the cancel watchers of the running jobs
+var (
+	watchersMu sync.Mutex
+	watchers   = map[*CancelWatcher]*exec.Cmd{}
+)
+
+// IsCanceled returns true if the cancel_flag of the job
+// stored in the given collection is set
+func IsCanceled(c *mgo.Collection, jobID bson.ObjectId) bool {
+	count, err := c.Find(bson.M{"_id": jobID, "cancel_flag": true}).Count()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": jobID.Hex(),
+			"Error":  err.Error(),
+		}).Warningln("Could not check the cancel flag of the job")
+		return false
+	}
+	return count > 0
+}
+
+// IsStarted returns true if the job stored in the given collection has already
+// been started. A message delivered again after a node was restarted or lost
+// its connection must not run the job twice
+func IsStarted(c *mgo.Collection, jobID bson.ObjectId) bool {
+	var job struct {
+		Status string `bson:"status"`
+	}
+	if err := c.FindId(jobID).Select(bson.M{"status": 1}).One(&job); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": jobID.Hex(),
+			"Error":  err.Error(),
+		}).Warningln("Could not check the status of the job")
+		return false
+	}
+
+	switch job.Status {
+	case "new", "pending", "waiting", "":
+		return false
+	}
+	return true
+}
+
+// Start sets the fields of the job stored in the given collection when it is started.
+// The job is only started if it is still waiting and was not canceled, mgo.ErrNotFound
+// is returned otherwise so a cancel received after IsCanceled was checked is not lost
+func Start(c *mgo.Collection, jobID bson.ObjectId, set bson.M) error {
+	return c.Update(bson.M{
+		"_id":         jobID,
+		"status":      bson.M{"$in": []string{"new", "pending", "waiting"}},
+		"cancel_flag": bson.M{"$ne": true},
+	}, bson.M{"$set": set})
+}
+
+// KillProcessGroup terminates the process group created by Setsid
+// for the given command. The whole group receives SIGTERM first
+// and SIGKILL if it is still alive after the grace period
+func KillProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	pgid := cmd.Process.Pid
+	if err := syscall.Kill(-pgid, syscall.SIGTERM); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"PGID":  pgid,
+			"Error": err.Error(),
+		}).Warningln("Could not send SIGTERM to the process group")
+	}
+
+	time.AfterFunc(killGracePeriod, func() {
+		// signal 0 checks whether the group still exists
+		if err := syscall.Kill(-pgid, 0); err == nil {
+			syscall.Kill(-pgid, syscall.SIGKILL)
+		}
+	})
+}
+
+// CancelWatcher polls the cancel_flag of a running job and kills
+// the process group of the job's command when the flag is set.
+// Since the flag is stored in the database a job can be canceled
+// from any tensord node
+type CancelWatcher struct {
+	done       chan struct{}
+	canceled   int32
+	terminated int32
+}
+
+// WatchCancel starts a CancelWatcher for the given job and command.
+// The command must already be started
+func WatchCancel(c *mgo.Collection, jobID bson.ObjectId, cmd *exec.Cmd) *CancelWatcher {
+	w := &CancelWatcher{done: make(chan struct{})}
+
+	watchersMu.Lock()
+	watchers[w] = cmd
+	watchersMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(cancelPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				if IsCanceled(c, jobID) {
+					logrus.WithFields(logrus.Fields{
+						"Job ID": jobID.Hex(),
+					}).Infoln("Job cancel requested, killing the process group")
+					atomic.StoreInt32(&w.canceled, 1)
+					KillProcessGroup(cmd)
+					return
+				}
+			}
+		}
+	}()
+
+	return w
+}
+
+// Stop stops polling the cancel_flag
+func (w *CancelWatcher) Stop() {
+	watchersMu.Lock()
+	delete(watchers, w)
+	watchersMu.Unlock()
+
+	select {
+	case <-w.done:
+	default:
+		close(w.done)
+	}
+}
+
+// Canceled returns true if the watcher killed the job
+func (w *CancelWatcher) Canceled() bool {
+	return atomic.LoadInt32(&w.canceled) == 1
+}
+
+// Terminated returns true if the job was killed by TerminateJobs
+func (w *CancelWatcher) Terminated() bool {
+	return atomic.LoadInt32(&w.terminated) == 1
+}
+
+// TerminateJobs kills the process groups of the running jobs
+// and returns the number of terminated jobs
+func TerminateJobs() int {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+
+	for w, cmd := range watchers {
+		atomic.StoreInt32(&w.terminated, 1)
+		KillProcessGroup(cmd)
+	}
+	return len(watchers)
+}
@@ -11,17 +11,17 @@ import (
 )
 
 // raxCredFile creates a Rackspace credential file in the system temporary directory
-// and returns the resulting *os.File.
+// whose name starts with prefix and returns the resulting *os.File.
 // Multiple programs calling raxCredFile simultaneously
 // will not choose the same file. The caller can use f.Name()
 // to find the pathname of the file. It is the caller's responsibility
 // to remove the file when no longer needed.
-func raxCredFile(c common.Credential) (f *os.File, err error) {
+func raxCredFile(c common.Credential, prefix string) (f *os.File, err error) {
 	content := "#!/usr/bin/python\n[rackspace_cloud]" +
 		"\nusername=" + c.Username +
 		"\napi_key=" + c.Secret
 
-	f, err = ioutil.TempFile("", "tensor_credential_rackspace")
+	f, err = ioutil.TempFile("", prefix+"credential_rackspace")
 	if err != nil {
 		logrus.Errorln("Rackspace credential file creation failed")
 		return
@@ -44,13 +44,13 @@ func raxCredFile(c common.Credential) (f *os.File, err error) {
 }
 
 // GCECredFile creates a Google Compute Engine credential file in the system
-// temporary directory and returns the resulting *os.File.
+// temporary directory whose name starts with prefix and returns the resulting *os.File.
 // Multiple programs calling GCECredFile simultaneously
 // will not choose the same file. The caller can use f.Name()
 // to find the pathname of the file. It is the caller's responsibility
 // to remove the file when no longer needed.
-func GCECredFile(c common.Credential) (f *os.File, err error) {
-	f, err = ioutil.TempFile("", "tensor_credential_gce")
+func GCECredFile(c common.Credential, prefix string) (f *os.File, err error) {
+	f, err = ioutil.TempFile("", prefix+"credential_gce")
 	if err != nil {
 		logrus.Errorln("GCE credential file creation failed")
 		return
@@ -70,8 +70,8 @@ func GCECredFile(c common.Credential) (f *os.File, err error) {
 // GetCloudCredential cloud credential files and generates environment variables,
 // This accepts string slice and common.Credential (cloud credential) interface
 // and returns slice of environment variables generated and file handler to the
-// credential file
-func GetCloudCredential(env []string, c common.Credential) (menv []string, f *os.File, err error) {
+// credential file. The name of the credential file starts with prefix
+func GetCloudCredential(env []string, c common.Credential, prefix string) (menv []string, f *os.File, err error) {
 	switch c.Kind {
 	//if Cloud Credential type is AWS
 	case common.CredentialKindAWS:
@@ -82,7 +82,7 @@ func GetCloudCredential(env []string, c common.Credential) (menv []string, f *os
 		}
 	case common.CredentialKindRAX:
 		{
-			f, err = raxCredFile(c)
+			f, err = raxCredFile(c, prefix)
 			if err != nil {
 				err = errors.New("Rackspace credential file creation failed")
 				return
@@ -93,7 +93,7 @@ func GetCloudCredential(env []string, c common.Credential) (menv []string, f *os
 		}
 	case common.CredentialKindGCE:
 		{
-			f, err = GCECredFile(c)
+			f, err = GCECredFile(c, prefix)
 			if err != nil {
 				err = errors.New("GCE credential file creation failed")
 			}
@@ -117,6 +117,26 @@ func GetCloudCredential(env []string, c common.Credential) (menv []string, f *os
 					"AZURE_TENANT="+c.Tenant)
 			}
 		}
+	case common.CredentialKindVMWARE:
+		{
+			// add environment variables for vCenter credential
+			menv = append(env, "VMWARE_HOST="+c.Host,
+				"VMWARE_USER="+c.Username,
+				"VMWARE_PASSWORD="+string(util.Decipher(c.Password)))
+		}
+	case common.CredentialKindOPENSTACK:
+		{
+			// add environment variables for OpenStack keystone credential
+			menv = append(env, "OS_AUTH_URL="+c.Host,
+				"OS_USERNAME="+c.Username,
+				"OS_PASSWORD="+string(util.Decipher(c.Password)),
+				"OS_PROJECT_NAME="+c.Project)
+			if len(c.Domain) > 0 {
+				menv = append(menv, "OS_USER_DOMAIN_NAME="+c.Domain, "OS_PROJECT_DOMAIN_NAME="+c.Domain)
+			}
+		}
+	default:
+		menv = env
 	}
 
 	return
@@ -20,7 +20,7 @@ func TestRaxCredFile(t *testing.T) {
 		"\nusername=" + c.Username +
 		"\napi_key=" + c.Secret
 
-	f, _ := raxCredFile(c)
+	f, _ := raxCredFile(c, "tensor_")
 	actual, _ := ioutil.ReadFile(f.Name())
 
 	assert.Equal(expected, string(actual), "Create racspace credential has invalid content")
@@ -39,7 +39,7 @@ func TestGCECredFile(t *testing.T) {
 		SSHKeyData: util.Cipher("test"),
 	}
 
-	f, _ := GCECredFile(c)
+	f, _ := GCECredFile(c, "tensor_")
 	actual, _ := ioutil.ReadFile(f.Name())
 
 	assert.Equal("test", string(actual), "Create GCE credential has invalid content")
@@ -57,7 +57,7 @@ func TestGetCloudCredential(t *testing.T) {
 		Kind:   common.CredentialKindAWS,
 	}
 
-	actual, _, _ := GetCloudCredential([]string{}, c)
+	actual, _, _ := GetCloudCredential([]string{}, c, "tensor_")
 	expected := []string{"AWS_SECRET_ACCESS_KEY=test", "AWS_ACCESS_KEY_ID=test"}
 	assert.Equal(expected, actual, "Must be equal")
 
@@ -68,7 +68,7 @@ func TestGetCloudCredential(t *testing.T) {
 		Kind:     common.CredentialKindRAX,
 	}
 
-	actual, f, _ := GetCloudCredential([]string{}, c)
+	actual, f, _ := GetCloudCredential([]string{}, c, "tensor_")
 	expected = []string{"RAX_CREDS_FILE=" + f.Name()}
 	os.Remove(f.Name())
 
@@ -82,7 +82,7 @@ func TestGetCloudCredential(t *testing.T) {
 		Kind:       common.CredentialKindGCE,
 	}
 
-	actual, f, _ = GetCloudCredential([]string{}, c)
+	actual, f, _ = GetCloudCredential([]string{}, c, "tensor_")
 	expected = []string{"GCE_EMAIL=test", "GCE_PROJECT=test", "GCE_CREDENTIALS_FILE_PATH=" + f.Name()}
 	os.Remove(f.Name())
 
@@ -97,7 +97,7 @@ func TestGetCloudCredential(t *testing.T) {
 		Kind:         common.CredentialKindAZURE,
 	}
 
-	actual, _, _ = GetCloudCredential([]string{}, c)
+	actual, _, _ = GetCloudCredential([]string{}, c, "tensor_")
 	expected = []string{"AZURE_AD_USER=test", "AZURE_PASSWORD=test", "AZURE_SUBSCRIPTION_ID=test"}
 	assert.Equal(expected, actual, "Must be equal")
 
@@ -110,7 +110,42 @@ func TestGetCloudCredential(t *testing.T) {
 		Kind:         common.CredentialKindAZURE,
 	}
 
-	actual, _, _ = GetCloudCredential([]string{}, c)
+	actual, _, _ = GetCloudCredential([]string{}, c, "tensor_")
 	expected = []string{"AZURE_CLIENT_ID=test", "AZURE_SECRET=test", "AZURE_SUBSCRIPTION_ID=test", "AZURE_TENANT=test"}
 	assert.Equal(expected, actual, "Must be equal")
+
+	// Test VMware credentials
+	c = common.Credential{
+		Host:     "vcenter",
+		Username: "test",
+		Password: util.Cipher("test"),
+		Kind:     common.CredentialKindVMWARE,
+	}
+
+	actual, _, _ = GetCloudCredential([]string{}, c, "tensor_")
+	expected = []string{"VMWARE_HOST=vcenter", "VMWARE_USER=test", "VMWARE_PASSWORD=test"}
+	assert.Equal(expected, actual, "Must be equal")
+
+	// Test OpenStack credentials
+	c = common.Credential{
+		Host:     "https://keystone:5000/v3",
+		Username: "test",
+		Password: util.Cipher("test"),
+		Project:  "test",
+		Domain:   "default",
+		Kind:     common.CredentialKindOPENSTACK,
+	}
+
+	actual, _, _ = GetCloudCredential([]string{}, c, "tensor_")
+	expected = []string{"OS_AUTH_URL=https://keystone:5000/v3", "OS_USERNAME=test", "OS_PASSWORD=test",
+		"OS_PROJECT_NAME=test", "OS_USER_DOMAIN_NAME=default", "OS_PROJECT_DOMAIN_NAME=default"}
+	assert.Equal(expected, actual, "Must be equal")
+
+	// Credentials without environment variables keep the environment
+	c = common.Credential{
+		Kind: common.CredentialKindSATELLITE6,
+	}
+
+	actual, _, _ = GetCloudCredential([]string{"TERM=xterm"}, c, "tensor_")
+	assert.Equal([]string{"TERM=xterm"}, actual, "Must be equal")
 }
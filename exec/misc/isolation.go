@@ -0,0 +1,120 @@
+package misc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/adjust/uniuri"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AgentBind returns the proot parameters binding the directory of the ssh-agent
+// socket of a job, the /tmp of the job does not contain the socket
+func AgentBind(socket string) []string {
+	dir := filepath.Dir(socket)
+	return []string{"-b", dir + ":" + dir}
+}
+
+// KerberosCache returns the kerberos credential cache of a job,
+// jobs running at the same time must not share the default cache of the user
+func KerberosCache(tmp string) string {
+	return "FILE:" + filepath.Join(tmp, "krb5cc")
+}
+
+// tempPrefix is the prefix of the temporary files of the jobs
+const tempPrefix = "tensor_"
+
+// jobCollections are the collections of the jobs creating temporary files
+var jobCollections = []string{db.CJobs, db.CTerraformJobs, db.CAdHocCommands, db.CInventoryUpdates}
+
+// nodePrefix returns the prefix of the temporary files of the jobs run by the node
+func nodePrefix() string {
+	return tempPrefix + util.Config.Hostname + "_"
+}
+
+// TempPrefix returns the prefix of the temporary files and directories of a job.
+// It contains the hostname of the node and the job ID, so the files left by a node
+// are only removed by that node once the job is not running anymore
+func TempPrefix(jobID bson.ObjectId) string {
+	return nodePrefix() + jobID.Hex() + "_"
+}
+
+// TempPath returns a new temporary path of the job in /tmp
+func TempPath(jobID bson.ObjectId) string {
+	return filepath.Join("/tmp", TempPrefix(jobID)+uniuri.New())
+}
+
+// StaleTempFiles returns the temporary files and directories left by the jobs of the node
+// which are not running anymore, the files of other nodes on the same host are not returned
+func StaleTempFiles() []string {
+	dirs := []string{"/tmp"}
+	if tmp := os.TempDir(); tmp != "/tmp" {
+		dirs = append(dirs, tmp)
+	}
+
+	stale := []string{}
+	for _, dir := range dirs {
+		prefix := filepath.Join(dir, nodePrefix())
+		paths, _ := filepath.Glob(prefix + "*")
+		for _, path := range paths {
+			id := jobID(strings.TrimPrefix(path, prefix))
+			if id == "" || isRunning(id) {
+				continue
+			}
+			stale = append(stale, path)
+		}
+	}
+	return stale
+}
+
+// jobID returns the job ID a temporary file name starts with
+func jobID(name string) bson.ObjectId {
+	if len(name) < 24 || !bson.IsObjectIdHex(name[:24]) {
+		return ""
+	}
+	return bson.ObjectIdHex(name[:24])
+}
+
+// isRunning returns whether the job is running, a job whose
+// status cannot be checked is considered as running
+func isRunning(id bson.ObjectId) bool {
+	for _, name := range jobCollections {
+		count, err := db.C(name).Find(bson.M{"_id": id, "status": "running"}).Count()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": id.Hex(),
+				"Error":  err.Error(),
+			}).Warningln("Could not check the status of the job")
+			return true
+		}
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveTempFiles removes the temporary directories and credential files returned
+// by StaleTempFiles. It returns the number of removed files
+func RemoveTempFiles(paths []string) int {
+	removed := 0
+	for _, path := range paths {
+		// the directories of the ssh agents are already removed
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Path":  path,
+				"Error": err.Error(),
+			}).Warningln("Could not remove stale temporary file")
+			continue
+		}
+		removed++
+	}
+	return removed
+}
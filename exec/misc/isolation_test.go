@@ -0,0 +1,32 @@
+package misc
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTempPath(t *testing.T) {
+	hostname := util.Config.Hostname
+	defer func() { util.Config.Hostname = hostname }()
+	util.Config.Hostname = "node1"
+
+	id := bson.NewObjectId()
+	assert.Equal(t, "tensor_node1_"+id.Hex()+"_", TempPrefix(id))
+
+	path := TempPath(id)
+	assert.Equal(t, "/tmp", filepath.Dir(path))
+
+	// the job ID is found after the prefix of the node
+	name := strings.TrimPrefix(path, filepath.Join("/tmp", nodePrefix()))
+	assert.Equal(t, id, jobID(name))
+
+	// files of a node whose hostname starts with the hostname of the node
+	util.Config.Hostname = "node1_b"
+	other := strings.TrimPrefix(TempPath(id), filepath.Join("/tmp", "tensor_node1_"))
+	assert.Equal(t, bson.ObjectId(""), jobID(other))
+}
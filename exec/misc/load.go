@@ -0,0 +1,40 @@
+package misc
+
+import (
+	"errors"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// LoadCredential returns the credential of the job, an empty credential is returned
+// if the id is nil. Credentials are loaded when the job is run, a credential edited
+// or deleted after the job was launched is respected
+func LoadCredential(id *bson.ObjectId, name string) (common.Credential, error) {
+	var credential common.Credential
+	if id == nil {
+		return credential, nil
+	}
+	if err := db.Credentials().FindId(*id).One(&credential); err != nil {
+		return credential, errors.New("Error while getting " + name + " credential: " + err.Error())
+	}
+	return credential, nil
+}
+
+// LoadUser returns the user who launched the job,
+// the job is run without user if the user was deleted
+func LoadUser(id bson.ObjectId) common.User {
+	var user common.User
+	if !id.Valid() {
+		return user
+	}
+	if err := db.Users().FindId(id).One(&user); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"User ID": id.Hex(),
+			"Error":   err.Error(),
+		}).Warningln("Could not get the user of the job")
+	}
+	return user
+}
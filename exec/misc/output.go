@@ -0,0 +1,118 @@
+package misc
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// outputFlushInterval is the interval between two output chunks
+// stored for a running job
+const outputFlushInterval = time.Second
+
+// OutputWriter captures the output of a job and periodically appends
+// the new output to the job_stdout collection, so the output of a
+// running job can be read or streamed before the job finishes and
+// is not lost if the process is killed. Only the new output is stored
+// on each flush, the job document does not grow with the output
+type OutputWriter struct {
+	mu sync.Mutex
+	// buf holds the output which is not stored yet
+	buf bytes.Buffer
+
+	jobID bson.ObjectId
+	// flushed is the length of the stored output, flushed and seq
+	// are only used by flush which never runs concurrently
+	flushed int
+	seq     int
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+// NewOutputWriter creates an OutputWriter for the job
+// and starts flushing its content
+func NewOutputWriter(jobID bson.ObjectId) *OutputWriter {
+	w := &OutputWriter{
+		jobID: jobID,
+		done:  make(chan struct{}),
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(outputFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+				w.flush()
+			}
+		}
+	}()
+
+	return w
+}
+
+// Write appends p to the output
+func (w *OutputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Write(p)
+}
+
+// Close stops the periodic updates and stores the remaining output.
+// The output must be complete when the final status of the job
+// is stored, therefore Close has to be called before that
+func (w *OutputWriter) Close() {
+	w.once.Do(func() {
+		close(w.done)
+		w.wg.Wait()
+		w.flush()
+	})
+}
+
+func (w *OutputWriter) flush() {
+	w.mu.Lock()
+	if w.buf.Len() == 0 {
+		w.mu.Unlock()
+		return
+	}
+	content := w.buf.String()
+	w.mu.Unlock()
+
+	chunk := common.StdoutChunk{
+		ID:      bson.NewObjectId(),
+		JobID:   w.jobID,
+		Seq:     w.seq,
+		Start:   w.flushed,
+		End:     w.flushed + len(content),
+		Content: content,
+	}
+	if err := db.JobStdout().Insert(chunk); err != nil {
+		// the output is stored with the next chunk
+		logrus.WithFields(logrus.Fields{
+			"Job ID": w.jobID.Hex(),
+			"Error":  err.Error(),
+		}).Warningln("Could not store job output")
+		return
+	}
+
+	w.mu.Lock()
+	w.buf.Next(len(content))
+	w.mu.Unlock()
+
+	w.flushed = chunk.End
+	w.seq++
+}
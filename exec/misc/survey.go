@@ -0,0 +1,38 @@
+package misc
+
+import (
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// MaskVars returns a copy of the variables where the encrypted
+// survey password answers are replaced with $encrypted$
+func MaskVars(vars map[string]interface{}, passwords []string) map[string]interface{} {
+	return replaceVars(vars, passwords, func(string) interface{} {
+		return "$encrypted$"
+	})
+}
+
+// DecipherVars returns a copy of the variables where the encrypted
+// survey password answers are replaced with the plain text answers
+func DecipherVars(vars map[string]interface{}, passwords []string) map[string]interface{} {
+	return replaceVars(vars, passwords, func(v string) interface{} {
+		return string(util.Decipher(v))
+	})
+}
+
+func replaceVars(vars map[string]interface{}, passwords []string, replace func(string) interface{}) map[string]interface{} {
+	if len(passwords) == 0 {
+		return vars
+	}
+
+	replaced := map[string]interface{}{}
+	for k, v := range vars {
+		replaced[k] = v
+	}
+	for _, k := range passwords {
+		if v, ok := vars[k].(string); ok {
+			replaced[k] = replace(v)
+		}
+	}
+	return replaced
+}
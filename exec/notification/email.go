@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"crypto/tls"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// sendEmail sends the message to the recipients using the SMTP server of the configuration.
+// UseSSL connects using implicit TLS and UseTLS upgrades the connection with STARTTLS
+func sendEmail(config common.NotificationConfiguration, msg message) (uint64, error) {
+	port := config.Port
+	if port == 0 {
+		port = 25
+	}
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(int(port)))
+	tlsConfig := &tls.Config{ServerName: config.Host}
+
+	dialer := &net.Dialer{Timeout: timeout(config)}
+	var conn net.Conn
+	var err error
+	if config.UseSSL {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return 0, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout(config)))
+
+	c, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return 0, err
+	}
+	defer c.Close()
+
+	if config.UseTLS {
+		if err = c.StartTLS(tlsConfig); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(config.Username) > 0 {
+		password := ""
+		if len(config.Password) > 0 {
+			password = string(util.Decipher(config.Password))
+		}
+		if err = c.Auth(smtp.PlainAuth("", config.Username, password, config.Host)); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = c.Mail(config.Sender); err != nil {
+		return 0, err
+	}
+	var sent uint64
+	for _, rcpt := range config.Recipients {
+		if err = c.Rcpt(rcpt); err != nil {
+			return 0, err
+		}
+		sent++
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return 0, err
+	}
+	body := "From: " + config.Sender + "\r\n" +
+		"To: " + strings.Join(config.Recipients, ", ") + "\r\n" +
+		"Subject: " + headerValue(msg.Subject) + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + crlf(msg.Body)
+	if _, err = w.Write([]byte(body)); err != nil {
+		return 0, err
+	}
+	if err = w.Close(); err != nil {
+		return 0, err
+	}
+
+	return sent, c.Quit()
+}
+
+// headerValue returns the value of a mail header. Line breaks would start new headers,
+// they are replaced with spaces and values which are not ASCII are encoded
+func headerValue(s string) string {
+	s = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+// crlf returns the text with CRLF line endings
+func crlf(s string) string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+	return strings.Replace(s, "\n", "\r\n", -1)
+}
@@ -0,0 +1,217 @@
+// Package notification delivers the notification templates attached to
+// organizations, job templates and terraform job templates when their jobs
+// start, succeed or fail.
+package notification
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Job types of notifications
+const (
+	JobTypeJob          = "job"
+	JobTypeTerraformJob = "terraform_job"
+)
+
+// retryDelay is multiplied by the attempt number to wait before a retry
+var retryDelay = 5 * time.Second
+
+// Job describes the job a notification is sent for
+type Job struct {
+	ID             bson.ObjectId `json:"id"`
+	Type           string        `json:"type"`
+	Name           string        `json:"name"`
+	Status         string        `json:"status"`
+	Started        time.Time     `json:"started"`
+	Finished       time.Time     `json:"finished"`
+	JobExplanation string        `json:"job_explanation"`
+}
+
+// message is the content of a notification
+type message struct {
+	Subject string
+	Body    string
+	// Payload is the JSON document posted by webhooks
+	Payload []byte
+}
+
+// backend delivers a message using the configuration of a notification template
+// and returns the number of recipients the message was sent to
+type backend func(config common.NotificationConfiguration, msg message) (uint64, error)
+
+var backends = map[string]backend{
+	common.NotificationTypeEmail:      sendEmail,
+	common.NotificationTypeWebhook:    sendWebhook,
+	common.NotificationTypeSlack:      sendChat,
+	common.NotificationTypeMattermost: sendChat,
+}
+
+// Send delivers the notification templates attached to any of the given objects
+// for the event and stores a notification for every delivery attempt.
+// Success and error events also deliver the templates attached to the any event
+func Send(job Job, event string, objects ...bson.ObjectId) {
+	// jobs rejected by a runner may not have a template or a project
+	var ids []bson.ObjectId
+	for _, id := range objects {
+		if id.Valid() {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 || !job.ID.Valid() {
+		return
+	}
+
+	fields := []string{common.NotificationEventField(event)}
+	if event == common.NotificationEventSuccess || event == common.NotificationEventError {
+		fields = append(fields, common.NotificationEventField(common.NotificationEventAny))
+	}
+
+	var or []bson.M
+	for _, field := range fields {
+		or = append(or, bson.M{field: bson.M{"$in": ids}})
+	}
+
+	var templates []common.NotificationTemplate
+	if err := db.NotificationTemplates().Find(bson.M{"$or": or}).All(&templates); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": job.ID.Hex(),
+			"Error":  err.Error(),
+		}).Errorln("Could not get notification templates")
+		return
+	}
+
+	for _, template := range templates {
+		for _, n := range deliver(template, job, event) {
+			if err := db.Notifications().Insert(n); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"Notification Template ID": template.ID.Hex(),
+					"Job ID":                   job.ID.Hex(),
+					"Error":                    err.Error(),
+				}).Errorln("Could not store notification")
+			}
+		}
+	}
+}
+
+// deliver sends the notification template for the job and retries failed deliveries.
+// It returns a notification for every attempt
+func deliver(template common.NotificationTemplate, job Job, event string) []common.Notification {
+	send, ok := backends[template.NotificationsType]
+	if !ok {
+		return nil
+	}
+
+	msg, err := newMessage(template, job, event)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Notification Template ID": template.ID.Hex(),
+			"Error":                    err.Error(),
+		}).Errorln("Could not create notification")
+		return nil
+	}
+
+	var notifications []common.Notification
+	for attempt := uint8(1); attempt <= template.NotificationConfiguration.Retries+1; attempt++ {
+		if attempt > 1 {
+			time.Sleep(time.Duration(attempt-1) * retryDelay)
+		}
+
+		n := common.Notification{
+			ID:                     bson.NewObjectId(),
+			Status:                 "successful",
+			NotificationsType:      template.NotificationsType,
+			Recipients:             recipients(template),
+			Subject:                msg.Subject,
+			Body:                   msg.Body,
+			NotificationTemplateID: template.ID,
+			JobID:                  job.ID,
+			JobType:                job.Type,
+			Event:                  event,
+			Attempt:                attempt,
+			Created:                time.Now(),
+		}
+
+		sent, err := send(template.NotificationConfiguration, msg)
+		n.NotificationsSent = sent
+		n.Modified = time.Now()
+		if err != nil {
+			n.Status = "failed"
+			n.Error = err.Error()
+			logrus.WithFields(logrus.Fields{
+				"Notification Template ID": template.ID.Hex(),
+				"Job ID":                   job.ID.Hex(),
+				"Attempt":                  attempt,
+				"Error":                    err.Error(),
+			}).Warningln("Notification delivery failed")
+		}
+		notifications = append(notifications, n)
+
+		if err == nil {
+			break
+		}
+	}
+
+	return notifications
+}
+
+// newMessage creates the message of the notification template for the job
+func newMessage(template common.NotificationTemplate, job Job, event string) (message, error) {
+	payload, err := json.Marshal(struct {
+		Job
+		Event string `json:"event"`
+		URL   string `json:"url"`
+	}{job, event, jobURL(job)})
+	if err != nil {
+		return message{}, err
+	}
+
+	subject := template.Subject
+	if len(subject) == 0 {
+		subject = fmt.Sprintf("%s #%s '%s' %s", strings.Replace(job.Type, "_", " ", -1), job.ID.Hex(), job.Name, job.Status)
+	}
+
+	body := subject + "\n\n" +
+		"Status: " + job.Status + "\n" +
+		"URL: " + jobURL(job) + "\n"
+	if !job.Started.IsZero() {
+		body += "Started: " + job.Started.Format(time.RFC3339) + "\n"
+	}
+	if !job.Finished.IsZero() {
+		body += "Finished: " + job.Finished.Format(time.RFC3339) + "\n"
+	}
+	if len(job.JobExplanation) > 0 {
+		body += "Explanation: " + job.JobExplanation + "\n"
+	}
+
+	return message{Subject: subject, Body: body, Payload: payload}, nil
+}
+
+func jobURL(job Job) string {
+	if job.Type == JobTypeTerraformJob {
+		return "/v1/terraform_jobs/" + job.ID.Hex()
+	}
+	return "/v1/jobs/" + job.ID.Hex()
+}
+
+func recipients(template common.NotificationTemplate) string {
+	if template.NotificationsType == common.NotificationTypeEmail {
+		return strings.Join(template.NotificationConfiguration.Recipients, ",")
+	}
+	return template.NotificationConfiguration.URL
+}
+
+// timeout returns the timeout of a delivery attempt, default is 30 seconds
+func timeout(config common.NotificationConfiguration) time.Duration {
+	if config.Timeout == 0 {
+		return 30 * time.Second
+	}
+	return time.Duration(config.Timeout) * time.Second
+}
@@ -0,0 +1,293 @@
+package notification
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func testJob() Job {
+	return Job{
+		ID:       bson.NewObjectId(),
+		Type:     JobTypeJob,
+		Name:     "deploy",
+		Status:   "failed",
+		Started:  time.Now().Add(-time.Minute),
+		Finished: time.Now(),
+	}
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	var body []byte
+	var signature string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "ops", r.Header.Get("X-Team"))
+	}))
+	defer ts.Close()
+
+	template := common.NotificationTemplate{
+		ID:                bson.NewObjectId(),
+		NotificationsType: common.NotificationTypeWebhook,
+		NotificationConfiguration: common.NotificationConfiguration{
+			URL:     ts.URL,
+			Secret:  util.Cipher("s3cret"),
+			Headers: map[string]string{"X-Team": "ops"},
+		},
+	}
+	job := testJob()
+
+	notifications := deliver(template, job, common.NotificationEventError)
+	if !assert.Len(t, notifications, 1) {
+		return
+	}
+	n := notifications[0]
+	assert.Equal(t, "successful", n.Status)
+	assert.Equal(t, uint64(1), n.NotificationsSent)
+	assert.Equal(t, job.ID, n.JobID)
+	assert.Equal(t, template.ID, n.NotificationTemplateID)
+	assert.Equal(t, common.NotificationEventError, n.Event)
+
+	assert.Equal(t, "sha256="+sign([]byte("s3cret"), body), signature)
+	var payload map[string]interface{}
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, job.ID.Hex(), payload["id"])
+	assert.Equal(t, "failed", payload["status"])
+	assert.Equal(t, "error", payload["event"])
+	assert.Equal(t, "/v1/jobs/"+job.ID.Hex(), payload["url"])
+}
+
+func TestDeliverWebhookRetries(t *testing.T) {
+	retryDelay = 0
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer ts.Close()
+
+	template := common.NotificationTemplate{
+		NotificationsType:         common.NotificationTypeWebhook,
+		NotificationConfiguration: common.NotificationConfiguration{URL: ts.URL, Retries: 3},
+	}
+
+	notifications := deliver(template, testJob(), common.NotificationEventError)
+	if !assert.Len(t, notifications, 3, "delivery stops after the first success") {
+		return
+	}
+	assert.Equal(t, "failed", notifications[0].Status)
+	assert.Contains(t, notifications[0].Error, "502")
+	assert.Equal(t, uint8(2), notifications[1].Attempt)
+	assert.Equal(t, "successful", notifications[2].Status)
+
+	template.NotificationConfiguration.Retries = 1
+	calls = -10
+	notifications = deliver(template, testJob(), common.NotificationEventError)
+	assert.Len(t, notifications, 2)
+	assert.Equal(t, "failed", notifications[1].Status)
+}
+
+func TestDeliverChat(t *testing.T) {
+	var payload map[string]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer ts.Close()
+
+	template := common.NotificationTemplate{
+		NotificationsType: common.NotificationTypeSlack,
+		Subject:           "Deployment failed",
+		NotificationConfiguration: common.NotificationConfiguration{
+			URL:      ts.URL,
+			Channel:  "#ops",
+			Username: "tensor",
+		},
+	}
+
+	notifications := deliver(template, testJob(), common.NotificationEventError)
+	assert.Equal(t, "successful", notifications[0].Status)
+	assert.Equal(t, "#ops", payload["channel"])
+	assert.Equal(t, "tensor", payload["username"])
+	assert.True(t, strings.HasPrefix(payload["text"], "Deployment failed\n"))
+	_, ok := payload["icon_url"]
+	assert.False(t, ok)
+}
+
+// smtpServer accepts a single mail and sends it to the returned channel
+func smtpServer(t *testing.T) (net.Listener, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var mail []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL"), strings.HasPrefix(cmd, "RCPT"):
+				mail = append(mail, strings.TrimSpace(line))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					mail = append(mail, strings.TrimRight(line, "\r\n"))
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 Bye")
+				mails <- strings.Join(mail, "\n")
+				return
+			default:
+				reply("502 Command not implemented")
+			}
+		}
+	}()
+	return l, mails
+}
+
+func TestDeliverEmail(t *testing.T) {
+	l, mails := smtpServer(t)
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	template := common.NotificationTemplate{
+		NotificationsType: common.NotificationTypeEmail,
+		NotificationConfiguration: common.NotificationConfiguration{
+			Host:       "127.0.0.1",
+			Port:       uint16(port),
+			Sender:     "tensor@example.com",
+			Recipients: []string{"ops@example.com", "dev@example.com"},
+		},
+	}
+	job := testJob()
+
+	notifications := deliver(template, job, common.NotificationEventError)
+	if !assert.Len(t, notifications, 1) {
+		return
+	}
+	assert.Equal(t, "successful", notifications[0].Status, notifications[0].Error)
+	assert.Equal(t, uint64(2), notifications[0].NotificationsSent)
+	assert.Equal(t, "ops@example.com,dev@example.com", notifications[0].Recipients)
+
+	select {
+	case mail := <-mails:
+		assert.Contains(t, mail, "MAIL FROM:<tensor@example.com>")
+		assert.Contains(t, mail, "RCPT TO:<dev@example.com>")
+		assert.Contains(t, mail, "Subject: job #"+job.ID.Hex()+" 'deploy' failed")
+		assert.Contains(t, mail, "URL: /v1/jobs/"+job.ID.Hex())
+	case <-time.After(5 * time.Second):
+		t.Fatal("mail was not received")
+	}
+}
+
+func TestDeliverEmailHeaders(t *testing.T) {
+	l, mails := smtpServer(t)
+	defer l.Close()
+
+	port := l.Addr().(*net.TCPAddr).Port
+	template := common.NotificationTemplate{
+		NotificationsType: common.NotificationTypeEmail,
+		NotificationConfiguration: common.NotificationConfiguration{
+			Host:       "127.0.0.1",
+			Port:       uint16(port),
+			Sender:     "tensor@example.com",
+			Recipients: []string{"ops@example.com"},
+		},
+	}
+	job := testJob()
+	job.Name = "deploy\r\nBcc: attacker@example.com\nX-Injected: yes"
+	job.JobExplanation = "first line\r\nsecond line"
+
+	notifications := deliver(template, job, common.NotificationEventError)
+	if !assert.Len(t, notifications, 1) {
+		return
+	}
+	assert.Equal(t, "successful", notifications[0].Status, notifications[0].Error)
+
+	select {
+	case mail := <-mails:
+		lines := strings.Split(mail, "\n")
+		headers := lines
+		for i, line := range lines {
+			if line == "" {
+				headers = lines[:i]
+				break
+			}
+		}
+		for _, h := range headers {
+			assert.False(t, strings.HasPrefix(h, "Bcc:"), "header injected: %s", h)
+			assert.False(t, strings.HasPrefix(h, "X-Injected:"), "header injected: %s", h)
+		}
+		assert.Contains(t, headers, "Subject: job #"+job.ID.Hex()+" 'deploy Bcc: attacker@example.com X-Injected: yes' failed")
+		// the lines of the body are kept
+		assert.Contains(t, mail, "first line\nsecond line")
+	case <-time.After(5 * time.Second):
+		t.Fatal("mail was not received")
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	assert.Equal(t, "a\r\nb\r\nc\r\nd", crlf("a\nb\r\nc\rd"))
+	assert.Equal(t, "=?utf-8?q?d=C3=A9ploy?=", headerValue("déploy"))
+}
+
+func TestDeliverEmailUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	template := common.NotificationTemplate{
+		NotificationsType: common.NotificationTypeEmail,
+		NotificationConfiguration: common.NotificationConfiguration{
+			Host:       "127.0.0.1",
+			Port:       uint16(port),
+			Sender:     "tensor@example.com",
+			Recipients: []string{"ops@example.com"},
+			Timeout:    1,
+		},
+	}
+
+	notifications := deliver(template, testJob(), common.NotificationEventStarted)
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, "failed", notifications[0].Status)
+	assert.NotEmpty(t, notifications[0].Error)
+}
@@ -0,0 +1,78 @@
+package notification
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// SignatureHeader contains the HMAC-SHA256 signature of webhook payloads
+// when the notification template has a secret
+const SignatureHeader = "X-Tensor-Signature"
+
+// sendWebhook posts the JSON payload of the message to the URL of the configuration
+func sendWebhook(config common.NotificationConfiguration, msg message) (uint64, error) {
+	headers := map[string]string{}
+	for k, v := range config.Headers {
+		headers[k] = v
+	}
+
+	if len(config.Secret) > 0 {
+		headers[SignatureHeader] = "sha256=" + sign(util.Decipher(config.Secret), msg.Payload)
+	}
+
+	return post(config, msg.Payload, headers)
+}
+
+// sendChat posts the message to a Slack or Mattermost incoming webhook
+func sendChat(config common.NotificationConfiguration, msg message) (uint64, error) {
+	payload, err := json.Marshal(struct {
+		Text     string `json:"text"`
+		Channel  string `json:"channel,omitempty"`
+		Username string `json:"username,omitempty"`
+		IconURL  string `json:"icon_url,omitempty"`
+	}{msg.Body, config.Channel, config.Username, config.IconURL})
+	if err != nil {
+		return 0, err
+	}
+
+	return post(config, payload, nil)
+}
+
+func post(config common.NotificationConfiguration, payload []byte, headers map[string]string) (uint64, error) {
+	req, err := http.NewRequest("POST", config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Tensor")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: timeout(config)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("%s returned %s", config.URL, resp.Status)
+	}
+	return 1, nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of the payload
+func sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/robfig/cron"
+	"github.com/teambition/rrule-go"
+)
+
+// occurrences returns the next occurrence of a schedule after the given time
+type occurrences interface {
+	next(after time.Time) time.Time
+}
+
+type rruleOccurrences struct {
+	rule *rrule.RRule
+}
+
+func (r rruleOccurrences) next(after time.Time) time.Time {
+	return r.rule.After(after, false)
+}
+
+type cronOccurrences struct {
+	schedule cron.Schedule
+	loc      *time.Location
+	start    time.Time
+}
+
+func (c cronOccurrences) next(after time.Time) time.Time {
+	// the first occurrence can be at the start date
+	if after.Before(c.start) {
+		after = c.start.Add(-time.Second)
+	}
+	return c.schedule.Next(after.In(c.loc))
+}
+
+// Validate checks the recurrence rule or cron expression,
+// the time zone and the start and end dates of the schedule
+func Validate(s common.Schedule) error {
+	_, err := parse(s)
+	return err
+}
+
+// NextRun returns the first occurrence of the schedule after the given time.
+// The boolean is false if the schedule has no further occurrences
+func NextRun(s common.Schedule, after time.Time) (time.Time, bool) {
+	o, err := parse(s)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	next := o.next(after)
+	if next.IsZero() {
+		return time.Time{}, false
+	}
+	if s.DtEnd != nil && next.After(*s.DtEnd) {
+		return time.Time{}, false
+	}
+	return next.UTC(), true
+}
+
+func parse(s common.Schedule) (occurrences, error) {
+	rule := strings.TrimSpace(s.RRule)
+	spec := strings.TrimSpace(s.Cron)
+
+	if len(rule) > 0 && len(spec) > 0 {
+		return nil, errors.New("Only one of rrule or cron can be specified")
+	}
+	if len(rule) == 0 && len(spec) == 0 {
+		return nil, errors.New("Either rrule or cron is required")
+	}
+
+	loc := time.UTC
+	if len(s.Timezone) > 0 {
+		var err error
+		if loc, err = time.LoadLocation(s.Timezone); err != nil {
+			return nil, errors.New("Invalid timezone " + s.Timezone)
+		}
+	}
+
+	if s.DtStart.IsZero() {
+		return nil, errors.New("Start date is required")
+	}
+	if s.DtEnd != nil && !s.DtEnd.After(s.DtStart) {
+		return nil, errors.New("End date must be after the start date")
+	}
+
+	start := s.DtStart.In(loc)
+
+	if len(spec) > 0 {
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			return nil, errors.New("Invalid cron expression: " + err.Error())
+		}
+		return cronOccurrences{schedule: schedule, loc: loc, start: start}, nil
+	}
+
+	// DTSTART is taken from the schedule, only the rule itself is accepted
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	if strings.Contains(rule, "DTSTART") || strings.Contains(rule, "\n") {
+		return nil, errors.New("Invalid rrule: use dtstart to set the start date")
+	}
+
+	opt, err := rrule.StrToROptionInLocation(rule, loc)
+	if err != nil {
+		return nil, errors.New("Invalid rrule: " + err.Error())
+	}
+	opt.Dtstart = start
+
+	r, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, errors.New("Invalid rrule: " + err.Error())
+	}
+	return rruleOccurrences{rule: r}, nil
+}
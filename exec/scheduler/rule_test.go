@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(-time.Hour)
+
+	assert.NoError(t, Validate(common.Schedule{RRule: "FREQ=DAILY;INTERVAL=1", DtStart: start}))
+	assert.NoError(t, Validate(common.Schedule{RRule: "RRULE:FREQ=WEEKLY;BYDAY=MO", DtStart: start}))
+	assert.NoError(t, Validate(common.Schedule{Cron: "0 3 * * *", DtStart: start, Timezone: "Europe/London"}))
+
+	assert.Error(t, Validate(common.Schedule{DtStart: start}), "rrule or cron is required")
+	assert.Error(t, Validate(common.Schedule{RRule: "FREQ=DAILY", Cron: "0 3 * * *", DtStart: start}))
+	assert.Error(t, Validate(common.Schedule{RRule: "FREQ=SOMETIMES", DtStart: start}))
+	assert.Error(t, Validate(common.Schedule{Cron: "0 3 * *", DtStart: start}))
+	assert.Error(t, Validate(common.Schedule{Cron: "0 3 * * *", DtStart: start, Timezone: "Mars/Olympus"}))
+	assert.Error(t, Validate(common.Schedule{Cron: "0 3 * * *"}), "start date is required")
+	assert.Error(t, Validate(common.Schedule{Cron: "0 3 * * *", DtStart: start, DtEnd: &end}))
+}
+
+func TestNextRunRRule(t *testing.T) {
+	start := time.Date(2017, 1, 1, 9, 30, 0, 0, time.UTC)
+	s := common.Schedule{RRule: "FREQ=DAILY;INTERVAL=2", DtStart: start}
+
+	next, ok := NextRun(s, start.Add(-time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, start, next)
+
+	next, ok = NextRun(s, start)
+	assert.True(t, ok)
+	assert.Equal(t, start.AddDate(0, 0, 2), next)
+
+	// occurrences after the end date are dropped
+	end := start.AddDate(0, 0, 3)
+	s.DtEnd = &end
+	_, ok = NextRun(s, start.AddDate(0, 0, 2))
+	assert.False(t, ok)
+}
+
+func TestNextRunCronTimezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+
+	start := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	s := common.Schedule{Cron: "0 3 * * *", DtStart: start, Timezone: "America/New_York"}
+
+	next, ok := NextRun(s, start)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2017, 6, 1, 3, 0, 0, 0, loc).UTC(), next)
+	assert.Equal(t, time.UTC, next.Location())
+
+	// nothing runs before the start date
+	next, ok = NextRun(s, start.AddDate(0, 0, -10))
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2017, 6, 1, 3, 0, 0, 0, loc).UTC(), next)
+}
@@ -0,0 +1,257 @@
+// Package scheduler launches job templates, terraform job templates and
+// project updates at the occurrences of their schedules.
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/launch"
+	"github.com/pearsonappeng/tensor/exec/sync"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/rbac"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// pollInterval is the interval between two lookups of due schedules
+const pollInterval = 15 * time.Second
+
+// Run starts the scheduler loop.
+// Every tensord node serving the API (role api or all) runs the loop,
+// an occurrence is launched only by the node that claims it first
+func Run() {
+	logrus.Infoln("Scheduler started")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		runDue(now)
+	}
+}
+
+// runDue launches all enabled schedules which are due at the given time
+func runDue(now time.Time) {
+	var schedules []common.Schedule
+	q := bson.M{"enabled": true, "next_run": bson.M{"$lte": now}}
+	if err := db.Schedules().Find(q).All(&schedules); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Could not get due schedules")
+		return
+	}
+
+	for _, s := range schedules {
+		if claim(s, now) {
+			fire(s)
+		}
+	}
+}
+
+// claim moves next_run of the schedule to its next occurrence.
+// The update only matches while next_run still has the value read by this node,
+// therefore only one node can claim an occurrence
+func claim(s common.Schedule, now time.Time) bool {
+	set := bson.M{"last_run": *s.NextRun}
+	update := bson.M{"$set": set}
+	// missed occurrences are skipped
+	if next, ok := NextRun(s, now); ok {
+		set["next_run"] = next
+	} else {
+		update["$unset"] = bson.M{"next_run": ""}
+	}
+
+	if err := db.Schedules().Update(bson.M{"_id": s.ID, "next_run": *s.NextRun}, update); err != nil {
+		if err != mgo.ErrNotFound {
+			logrus.WithFields(logrus.Fields{
+				"Schedule ID": s.ID.Hex(),
+				"Error":       err.Error(),
+			}).Errorln("Could not claim schedule")
+		}
+		return false
+	}
+
+	return true
+}
+
+// fire launches the template of the schedule
+func fire(s common.Schedule) {
+	logrus.WithFields(logrus.Fields{
+		"Schedule ID": s.ID.Hex(),
+		"Name":        s.Name,
+		"Template ID": s.TemplateID.Hex(),
+	}).Infoln("Launching scheduled job")
+
+	jobID, err := launchTemplate(s)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Schedule ID": s.ID.Hex(),
+			"Error":       err.Error(),
+		}).Errorln("Could not launch scheduled job")
+		if _, ok := err.(ownerError); ok {
+			disable(s)
+		}
+	} else {
+		if err := db.Schedules().UpdateId(s.ID, bson.M{"$set": bson.M{"last_job_id": jobID}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Schedule ID": s.ID.Hex(),
+				"Error":       err.Error(),
+			}).Errorln("Could not update schedule")
+		}
+	}
+
+	UpdateTemplate(s.TemplateID, s.TemplateType)
+}
+
+// ownerError is returned when the owner of the schedule no longer
+// exists or can no longer launch the template of the schedule
+type ownerError string
+
+func (e ownerError) Error() string {
+	return string(e)
+}
+
+// disable disables the schedule, it is not launched again until it is enabled
+func disable(s common.Schedule) {
+	if err := db.Schedules().UpdateId(s.ID, bson.M{"$set": bson.M{"enabled": false, "modified": time.Now()}}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Schedule ID": s.ID.Hex(),
+			"Error":       err.Error(),
+		}).Errorln("Could not disable schedule")
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Schedule ID": s.ID.Hex(),
+		"Name":        s.Name,
+	}).Warningln("Schedule disabled, its owner can no longer launch the template")
+}
+
+func launchTemplate(s common.Schedule) (bson.ObjectId, error) {
+	// scheduled jobs run as the user who created the schedule,
+	// the permissions of the user are checked on every occurrence
+	var user common.User
+	if err := db.Users().FindId(s.CreatedByID).One(&user); err == mgo.ErrNotFound {
+		return "", ownerError("Schedule owner does not exist")
+	} else if err != nil {
+		return "", errors.New("Could not find schedule owner: " + err.Error())
+	}
+
+	switch s.TemplateType {
+	case common.ScheduleJobTemplate:
+		var template ansible.JobTemplate
+		if err := db.JobTemplates().FindId(s.TemplateID).One(&template); err != nil {
+			return "", errors.New("Could not find job template: " + err.Error())
+		}
+		if !new(rbac.JobTemplate).Write(user, template) {
+			return "", ownerError("Schedule owner can no longer launch the job template")
+		}
+		job := launch.NewAnsibleJob(template, user, ansible.JOB_LAUNCH_TYPE_SCHEDULED)
+		job.ExtraVars = launch.MergeVars(job.ExtraVars, s.ExtraData)
+		if err := launch.AnsibleSurvey(&job, template, s.ExtraData); err != nil {
+			return "", err
+		}
+		if err := launch.Ansible(&job, user); err != nil {
+			return "", err
+		}
+		return job.ID, nil
+	case common.ScheduleTerraformJobTemplate:
+		var template terraform.JobTemplate
+		if err := db.TerrafromJobTemplates().FindId(s.TemplateID).One(&template); err != nil {
+			return "", errors.New("Could not find terraform job template: " + err.Error())
+		}
+		if !new(rbac.TerraformJobTemplate).Write(user, template) {
+			return "", ownerError("Schedule owner can no longer launch the terraform job template")
+		}
+		job := launch.NewTerraformJob(template, user, terraform.JobLaunchTypeScheduled)
+		job.Vars = launch.MergeVars(job.Vars, s.ExtraData)
+		if err := launch.TerraformSurvey(&job, template, s.ExtraData); err != nil {
+			return "", err
+		}
+		if err := launch.Terraform(&job, user); err != nil {
+			return "", err
+		}
+		return job.ID, nil
+	case common.ScheduleProject:
+		var project common.Project
+		if err := db.Projects().FindId(s.TemplateID).One(&project); err != nil {
+			return "", errors.New("Could not find project: " + err.Error())
+		}
+		if !new(rbac.Project).Update(user, project) {
+			return "", ownerError("Schedule owner can no longer update the project")
+		}
+		tj, err := sync.UpdateProject(project)
+		if err != nil {
+			return "", err
+		}
+		if err := db.Jobs().UpdateId(tj.Job.ID, bson.M{"$set": bson.M{"launch_type": ansible.JOB_LAUNCH_TYPE_SCHEDULED}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": tj.Job.ID.Hex(),
+				"Error":  err.Error(),
+			}).Warningln("Could not update launch type of project update")
+		}
+		return tj.Job.ID, nil
+	}
+
+	return "", errors.New("Unknown template type " + s.TemplateType)
+}
+
+// UpdateTemplate stores the schedule summary in the job template, terraform job
+// template or project: whether it has schedules and the next run of its enabled schedules
+func UpdateTemplate(id bson.ObjectId, templateType string) {
+	var c *mgo.Collection
+	switch templateType {
+	case common.ScheduleJobTemplate:
+		c = db.JobTemplates()
+	case common.ScheduleTerraformJobTemplate:
+		c = db.TerrafromJobTemplates()
+	case common.ScheduleProject:
+		c = db.Projects()
+	default:
+		return
+	}
+
+	var schedules []common.Schedule
+	if err := db.Schedules().Find(bson.M{"template_id": id}).All(&schedules); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Template ID": id.Hex(),
+			"Error":       err.Error(),
+		}).Errorln("Could not get schedules")
+		return
+	}
+
+	var next *common.Schedule
+	for i := range schedules {
+		s := &schedules[i]
+		if !s.Enabled || s.NextRun == nil {
+			continue
+		}
+		if next == nil || s.NextRun.Before(*next.NextRun) {
+			next = s
+		}
+	}
+
+	update := bson.M{}
+	if next != nil {
+		update["$set"] = bson.M{
+			"has_schedules":    len(schedules) > 0,
+			"next_job_run":     next.NextRun,
+			"next_schedule_id": next.ID,
+		}
+	} else {
+		update["$set"] = bson.M{"has_schedules": len(schedules) > 0}
+		update["$unset"] = bson.M{"next_job_run": "", "next_schedule_id": ""}
+	}
+
+	if err := c.UpdateId(id, update); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Template ID": id.Hex(),
+			"Error":       err.Error(),
+		}).Errorln("Could not update schedule summary")
+	}
+}
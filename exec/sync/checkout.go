@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// locks serializes the updates of the checkout of a project on the node
+var (
+	locksMu sync.Mutex
+	locks   = map[bson.ObjectId]*sync.Mutex{}
+)
+
+func lock(id bson.ObjectId) *sync.Mutex {
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	l, ok := locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		locks[id] = l
+	}
+	return l
+}
+
+// Checkout updates the checkout of the project on the node before a job
+// of the project is run. Every node keeps its own checkouts in projects_home,
+// the checkout is updated when the project was updated on another node,
+// when the node has no checkout or when the project is updated on launch
+func Checkout(p common.Project) error {
+	// manual projects are not managed by a scm
+	if p.ScmType == "manual" {
+		return nil
+	}
+
+	l := lock(p.ID)
+	l.Lock()
+	defer l.Unlock()
+
+	// the project may have been updated since the job was loaded
+	if err := db.Projects().FindId(p.ID).One(&p); err != nil {
+		return errors.New("Error while getting project: " + err.Error())
+	}
+
+	synced, err := instance.ProjectUpdated(p.ID)
+	if err != nil {
+		return errors.New("Error while getting the project checkout of the instance: " + err.Error())
+	}
+
+	_, err = os.Stat(filepath.Join(util.Config.ProjectsHome, p.ID.Hex()))
+	onLaunch := p.ScmUpdateOnLaunch && !cached(p, synced, time.Now())
+	if !onLaunch && current(p, synced, err == nil) {
+		return nil
+	}
+
+	scm, err := misc.LoadCredential(p.ScmCredentialID, "SCM")
+	if err != nil {
+		return err
+	}
+
+	j, err := newUpdateJob(p, ansible.JOB_LAUNCH_TYPE_DEPENDENCY)
+	if err != nil {
+		return err
+	}
+	j.SCM = scm
+	j.User = misc.LoadUser(p.CreatedByID)
+	// an update on launch is an update of the project,
+	// otherwise the node only catches up with the last update
+	j.Local = !onLaunch
+
+	logrus.WithFields(logrus.Fields{
+		"Project ID": p.ID.Hex(),
+		"Job ID":     j.Job.ID.Hex(),
+	}).Infoln("Updating the project checkout of the instance")
+
+	run(*j)
+
+	var update ansible.Job
+	if err := db.Jobs().FindId(j.Job.ID).One(&update); err != nil {
+		return err
+	}
+	if update.Status != "successful" {
+		return errors.New("Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + update.Name + "\", \"job_id\": \"" + update.ID.Hex() + "\"}")
+	}
+	return nil
+}
+
+// current returns whether the checkout of the node, updated at synced,
+// contains the last update of the project. A failed update of the project
+// is not caught up with
+func current(p common.Project, synced *time.Time, exists bool) bool {
+	if !exists || synced == nil {
+		return false
+	}
+	return p.LastUpdated == nil || p.LastUpdateFailed || !synced.Before(*p.LastUpdated)
+}
+
+// cached returns whether the checkout of the node was updated
+// within the cache timeout of the project
+func cached(p common.Project, synced *time.Time, now time.Time) bool {
+	if synced == nil {
+		return false
+	}
+	return now.Sub(*synced) < time.Duration(p.ScmUpdateCacheTimeout)*time.Second
+}
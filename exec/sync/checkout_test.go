@@ -0,0 +1,43 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrent(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Minute)
+
+	cases := []struct {
+		name    string
+		project common.Project
+		synced  *time.Time
+		exists  bool
+		current bool
+	}{
+		{"no checkout", common.Project{}, nil, false, false},
+		{"not synced", common.Project{}, nil, true, false},
+		{"missing directory", common.Project{LastUpdated: &before}, &now, false, false},
+		{"never updated", common.Project{}, &now, true, true},
+		{"synced last update", common.Project{LastUpdated: &now}, &now, true, true},
+		{"updated on another node", common.Project{LastUpdated: &now}, &before, true, false},
+		{"failed update", common.Project{LastUpdated: &now, LastUpdateFailed: true}, &before, true, true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.current, current(c.project, c.synced, c.exists), c.name)
+	}
+}
+
+func TestCached(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+
+	assert.False(t, cached(common.Project{ScmUpdateCacheTimeout: 120}, nil, now), "not synced")
+	assert.True(t, cached(common.Project{ScmUpdateCacheTimeout: 120}, &recent, now), "within timeout")
+	assert.False(t, cached(common.Project{ScmUpdateCacheTimeout: 30}, &recent, now), "timed out")
+	assert.False(t, cached(common.Project{}, &now, now), "no cache timeout")
+}
@@ -3,31 +3,41 @@ package sync
 import (
 	"time"
 
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/misc"
 	"github.com/pearsonappeng/tensor/exec/types"
 )
 
-func start(t types.SyncJob) {
-	t.Job.Status = "running"
-	t.Job.Started = time.Now()
+// start marks the job as running, it returns false when the job
+// was canceled or started by another node in the meantime
+func start(t *types.SyncJob) bool {
+	started := time.Now()
 
 	d := bson.M{
-		"$set": bson.M{
-			"status":  t.Job.Status,
-			"failed":  false,
-			"started": t.Job.Started,
-		},
+		"status":         "running",
+		"failed":         false,
+		"started":        started,
+		"execution_node": instance.Hostname(),
 	}
 
-	if err := db.Jobs().UpdateId(t.Job.ID, d); err != nil {
+	if err := misc.Start(db.Jobs(), t.Job.ID, d); err == mgo.ErrNotFound {
+		return false
+	} else if err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Status": t.Job.Status,
+			"Status": "running",
 			"Error":  err,
 		}).Errorln("Failed to update job status")
 	}
+
+	t.Job.Status = "running"
+	t.Job.Started = started
+	return true
 }
 
 func status(t types.SyncJob, s string) {
@@ -75,6 +85,7 @@ func jobFail(t types.SyncJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 }
 
@@ -83,6 +94,15 @@ func jobCancel(t types.SyncJob) {
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
 
+	// a job canceled before it was started has no elapsed time
+	// and no output
+	if t.Job.Started.IsZero() {
+		t.Job.Started = t.Job.Finished
+	}
+	if len(t.Job.ResultStdout) == 0 {
+		t.Job.ResultStdout = "stdout capture is missing"
+	}
+
 	//get elapsed time in minutes
 	diff := t.Job.Finished.Sub(t.Job.Started)
 
@@ -93,7 +113,7 @@ func jobCancel(t types.SyncJob) {
 			"failed":          t.Job.Failed,
 			"finished":        t.Job.Finished,
 			"elapsed":         diff.Minutes(),
-			"result_stdout":   "stdout capture is missing",
+			"result_stdout":   t.Job.ResultStdout,
 			"job_explanation": "Job Cancelled",
 			"job_args":        t.Job.JobARGS,
 			"job_env":         t.Job.JobENV,
@@ -108,6 +128,7 @@ func jobCancel(t types.SyncJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 }
 
@@ -140,6 +161,7 @@ func jobError(t types.SyncJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 }
 
@@ -172,10 +194,24 @@ func jobSuccess(t types.SyncJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	// the checkout of the node is current now
+	if err := instance.SetProject(t.ProjectID, t.Job.Finished); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+		}).Errorln("Failed to record the project checkout of the instance")
+	}
+
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 }
 
+// updateProject sets the status of the last update of the project,
+// an update of the checkout of a single node does not change the project
 func updateProject(t types.SyncJob) {
+	if t.Local {
+		return
+	}
+
 	d := bson.M{
 		"$set": bson.M{
 			"last_updated":       t.Job.Finished,
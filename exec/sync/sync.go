@@ -1,7 +1,6 @@
 package sync
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"os"
@@ -17,6 +16,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/misc"
 	"github.com/pearsonappeng/tensor/exec/types"
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
@@ -25,8 +25,27 @@ import (
 	"github.com/pearsonappeng/tensor/util"
 )
 
+// Sync runs the update job, updates of the checkout of a project
+// on the node are run one at a time
 func Sync(j types.SyncJob) {
-	start(j)
+	l := lock(j.ProjectID)
+	l.Lock()
+	defer l.Unlock()
+
+	run(j)
+}
+
+func run(j types.SyncJob) {
+	// the job may have been canceled since its cancel_flag was checked
+	if !start(&j) {
+		logrus.WithFields(logrus.Fields{
+			"Job ID": j.Job.ID.Hex(),
+		}).Infoln("Job was canceled or started by another node, run aborted")
+		if misc.IsCanceled(db.Jobs(), j.Job.ID) {
+			jobCancel(j)
+		}
+		return
+	}
 	// create job directories
 	createJobDirs(j)
 
@@ -36,7 +55,7 @@ func Sync(j types.SyncJob) {
 	}).Infoln("Started system job")
 
 	// Start SSH agent
-	agent, socket, pid, cleanup := ssh.StartAgent()
+	agent, socket, pid, cleanup := ssh.StartAgent(misc.TempPrefix(j.Job.ID))
 
 	if len(j.SCM.SSHKeyData) > 0 {
 		if len(j.SCM.SSHKeyUnlock) > 0 {
@@ -101,9 +120,10 @@ func Sync(j types.SyncJob) {
 		return
 	}
 
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
+	// output is stored while the job is running
+	b := misc.NewOutputWriter(j.Job.ID)
+	cmd.Stdout = b
+	cmd.Stderr = b
 
 	// Set setsid to create a new session, The new process group has no controlling
 	// terminal which disables the stdin & will skip prompts
@@ -113,7 +133,7 @@ func Sync(j types.SyncJob) {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running Project update task failed")
-		j.Job.ResultStdout = string(b.Bytes())
+		b.Close()
 		j.Job.JobExplanation = err.Error()
 		jobFail(j)
 		return
@@ -122,23 +142,36 @@ func Sync(j types.SyncJob) {
 	var timer *time.Timer
 	timer = time.AfterFunc(time.Duration(util.Config.SyncJobTimeOut)*time.Second, func() {
 		logrus.Println("Killing the process. Execution exceeded threashold value")
-		cmd.Process.Kill()
+		misc.KillProcessGroup(cmd)
 	})
 
+	// kill the process group when a cancel is requested
+	watcher := misc.WatchCancel(db.Jobs(), j.Job.ID, cmd)
+
 	if err := cmd.Wait(); err != nil {
+		timer.Stop()
+		watcher.Stop()
+		b.Close()
+		if watcher.Canceled() {
+			jobCancel(j)
+			return
+		}
+		if watcher.Terminated() {
+			j.Job.JobExplanation = misc.TerminatedExplanation
+			jobError(j)
+			return
+		}
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running Project update task failed")
-		j.Job.ResultStdout = string(b.Bytes())
 		j.Job.JobExplanation = err.Error()
 		jobFail(j)
 		return
 	}
 
 	timer.Stop()
-
-	// set stdout
-	j.Job.ResultStdout = string(b.Bytes())
+	watcher.Stop()
+	b.Close()
 	//success
 	jobSuccess(j)
 }
@@ -195,11 +228,37 @@ func createJobDirs(j types.SyncJob) {
 // UpdateProject will create and start a update system job
 // using ansible playbook project_update.yml
 func UpdateProject(p common.Project) (*types.SyncJob, error) {
+	runnerJob, err := newUpdateJob(p, ansible.JOB_LAUNCH_TYPE_MANUAL)
+	if err != nil {
+		return nil, err
+	}
+
+	jobBytes, err := json.Marshal(types.Message{JobID: runnerJob.Job.ID})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Unable to marshal Job")
+		return nil, err
+	}
+
+	// publish bytes to ansible queue
+	if err := queue.Publish(queue.Ansible, jobBytes); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Error while publishing to Queue")
+		return nil, err
+	}
+
+	return runnerJob, nil
+}
+
+// newUpdateJob inserts a new update job of the project into the jobs collection
+func newUpdateJob(p common.Project, launchType string) (*types.SyncJob, error) {
 	job := ansible.Job{
 		ID:           bson.NewObjectId(),
 		Name:         p.Name + " update Job",
 		Description:  "Updates " + p.Name + " Project",
-		LaunchType:   ansible.JOB_LAUNCH_TYPE_MANUAL,
+		LaunchType:   launchType,
 		CancelFlag:   false,
 		Status:       "pending",
 		JobType:      ansible.JOBTYPE_UPDATE_JOB,
@@ -240,37 +299,11 @@ func UpdateProject(p common.Project) (*types.SyncJob, error) {
 		return nil, errors.New("Error while creating update Job")
 	}
 
-	// create new background job
+	// create new background job, the SCM credential is loaded by the worker
 	runnerJob := types.SyncJob{
-		Job:     job,
-		Project: p,
-	}
-
-	if job.SCMCredentialID != nil {
-		var credential common.Credential
-		if err := db.Credentials().FindId(*job.SCMCredentialID).One(&credential); err != nil {
-			logrus.WithFields(logrus.Fields{
-				"Error": err.Error(),
-			}).Errorln("Error while getting SCM Credential")
-			return nil, errors.New("Error while getting SCM Credential")
-		}
-		runnerJob.SCM = credential
-	}
-
-	jobBytes, err := json.Marshal(runnerJob)
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Unable to marshal Job")
-		return nil, err
-	}
-
-	// publish bytes to ansible queue
-	if err := queue.Publish(queue.Ansible, jobBytes); err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Error": err.Error(),
-		}).Errorln("Error while publishing to Queue")
-		return nil, err
+		Job:       job,
+		ProjectID: p.ID,
+		Project:   p,
 	}
 
 	return &runnerJob, nil
@@ -0,0 +1,111 @@
+package terraform
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// backendOverride is written to the configuration directory of the job
+// and replaces the backend of the configuration with the http backend,
+// the backend is configured by terraform init
+const backendOverride = `# Generated by Tensor, the terraform state is stored by Tensor
+terraform {
+  backend "http" {}
+}
+`
+
+// backendOverrideFile is the name of the backend override file
+const backendOverrideFile = "tensor_backend_override.tf"
+
+// projectCopy returns the copy of the project checkout the job runs in.
+// The copy is bound to the project path, so the override file and the files written
+// by terraform never reach the checkout shared with the other jobs of the project
+func projectCopy(j *types.TerraformJob) string {
+	return filepath.Join(j.Paths.TmpRand, "project")
+}
+
+// dataDir returns the TF_DATA_DIR of the job, it holds the initialized backend
+// including the state credentials of the job
+func dataDir(j *types.TerraformJob) string {
+	return filepath.Join(j.Paths.TmpRand, "terraform.d")
+}
+
+// copyProject copies the project checkout to the project copy of the job,
+// the .git and .terraform directories are skipped
+func copyProject(j *types.TerraformJob) error {
+	dst := projectCopy(j)
+	return filepath.Walk(j.Paths.ProjectRoot, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(j.Paths.ProjectRoot, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case f.IsDir():
+			if rel != "." && (f.Name() == ".git" || f.Name() == ".terraform") {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(target, f.Mode().Perm())
+		case f.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case f.Mode().IsRegular():
+			return copyFile(path, target, f.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// copyFile copies the content of the src file to a new dst file
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeBackendOverride writes the backend override file to the configuration directory
+// of the job in the project copy, it is removed with the temporary files of the job
+func writeBackendOverride(j *types.TerraformJob) error {
+	dir := filepath.Join(projectCopy(j), j.Job.Directory)
+	return ioutil.WriteFile(filepath.Join(dir, backendOverrideFile), []byte(backendOverride), 0644)
+}
+
+// backendConfig returns the terraform init parameters that configure
+// the Tensor state backend of the job template workspace.
+// The job authenticates with the job ID and its state token
+func backendConfig(j *types.TerraformJob) []string {
+	address := util.Config.GetUrl() + "/v1/terraform_state/" + j.Job.JobTemplateID.Hex() + "/" + terraform.Workspace(j.Job.Workspace)
+
+	return []string{
+		"-backend-config=address=" + address,
+		"-backend-config=lock_address=" + address,
+		"-backend-config=unlock_address=" + address,
+		"-backend-config=username=" + j.Job.ID.Hex(),
+		"-backend-config=password=" + j.StateToken,
+	}
+}
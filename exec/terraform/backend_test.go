@@ -0,0 +1,81 @@
+package terraform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestBackendConfig(t *testing.T) {
+	j := &types.TerraformJob{
+		Job:        terraform.Job{ID: bson.NewObjectId(), JobTemplateID: bson.NewObjectId()},
+		StateToken: "token",
+	}
+
+	config := backendConfig(j)
+	assert.Contains(t, config[0], "/v1/terraform_state/"+j.Job.JobTemplateID.Hex()+"/default")
+	assert.Contains(t, config, "-backend-config=username="+j.Job.ID.Hex())
+	assert.Contains(t, config, "-backend-config=password=token")
+
+	j.Job.Workspace = "staging"
+	assert.Contains(t, backendConfig(j)[1], "/v1/terraform_state/"+j.Job.JobTemplateID.Hex()+"/staging")
+}
+
+func TestWriteBackendOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tensor_backend")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j := &types.TerraformJob{
+		Job:   terraform.Job{Directory: "env"},
+		Paths: types.JobPaths{TmpRand: dir},
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(projectCopy(j), "env"), 0755))
+	assert.NoError(t, writeBackendOverride(j))
+
+	content, err := ioutil.ReadFile(filepath.Join(projectCopy(j), "env", backendOverrideFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `backend "http" {}`)
+}
+
+func TestCopyProject(t *testing.T) {
+	project, err := ioutil.TempDir("", "tensor_project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(project)
+	tmp, err := ioutil.TempDir("", "tensor_job")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	for _, d := range []string{".git", "env/.terraform", "modules/vpc"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(project, d), 0755))
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(project, ".git", "HEAD"), []byte("ref"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(project, "env", "main.tf"), []byte("module"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(project, "modules", "vpc", "vpc.tf"), []byte("vpc"), 0644))
+	assert.NoError(t, os.Symlink("../modules", filepath.Join(project, "env", "modules")))
+
+	j := &types.TerraformJob{
+		Job:   terraform.Job{Directory: "env"},
+		Paths: types.JobPaths{ProjectRoot: project, TmpRand: tmp},
+	}
+	assert.NoError(t, copyProject(j))
+	assert.NoError(t, writeBackendOverride(j))
+
+	content, err := ioutil.ReadFile(filepath.Join(projectCopy(j), "env", "modules", "vpc", "vpc.tf"))
+	assert.NoError(t, err)
+	assert.Equal(t, "vpc", string(content), "relative module paths are kept")
+	_, err = os.Stat(filepath.Join(projectCopy(j), ".git"))
+	assert.True(t, os.IsNotExist(err), ".git is not copied")
+	_, err = os.Stat(filepath.Join(projectCopy(j), "env", ".terraform"))
+	assert.True(t, os.IsNotExist(err), ".terraform is not copied")
+
+	// the shared checkout is not modified
+	_, err = os.Stat(filepath.Join(project, "env", backendOverrideFile))
+	assert.True(t, os.IsNotExist(err))
+}
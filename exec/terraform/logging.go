@@ -3,31 +3,52 @@ package terraform
 import (
 	"time"
 
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/notification"
 	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
 )
 
-func start(t *types.TerraformJob) {
-	t.Job.Status = "running"
-	t.Job.Started = time.Now()
+// start marks the job as running, it returns false when the job
+// was canceled or started by another node in the meantime
+func start(t *types.TerraformJob) bool {
+	started := time.Now()
+
+	// the token of the terraform state backend is created when the job
+	// is started, only its hash is stored with the job
+	t.StateToken = util.UniqueNewLen(32)
+	t.Job.StateTokenHash = util.HashToken(t.StateToken)
 
 	d := bson.M{
-		"$set": bson.M{
-			"status":  t.Job.Status,
-			"failed":  false,
-			"started": t.Job.Started,
-		},
+		"status":           "running",
+		"failed":           false,
+		"started":          started,
+		"job_explanation":  "",
+		"execution_node":   instance.Hostname(),
+		"state_token_hash": t.Job.StateTokenHash,
 	}
 
-	if err := db.TerrafromJobs().UpdateId(t.Job.ID, d); err != nil {
+	if err := misc.Start(db.TerrafromJobs(), t.Job.ID, d); err == mgo.ErrNotFound {
+		return false
+	} else if err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Status": t.Job.Status,
+			"Status": "running",
 			"Error":  err,
 		}).Errorln("Failed to update job status")
 	}
+
+	t.Job.Status = "running"
+	t.Job.Started = started
+	notify(t, common.NotificationEventStarted)
+	return true
 }
 
 func status(t *types.TerraformJob, s string) {
@@ -75,8 +96,10 @@ func jobFail(t *types.TerraformJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
+	notify(t, common.NotificationEventError)
 }
 
 func jobCancel(t *types.TerraformJob) {
@@ -84,6 +107,15 @@ func jobCancel(t *types.TerraformJob) {
 	t.Job.Finished = time.Now()
 	t.Job.Failed = false
 
+	// a job canceled before it was started has no elapsed time
+	// and no output
+	if t.Job.Started.IsZero() {
+		t.Job.Started = t.Job.Finished
+	}
+	if len(t.Job.ResultStdout) == 0 {
+		t.Job.ResultStdout = "stdout capture is missing"
+	}
+
 	//get elapsed time in minutes
 	diff := t.Job.Finished.Sub(t.Job.Started)
 
@@ -94,7 +126,7 @@ func jobCancel(t *types.TerraformJob) {
 			"failed":          t.Job.Failed,
 			"finished":        t.Job.Finished,
 			"elapsed":         diff.Minutes(),
-			"result_stdout":   "stdout capture is missing",
+			"result_stdout":   t.Job.ResultStdout,
 			"job_explanation": "Job Cancelled",
 			"job_args":        t.Job.JobARGS,
 			"job_env":         t.Job.JobENV,
@@ -109,6 +141,7 @@ func jobCancel(t *types.TerraformJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
 }
@@ -142,8 +175,10 @@ func jobError(t *types.TerraformJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
+	notify(t, common.NotificationEventError)
 }
 
 func jobSuccess(t *types.TerraformJob) {
@@ -175,8 +210,10 @@ func jobSuccess(t *types.TerraformJob) {
 		}).Errorln("Failed to update job status")
 	}
 
+	blocking.Finish(t.Job.ID)
 	updateProject(t)
 	updateJobTemplate(t)
+	notify(t, common.NotificationEventSuccess)
 }
 
 func updateProject(t *types.TerraformJob) {
@@ -210,3 +247,17 @@ func updateJobTemplate(t *types.TerraformJob) {
 		}).Errorln("Failed to update JobTemplate")
 	}
 }
+
+// notify sends the notifications of the job template and its organization
+func notify(t *types.TerraformJob, event string) {
+	job := notification.Job{
+		ID:             t.Job.ID,
+		Type:           notification.JobTypeTerraformJob,
+		Name:           t.Job.Name,
+		Status:         t.Job.Status,
+		Started:        t.Job.Started,
+		Finished:       t.Job.Finished,
+		JobExplanation: t.Job.JobExplanation,
+	}
+	go notification.Send(job, event, t.Project.OrganizationID, t.Template.ID)
+}
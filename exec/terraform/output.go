@@ -0,0 +1,51 @@
+package terraform
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// saveOutputs runs terraform output and stores the outputs on the job
+func saveOutputs(j *types.TerraformJob, cmd *exec.Cmd) error {
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.New("terraform output failed: " + err.Error())
+	}
+
+	outputs, err := parseOutputs(out)
+	if err != nil {
+		return err
+	}
+
+	j.Job.Outputs = outputs
+	return db.TerrafromJobs().UpdateId(j.Job.ID, bson.M{"$set": bson.M{"outputs": outputs}})
+}
+
+// parseOutputs parses the output of terraform output -json,
+// the values of sensitive outputs are encrypted
+func parseOutputs(data []byte) (map[string]terraform.Output, error) {
+	var raw map[string]terraform.Output
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.New("Could not parse terraform outputs: " + err.Error())
+	}
+
+	outputs := map[string]terraform.Output{}
+	for k, o := range raw {
+		if o.Sensitive {
+			value, err := json.Marshal(o.Value)
+			if err != nil {
+				return nil, errors.New("Could not encode terraform output " + k + ": " + err.Error())
+			}
+			o.Value = util.Cipher(string(value))
+		}
+		outputs[k] = o
+	}
+	return outputs, nil
+}
@@ -0,0 +1,27 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOutputs(t *testing.T) {
+	outputs, err := parseOutputs([]byte(`{
+		"ip": {"sensitive": false, "type": "string", "value": "10.0.0.1"},
+		"dns": {"sensitive": false, "type": "list", "value": ["a.example.com", "b.example.com"]},
+		"password": {"sensitive": true, "type": "string", "value": "hunter2"}
+	}`))
+	assert.NoError(t, err)
+	assert.Len(t, outputs, 3)
+	assert.Equal(t, "10.0.0.1", outputs["ip"].Value)
+	assert.Equal(t, []interface{}{"a.example.com", "b.example.com"}, outputs["dns"].Value)
+
+	assert.True(t, outputs["password"].Sensitive)
+	assert.NotEqual(t, "hunter2", outputs["password"].Value, "sensitive outputs are encrypted")
+	assert.Equal(t, `"hunter2"`, string(util.Decipher(outputs["password"].Value.(string))))
+
+	_, err = parseOutputs([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package terraform
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// planPath returns the path of the plan file of the job
+func planPath(j *types.TerraformJob) string {
+	return filepath.Join(j.Paths.TmpRand, "tensor.tfplan")
+}
+
+// savePlan stores the encrypted plan file of a successful plan job
+// with the state version the plan was made on
+func savePlan(j *types.TerraformJob) error {
+	plan, err := ioutil.ReadFile(planPath(j))
+	if err != nil {
+		return errors.New("Could not read the plan file: " + err.Error())
+	}
+
+	version, err := terraform.LatestStateVersion(j.Job.JobTemplateID, j.Job.Workspace)
+	if err != nil {
+		return errors.New("Could not get the terraform state version: " + err.Error())
+	}
+
+	f, err := db.TerraformPlans().Create(j.Job.ID.Hex())
+	if err != nil {
+		return errors.New("Could not store the plan file: " + err.Error())
+	}
+	if _, err := f.Write([]byte(util.Cipher(string(plan)))); err != nil {
+		f.Close()
+		return errors.New("Could not store the plan file: " + err.Error())
+	}
+	if err := f.Close(); err != nil {
+		return errors.New("Could not store the plan file: " + err.Error())
+	}
+
+	id := f.Id().(bson.ObjectId)
+	j.Job.PlanFileID = &id
+	j.Job.PlanStateVersion = version
+	return db.TerrafromJobs().UpdateId(j.Job.ID, bson.M{"$set": bson.M{
+		"plan_file_id":       id,
+		"plan_state_version": version,
+	}})
+}
+
+// restorePlan writes the saved plan of the plan job to the plan file of the apply job.
+// The plan is validated again since the state may have changed while the job was queued
+func restorePlan(j *types.TerraformJob) error {
+	var plan terraform.Job
+	if err := db.TerrafromJobs().FindId(*j.Job.PlanJobID).One(&plan); err != nil {
+		return errors.New("Could not find the plan job: " + err.Error())
+	}
+
+	if err := plan.ValidatePlan(time.Duration(util.Config.TerraformPlanMaxAge) * time.Second); err != nil {
+		return err
+	}
+
+	f, err := db.TerraformPlans().OpenId(*plan.PlanFileID)
+	if err != nil {
+		return errors.New("Could not read the saved plan: " + err.Error())
+	}
+	defer f.Close()
+
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		return errors.New("Could not read the saved plan: " + err.Error())
+	}
+
+	return ioutil.WriteFile(planPath(j), util.Decipher(string(content)), 0600)
+}
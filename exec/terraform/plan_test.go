@@ -0,0 +1,37 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/exec/types"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestBuildParamsPlan(t *testing.T) {
+	j := &types.TerraformJob{
+		Job:   terraform.Job{JobType: terraform.JobTypePlan, Directory: "env"},
+		Paths: types.JobPaths{TmpRand: "/tmp/tensor__test"},
+	}
+
+	params := buildParams(j, []string{"terraform"})
+	assert.Equal(t, []string{"terraform", "plan", "-input=false", "-out=/tmp/tensor__test/tensor.tfplan", "env"}, params)
+}
+
+func TestBuildParamsApplyPlan(t *testing.T) {
+	id := bson.NewObjectId()
+	j := &types.TerraformJob{
+		Job: terraform.Job{
+			JobType:   terraform.JobTypeApply,
+			Directory: "env",
+			Vars:      map[string]interface{}{"region": "eu"},
+			PlanJobID: &id,
+		},
+		Paths: types.JobPaths{TmpRand: "/tmp/tensor__test"},
+	}
+
+	params := buildParams(j, []string{"terraform"})
+	assert.Equal(t, []string{"terraform", "apply", "-input=false", "/tmp/tensor__test/tensor.tfplan"}, params,
+		"the saved plan is applied without variables")
+}
@@ -1,8 +1,8 @@
 package terraform
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
 	"os/exec"
 	"strconv"
@@ -12,9 +12,16 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/blocking"
+	"github.com/pearsonappeng/tensor/exec/launch"
 	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/sync"
 	"github.com/pearsonappeng/tensor/exec/types"
-	"github.com/streadway/amqp"
+	"github.com/pearsonappeng/tensor/exec/worker"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 
 	"io/ioutil"
 	"path"
@@ -27,106 +34,102 @@ import (
 	"github.com/rodaine/hclencoder"
 )
 
-// Run starts consuming jobs into a channel of size prefetchLimit
+// Run starts the workers consuming the terraform queue
 func Run() {
-	conn, err := amqp.Dial(util.Config.RabbitMQ)
+	worker.Run(queue.Terraform, util.Config.TerraformWorkers, handleJob)
+}
 
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Terraform,
-			"Error": err.Error(),
-		}).Infoln("Could not contact RabbitMQ server")
+// handleJob runs a job delivered by the queue
+func handleJob(d queue.Delivery) {
+	var msg types.Message
+	if err := json.Unmarshal(d.Body(), &msg); err != nil {
+		// handle error
+		logrus.Warningln("TerraformJob delivery rejected")
+		d.DeadLetter()
 		return
 	}
 
-	defer conn.Close()
-
-	ch, err := conn.Channel()
-
-	if err != nil {
+	// the message may be delivered again after the node was restarted
+	if misc.IsStarted(db.TerrafromJobs(), msg.JobID) {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Terraform,
-			"Error": err.Error(),
-		}).Infoln("Failed to open a channel")
+			"Terraform Job ID": msg.JobID.Hex(),
+		}).Warningln("Terraform Job was already started, delivery skipped")
+		d.Ack()
 		return
 	}
 
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		queue.Terraform, // name
-		true,            // durable
-		false,           // delete when unused
-		false,           // exclusive
-		false,           // no-wait
-		nil,             // arguments
-	)
-
-	if err != nil {
+	jb := types.TerraformJob{}
+	if err := db.TerrafromJobs().FindId(msg.JobID).One(&jb.Job); err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Terraform,
-			"Error": err.Error(),
-		}).Infoln("Failed to declare a queue")
+			"Terraform Job ID": msg.JobID.Hex(),
+			"Error":            err.Error(),
+		}).Warningln("Terraform Job could not be loaded, delivery skipped")
+		d.Ack()
 		return
 	}
 
-	err = ch.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
+	logrus.WithFields(logrus.Fields{
+		"Job ID": jb.Job.ID.Hex(),
+		"Name":   jb.Job.Name,
+	}).Infoln("TerraformJob successfuly received")
 
-	if err != nil {
+	if err := load(&jb, msg); err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Terraform,
-			"Error": err.Error(),
-		}).Infoln("Failed to set QoS")
+			"Terraform Job ID": jb.Job.ID.Hex(),
+			"Error":            err.Error(),
+		}).Errorln("Terraform Job can not be started")
+		jb.Job.JobExplanation = err.Error()
+		jobError(&jb)
+		d.Ack()
 		return
 	}
 
-	msgs, err := ch.Consume(
-		q.Name, // queue
-		"",     // consumer
-		false,  // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
-	)
-
-	if err != nil {
+	// job may have been canceled while it was in the queue
+	if misc.IsCanceled(db.TerrafromJobs(), jb.Job.ID) {
 		logrus.WithFields(logrus.Fields{
-			"Queue": queue.Terraform,
-			"Error": err.Error(),
-		}).Infoln("Failed to register a consumer")
+			"Terraform Job ID": jb.Job.ID.Hex(),
+			"Name":             jb.Job.Name,
+		}).Infoln("Terraform Job was canceled before it started")
+		jobCancel(&jb)
+		d.Ack()
 		return
 	}
 
-	for d := range msgs {
-		jb := types.TerraformJob{}
-		if err := json.Unmarshal(d.Body, &jb); err != nil {
-			// handle error
-			logrus.Warningln("TerraformJob delivery rejected")
-			d.Reject(false)
-			jobFail(&jb)
-			continue
-		}
+	status(&jb, "pending")
 
-		logrus.WithFields(logrus.Fields{
-			"Job ID": jb.Job.ID.Hex(),
-			"Name":   jb.Job.Name,
-		}).Infoln("TerraformJob successfuly received")
+	logrus.WithFields(logrus.Fields{
+		"Terraform Job ID": jb.Job.ID.Hex(),
+		"Name":             jb.Job.Name,
+	}).Infoln("Terraform Job changed status to pending")
+
+	// the job is started again when the jobs blocking it have finished
+	if !waitBlockers(&jb, d.Body()) {
+		d.Ack()
+		return
+	}
 
-		status(&jb, "pending")
+	// wait for the capacity of the node
+	impact, ok := worker.Acquire(worker.TerraformImpact(jb.Job.Parallelism))
+	if !ok {
+		d.Reject()
+		return
+	}
 
+	// the checkout of the project is updated on the node running the job
+	if err := sync.Checkout(jb.Project); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Terraform Job ID": jb.Job.ID.Hex(),
-			"Name":             jb.Job.Name,
-		}).Infoln("Terraform Job changed status to pending")
-
-		terraformRun(&jb)
-		d.Ack(false)
+			"Error":            err.Error(),
+		}).Errorln("Terraform Job can not be started")
+		jb.Job.JobExplanation = err.Error()
+		jobError(&jb)
+		worker.NodeCapacity().Release(impact)
+		d.Ack()
+		return
 	}
+	terraformRun(&jb)
+	worker.NodeCapacity().Release(impact)
+	d.Ack()
 }
 
 func terraformRun(j *types.TerraformJob) {
@@ -135,53 +138,24 @@ func terraformRun(j *types.TerraformJob) {
 		"Name":             j.Job.Name,
 	}).Infoln("Terraform Job starting")
 
-	// update if requested
-	if j.PreviousJob != nil {
-		// wait for scm update
-		status(j, "waiting")
-
+	// the job may have been canceled since its cancel_flag was checked
+	if !start(j) {
 		logrus.WithFields(logrus.Fields{
-			"Job ID": j.Job.ID.Hex(),
-			"Name":   j.Job.Name,
-		}).Infoln("Terraform Job changed status to waiting")
-
-		ticker := time.NewTicker(time.Second * 2)
-
-		for range ticker.C {
-			if err := db.Jobs().FindId(j.PreviousJob.Job.ID).One(&j.PreviousJob.Job); err != nil {
-				logrus.Warningln("Could not find Previous Job", err)
-				continue
-			}
-
-			if j.PreviousJob.Job.Status == "failed" || j.PreviousJob.Job.Status == "error" {
-				e := "Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}"
-				logrus.Errorln(e)
-				j.Job.JobExplanation = e
-				j.Job.ResultStdout = "stdout capture is missing"
-				jobError(j)
-				return
-			}
-			if j.PreviousJob.Job.Status == "successful" {
-				// stop the ticker and break the loop
-				logrus.WithFields(logrus.Fields{
-					"Job ID": j.PreviousJob.Job.ID.Hex(),
-					"Name":   j.PreviousJob.Job.Name,
-				}).Infoln("Update job successful")
-				ticker.Stop()
-				break
-			}
+			"Terraform Job ID": j.Job.ID.Hex(),
+		}).Infoln("Terraform Job was canceled or started by another node, run aborted")
+		if misc.IsCanceled(db.TerrafromJobs(), j.Job.ID) {
+			jobCancel(j)
 		}
+		return
 	}
 
-	start(j)
-
 	logrus.WithFields(logrus.Fields{
 		"Terraform Job ID": j.Job.ID.Hex(),
 		"Name":             j.Job.Name,
 	}).Infoln("Terraform Job started")
 
 	// Start SSH agent
-	client, socket, pid, sshcleanup := ssh.StartAgent()
+	client, socket, pid, sshcleanup := ssh.StartAgent(misc.TempPrefix(j.Job.ID))
 
 	if len(j.Machine.SSHKeyData) > 0 {
 		if len(j.Machine.SSHKeyUnlock) > 0 {
@@ -268,7 +242,7 @@ func terraformRun(j *types.TerraformJob) {
 
 	}
 
-	cmd, getCmd, cleanup, err := getCmd(j, socket, pid)
+	cmd, getCmd, outputCmd, cleanup, err := getCmd(j, socket, pid)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
@@ -288,20 +262,23 @@ func terraformRun(j *types.TerraformJob) {
 		sshcleanup()
 		cleanup()
 	}()
-	var b bytes.Buffer
-	cmd.Stdout = &b
-	cmd.Stderr = &b
+	// output is stored while the job is running
+	b := misc.NewOutputWriter(j.Job.ID)
+	cmd.Stdout = b
+	cmd.Stderr = b
 	// Set setsid to create a new session, The new process group has no controlling
 	// terminal which disables the stdin & will skip prompts
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 	getCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	outputCmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
 
 	getOutput, err := getCmd.CombinedOutput()
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running terraform " + j.Job.JobType + " failed")
-		j.Job.JobExplanation = "terraform get failed"
+		b.Close()
+		j.Job.JobExplanation = "terraform init failed"
 		j.Job.ResultStdout = string(getOutput)
 		jobFail(j)
 		return
@@ -311,37 +288,198 @@ func terraformRun(j *types.TerraformJob) {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running terraform " + j.Job.JobType + " failed")
+		b.Close()
 		j.Job.JobExplanation = err.Error()
-		j.Job.ResultStdout = string(b.Bytes())
 		jobFail(j)
 		return
 	}
 	var timer *time.Timer
 	timer = time.AfterFunc(time.Duration(util.Config.TerraformJobTimeOut)*time.Second, func() {
 		logrus.Println("Killing the process. Execution exceeded threashold value")
-		cmd.Process.Kill()
+		misc.KillProcessGroup(cmd)
 	})
+	// kill the process group when a cancel is requested
+	watcher := misc.WatchCancel(db.TerrafromJobs(), j.Job.ID, cmd)
 	if err := cmd.Wait(); err != nil {
+		timer.Stop()
+		watcher.Stop()
+		b.Close()
+		if watcher.Canceled() {
+			jobCancel(j)
+			return
+		}
+		if watcher.Terminated() {
+			j.Job.JobExplanation = misc.TerminatedExplanation
+			jobError(j)
+			return
+		}
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
 		}).Errorln("Running terraform " + j.Job.JobType + " failed")
 		j.Job.JobExplanation = err.Error()
-		j.Job.ResultStdout = string(b.Bytes())
 		jobFail(j)
-		timer.Stop()
 		return
 	}
 	timer.Stop()
-	// set stdout
-	j.Job.ResultStdout = string(b.Bytes())
+	watcher.Stop()
+	b.Close()
+	// plan jobs keep the plan so that it can be approved and applied
+	if j.Job.JobType == terraform.JobTypePlan {
+		if err := savePlan(j); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Saving terraform plan failed")
+			j.Job.JobExplanation = err.Error()
+			jobFail(j)
+			return
+		}
+	}
+	// record the outputs of the applied configuration, the apply
+	// itself succeeded so the job is not failed if this fails
+	if j.Job.JobType == terraform.JobTypeApply {
+		if err := saveOutputs(j, outputCmd); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Terraform Job ID": j.Job.ID.Hex(),
+				"Error":            err.Error(),
+			}).Errorln("Saving terraform outputs failed")
+		}
+	}
 	//success
 	jobSuccess(j)
+
+	// import the applied resources into the inventories
+	if j.Job.JobType == terraform.JobTypeApply {
+		if _, err := launch.UpdateTerraformSources(j.Job.JobTemplateID, j.User); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Terraform Job ID": j.Job.ID.Hex(),
+				"Error":            err.Error(),
+			}).Errorln("Could not update terraform inventory sources")
+		}
+	}
+}
+
+// load loads the template, the project and the credentials of the job.
+// They are loaded from the database when the job is run and are not stored in the queue
+func load(j *types.TerraformJob, msg types.Message) error {
+	var err error
+	if err = db.TerrafromJobTemplates().FindId(j.Job.JobTemplateID).One(&j.Template); err != nil {
+		return errors.New("Error while getting job template: " + err.Error())
+	}
+
+	if err = db.Projects().FindId(j.Job.ProjectID).One(&j.Project); err != nil {
+		return errors.New("Error while getting project: " + err.Error())
+	}
+
+	if j.Machine, err = misc.LoadCredential(j.Job.MachineCredentialID, "machine"); err != nil {
+		return err
+	}
+	if j.Network, err = misc.LoadCredential(j.Job.NetworkCredentialID, "network"); err != nil {
+		return err
+	}
+	if j.Cloud, err = misc.LoadCredential(j.Job.CloudCredentialID, "cloud"); err != nil {
+		return err
+	}
+	if j.SCM, err = misc.LoadCredential(j.Job.SCMCredentialID, "SCM"); err != nil {
+		return err
+	}
+
+	j.User = misc.LoadUser(j.Job.CreatedByID)
+	if msg.PreviousJobID != nil {
+		j.PreviousJob = &types.SyncJob{Job: ansible.Job{ID: *msg.PreviousJobID}}
+	}
+
+	return nil
+}
+
+// blocker returns the job which has to finish before the job is started. The project update
+// of the job, the updates of the project and the running job of the job template block the job.
+// An error is returned if the project update has failed
+func blocker(j *types.TerraformJob) (*blocking.Blocker, error) {
+	if j.PreviousJob != nil {
+		if err := db.Jobs().FindId(j.PreviousJob.Job.ID).One(&j.PreviousJob.Job); err != nil {
+			return nil, err
+		}
+		switch j.PreviousJob.Job.Status {
+		case "failed", "error", "canceled":
+			return nil, errors.New("Previous Task Failed: {\"job_type\": \"project_update\", \"job_name\": \"" + j.PreviousJob.Job.Name + "\", \"job_id\": \"" + j.PreviousJob.Job.ID.Hex() + "\"}")
+		case "successful":
+		default:
+			return &blocking.Blocker{
+				ID:         j.PreviousJob.Job.ID,
+				Type:       blocking.TypeProjectUpdate,
+				Name:       j.PreviousJob.Job.Name,
+				Collection: db.CJobs,
+			}, nil
+		}
+	}
+
+	var update ansible.Job
+	err := db.Jobs().Find(bson.M{
+		"project_id": j.Project.ID,
+		"job_type":   ansible.JOBTYPE_UPDATE_JOB,
+		"status":     bson.M{"$in": []string{"new", "pending", "waiting", "running"}},
+	}).One(&update)
+	if err == nil {
+		return &blocking.Blocker{
+			ID:         update.ID,
+			Type:       blocking.TypeProjectUpdate,
+			Name:       update.Name,
+			Collection: db.CJobs,
+		}, nil
+	}
+	if err != mgo.ErrNotFound {
+		return nil, err
+	}
+
+	// only one job of the terraform job template runs at a time
+	if !j.Job.AllowSimultaneous && j.Job.JobTemplateID.Valid() {
+		return blocking.Lock("terraform_job_template:"+j.Job.JobTemplateID.Hex(), blocking.Blocker{
+			ID:         j.Job.ID,
+			Type:       blocking.TypeTerraformJob,
+			Name:       j.Job.Name,
+			Collection: db.CTerraformJobs,
+		})
+	}
+
+	return nil, nil
+}
+
+// waitBlockers parks the job while it is blocked by other jobs,
+// it returns whether the job can be started
+func waitBlockers(j *types.TerraformJob, body []byte) bool {
+	for {
+		b, err := blocker(j)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Terraform Job ID": j.Job.ID.Hex(),
+				"Error":            err.Error(),
+			}).Errorln("Terraform Job can not be started")
+			j.Job.JobExplanation = err.Error()
+			j.Job.ResultStdout = "stdout capture is missing"
+			jobError(j)
+			return false
+		}
+		if b == nil {
+			return true
+		}
+
+		parked, err := blocking.Wait(db.TerrafromJobs(), j.Job.ID, queue.Terraform, body, *b)
+		if err != nil {
+			j.Job.JobExplanation = err.Error()
+			j.Job.ResultStdout = "stdout capture is missing"
+			jobError(j)
+			return false
+		}
+		if parked {
+			return false
+		}
+	}
 }
 
 // getCmd returns cmd
-func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCmd *exec.Cmd, cleanup func(), err error) {
+func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCmd *exec.Cmd, outputCmd *exec.Cmd, cleanup func(), err error) {
 	// Generate directory paths and create directories
-	tmp := "/tmp/tensor_proot_" + uniuri.New() + "/"
+	tmp := misc.TempPath(j.Job.ID) + "/"
 	j.Paths = types.JobPaths{
 		Etc:             filepath.Join(tmp, uniuri.New()),
 		Tmp:             filepath.Join(tmp, uniuri.New()),
@@ -349,12 +487,26 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 		VarLibJobStatus: filepath.Join(tmp, uniuri.New()),
 		VarLibProjects:  filepath.Join(tmp, uniuri.New()),
 		VarLog:          filepath.Join(tmp, uniuri.New()),
-		TmpRand:         "/tmp/tensor__" + uniuri.New(),
+		TmpRand:         misc.TempPath(j.Job.ID),
 		ProjectRoot:     filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
-		CredentialPath:  "/tmp/tensor_" + uniuri.New(),
+		CredentialPath:  misc.TempPath(j.Job.ID),
 	}
 	// create job directories
 	createTmpDirs(j)
+	// the job runs in its own copy of the project,
+	// the state is stored by the Tensor state backend
+	if err := copyProject(j); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if err := writeBackendOverride(j); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	// apply jobs of an approved plan apply the saved plan
+	if j.Job.PlanJobID != nil {
+		if err := restorePlan(j); err != nil {
+			return nil, nil, nil, nil, err
+		}
+	}
 	// add proot and ansible parameters
 	args := []string{"-v", "0", "-r", "/",
 		"-b", j.Paths.Etc + ":/etc/tensor",
@@ -363,10 +515,11 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 		"-b", j.Paths.VarLibProjects + ":" + util.Config.ProjectsHome,
 		"-b", j.Paths.VarLog + ":/var/log",
 		"-b", j.Paths.TmpRand + ":" + j.Paths.TmpRand,
-		"-b", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()) + ":" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
+		"-b", projectCopy(j) + ":" + filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
 		"-b", "/var/lib/tensor:/var/lib/tensor",
 		"-w", filepath.Join(util.Config.ProjectsHome, j.Project.ID.Hex()),
 	}
+	args = append(args, misc.AgentBind(socket)...)
 
 	JobARGS := append(args, buildParams(j, []string{"terraform"})...)
 	j.Job.JobARGS = JobARGS
@@ -383,11 +536,11 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 		"_=/usr/bin/tensord",
 		"PROOT_NO_SECCOMP=1",
 		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
-		"REST_API_TOKEN=" + j.Token,
 		"JOB_ID=" + j.Job.ID.Hex(),
 		"REST_API_URL=" + util.Config.GetUrl(),
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"TF_DATA_DIR=" + dataDir(j),
 	}
 	// Assign job env here to ensure that sensitive information will
 	// not be exposed
@@ -400,40 +553,47 @@ func getCmd(j *types.TerraformJob, socket string, pid int) (cmd *exec.Cmd, getCm
 		"PROOT_NO_SECCOMP=1",
 		"_=/usr/bin/tensord",
 		"PATH=/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
-		"REST_API_TOKEN=" + strings.Repeat("*", len(j.Token)),
 		"JOB_ID=" + j.Job.ID.Hex(),
 		"REST_API_URL=" + util.Config.GetUrl(),
 		"SSH_AUTH_SOCK=" + socket,
 		"SSH_AGENT_PID=" + strconv.Itoa(pid),
+		"TF_DATA_DIR=" + dataDir(j),
 	}
 	var f *os.File
 	if j.Cloud.Cloud {
-		cmd.Env, f, err = misc.GetCloudCredential(cmd.Env, j.Cloud)
+		cmd.Env, f, err = misc.GetCloudCredential(cmd.Env, j.Cloud, misc.TempPrefix(j.Job.ID))
 		if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, nil, err
 		}
 	}
 
-	// Issue a terraform get for all jobs
-	// and apply -update parameter if update on launch is true
-	tget := append(args, "terraform", "get")
+	// Issue a terraform init for all jobs, it configures the backend and gets the modules,
+	// apply -upgrade parameter if update on launch is true. The backend of the job
+	// is always configured from scratch in the data directory of the job
+	tinit := append(args, "terraform", "init", "-input=false", "-reconfigure")
+	tinit = append(tinit, backendConfig(j)...)
 	if j.Job.UpdateOnLaunch {
-		tget = append(tget, "-update")
+		tinit = append(tinit, "-upgrade")
 	}
 	if len(j.Job.Directory) > 0 {
-		tget = append(tget, j.Job.Directory)
+		tinit = append(tinit, j.Job.Directory)
 	}
 
-	getCmd = exec.Command("proot", tget...)
+	getCmd = exec.Command("proot", tinit...)
 	getCmd.Env = cmd.Env
 	getCmd.Dir = cmd.Dir
 
+	// terraform output reads the outputs from the state of the initialized backend
+	outputCmd = exec.Command("proot", append(args, "terraform", "output", "-json")...)
+	outputCmd.Env = cmd.Env
+	outputCmd.Dir = cmd.Dir
+
 	logrus.WithFields(logrus.Fields{
 		"Dir":         cmd.Dir,
 		"Environment": append([]string{}, cmd.Env...),
 	}).Debugln("Job Directory and Environment")
 
-	return cmd, getCmd, func() {
+	return cmd, getCmd, outputCmd, func() {
 		if f != nil {
 			if err := os.RemoveAll(f.Name()); err != nil {
 				logrus.Errorln("Unable to remove cloud credential")
@@ -456,11 +616,15 @@ func buildParams(j *types.TerraformJob, params []string) []string {
 	case "apply":
 		{
 			params = append(params, "apply", "-input=false")
+			// an approved plan already contains the variables
+			if j.Job.PlanJobID != nil {
+				return append(params, planPath(j))
+			}
 			break
 		}
 	case "plan":
 		{
-			params = append(params, "plan", "-input=false")
+			params = append(params, "plan", "-input=false", "-out="+planPath(j))
 			break
 		}
 	case "destroy":
@@ -483,7 +647,8 @@ func buildParams(j *types.TerraformJob, params []string) []string {
 
 	// extra variables -e EXTRA_VARS, --extra-vars=EXTRA_VARS
 	if len(j.Job.Vars) > 0 {
-		vars, err := hclencoder.Encode(j.Job.Vars)
+		// the variable file is removed with the job directories
+		vars, err := hclencoder.Encode(misc.DecipherVars(j.Job.Vars, j.Job.SurveyPasswords))
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"Error": err,
@@ -0,0 +1,17 @@
+package types
+
+import (
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// AdHocJob contains all the information required to start an ad hoc command,
+// it is loaded by the worker from the command stored in the database
+type AdHocJob struct {
+	Command   ansible.AdHocCommand
+	Machine   common.Credential
+	Inventory ansible.Inventory
+	User      common.User
+	Token     string
+	Paths     JobPaths
+}
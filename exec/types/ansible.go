@@ -3,9 +3,11 @@ package types
 import (
 	"github.com/pearsonappeng/tensor/models/ansible"
 	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
 )
 
-// AnsibleJob contains all the information required to start a job
+// AnsibleJob contains all the information required to start a job,
+// it is loaded by the worker from the job stored in the database
 type AnsibleJob struct {
 	Job         ansible.Job
 	Template    ansible.JobTemplate
@@ -17,8 +19,11 @@ type AnsibleJob struct {
 	Project     common.Project
 	User        common.User
 	PreviousJob *SyncJob
-	Token       string
-	Paths       JobPaths
+	// InventoryUpdates are the updates of the inventory sources
+	// the job waits for
+	InventoryUpdates []bson.ObjectId
+	Token            string
+	Paths            JobPaths
 }
 
 type JobPaths struct {
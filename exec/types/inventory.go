@@ -0,0 +1,19 @@
+package types
+
+import (
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// InventoryUpdateJob contains all the information required to synchronize an inventory source,
+// it is loaded by the worker from the update stored in the database
+type InventoryUpdateJob struct {
+	Update     ansible.InventoryUpdate
+	Source     ansible.InventorySource
+	Inventory  ansible.Inventory
+	Credential common.Credential
+	// Script is the custom inventory script of the source
+	Script ansible.InventoryScript
+	User   common.User
+	Paths  JobPaths
+}
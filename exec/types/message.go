@@ -0,0 +1,17 @@
+package types
+
+import (
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Message is published to the job queues. It carries only the ids of the job and of
+// the jobs it depends on, the worker loads the job, its credentials and the objects
+// it uses from the database when the job is run. No secret is stored in the queue
+type Message struct {
+	JobID bson.ObjectId `json:"job_id"`
+	// PreviousJobID is the project update run before the job
+	PreviousJobID *bson.ObjectId `json:"previous_job_id,omitempty"`
+	// InventoryUpdates are the updates of the inventory sources
+	// the job waits for
+	InventoryUpdates []bson.ObjectId `json:"inventory_updates,omitempty"`
+}
@@ -0,0 +1,33 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestMessage(t *testing.T) {
+	previous := bson.NewObjectId()
+	m := Message{
+		JobID:            bson.NewObjectId(),
+		PreviousJobID:    &previous,
+		InventoryUpdates: []bson.ObjectId{bson.NewObjectId()},
+	}
+
+	b, err := json.Marshal(m)
+	assert.NoError(t, err)
+
+	var fields map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &fields))
+	assert.Len(t, fields, 3, "the message only carries ids")
+
+	var decoded Message
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, m, decoded)
+
+	b, err = json.Marshal(Message{JobID: m.JobID})
+	assert.NoError(t, err)
+	assert.Equal(t, `{"job_id":"`+m.JobID.Hex()+`"}`, string(b))
+}
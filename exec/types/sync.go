@@ -14,6 +14,8 @@ type SyncJob struct {
 	SCM            common.Credential
 	Project        common.Project
 	User           common.User
-	Token          string
 	CredentialPath string // for system jobs
+	// Local is set when only the checkout of the node is updated,
+	// the project itself is left untouched
+	Local bool
 }
@@ -5,7 +5,8 @@ import (
 	"github.com/pearsonappeng/tensor/models/terraform"
 )
 
-// TerraformJob contains all the information required to start a job
+// TerraformJob contains all the information required to start a job,
+// it is loaded by the worker from the job stored in the database
 type TerraformJob struct {
 	Job         terraform.Job
 	Template    terraform.JobTemplate
@@ -16,6 +17,7 @@ type TerraformJob struct {
 	Project     common.Project
 	User        common.User
 	PreviousJob *SyncJob
-	Token       string
-	Paths       JobPaths
+	// StateToken authenticates the job at the terraform state backend
+	StateToken string
+	Paths      JobPaths
 }
@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"sync"
+)
+
+// Capacity limits the jobs running on a node by their impact.
+// A job whose impact is greater than the capacity is run when the node is idle
+type Capacity struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	used int
+	max  int
+	// stopped wakes up the waiting jobs and refuses new ones
+	stopped bool
+}
+
+// NewCapacity returns a capacity of max
+func NewCapacity(max int) *Capacity {
+	c := &Capacity{max: max}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Acquire waits until the impact is available and consumes it,
+// it returns the consumed impact which must be released.
+// It returns false without consuming anything once the capacity is stopped
+func (c *Capacity) Acquire(impact int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if impact > c.max {
+		impact = c.max
+	}
+	if impact < 1 {
+		impact = 1
+	}
+	for !c.stopped && c.used > 0 && c.used+impact > c.max {
+		c.cond.Wait()
+	}
+	if c.stopped {
+		return 0, false
+	}
+	c.used += impact
+	return impact, true
+}
+
+// Stop wakes up the waiting Acquire calls, which return false as
+// every later call. The consumed impact can still be released
+func (c *Capacity) Stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// Release releases the impact consumed by Acquire
+func (c *Capacity) Release(impact int) {
+	c.mu.Lock()
+	c.used -= impact
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// Used returns the consumed capacity
+func (c *Capacity) Used() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.used
+}
+
+// Max returns the capacity
+func (c *Capacity) Max() int {
+	return c.max
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func acquire(t *testing.T, c *Capacity, impact int) int {
+	impact, ok := c.Acquire(impact)
+	assert.True(t, ok, "capacity is stopped")
+	return impact
+}
+
+func TestCapacityAcquire(t *testing.T) {
+	c := NewCapacity(10)
+
+	assert.Equal(t, 6, acquire(t, c, 6))
+	assert.Equal(t, 6, c.Used())
+
+	acquired := make(chan int)
+	go func() {
+		acquired <- acquire(t, c, 6)
+	}()
+
+	// the impact is not available until the first job is released
+	select {
+	case <-acquired:
+		t.Fatal("capacity exceeded")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Release(6)
+	select {
+	case impact := <-acquired:
+		assert.Equal(t, 6, impact)
+	case <-time.After(time.Second):
+		t.Fatal("capacity not acquired after release")
+	}
+	assert.Equal(t, 6, c.Used())
+}
+
+func TestCapacityLargeImpact(t *testing.T) {
+	c := NewCapacity(10)
+
+	// a job larger than the node runs alone
+	assert.Equal(t, 10, acquire(t, c, 51))
+	assert.Equal(t, 10, c.Used())
+	c.Release(10)
+
+	assert.Equal(t, 1, acquire(t, c, 0))
+	assert.Equal(t, 10, c.Max())
+}
+
+func TestCapacityStop(t *testing.T) {
+	c := NewCapacity(10)
+	assert.Equal(t, 10, acquire(t, c, 10))
+
+	stopped := make(chan bool)
+	go func() {
+		_, ok := c.Acquire(5)
+		stopped <- ok
+	}()
+
+	// the waiting job is woken up without a release
+	c.Stop()
+	select {
+	case ok := <-stopped:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("waiting job not woken up by stop")
+	}
+
+	c.Release(10)
+	_, ok := c.Acquire(1)
+	assert.False(t, ok, "no capacity is acquired once stopped")
+	assert.Equal(t, 0, c.Used())
+}
+
+func TestImpact(t *testing.T) {
+	assert.Equal(t, 6, AnsibleImpact(0))
+	assert.Equal(t, 21, AnsibleImpact(20))
+	assert.Equal(t, 11, TerraformImpact(0))
+	assert.Equal(t, 3, TerraformImpact(2))
+}
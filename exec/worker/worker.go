@@ -0,0 +1,180 @@
+// Package worker runs the jobs consumed from the queues with a fixed number
+// of workers per queue. The jobs running on a node are limited by the capacity
+// of the node, the impact of a job is based on its forks or parallelism.
+package worker
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/util"
+)
+
+// default forks of ansible and parallelism of terraform
+const (
+	defaultForks       = 5
+	defaultParallelism = 10
+)
+
+// Handler handles a delivery, it must acknowledge, reject or dead-letter it
+type Handler func(d queue.Delivery)
+
+// Pool is the set of workers consuming a queue
+type Pool struct {
+	Queue   string `json:"queue"`
+	Workers int    `json:"workers"`
+	running int32
+}
+
+// Running returns the number of deliveries being handled
+func (p *Pool) Running() int {
+	return int(atomic.LoadInt32(&p.running))
+}
+
+var (
+	mu    sync.Mutex
+	pools = map[string]*Pool{}
+
+	capacityOnce sync.Once
+	capacity     *Capacity
+
+	stopOnce sync.Once
+	stop     = make(chan struct{})
+)
+
+// NodeCapacity returns the capacity of the node
+func NodeCapacity() *Capacity {
+	capacityOnce.Do(func() {
+		capacity = NewCapacity(util.Config.Capacity)
+	})
+	return capacity
+}
+
+// Run consumes the queue with the given number of workers, every worker handles
+// one delivery at a time. Run returns when the queue is closed and the workers are done
+func Run(name string, workers int, handle Handler) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	msgs, err := queue.Consume(name, workers)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Queue": name,
+			"Error": err.Error(),
+		}).Errorln("Failed to register a consumer")
+		return
+	}
+
+	pool := &Pool{Queue: name, Workers: workers}
+	mu.Lock()
+	pools[name] = pool
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				case d, ok := <-msgs:
+					if !ok {
+						return
+					}
+					atomic.AddInt32(&pool.running, 1)
+					// deliveries received while stopping are requeued for other nodes
+					if Stopping() {
+						d.Reject()
+					} else {
+						handle(d)
+					}
+					atomic.AddInt32(&pool.running, -1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	logrus.WithFields(logrus.Fields{
+		"Queue": name,
+	}).Warningln("Consumer stopped")
+}
+
+// Stop stops the workers from handling new deliveries,
+// the deliveries being handled are not interrupted
+func Stop() {
+	stopOnce.Do(func() {
+		close(stop)
+		NodeCapacity().Stop()
+	})
+}
+
+// Stopping returns whether the workers are stopping
+func Stopping() bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Wait waits until the deliveries being handled are done or the timeout
+// expires, it returns false if deliveries are still being handled
+func Wait(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		running := 0
+		for _, p := range Pools() {
+			running += p.Running()
+		}
+		if running == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Acquire waits for the impact to be available on the node. It returns false
+// if the node is stopping, the job must not be started and its delivery must be rejected
+func Acquire(impact int) (int, bool) {
+	return NodeCapacity().Acquire(impact)
+}
+
+// Pools returns the worker pools of the node ordered by queue
+func Pools() []*Pool {
+	mu.Lock()
+	defer mu.Unlock()
+	list := []*Pool{}
+	for _, p := range pools {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Queue < list[j].Queue })
+	return list
+}
+
+// AnsibleImpact returns the impact of an ansible job or ad hoc command
+func AnsibleImpact(forks uint8) int {
+	if forks == 0 {
+		return defaultForks + 1
+	}
+	return int(forks) + 1
+}
+
+// TerraformImpact returns the impact of a terraform job
+func TerraformImpact(parallelism uint8) int {
+	if parallelism == 0 {
+		return defaultParallelism + 1
+	}
+	return int(parallelism) + 1
+}
@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStop(t *testing.T) {
+	util.Config.Capacity = 10
+	assert.False(t, Stopping())
+
+	impact, ok := Acquire(AnsibleImpact(0))
+	assert.True(t, ok)
+	assert.Equal(t, 6, impact)
+	NodeCapacity().Release(impact)
+
+	Stop()
+	Stop()
+	assert.True(t, Stopping())
+
+	// jobs are not started once the node is stopping
+	_, ok = Acquire(1)
+	assert.False(t, ok)
+	assert.Equal(t, 0, NodeCapacity().Used())
+	assert.True(t, Wait(0))
+}
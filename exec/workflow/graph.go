@@ -0,0 +1,205 @@
+package workflow
+
+import (
+	"errors"
+
+	"github.com/pearsonappeng/tensor/models/common"
+)
+
+// Validate checks that the nodes form a directed acyclic graph.
+// Node ids must be unique and every edge must point to a node of the graph
+func Validate(nodes []common.WorkflowNode) error {
+	if len(nodes) == 0 {
+		return errors.New("Workflow requires at least one node")
+	}
+
+	index := map[string]int{}
+	for i, node := range nodes {
+		if node.ID == "" {
+			return errors.New("Node id is required")
+		}
+		if _, ok := index[node.ID]; ok {
+			return errors.New("Duplicate node id " + node.ID)
+		}
+		switch node.TemplateType {
+		case common.WorkflowNodeJobTemplate,
+			common.WorkflowNodeTerraformJobTemplate,
+			common.WorkflowNodeProject:
+		default:
+			return errors.New("Node " + node.ID + " has an invalid template type " + node.TemplateType)
+		}
+		index[node.ID] = i
+	}
+
+	for _, node := range nodes {
+		for _, child := range children(node) {
+			if _, ok := index[child]; !ok {
+				return errors.New("Node " + node.ID + " has an edge to unknown node " + child)
+			}
+		}
+	}
+
+	// depth first search, a node which is reached again
+	// while it is still on the stack closes a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(nodes))
+	var visit func(i int) error
+	visit = func(i int) error {
+		state[i] = visiting
+		for _, child := range children(nodes[i]) {
+			j := index[child]
+			switch state[j] {
+			case visiting:
+				return errors.New("Workflow contains a cycle at node " + child)
+			case unvisited:
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i := range nodes {
+		if state[i] == unvisited {
+			if err := visit(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// children returns the ids of the nodes the node has an edge to
+func children(node common.WorkflowNode) []string {
+	var ids []string
+	ids = append(ids, node.SuccessNodes...)
+	ids = append(ids, node.FailureNodes...)
+	ids = append(ids, node.AlwaysNodes...)
+	return ids
+}
+
+// isFinished returns true if the node has run and its job finished
+func isFinished(status string) bool {
+	switch status {
+	case common.WorkflowStatusSuccessful,
+		common.WorkflowStatusFailed,
+		common.WorkflowStatusError,
+		common.WorkflowStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// isFailed returns true if the job of the node did not succeed
+func isFailed(status string) bool {
+	return isFinished(status) && status != common.WorkflowStatusSuccessful
+}
+
+// isDecided returns true if the node will not change its outcome anymore
+func isDecided(status string) bool {
+	return isFinished(status) || status == common.WorkflowStatusDoNotRun
+}
+
+// followed returns the ids of the nodes reached by the edges
+// which are followed for the outcome of the node
+func followed(node common.WorkflowJobNode) []string {
+	if !isFinished(node.Status) {
+		return nil
+	}
+
+	var ids []string
+	if node.Status == common.WorkflowStatusSuccessful {
+		ids = append(ids, node.SuccessNodes...)
+	} else {
+		ids = append(ids, node.FailureNodes...)
+	}
+	return append(ids, node.AlwaysNodes...)
+}
+
+// evaluate walks the graph using current statuses of the nodes.
+// It returns the nodes which are ready to be launched and the nodes which will
+// never run since all of their parents are decided and none of them followed an edge to it.
+// Nodes without parents are ready as soon as the workflow starts
+func evaluate(nodes []common.WorkflowJobNode) (ready []int, skip []int) {
+	parents := map[string][]int{}
+	for i, node := range nodes {
+		for _, child := range children(node.WorkflowNode) {
+			parents[child] = append(parents[child], i)
+		}
+	}
+
+	status := make([]string, len(nodes))
+	for i, node := range nodes {
+		status[i] = node.Status
+	}
+
+	// reached reports whether a parent followed an edge to the node
+	// and whether all parents of the node are decided
+	reached := func(i int) (bool, bool) {
+		if len(parents[nodes[i].ID]) == 0 {
+			return true, true
+		}
+		found, decided := false, true
+		for _, p := range parents[nodes[i].ID] {
+			if !isDecided(status[p]) {
+				decided = false
+				continue
+			}
+			parent := nodes[p]
+			parent.Status = status[p]
+			for _, id := range followed(parent) {
+				if id == nodes[i].ID {
+					found = true
+				}
+			}
+		}
+		return found, decided
+	}
+
+	// skipping a node can decide its children,
+	// repeat until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for i := range nodes {
+			if status[i] != common.WorkflowStatusNew {
+				continue
+			}
+			if found, decided := reached(i); !found && decided {
+				status[i] = common.WorkflowStatusDoNotRun
+				skip = append(skip, i)
+				changed = true
+			}
+		}
+	}
+
+	for i := range nodes {
+		if status[i] != common.WorkflowStatusNew {
+			continue
+		}
+		if found, _ := reached(i); found {
+			ready = append(ready, i)
+		}
+	}
+
+	return ready, skip
+}
+
+// outcome returns whether all nodes are decided, and whether the workflow failed.
+// A workflow fails when a failed node has no failure or always edges to handle the failure
+func outcome(nodes []common.WorkflowJobNode) (done bool, failed bool) {
+	for _, node := range nodes {
+		if !isDecided(node.Status) {
+			return false, false
+		}
+		if isFailed(node.Status) && len(node.FailureNodes) == 0 && len(node.AlwaysNodes) == 0 {
+			failed = true
+		}
+	}
+	return true, failed
+}
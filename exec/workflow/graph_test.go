@@ -0,0 +1,116 @@
+package workflow
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func node(id string, success, failure, always []string) common.WorkflowNode {
+	return common.WorkflowNode{
+		ID:           id,
+		TemplateType: common.WorkflowNodeJobTemplate,
+		TemplateID:   bson.NewObjectId(),
+		SuccessNodes: success,
+		FailureNodes: failure,
+		AlwaysNodes:  always,
+	}
+}
+
+// provision runs apply, then configure on success, and cleanup on failure of apply
+func provision() []common.WorkflowNode {
+	return []common.WorkflowNode{
+		node("apply", []string{"configure"}, []string{"cleanup"}, nil),
+		node("configure", nil, nil, []string{"smoke"}),
+		node("cleanup", nil, nil, nil),
+		node("smoke", nil, nil, nil),
+	}
+}
+
+func jobNodes(nodes []common.WorkflowNode, status ...string) []common.WorkflowJobNode {
+	var jobNodes []common.WorkflowJobNode
+	for i, n := range nodes {
+		jobNodes = append(jobNodes, common.WorkflowJobNode{WorkflowNode: n, Status: status[i]})
+	}
+	return jobNodes
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(provision()))
+
+	assert.Error(t, Validate(nil))
+	assert.Error(t, Validate([]common.WorkflowNode{node("", nil, nil, nil)}))
+	assert.Error(t, Validate([]common.WorkflowNode{node("a", nil, nil, nil), node("a", nil, nil, nil)}))
+	assert.Error(t, Validate([]common.WorkflowNode{node("a", []string{"b"}, nil, nil)}), "edge to unknown node")
+
+	invalid := node("a", nil, nil, nil)
+	invalid.TemplateType = "inventory"
+	assert.Error(t, Validate([]common.WorkflowNode{invalid}))
+
+	assert.Error(t, Validate([]common.WorkflowNode{node("a", []string{"a"}, nil, nil)}), "self loop")
+	assert.Error(t, Validate([]common.WorkflowNode{
+		node("a", []string{"b"}, nil, nil),
+		node("b", nil, []string{"c"}, nil),
+		node("c", nil, nil, []string{"a"}),
+	}), "cycle")
+}
+
+func TestEvaluateStart(t *testing.T) {
+	nodes := jobNodes(provision(), "new", "new", "new", "new")
+	ready, skip := evaluate(nodes)
+	assert.Equal(t, []int{0}, ready)
+	assert.Empty(t, skip)
+
+	done, _ := outcome(nodes)
+	assert.False(t, done)
+}
+
+func TestEvaluateSuccess(t *testing.T) {
+	nodes := jobNodes(provision(), "successful", "new", "new", "new")
+	ready, skip := evaluate(nodes)
+	assert.Equal(t, []int{1}, ready)
+	assert.Equal(t, []int{2}, skip)
+
+	// always edges are followed on failure
+	nodes = jobNodes(provision(), "successful", "failed", "do_not_run", "new")
+	ready, skip = evaluate(nodes)
+	assert.Equal(t, []int{3}, ready)
+	assert.Empty(t, skip)
+
+	nodes = jobNodes(provision(), "successful", "failed", "do_not_run", "successful")
+	done, failed := outcome(nodes)
+	assert.True(t, done)
+	assert.False(t, failed, "failure of configure is handled by its always edge")
+}
+
+func TestEvaluateFailure(t *testing.T) {
+	// skipping configure decides smoke as well
+	nodes := jobNodes(provision(), "failed", "new", "new", "new")
+	ready, skip := evaluate(nodes)
+	assert.Equal(t, []int{2}, ready)
+	assert.Equal(t, []int{1, 3}, skip)
+
+	nodes = jobNodes(provision(), "failed", "do_not_run", "failed", "do_not_run")
+	done, failed := outcome(nodes)
+	assert.True(t, done)
+	assert.True(t, failed)
+}
+
+func TestEvaluateWaitsForParents(t *testing.T) {
+	nodes := jobNodes([]common.WorkflowNode{
+		node("a", nil, []string{"c"}, nil),
+		node("b", nil, []string{"c"}, nil),
+		node("c", nil, nil, nil),
+	}, "successful", "running", "new")
+
+	ready, skip := evaluate(nodes)
+	assert.Empty(t, ready)
+	assert.Empty(t, skip, "c must wait until b is finished")
+
+	nodes[1].Status = "error"
+	ready, skip = evaluate(nodes)
+	assert.Equal(t, []int{2}, ready)
+	assert.Empty(t, skip)
+}
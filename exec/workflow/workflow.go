@@ -0,0 +1,400 @@
+// Package workflow runs workflow jobs. Nodes of a workflow launch job templates,
+// terraform job templates and project updates, and the outcome of a node decides
+// which nodes run next.
+package workflow
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/launch"
+	"github.com/pearsonappeng/tensor/exec/sync"
+	"github.com/pearsonappeng/tensor/models/ansible"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/models/terraform"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// pollInterval is the interval between two passes over the active workflow jobs
+const pollInterval = 5 * time.Second
+
+// claimTimeout is the time given to a tensord node to launch a claimed node,
+// the node is an error when its job is not stored within that time
+const claimTimeout = 5 * time.Minute
+
+// NewJob creates a new workflow job from the workflow job template
+func NewJob(template common.WorkflowJobTemplate, user common.User, launchType string) common.WorkflowJob {
+	job := common.WorkflowJob{
+		ID:                    bson.NewObjectId(),
+		Name:                  template.Name,
+		Description:           template.Description,
+		LaunchType:            launchType,
+		Status:                common.WorkflowStatusNew,
+		ExtraVars:             template.ExtraVars,
+		WorkflowJobTemplateID: template.ID,
+		OrganizationID:        template.OrganizationID,
+		CreatedByID:           user.ID,
+		ModifiedByID:          user.ID,
+		Created:               time.Now(),
+		Modified:              time.Now(),
+	}
+
+	for _, node := range template.Nodes {
+		job.Nodes = append(job.Nodes, common.WorkflowJobNode{
+			WorkflowNode: node,
+			Status:       common.WorkflowStatusNew,
+		})
+	}
+
+	return job
+}
+
+// Launch stores the workflow job as pending.
+// The nodes of the workflow are launched by the workflow manager
+func Launch(job *common.WorkflowJob) error {
+	job.Status = common.WorkflowStatusPending
+	if err := db.WorkflowJobs().Insert(*job); err != nil {
+		return &launch.Error{Message: "Error while creating workflow job", Err: err}
+	}
+
+	update := bson.M{"$set": bson.M{
+		"last_job_id":  job.ID,
+		"last_job_run": job.Created,
+		"status":       job.Status,
+	}}
+	if err := db.WorkflowJobTemplates().UpdateId(job.WorkflowJobTemplateID, update); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job Template ID": job.WorkflowJobTemplateID.Hex(),
+			"Error":                    err.Error(),
+		}).Errorln("Could not update workflow job template")
+	}
+
+	return nil
+}
+
+// Run starts the workflow manager loop.
+// Every tensord node runs the loop, a workflow node is launched only by the
+// tensord node that claims it first
+func Run() {
+	logrus.Infoln("Workflow manager started")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var jobs []common.WorkflowJob
+		q := bson.M{"status": bson.M{"$in": []string{common.WorkflowStatusPending, common.WorkflowStatusRunning}}}
+		if err := db.WorkflowJobs().Find(q).All(&jobs); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err.Error(),
+			}).Errorln("Could not get active workflow jobs")
+			continue
+		}
+
+		for _, job := range jobs {
+			advance(job)
+		}
+	}
+}
+
+// advance refreshes the statuses of the nodes of the workflow job,
+// launches the nodes which became ready and finishes the workflow job once all nodes are decided
+func advance(job common.WorkflowJob) {
+	for i := range job.Nodes {
+		refresh(&job, i)
+	}
+
+	if job.CancelFlag {
+		cancelNodes(&job)
+	}
+
+	ready, skip := evaluate(job.Nodes)
+	for _, i := range skip {
+		setNode(job, i, bson.M{"nodes.$.status": common.WorkflowStatusDoNotRun})
+		job.Nodes[i].Status = common.WorkflowStatusDoNotRun
+	}
+
+	if job.Status == common.WorkflowStatusPending {
+		start(&job)
+	}
+
+	for _, i := range ready {
+		if !claim(job, i) {
+			continue
+		}
+		job.Nodes[i].Status = common.WorkflowStatusPending
+		launchNode(job, i)
+	}
+
+	if done, failed := outcome(job.Nodes); done {
+		finish(job, failed)
+	}
+}
+
+// refresh copies the status of the job launched for the node into the node
+func refresh(job *common.WorkflowJob, i int) {
+	node := &job.Nodes[i]
+	if staleClaim(*node, time.Now()) {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job ID": job.ID.Hex(),
+			"Node":            node.ID,
+		}).Warningln("Workflow node was claimed but not launched")
+		node.Status = common.WorkflowStatusError
+		setNode(*job, i, bson.M{"nodes.$.status": node.Status})
+		return
+	}
+	if node.JobID == nil || isDecided(node.Status) {
+		return
+	}
+
+	c := db.Jobs()
+	if node.JobType == common.WorkflowJobTypeTerraformJob {
+		c = db.TerrafromJobs()
+	}
+
+	var child struct {
+		Status string `bson:"status"`
+	}
+	if err := c.FindId(*node.JobID).Select(bson.M{"status": 1}).One(&child); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job ID": job.ID.Hex(),
+			"Job ID":          node.JobID.Hex(),
+			"Error":           err.Error(),
+		}).Errorln("Could not get status of workflow node job")
+		if err == mgo.ErrNotFound {
+			child.Status = common.WorkflowStatusError
+		} else {
+			return
+		}
+	}
+
+	switch child.Status {
+	case "new", "pending", "waiting":
+		child.Status = common.WorkflowStatusPending
+	}
+
+	if child.Status != node.Status {
+		node.Status = child.Status
+		setNode(*job, i, bson.M{"nodes.$.status": node.Status})
+	}
+}
+
+// cancelNodes cancels the jobs of the running nodes
+// and stops the nodes which were not launched yet
+func cancelNodes(job *common.WorkflowJob) {
+	for i := range job.Nodes {
+		node := &job.Nodes[i]
+		switch {
+		case node.Status == common.WorkflowStatusNew:
+			node.Status = common.WorkflowStatusDoNotRun
+			setNode(*job, i, bson.M{"nodes.$.status": node.Status})
+		case node.JobID != nil && !isDecided(node.Status):
+			c := db.Jobs()
+			if node.JobType == common.WorkflowJobTypeTerraformJob {
+				c = db.TerrafromJobs()
+			}
+			if err := c.UpdateId(*node.JobID, bson.M{"$set": bson.M{"cancel_flag": true}}); err != nil {
+				logrus.WithFields(logrus.Fields{
+					"Workflow Job ID": job.ID.Hex(),
+					"Job ID":          node.JobID.Hex(),
+					"Error":           err.Error(),
+				}).Errorln("Could not cancel workflow node job")
+			}
+		}
+	}
+}
+
+// claim marks the node as pending.
+// The update only matches while the node is new, therefore only one tensord node can launch it
+func claim(job common.WorkflowJob, i int) bool {
+	q := bson.M{
+		"_id":   job.ID,
+		"nodes": bson.M{"$elemMatch": bson.M{"id": job.Nodes[i].ID, "status": common.WorkflowStatusNew}},
+	}
+	set := bson.M{"nodes.$.status": common.WorkflowStatusPending, "nodes.$.claimed": time.Now()}
+	if err := db.WorkflowJobs().Update(q, bson.M{"$set": set}); err != nil {
+		if err != mgo.ErrNotFound {
+			logrus.WithFields(logrus.Fields{
+				"Workflow Job ID": job.ID.Hex(),
+				"Node":            job.Nodes[i].ID,
+				"Error":           err.Error(),
+			}).Errorln("Could not claim workflow node")
+		}
+		return false
+	}
+	return true
+}
+
+// staleClaim returns whether the node was claimed and its job was not stored
+// within claimTimeout, the tensord node launching it has stopped in between
+func staleClaim(node common.WorkflowJobNode, now time.Time) bool {
+	if node.Status != common.WorkflowStatusPending || node.JobID != nil {
+		return false
+	}
+	// nodes claimed before the claim time was stored
+	if node.Claimed == nil {
+		return true
+	}
+	return now.Sub(*node.Claimed) > claimTimeout
+}
+
+// launchNode launches the template of the node and stores the launched job in the node
+func launchNode(job common.WorkflowJob, i int) {
+	node := job.Nodes[i]
+	logrus.WithFields(logrus.Fields{
+		"Workflow Job ID": job.ID.Hex(),
+		"Node":            node.ID,
+		"Template ID":     node.TemplateID.Hex(),
+	}).Infoln("Launching workflow node")
+
+	jobID, jobType, err := launchTemplate(job, node.WorkflowNode)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job ID": job.ID.Hex(),
+			"Node":            node.ID,
+			"Error":           err.Error(),
+		}).Errorln("Could not launch workflow node")
+		setNode(job, i, bson.M{"nodes.$.status": common.WorkflowStatusError})
+		return
+	}
+
+	setNode(job, i, bson.M{"nodes.$.job_id": jobID, "nodes.$.job_type": jobType})
+}
+
+func launchTemplate(job common.WorkflowJob, node common.WorkflowNode) (bson.ObjectId, string, error) {
+	// nodes run as the user who launched the workflow
+	var user common.User
+	if err := db.Users().FindId(job.CreatedByID).One(&user); err != nil {
+		return "", "", errors.New("Could not find workflow owner: " + err.Error())
+	}
+
+	switch node.TemplateType {
+	case common.WorkflowNodeJobTemplate:
+		var template ansible.JobTemplate
+		if err := db.JobTemplates().FindId(node.TemplateID).One(&template); err != nil {
+			return "", "", errors.New("Could not find job template: " + err.Error())
+		}
+		child := launch.NewAnsibleJob(template, user, ansible.JOB_LAUNCH_TYPE_WORKFLOW)
+		child.ExtraVars = launch.MergeVars(child.ExtraVars, job.ExtraVars)
+		if err := launch.AnsibleSurvey(&child, template, job.ExtraVars); err != nil {
+			return "", "", err
+		}
+		if err := launch.Ansible(&child, user); err != nil {
+			return "", "", err
+		}
+		return child.ID, common.WorkflowJobTypeJob, nil
+	case common.WorkflowNodeTerraformJobTemplate:
+		var template terraform.JobTemplate
+		if err := db.TerrafromJobTemplates().FindId(node.TemplateID).One(&template); err != nil {
+			return "", "", errors.New("Could not find terraform job template: " + err.Error())
+		}
+		child := launch.NewTerraformJob(template, user, terraform.JobLaunchTypeWorkflow)
+		child.Vars = launch.MergeVars(child.Vars, job.ExtraVars)
+		if err := launch.TerraformSurvey(&child, template, job.ExtraVars); err != nil {
+			return "", "", err
+		}
+		if err := launch.Terraform(&child, user); err != nil {
+			return "", "", err
+		}
+		return child.ID, common.WorkflowJobTypeTerraformJob, nil
+	case common.WorkflowNodeProject:
+		var project common.Project
+		if err := db.Projects().FindId(node.TemplateID).One(&project); err != nil {
+			return "", "", errors.New("Could not find project: " + err.Error())
+		}
+		tj, err := sync.UpdateProject(project)
+		if err != nil {
+			return "", "", err
+		}
+		if err := db.Jobs().UpdateId(tj.Job.ID, bson.M{"$set": bson.M{"launch_type": ansible.JOB_LAUNCH_TYPE_WORKFLOW}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Job ID": tj.Job.ID.Hex(),
+				"Error":  err.Error(),
+			}).Warningln("Could not update launch type of project update")
+		}
+		return tj.Job.ID, common.WorkflowJobTypeJob, nil
+	}
+
+	return "", "", errors.New("Unknown template type " + node.TemplateType)
+}
+
+// setNode updates fields of the node of the workflow job
+func setNode(job common.WorkflowJob, i int, set bson.M) {
+	q := bson.M{"_id": job.ID, "nodes.id": job.Nodes[i].ID}
+	if err := db.WorkflowJobs().Update(q, bson.M{"$set": set}); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job ID": job.ID.Hex(),
+			"Node":            job.Nodes[i].ID,
+			"Error":           err.Error(),
+		}).Errorln("Could not update workflow node")
+	}
+}
+
+// start marks the workflow job as running
+func start(job *common.WorkflowJob) {
+	job.Status = common.WorkflowStatusRunning
+	job.Started = time.Now()
+	q := bson.M{"_id": job.ID, "status": common.WorkflowStatusPending}
+	if err := db.WorkflowJobs().Update(q, bson.M{"$set": bson.M{"status": job.Status, "started": job.Started}}); err != nil && err != mgo.ErrNotFound {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job ID": job.ID.Hex(),
+			"Error":           err.Error(),
+		}).Errorln("Could not start workflow job")
+	}
+	updateTemplate(*job)
+}
+
+// finish stores the final status of the workflow job
+func finish(job common.WorkflowJob, failed bool) {
+	job.Failed = failed
+	job.Finished = time.Now()
+	switch {
+	case job.CancelFlag:
+		job.Status = common.WorkflowStatusCanceled
+		job.JobExplanation = "Workflow Job Cancelled"
+	case failed:
+		job.Status = common.WorkflowStatusFailed
+	default:
+		job.Status = common.WorkflowStatusSuccessful
+	}
+
+	q := bson.M{"_id": job.ID, "status": bson.M{"$in": []string{common.WorkflowStatusPending, common.WorkflowStatusRunning}}}
+	update := bson.M{"$set": bson.M{
+		"status":          job.Status,
+		"failed":          job.Failed,
+		"finished":        job.Finished,
+		"job_explanation": job.JobExplanation,
+	}}
+	if err := db.WorkflowJobs().Update(q, update); err != nil {
+		if err != mgo.ErrNotFound {
+			logrus.WithFields(logrus.Fields{
+				"Workflow Job ID": job.ID.Hex(),
+				"Error":           err.Error(),
+			}).Errorln("Could not finish workflow job")
+		}
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Workflow Job ID": job.ID.Hex(),
+		"Status":          job.Status,
+	}).Infoln("Workflow job finished")
+
+	updateTemplate(job)
+}
+
+// updateTemplate stores the status of the workflow job in the workflow job template
+// if the workflow job is its last job
+func updateTemplate(job common.WorkflowJob) {
+	q := bson.M{"_id": job.WorkflowJobTemplateID, "last_job_id": job.ID}
+	update := bson.M{"$set": bson.M{"status": job.Status, "last_job_failed": job.Failed}}
+	if err := db.WorkflowJobTemplates().Update(q, update); err != nil && err != mgo.ErrNotFound {
+		logrus.WithFields(logrus.Fields{
+			"Workflow Job Template ID": job.WorkflowJobTemplateID.Hex(),
+			"Error":                    err.Error(),
+		}).Errorln("Could not update workflow job template")
+	}
+}
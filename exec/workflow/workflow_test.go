@@ -0,0 +1,32 @@
+package workflow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestStaleClaim(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Minute)
+	old := now.Add(-claimTimeout - time.Second)
+	jobID := bson.NewObjectId()
+
+	cases := []struct {
+		name  string
+		node  common.WorkflowJobNode
+		stale bool
+	}{
+		{"new", common.WorkflowJobNode{Status: common.WorkflowStatusNew}, false},
+		{"recent claim", common.WorkflowJobNode{Status: common.WorkflowStatusPending, Claimed: &recent}, false},
+		{"old claim", common.WorkflowJobNode{Status: common.WorkflowStatusPending, Claimed: &old}, true},
+		{"claim without time", common.WorkflowJobNode{Status: common.WorkflowStatusPending}, true},
+		{"launched", common.WorkflowJobNode{Status: common.WorkflowStatusPending, Claimed: &old, JobID: &jobID}, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.stale, staleClaim(c.node, now), c.name)
+	}
+}
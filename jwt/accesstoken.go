@@ -0,0 +1,128 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// AccessTokenPrefix starts the personal access tokens, it tells them apart from the JWTs
+const AccessTokenPrefix = "tensor_"
+
+// launchPath matches the endpoints which launch jobs
+var launchPath = regexp.MustCompile(`^/v1/(` +
+	`(job_templates|terraform_job_templates|workflow_job_templates)/[0-9a-f]{24}/launch|` +
+	`(projects|inventory_sources)/[0-9a-f]{24}/update|` +
+	`terraform_jobs/[0-9a-f]{24}/apply|` +
+	`inventories/[0-9a-f]{24}/ad_hoc_commands|` +
+	`ad_hoc_commands)$`)
+
+// NewAccessToken returns a new personal access token and the hash stored in the database
+func NewAccessToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashAccessToken(token), nil
+}
+
+// HashAccessToken returns the hash of the personal access token, tokens are random
+// so a fast hash is enough and tokens can be looked up by their hash
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AccessTokenMiddleware authenticates the requests made with a personal access token,
+// other requests are passed to next which authenticates users with their JWT.
+// The scope of the token is checked against the request and set to the user
+// so the rbac checks are limited by the scope as well
+func AccessTokenMiddleware(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := accessToken(c.Request)
+		if !ok {
+			next(c)
+			return
+		}
+
+		var token common.AccessToken
+		if err := db.AccessTokens().Find(bson.M{"hash": HashAccessToken(raw)}).One(&token); err != nil {
+			unauthorized(c, http.StatusUnauthorized, "Invalid or revoked access token")
+			return
+		}
+		if token.Expired() {
+			unauthorized(c, http.StatusUnauthorized, "Access token has expired")
+			return
+		}
+		if !tokenRequestAllowed(token.Scope, c.Request.Method, c.Request.URL.Path) {
+			unauthorized(c, http.StatusForbidden, "The scope of the access token does not allow this request")
+			return
+		}
+
+		var user common.User
+		if err := db.Users().FindId(token.UserID).One(&user); err != nil {
+			unauthorized(c, http.StatusUnauthorized, "User of the access token does not exist")
+			return
+		}
+
+		if err := db.AccessTokens().UpdateId(token.ID, bson.M{"$set": bson.M{
+			"last_used":    time.Now(),
+			"last_used_ip": c.ClientIP(),
+		}}); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Token ID": token.ID.Hex(),
+				"Error":    err.Error(),
+			}).Errorln("Failed to update last use of access token")
+		}
+
+		user.TokenScope = token.Scope
+		// set user to gin context
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// tokenRequestAllowed returns whether a personal access token of the scope is allowed
+// for the request. Tokens and sessions are managed with a login, a token cannot manage them
+func tokenRequestAllowed(scope string, method string, path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, p := range []string{"/v1/me/tokens", "/v1/me/sessions", "/v1/logout"} {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return false
+		}
+	}
+
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return true
+	}
+
+	switch scope {
+	case common.TokenScopeWrite:
+		return true
+	case common.TokenScopeLaunch:
+		return method == "POST" && launchPath.MatchString(path)
+	}
+	return false
+}
+
+// accessToken returns the personal access token of the request
+func accessToken(r *http.Request) (string, bool) {
+	auth := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != "Bearer" || !strings.HasPrefix(auth[1], AccessTokenPrefix) {
+		return "", false
+	}
+	return auth[1], true
+}
@@ -29,6 +29,13 @@ func init() {
 			// Lowercase email or username
 			login := strings.ToLower(loginid)
 
+			// LDAP users are authenticated first, local users are the fallback
+			if util.Config.LDAP.Enabled {
+				if user, ok := ldapAuthenticate(login, password); ok {
+					return user.ID.Hex(), true
+				}
+			}
+
 			var q bson.M
 
 			if _, err := mail.ParseAddress(login); err == nil {
@@ -60,10 +67,18 @@ func init() {
 				return false
 			}
 
+			// tokens of logged out and revoked sessions are refused
+			if err := checkSession(c, jwt.ExtractClaims(c)); err != nil {
+				logrus.Warningln("Auth:", err.Error(), userID)
+				return false
+			}
+
 			// set user to gin context
 			c.Set("user", user)
 			return true
 		},
+		// every login is a session, its tokens are revoked with the session
+		PayloadFunc: sessionPayload,
 		Unauthorized: func(c *gin.Context, code int, message string) {
 			c.JSON(code, gin.H{
 				"code":    code,
@@ -0,0 +1,179 @@
+package jwt
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Kinds of the jobs which are given a job token
+const (
+	JobKindJob          = "job"
+	JobKindAdHocCommand = "ad_hoc_command"
+)
+
+// jobScope is the scope claim of job tokens, user tokens do not have a scope
+const jobScope = "job"
+
+// cJobToken is the key of the job ID of the job token in the gin context
+const cJobToken = "job_token_id"
+
+// NewJobToken returns a token bound to the job. The token is accepted by JobTokenMiddleware
+// for the inventory script and the event callbacks of the job while the job is running,
+// it expires after the timeout
+func NewJobToken(kind string, jobID bson.ObjectId, timeout time.Duration) (string, error) {
+	// Initial middleware default setting.
+	HeaderAuthMiddleware.MiddlewareInit()
+
+	token := jwt.New(jwt.GetSigningMethod(HeaderAuthMiddleware.SigningAlgorithm))
+	claims := token.Claims.(jwt.MapClaims)
+	claims["scope"] = jobScope
+	claims["kind"] = kind
+	claims["job_id"] = jobID.Hex()
+	claims["exp"] = time.Now().Add(timeout).Unix()
+	claims["iat"] = time.Now().Unix()
+
+	return token.SignedString(HeaderAuthMiddleware.Key)
+}
+
+// JobTokenMiddleware authenticates the requests made by running jobs with a job token,
+// other requests are passed to next which authenticates users. The user who launched
+// the job is set to the context with its own flags and the job ID is set as the job scope,
+// handlers check the scope with JobTokenID instead of the permissions of the user
+func JobTokenMiddleware(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, valid, ok := jobTokenClaims(c.Request)
+		if !ok {
+			next(c)
+			return
+		}
+		if !valid {
+			unauthorized(c, http.StatusUnauthorized, "Invalid or expired job token")
+			return
+		}
+
+		kind, _ := claims["kind"].(string)
+		id, _ := claims["job_id"].(string)
+		job, err := runningJob(kind, id)
+		if err != nil {
+			unauthorized(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+
+		if !jobRequestAllowed(c.Request.Method, c.Request.URL.Path, kind, job.ID, job.InventoryID) {
+			unauthorized(c, http.StatusForbidden, "The job token is not allowed for this request")
+			return
+		}
+
+		var user common.User
+		if err := db.Users().FindId(job.CreatedByID).One(&user); err != nil {
+			user = common.User{ID: job.CreatedByID}
+		}
+
+		// set user and job scope to gin context
+		c.Set("user", user)
+		c.Set(cJobToken, job.ID)
+		c.Next()
+	}
+}
+
+// JobTokenID returns the ID of the job whose job token authenticated the request,
+// ok is false if the request was authenticated as a user
+func JobTokenID(c *gin.Context) (bson.ObjectId, bool) {
+	id, ok := c.Get(cJobToken)
+	if !ok {
+		return "", false
+	}
+	return id.(bson.ObjectId), true
+}
+
+// jobRequestAllowed returns whether a job token of the kind is allowed for the request,
+// jobs only fetch their inventory and send their events
+func jobRequestAllowed(method string, path string, kind string, jobID bson.ObjectId, inventoryID bson.ObjectId) bool {
+	path = strings.TrimSuffix(path, "/")
+
+	if method == "GET" && inventoryID.Valid() && path == "/v1/inventories/"+inventoryID.Hex()+"/script" {
+		return true
+	}
+
+	switch kind {
+	case JobKindJob:
+		return method == "POST" && path == "/v1/jobs/"+jobID.Hex()+"/job_events"
+	case JobKindAdHocCommand:
+		return method == "POST" && path == "/v1/ad_hoc_commands/"+jobID.Hex()+"/events"
+	}
+	return false
+}
+
+// jobTokenClaims returns the claims of the job token of the request, ok is false if the
+// request is not made with a job token and valid is false if the token has expired
+func jobTokenClaims(r *http.Request) (claims jwt.MapClaims, valid bool, ok bool) {
+	auth := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(auth) != 2 || auth[0] != "Bearer" {
+		return nil, false, false
+	}
+
+	token, err := jwt.Parse(auth[1], func(t *jwt.Token) (interface{}, error) {
+		if jwt.GetSigningMethod(HeaderAuthMiddleware.SigningAlgorithm) != t.Method {
+			return nil, errors.New("invalid signing algorithm")
+		}
+		return HeaderAuthMiddleware.Key, nil
+	})
+	if token == nil {
+		return nil, false, false
+	}
+
+	claims, _ = token.Claims.(jwt.MapClaims)
+	if scope, _ := claims["scope"].(string); scope != jobScope {
+		return nil, false, false
+	}
+	return claims, err == nil && token.Valid, true
+}
+
+// tokenJob is the job of a job token
+type tokenJob struct {
+	ID          bson.ObjectId `bson:"_id"`
+	Status      string        `bson:"status"`
+	InventoryID bson.ObjectId `bson:"inventory_id,omitempty"`
+	CreatedByID bson.ObjectId `bson:"created_by_id"`
+}
+
+// runningJob returns the job of the token, the token expires when the job finishes
+func runningJob(kind string, id string) (tokenJob, error) {
+	var job tokenJob
+
+	var c *mgo.Collection
+	switch kind {
+	case JobKindJob:
+		c = db.Jobs()
+	case JobKindAdHocCommand:
+		c = db.AdHocCommands()
+	default:
+		return job, errors.New("Invalid job token")
+	}
+
+	if !bson.IsObjectIdHex(id) {
+		return job, errors.New("Invalid job token")
+	}
+	if err := c.FindId(bson.ObjectIdHex(id)).One(&job); err != nil {
+		return job, errors.New("Job of the token does not exist")
+	}
+	if job.Status != "running" {
+		return job, errors.New("Job of the token is not running")
+	}
+	return job, nil
+}
+
+// unauthorized aborts the request with the response of HeaderAuthMiddleware
+func unauthorized(c *gin.Context, code int, message string) {
+	c.Abort()
+	HeaderAuthMiddleware.Unauthorized(c, code, message)
+}
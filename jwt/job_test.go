@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func request(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/v1/inventories", nil)
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func TestJobTokenClaims(t *testing.T) {
+	HeaderAuthMiddleware.SigningAlgorithm = "HS256"
+	id := bson.NewObjectId()
+
+	token, err := NewJobToken(JobKindJob, id, time.Minute)
+	assert.NoError(t, err)
+	claims, valid, ok := jobTokenClaims(request(token))
+	assert.True(t, ok)
+	assert.True(t, valid)
+	assert.Equal(t, JobKindJob, claims["kind"])
+	assert.Equal(t, id.Hex(), claims["job_id"])
+
+	// expired job tokens are rejected by the job token middleware
+	token, err = NewJobToken(JobKindAdHocCommand, id, -time.Minute)
+	assert.NoError(t, err)
+	_, valid, ok = jobTokenClaims(request(token))
+	assert.True(t, ok)
+	assert.False(t, valid)
+
+	// user tokens are passed to the user middleware
+	user := jwt.New(jwt.SigningMethodHS256)
+	user.Claims.(jwt.MapClaims)["id"] = id.Hex()
+	token, err = user.SignedString(HeaderAuthMiddleware.Key)
+	assert.NoError(t, err)
+	_, _, ok = jobTokenClaims(request(token))
+	assert.False(t, ok)
+
+	_, _, ok = jobTokenClaims(request(""))
+	assert.False(t, ok)
+	_, _, ok = jobTokenClaims(request("invalid"))
+	assert.False(t, ok)
+}
+
+func TestJobRequestAllowed(t *testing.T) {
+	job := bson.NewObjectId()
+	inventory := bson.NewObjectId()
+	other := bson.NewObjectId()
+
+	assert.True(t, jobRequestAllowed("GET", "/v1/inventories/"+inventory.Hex()+"/script", JobKindJob, job, inventory))
+	assert.True(t, jobRequestAllowed("GET", "/v1/inventories/"+inventory.Hex()+"/script/", JobKindAdHocCommand, job, inventory))
+	assert.True(t, jobRequestAllowed("POST", "/v1/jobs/"+job.Hex()+"/job_events", JobKindJob, job, inventory))
+	assert.True(t, jobRequestAllowed("POST", "/v1/ad_hoc_commands/"+job.Hex()+"/events", JobKindAdHocCommand, job, inventory))
+
+	// only the inventory and the events of the job
+	assert.False(t, jobRequestAllowed("GET", "/v1/inventories/"+other.Hex()+"/script", JobKindJob, job, inventory))
+	assert.False(t, jobRequestAllowed("GET", "/v1/inventories/"+inventory.Hex(), JobKindJob, job, inventory))
+	assert.False(t, jobRequestAllowed("POST", "/v1/jobs/"+other.Hex()+"/job_events", JobKindJob, job, inventory))
+	assert.False(t, jobRequestAllowed("GET", "/v1/jobs/"+job.Hex()+"/job_events", JobKindJob, job, inventory))
+	assert.False(t, jobRequestAllowed("POST", "/v1/ad_hoc_commands/"+job.Hex()+"/events", JobKindJob, job, inventory))
+	assert.False(t, jobRequestAllowed("POST", "/v1/jobs/"+job.Hex()+"/job_events", JobKindAdHocCommand, job, inventory))
+	assert.False(t, jobRequestAllowed("GET", "/v1/users", JobKindJob, job, inventory))
+	assert.False(t, jobRequestAllowed("GET", "/v1/inventories//script", JobKindAdHocCommand, job, ""))
+}
+
+func TestJobTokenID(t *testing.T) {
+	c := &gin.Context{}
+	_, ok := JobTokenID(c)
+	assert.False(t, ok, "user requests have no job scope")
+
+	id := bson.NewObjectId()
+	c.Set(cJobToken, id)
+	scope, ok := JobTokenID(c)
+	assert.True(t, ok)
+	assert.Equal(t, id, scope)
+}
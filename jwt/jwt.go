@@ -1,15 +1,11 @@
 package jwt
 
 import (
-	"github.com/pearsonappeng/tensor/db"
-	"github.com/pearsonappeng/tensor/models/common"
-
 	"errors"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"gopkg.in/dgrijalva/jwt-go.v3"
-	"gopkg.in/mgo.v2/bson"
 )
 
 type LocalToken struct {
@@ -17,34 +13,37 @@ type LocalToken struct {
 	Expire string
 }
 
-func NewAuthToken(t *LocalToken) error {
+// NewUserToken returns a token of the user like the tokens returned by the LoginHandler,
+// it is used by the logins which do not go through the Authenticator
+func NewUserToken(userID string) (LocalToken, error) {
 	// Initial middleware default setting.
 	HeaderAuthMiddleware.MiddlewareInit()
 
+	session, err := newSession(userID)
+	if err != nil {
+		logrus.Errorln("Create session faild", err)
+		return LocalToken{}, errors.New("Create JWT Token faild")
+	}
+
 	// Create the token
 	token := jwt.New(jwt.GetSigningMethod(HeaderAuthMiddleware.SigningAlgorithm))
 	claims := token.Claims.(jwt.MapClaims)
 
-	var admin common.User
-
-	if err := db.Users().Find(bson.M{"username": "admin"}).One(&admin); err != nil {
-		logrus.Errorln("User not found, Create JWT Token faild")
-		return errors.New("User not found, Create JWT Token faild")
-	}
-
 	expire := time.Now().Add(HeaderAuthMiddleware.Timeout)
-	claims["id"] = admin.ID
+	claims["id"] = userID
 	claims["exp"] = expire.Unix()
 	claims["orig_iat"] = time.Now().Unix()
+	claims[sessionClaim] = session.Hex()
 
 	tokenString, err := token.SignedString(HeaderAuthMiddleware.Key)
 
 	if err != nil {
 		logrus.Errorln("Create JWT Token faild")
-		return errors.New("Create JWT Token faild")
+		return LocalToken{}, errors.New("Create JWT Token faild")
 	}
 
-	t.Token = tokenString
-	t.Expire = expire.Format(time.RFC3339)
-	return nil
+	return LocalToken{
+		Token:  tokenString,
+		Expire: expire.Format(time.RFC3339),
+	}, nil
 }
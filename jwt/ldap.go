@@ -0,0 +1,173 @@
+package jwt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/ldap.v3"
+)
+
+// ldapField is the field of the users holding their LDAP DN
+const ldapField = "ldap_dn"
+
+// ldapAuthenticate authenticates the login against the LDAP directory,
+// the user is created on its first login and its roles are updated from its groups
+func ldapAuthenticate(login string, password string) (common.User, bool) {
+	u, err := ldapLogin(util.Config.LDAP, login, password)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Login": login,
+			"Error": err.Error(),
+		}).Warningln("Auth: LDAP authentication failed")
+		return common.User{}, false
+	}
+
+	cfg := util.Config.LDAP
+	user, err := provisionUser(ldapField, u, groupRules{
+		SuperUserGroups: cfg.SuperUserGroups,
+		AuditorGroups:   cfg.AuditorGroups,
+		Organizations:   cfg.Organizations,
+		Teams:           cfg.Teams,
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Login": login,
+			"DN":    u.ID,
+			"Error": err.Error(),
+		}).Errorln("Auth: Failed to update LDAP user")
+		return common.User{}, false
+	}
+	return user, true
+}
+
+// ldapDial connects to the LDAP server, with StartTLS if it is enabled
+func ldapDial(cfg util.LDAPConfig) (*ldap.Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if len(cfg.CACertificate) > 0 {
+		pem, err := ioutil.ReadFile(cfg.CACertificate)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("Invalid LDAP CA certificate " + cfg.CACertificate)
+		}
+	}
+
+	var conn *ldap.Conn
+	switch u.Scheme {
+	case "ldaps":
+		conn, err = ldap.DialTLS("tcp", ldapHost(u, "636"), config)
+	case "ldap":
+		conn, err = ldap.Dial("tcp", ldapHost(u, "389"))
+	default:
+		return nil, errors.New("Unsupported LDAP URL scheme " + u.Scheme)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(10 * time.Second)
+
+	if cfg.StartTLS && u.Scheme == "ldap" {
+		if err := conn.StartTLS(config); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func ldapHost(u *url.URL, port string) string {
+	if len(u.Port()) > 0 {
+		return u.Host
+	}
+	return u.Hostname() + ":" + port
+}
+
+// ldapLogin finds the user with the service account, binds as the user
+// to check the password and returns the user with the DNs of its groups
+func ldapLogin(cfg util.LDAPConfig, login string, password string) (externalUser, error) {
+	var u externalUser
+	// an empty password is an unauthenticated bind which always succeeds
+	if len(password) == 0 {
+		return u, errors.New("Empty password")
+	}
+
+	conn, err := ldapDial(cfg)
+	if err != nil {
+		return u, err
+	}
+	defer conn.Close()
+
+	if err := ldapBind(conn, cfg); err != nil {
+		return u, err
+	}
+
+	attributes := []string{cfg.UsernameAttribute, cfg.EmailAttribute, cfg.FirstNameAttribute, cfg.LastNameAttribute}
+	res, err := conn.Search(ldap.NewSearchRequest(cfg.UserSearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, fmt.Sprintf(cfg.UserFilter, ldap.EscapeFilter(login)), attributes, nil))
+	if err != nil {
+		return u, err
+	}
+	if len(res.Entries) != 1 {
+		return u, fmt.Errorf("Found %d users", len(res.Entries))
+	}
+
+	entry := res.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return u, err
+	}
+
+	u = externalUser{
+		ID:        entry.DN,
+		Username:  strings.ToLower(entry.GetAttributeValue(cfg.UsernameAttribute)),
+		Email:     strings.ToLower(entry.GetAttributeValue(cfg.EmailAttribute)),
+		FirstName: entry.GetAttributeValue(cfg.FirstNameAttribute),
+		LastName:  entry.GetAttributeValue(cfg.LastNameAttribute),
+	}
+	if len(u.Username) == 0 {
+		return u, errors.New("User has no " + cfg.UsernameAttribute + " attribute")
+	}
+
+	if len(cfg.GroupSearchBase) == 0 {
+		return u, nil
+	}
+
+	// groups are searched with the service account
+	if err := ldapBind(conn, cfg); err != nil {
+		return u, err
+	}
+	res, err = conn.Search(ldap.NewSearchRequest(cfg.GroupSearchBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, fmt.Sprintf(cfg.GroupFilter, ldap.EscapeFilter(entry.DN)), []string{"dn"}, nil))
+	if err != nil {
+		return u, err
+	}
+	for _, g := range res.Entries {
+		u.Groups = append(u.Groups, g.DN)
+	}
+	return u, nil
+}
+
+func ldapBind(conn *ldap.Conn, cfg util.LDAPConfig) error {
+	if len(cfg.BindDN) == 0 {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(cfg.BindDN, cfg.BindPassword)
+}
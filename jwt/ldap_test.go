@@ -0,0 +1,263 @@
+package jwt
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/asn1-ber.v1"
+	"gopkg.in/ldap.v3"
+)
+
+// ldapEntry is an entry of the LDAP stand-in
+type ldapEntry struct {
+	DN         string
+	Password   string
+	Attributes map[string][]string
+}
+
+// ldapServer is an in-process LDAP stand-in which answers simple binds and searches
+type ldapServer struct {
+	listener net.Listener
+	entries  []ldapEntry
+}
+
+func newLDAPServer(t *testing.T, entries []ldapEntry) *ldapServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &ldapServer{listener: l, entries: entries}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *ldapServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapServer) Close() {
+	s.listener.Close()
+}
+
+func (s *ldapServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		p, err := ber.ReadPacket(conn)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+		id := p.Children[0].Value.(int64)
+		op := p.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := ldap.LDAPResultInvalidCredentials
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			if len(dn) == 0 && len(password) == 0 {
+				code = ldap.LDAPResultSuccess
+			}
+			for _, e := range s.entries {
+				if strings.EqualFold(e.DN, dn) && len(e.Password) > 0 && e.Password == password {
+					code = ldap.LDAPResultSuccess
+				}
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Value.(string))
+			for _, e := range s.entries {
+				if strings.HasSuffix(strings.ToLower(e.DN), base) && ldapMatch(op.Children[6], e) {
+					conn.Write(ldapSearchEntry(id, e).Bytes())
+				}
+			}
+			conn.Write(ldapResult(id, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			conn.Write(ldapResult(id, ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform).Bytes())
+		}
+	}
+}
+
+// ldapMatch matches the and, or, not, equality and present filters
+func ldapMatch(f *ber.Packet, e ldapEntry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !ldapMatch(c, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if ldapMatch(c, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !ldapMatch(f.Children[0], e)
+	case ldap.FilterEqualityMatch:
+		for _, v := range ldapValues(e, f.Children[0].Value.(string)) {
+			if strings.EqualFold(v, f.Children[1].Value.(string)) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(ldapValues(e, f.Data.String())) > 0
+	}
+	return false
+}
+
+func ldapValues(e ldapEntry, name string) []string {
+	for attr, values := range e.Attributes {
+		if strings.EqualFold(attr, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// ldapMessage wraps the protocol operation in an LDAP message,
+// the operation must be complete as its encoding is copied
+func ldapMessage(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+func ldapResult(id int64, tag int, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ber.Tag(tag), nil, "")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return ldapMessage(id, op)
+}
+
+func ldapSearchEntry(id int64, e ldapEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "objectName"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range e.Attributes {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(vals)
+		attributes.AppendChild(attr)
+	}
+	op.AppendChild(attributes)
+	return ldapMessage(id, op)
+}
+
+const (
+	adminsGroup     = "cn=admins,ou=groups,dc=example,dc=com"
+	developersGroup = "cn=developers,ou=groups,dc=example,dc=com"
+)
+
+func ldapTestConfig(url string) util.LDAPConfig {
+	return util.LDAPConfig{
+		Enabled:            true,
+		URL:                url,
+		BindDN:             "cn=tensor,ou=services,dc=example,dc=com",
+		BindPassword:       "service",
+		UserSearchBase:     "ou=people,dc=example,dc=com",
+		UserFilter:         "(&(objectClass=person)(uid=%s))",
+		UsernameAttribute:  "uid",
+		EmailAttribute:     "mail",
+		FirstNameAttribute: "givenName",
+		LastNameAttribute:  "sn",
+		GroupSearchBase:    "ou=groups,dc=example,dc=com",
+		GroupFilter:        "(member=%s)",
+	}
+}
+
+func ldapTestServer(t *testing.T) *ldapServer {
+	return newLDAPServer(t, []ldapEntry{
+		{DN: "cn=tensor,ou=services,dc=example,dc=com", Password: "service"},
+		{
+			DN:       "uid=alice,ou=people,dc=example,dc=com",
+			Password: "secret",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {"Alice"},
+				"mail":        {"Alice@example.com"},
+				"givenName":   {"Alice"},
+				"sn":          {"Liddell"},
+			},
+		},
+		{
+			DN:         adminsGroup,
+			Attributes: map[string][]string{"member": {"uid=alice,ou=people,dc=example,dc=com"}},
+		},
+		{
+			DN:         developersGroup,
+			Attributes: map[string][]string{"member": {"uid=bob,ou=people,dc=example,dc=com"}},
+		},
+	})
+}
+
+func TestLDAPLogin(t *testing.T) {
+	s := ldapTestServer(t)
+	defer s.Close()
+	cfg := ldapTestConfig(s.URL())
+
+	u, err := ldapLogin(cfg, "alice", "secret")
+	assert.NoError(t, err)
+	assert.Equal(t, externalUser{
+		ID:        "uid=alice,ou=people,dc=example,dc=com",
+		Username:  "alice",
+		Email:     "alice@example.com",
+		FirstName: "Alice",
+		LastName:  "Liddell",
+		Groups:    []string{adminsGroup},
+	}, u)
+
+	_, err = ldapLogin(cfg, "alice", "wrong")
+	assert.Error(t, err)
+	_, err = ldapLogin(cfg, "alice", "")
+	assert.Error(t, err, "an empty password is refused")
+	_, err = ldapLogin(cfg, "bob", "secret")
+	assert.Error(t, err, "unknown user")
+	_, err = ldapLogin(cfg, "*", "secret")
+	assert.Error(t, err, "the login is escaped in the filter")
+
+	cfg.BindPassword = "wrong"
+	_, err = ldapLogin(cfg, "alice", "secret")
+	assert.Error(t, err, "the service account cannot bind")
+
+	cfg = ldapTestConfig(s.URL())
+	cfg.GroupSearchBase = ""
+	u, err = ldapLogin(cfg, "alice", "secret")
+	assert.NoError(t, err)
+	assert.Empty(t, u.Groups)
+}
+
+func TestLDAPDial(t *testing.T) {
+	cfg := ldapTestConfig("http://127.0.0.1:389")
+	_, err := ldapDial(cfg)
+	assert.Error(t, err)
+
+	s := ldapTestServer(t)
+	defer s.Close()
+	cfg = ldapTestConfig(s.URL())
+	cfg.StartTLS = true
+	_, err = ldapDial(cfg)
+	assert.Error(t, err, "the stand-in does not support StartTLS")
+}
@@ -0,0 +1,481 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// oidcField is the field of the users holding their OpenID Connect subject
+const oidcField = "oidc_subject"
+
+// oidcCookie holds the state and the nonce of a login until the callback
+const oidcCookie = "tensor_oidc"
+
+// oidcStateTimeout is the time given to the user to log in at the provider
+const oidcStateTimeout = 10 * time.Minute
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// oidcProvider is the discovered configuration of a provider with its signing keys
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+var (
+	oidcMu        sync.Mutex
+	oidcProviders = map[string]*oidcProvider{}
+)
+
+// OIDCLogin redirects the user to the provider to log in,
+// the provider redirects the user to OIDCCallback with a code
+func OIDCLogin(c *gin.Context) {
+	cfg := util.Config.OIDC
+	if !cfg.Enabled {
+		unauthorized(c, http.StatusNotFound, "OpenID Connect login is not enabled")
+		return
+	}
+
+	p, err := oidcDiscover(cfg.Issuer)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Issuer": cfg.Issuer,
+			"Error":  err.Error(),
+		}).Errorln("Auth: Failed to discover the OpenID Connect provider")
+		unauthorized(c, http.StatusBadGateway, "OpenID Connect provider is not available")
+		return
+	}
+
+	state, nonce, cookie, err := oidcNewState()
+	if err != nil {
+		unauthorized(c, http.StatusInternalServerError, "Failed to create the login state")
+		return
+	}
+
+	redirect, err := oidcAuthURL(cfg, p, state, nonce)
+	if err != nil {
+		unauthorized(c, http.StatusBadGateway, "Invalid authorization endpoint of the OpenID Connect provider")
+		return
+	}
+
+	c.SetCookie(oidcCookie, cookie, int(oidcStateTimeout/time.Second), "/v1/auth/oidc", "", util.Config.TLSEnabled, true)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// OIDCCallback exchanges the code returned by the provider for an ID token, provisions
+// the user from its claims and returns a token like the one returned by /authtoken
+func OIDCCallback(c *gin.Context) {
+	cfg := util.Config.OIDC
+	if !cfg.Enabled {
+		unauthorized(c, http.StatusNotFound, "OpenID Connect login is not enabled")
+		return
+	}
+
+	cookie, _ := c.Cookie(oidcCookie)
+	// the state is used once
+	c.SetCookie(oidcCookie, "", -1, "/v1/auth/oidc", "", util.Config.TLSEnabled, true)
+
+	if e := c.Query("error"); len(e) > 0 {
+		unauthorized(c, http.StatusUnauthorized, "OpenID Connect login failed: "+e+" "+c.Query("error_description"))
+		return
+	}
+
+	u, err := oidcAuthenticate(cfg, c.Query("code"), c.Query("state"), cookie)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Issuer": cfg.Issuer,
+			"Error":  err.Error(),
+		}).Warningln("Auth: OpenID Connect authentication failed")
+		unauthorized(c, http.StatusUnauthorized, "OpenID Connect authentication failed")
+		return
+	}
+
+	user, err := provisionUser(oidcField, u, groupRules{
+		SuperUserGroups: cfg.SuperUserGroups,
+		AuditorGroups:   cfg.AuditorGroups,
+		Organizations:   cfg.Organizations,
+		Teams:           cfg.Teams,
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Username": u.Username,
+			"Subject":  u.ID,
+			"Error":    err.Error(),
+		}).Errorln("Auth: Failed to update OpenID Connect user")
+		unauthorized(c, http.StatusUnauthorized, "OpenID Connect authentication failed")
+		return
+	}
+
+	token, err := NewUserToken(user.ID.Hex())
+	if err != nil {
+		unauthorized(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":  token.Token,
+		"expire": token.Expire,
+	})
+}
+
+// oidcAuthenticate checks the state of the callback, exchanges the code
+// for an ID token and returns the user of the verified ID token
+func oidcAuthenticate(cfg util.OIDCConfig, code string, state string, cookie string) (externalUser, error) {
+	nonce, err := oidcCheckState(cookie, state)
+	if err != nil {
+		return externalUser{}, err
+	}
+	if len(code) == 0 {
+		return externalUser{}, errors.New("Missing authorization code")
+	}
+
+	p, err := oidcDiscover(cfg.Issuer)
+	if err != nil {
+		return externalUser{}, err
+	}
+
+	raw, err := oidcExchange(cfg, p, code)
+	if err != nil {
+		return externalUser{}, err
+	}
+
+	claims, err := oidcVerify(cfg, p, raw, nonce)
+	if err != nil {
+		return externalUser{}, err
+	}
+	return oidcUser(cfg, claims)
+}
+
+// oidcDiscover returns the provider of the issuer, its configuration is fetched once
+func oidcDiscover(issuer string) (*oidcProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if p, ok := oidcProviders[issuer]; ok {
+		return p, nil
+	}
+
+	p := &oidcProvider{}
+	if err := oidcGet(strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", p); err != nil {
+		return nil, err
+	}
+	if p.Issuer != issuer {
+		return nil, errors.New("Issuer of the provider configuration is " + p.Issuer)
+	}
+	if len(p.AuthorizationEndpoint) == 0 || len(p.TokenEndpoint) == 0 || len(p.JWKSURI) == 0 {
+		return nil, errors.New("Incomplete provider configuration")
+	}
+
+	oidcProviders[issuer] = p
+	return p, nil
+}
+
+// key returns the signing key of the provider, the keys are fetched
+// again when the key is not known since the provider rotates its keys
+func (p *oidcProvider) key(kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+
+	keys, err := oidcKeys(p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errors.New("Unknown signing key " + kid)
+}
+
+// findKey returns the key with the kid, a token without kid
+// can only be verified when the provider has a single key
+func (p *oidcProvider) findKey(kid string) *rsa.PublicKey {
+	if len(kid) == 0 && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+// oidcKeys fetches the RSA signing keys of the JWKS
+func oidcKeys(uri string) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := oidcGet(uri, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (len(k.Use) > 0 && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.N, "="))
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.E, "="))
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+func oidcGet(uri string, v interface{}) error {
+	resp, err := oidcClient.Get(uri)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", uri, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// oidcAuthURL returns the URL of the authorization endpoint the user is redirected to
+func oidcAuthURL(cfg util.OIDCConfig, p *oidcProvider, state string, nonce string) (string, error) {
+	u, err := url.Parse(p.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	scopes := cfg.Scopes
+	if !inGroups([]string{"openid"}, scopes) {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", cfg.RedirectURL)
+	q.Set("scope", strings.Join(scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// oidcExchange exchanges the code at the token endpoint and returns the ID token
+func oidcExchange(cfg util.OIDCConfig, p *oidcProvider, code string) (string, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {cfg.RedirectURL},
+	}
+	req, err := http.NewRequest("POST", p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("Invalid token response: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Token request failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if len(body.IDToken) == 0 {
+		return "", errors.New("Token response without ID token")
+	}
+	return body.IDToken, nil
+}
+
+// oidcVerify verifies the signature, the issuer, the audience,
+// the expiry and the nonce of the ID token and returns its claims
+func oidcVerify(cfg util.OIDCConfig, p *oidcProvider, raw string, nonce string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(raw, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, errors.New("Unsupported signing algorithm " + t.Method.Alg())
+		}
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("Invalid ID token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if !claims.VerifyIssuer(p.Issuer, true) {
+		return nil, errors.New("Invalid issuer of the ID token")
+	}
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, errors.New("ID token has expired")
+	}
+	if !oidcAudience(claims, cfg.ClientID) {
+		return nil, errors.New("ID token is not issued to " + cfg.ClientID)
+	}
+	if n, _ := claims["nonce"].(string); len(nonce) == 0 || !hmac.Equal([]byte(n), []byte(nonce)) {
+		return nil, errors.New("Invalid nonce of the ID token")
+	}
+	if sub, _ := claims["sub"].(string); len(sub) == 0 {
+		return nil, errors.New("ID token without subject")
+	}
+	return claims, nil
+}
+
+// oidcAudience returns whether the token is issued to the client, a token
+// with several audiences must be authorized for the client
+func oidcAudience(claims jwt.MapClaims, clientID string) bool {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return aud == clientID
+	case []interface{}:
+		found := false
+		for _, a := range aud {
+			if s, _ := a.(string); s == clientID {
+				found = true
+			}
+		}
+		if len(aud) > 1 {
+			azp, _ := claims["azp"].(string)
+			return found && azp == clientID
+		}
+		return found
+	}
+	return false
+}
+
+// oidcUser returns the user of the claims
+func oidcUser(cfg util.OIDCConfig, claims jwt.MapClaims) (externalUser, error) {
+	claim := func(name string) string {
+		v, _ := claims[name].(string)
+		return v
+	}
+
+	u := externalUser{
+		ID:        claim("sub"),
+		Username:  strings.ToLower(claim(cfg.UsernameClaim)),
+		Email:     strings.ToLower(claim(cfg.EmailClaim)),
+		FirstName: claim(cfg.FirstNameClaim),
+		LastName:  claim(cfg.LastNameClaim),
+	}
+	if len(u.Username) == 0 {
+		return u, errors.New("ID token has no " + cfg.UsernameClaim + " claim")
+	}
+
+	switch groups := claims[cfg.GroupsClaim].(type) {
+	case string:
+		u.Groups = []string{groups}
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				u.Groups = append(u.Groups, s)
+			}
+		}
+	}
+	return u, nil
+}
+
+// oidcNewState returns a random state and nonce with the signed cookie holding them
+func oidcNewState() (state string, nonce string, cookie string, err error) {
+	if state, err = oidcRandom(); err != nil {
+		return
+	}
+	if nonce, err = oidcRandom(); err != nil {
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state": state,
+		"nonce": nonce,
+		"exp":   time.Now().Add(oidcStateTimeout).Unix(),
+	})
+	cookie, err = token.SignedString(oidcStateKey())
+	return
+}
+
+// oidcCheckState checks the state of the callback against
+// the cookie of the login and returns the nonce of the login
+func oidcCheckState(cookie string, state string) (string, error) {
+	token, err := jwt.Parse(cookie, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("invalid signing algorithm")
+		}
+		return oidcStateKey(), nil
+	})
+	if err != nil || !token.Valid {
+		return "", errors.New("Missing or expired login state")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	expected, _ := claims["state"].(string)
+	if len(state) == 0 || !hmac.Equal([]byte(expected), []byte(state)) {
+		return "", errors.New("Invalid login state")
+	}
+	nonce, _ := claims["nonce"].(string)
+	return nonce, nil
+}
+
+// oidcStateKey is the key of the state cookies, it differs from
+// the key of the user tokens so a cookie is not accepted as a token
+func oidcStateKey() []byte {
+	mac := hmac.New(sha256.New, []byte(util.Config.Salt))
+	mac.Write([]byte("oidc_state"))
+	return mac.Sum(nil)
+}
+
+func oidcRandom() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
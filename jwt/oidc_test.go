@@ -0,0 +1,295 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// oidcTestProvider is a local stand-in of an OpenID Connect provider,
+// the ID tokens of the codes are signed when the codes are exchanged
+type oidcTestProvider struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	kid   string
+	key   *rsa.PrivateKey
+	codes map[string]jwt.MapClaims
+}
+
+func newOIDCTestProvider(t *testing.T) *oidcTestProvider {
+	p := &oidcTestProvider{codes: map[string]jwt.MapClaims{}}
+	p.rotate(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize?prompt=login",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": p.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "tensor" || secret != "secret" || r.PostFormValue("grant_type") != "authorization_code" ||
+			r.PostFormValue("redirect_uri") != "https://tensor.example.com/v1/auth/oidc/callback" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+
+		p.mu.Lock()
+		claims, ok := p.codes[r.PostFormValue("code")]
+		delete(p.codes, r.PostFormValue("code"))
+		p.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     p.sign(t, claims),
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	return p
+}
+
+// rotate replaces the signing key of the provider
+func (p *oidcTestProvider) rotate(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.kid = kid
+	p.key = key
+	p.mu.Unlock()
+}
+
+func (p *oidcTestProvider) sign(t *testing.T, claims jwt.MapClaims) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// issue returns a code for an ID token with the claims
+func (p *oidcTestProvider) issue(code string, claims jwt.MapClaims) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes[code] = claims
+	return code
+}
+
+func (p *oidcTestProvider) claims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                p.server.URL,
+		"sub":                "248289761001",
+		"aud":                "tensor",
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              nonce,
+		"preferred_username": "Alice",
+		"email":              "alice@example.com",
+		"given_name":         "Alice",
+		"family_name":        "Liddell",
+		"groups":             []string{"tensor-admins", "developers"},
+	}
+}
+
+func oidcTestConfig(issuer string) util.OIDCConfig {
+	return util.OIDCConfig{
+		Enabled:        true,
+		Issuer:         issuer,
+		ClientID:       "tensor",
+		ClientSecret:   "secret",
+		RedirectURL:    "https://tensor.example.com/v1/auth/oidc/callback",
+		Scopes:         []string{"profile", "email"},
+		UsernameClaim:  "preferred_username",
+		EmailClaim:     "email",
+		FirstNameClaim: "given_name",
+		LastNameClaim:  "family_name",
+		GroupsClaim:    "groups",
+	}
+}
+
+// oidcTestLogin starts a login and returns the state, the nonce and the cookie of the login
+func oidcTestLogin(t *testing.T, cfg util.OIDCConfig) (string, string, string) {
+	previous := util.Config.OIDC
+	util.Config.OIDC = cfg
+	defer func() { util.Config.OIDC = previous }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/v1/auth/oidc/login", nil)
+	OIDCLogin(c)
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	assert.NoError(t, err)
+	q := location.Query()
+	assert.Equal(t, "/authorize", location.Path)
+	assert.Equal(t, "login", q.Get("prompt"))
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "tensor", q.Get("client_id"))
+	assert.Equal(t, cfg.RedirectURL, q.Get("redirect_uri"))
+	assert.Equal(t, "openid profile email", q.Get("scope"))
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcCookie {
+		t.Fatalf("missing login cookie %v", cookies)
+	}
+	assert.True(t, cookies[0].HttpOnly)
+	return q.Get("state"), q.Get("nonce"), cookies[0].Value
+}
+
+func TestOIDCLogin(t *testing.T) {
+	p := newOIDCTestProvider(t)
+	defer p.server.Close()
+	cfg := oidcTestConfig(p.server.URL)
+
+	state, nonce, cookie := oidcTestLogin(t, cfg)
+	u, err := oidcAuthenticate(cfg, p.issue("code-1", p.claims(nonce)), state, cookie)
+	assert.NoError(t, err)
+	assert.Equal(t, externalUser{
+		ID:        "248289761001",
+		Username:  "alice",
+		Email:     "alice@example.com",
+		FirstName: "Alice",
+		LastName:  "Liddell",
+		Groups:    []string{"tensor-admins", "developers"},
+	}, u)
+
+	_, err = oidcAuthenticate(cfg, "code-1", state, cookie)
+	assert.Error(t, err, "a code is exchanged once")
+
+	// the provider rotates its key
+	p.rotate(t, "key-2")
+	state, nonce, cookie = oidcTestLogin(t, cfg)
+	_, err = oidcAuthenticate(cfg, p.issue("code-2", p.claims(nonce)), state, cookie)
+	assert.NoError(t, err)
+}
+
+func TestOIDCLoginState(t *testing.T) {
+	p := newOIDCTestProvider(t)
+	defer p.server.Close()
+	cfg := oidcTestConfig(p.server.URL)
+
+	state, nonce, cookie := oidcTestLogin(t, cfg)
+	_, err := oidcAuthenticate(cfg, p.issue("code-1", p.claims(nonce)), "other", cookie)
+	assert.Error(t, err, "the state of the callback differs")
+	_, err = oidcAuthenticate(cfg, p.issue("code-2", p.claims(nonce)), state, "")
+	assert.Error(t, err, "the login cookie is missing")
+
+	_, _, other := oidcTestLogin(t, cfg)
+	_, err = oidcAuthenticate(cfg, p.issue("code-3", p.claims(nonce)), state, other)
+	assert.Error(t, err, "the cookie is of another login")
+
+	_, err = oidcAuthenticate(cfg, p.issue("code-4", p.claims("other")), state, cookie)
+	assert.Error(t, err, "the nonce of the ID token differs")
+
+	_, err = oidcAuthenticate(cfg, "", state, cookie)
+	assert.Error(t, err, "the code is missing")
+}
+
+func TestOIDCVerify(t *testing.T) {
+	p := newOIDCTestProvider(t)
+	defer p.server.Close()
+	cfg := oidcTestConfig(p.server.URL)
+	provider, err := oidcDiscover(cfg.Issuer)
+	assert.NoError(t, err)
+
+	_, err = oidcVerify(cfg, provider, p.sign(t, p.claims("nonce")), "nonce")
+	assert.NoError(t, err)
+
+	invalid := map[string]jwt.MapClaims{
+		"issuer":   {"iss": "https://other.example.com"},
+		"audience": {"aud": "other"},
+		"azp":      {"aud": []string{"tensor", "other"}},
+		"expired":  {"exp": time.Now().Add(-time.Minute).Unix()},
+		"expiry":   {"exp": nil},
+		"subject":  {"sub": ""},
+	}
+	for name, override := range invalid {
+		claims := p.claims("nonce")
+		for k, v := range override {
+			claims[k] = v
+		}
+		_, err := oidcVerify(cfg, provider, p.sign(t, claims), "nonce")
+		assert.Error(t, err, name)
+	}
+
+	claims := p.claims("nonce")
+	claims["aud"] = []string{"tensor", "other"}
+	claims["azp"] = "tensor"
+	_, err = oidcVerify(cfg, provider, p.sign(t, claims), "nonce")
+	assert.NoError(t, err, "the client is the authorized party")
+
+	// a token signed with the client secret is refused
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, p.claims("nonce"))
+	signed, _ := hs.SignedString([]byte("secret"))
+	_, err = oidcVerify(cfg, provider, signed, "nonce")
+	assert.Error(t, err)
+
+	// a token signed by another key with the same kid is refused
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, p.claims("nonce"))
+	forged.Header["kid"] = "key-1"
+	signed, _ = forged.SignedString(other)
+	_, err = oidcVerify(cfg, provider, signed, "nonce")
+	assert.Error(t, err)
+}
+
+func TestOIDCDiscover(t *testing.T) {
+	p := newOIDCTestProvider(t)
+	defer p.server.Close()
+
+	_, err := oidcDiscover(p.server.URL + "/")
+	assert.Error(t, err, "the issuer of the configuration differs")
+
+	previous := util.Config.OIDC
+	util.Config.OIDC = util.OIDCConfig{}
+	defer func() { util.Config.OIDC = previous }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/v1/auth/oidc/login", nil)
+	OIDCLogin(c)
+	assert.Equal(t, http.StatusNotFound, w.Code, "the login is not enabled")
+}
@@ -0,0 +1,218 @@
+package jwt
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/rbac"
+	"github.com/pearsonappeng/tensor/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// externalUser is a user authenticated by an external backend,
+// ID is its identifier in the backend such as its LDAP DN
+type externalUser struct {
+	ID        string
+	Username  string
+	Email     string
+	FirstName string
+	LastName  string
+	Groups    []string
+}
+
+// groupRules maps the groups of external users to their flags and roles
+type groupRules struct {
+	SuperUserGroups []string
+	AuditorGroups   []string
+	Organizations   []util.OrganizationRule
+	Teams           []util.TeamRule
+}
+
+// provisionUser creates the external user on its first login, updates it and applies
+// the group rules. field is the field of the user holding its identifier in the backend
+func provisionUser(field string, u externalUser, rules groupRules) (common.User, error) {
+	var user common.User
+	err := db.Users().Find(bson.M{"username": u.Username}).One(&user)
+	if err != nil && err != mgo.ErrNotFound {
+		return user, err
+	}
+
+	if err == mgo.ErrNotFound {
+		user = common.User{
+			ID:       bson.NewObjectId(),
+			Username: u.Username,
+			Created:  time.Now(),
+			Roles:    []common.AccessControl{},
+		}
+		setExternalID(&user, field, u.ID)
+		if err := db.Users().Insert(user); err != nil {
+			return user, err
+		}
+		logrus.WithFields(logrus.Fields{
+			"Username": u.Username,
+			"ID":       u.ID,
+		}).Infoln("Auth: External user created")
+	} else if externalID(user, field) != u.ID {
+		// a user is never taken over by another account
+		return user, errors.New("A user with the same username exists")
+	}
+
+	previous := user
+	user.Email = u.Email
+	user.FirstName = u.FirstName
+	user.LastName = u.LastName
+	if granted, ok := groupFlag(u.Groups, rules.SuperUserGroups); ok {
+		user.IsSuperUser = granted
+	}
+	if granted, ok := groupFlag(u.Groups, rules.AuditorGroups); ok {
+		user.IsSystemAuditor = granted
+	}
+	user.Modified = time.Now()
+
+	if err := db.Users().UpdateId(user.ID, bson.M{"$set": bson.M{
+		"email":             user.Email,
+		"first_name":        user.FirstName,
+		"last_name":         user.LastName,
+		"is_superuser":      user.IsSuperUser,
+		"is_system_auditor": user.IsSystemAuditor,
+		"modified":          user.Modified,
+	}}); err != nil {
+		return user, err
+	}
+
+	// the sessions of the user are revoked when the group rules change its flags
+	if user.IsSuperUser != previous.IsSuperUser || user.IsSystemAuditor != previous.IsSystemAuditor {
+		if err := RevokeUserSessions(user.ID); err != nil {
+			return user, err
+		}
+	}
+
+	for _, r := range rules.Organizations {
+		var org common.Organization
+		if err := db.Organizations().Find(bson.M{"name": r.Organization}).One(&org); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Organization": r.Organization,
+				"Error":        err.Error(),
+			}).Warningln("Auth: Organization of the group rule not found")
+			continue
+		}
+		for role, granted := range organizationRoles(r, u.Groups) {
+			assignRole(rbac.Organization{}, org.ID, user.ID, role, granted)
+		}
+	}
+
+	for _, r := range rules.Teams {
+		var org common.Organization
+		var team common.Team
+		err := db.Organizations().Find(bson.M{"name": r.Organization}).One(&org)
+		if err == nil {
+			err = db.Teams().Find(bson.M{"name": r.Team, "organization_id": org.ID}).One(&team)
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Organization": r.Organization,
+				"Team":         r.Team,
+				"Error":        err.Error(),
+			}).Warningln("Auth: Team of the group rule not found")
+			continue
+		}
+		for role, granted := range teamRoles(r, u.Groups) {
+			assignRole(rbac.Team{}, team.ID, user.ID, role, granted)
+		}
+	}
+
+	return user, nil
+}
+
+// externalID returns the identifier of the user in the backend of the field,
+// local users and users of other backends do not have one
+func externalID(user common.User, field string) string {
+	switch field {
+	case ldapField:
+		return user.LDAPDN
+	case oidcField:
+		return user.OIDCSubject
+	}
+	return ""
+}
+
+func setExternalID(user *common.User, field string, id string) {
+	switch field {
+	case ldapField:
+		user.LDAPDN = id
+	case oidcField:
+		user.OIDCSubject = id
+	}
+}
+
+// roleAssigner is an rbac resource whose roles can be assigned
+type roleAssigner interface {
+	Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) error
+	Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) error
+}
+
+func assignRole(r roleAssigner, resourceID bson.ObjectId, userID bson.ObjectId, role string, granted bool) {
+	if granted {
+		r.Associate(resourceID, userID, rbac.RoleTypeUser, role)
+		return
+	}
+	r.Disassociate(resourceID, userID, rbac.RoleTypeUser, role)
+}
+
+// groupFlag returns whether the user is in one of the groups of a flag,
+// the flag is not managed when it has no groups
+func groupFlag(groups []string, ruleGroups []string) (bool, bool) {
+	if len(ruleGroups) == 0 {
+		return false, false
+	}
+	return inGroups(groups, ruleGroups), true
+}
+
+// organizationRoles returns the managed roles of the organization rule
+// and whether they are granted to a user of the groups
+func organizationRoles(r util.OrganizationRule, groups []string) map[string]bool {
+	roles := map[string]bool{}
+	for role, ruleGroups := range map[string][]string{
+		rbac.OrganizationAdmin:   r.Admins,
+		rbac.OrganizationAuditor: r.Auditors,
+		rbac.OrganizationMember:  r.Members,
+	} {
+		if granted, ok := groupFlag(groups, ruleGroups); ok {
+			roles[role] = granted
+		}
+	}
+	return roles
+}
+
+// teamRoles returns the managed roles of the team rule
+// and whether they are granted to a user of the groups
+func teamRoles(r util.TeamRule, groups []string) map[string]bool {
+	roles := map[string]bool{}
+	for role, ruleGroups := range map[string][]string{
+		rbac.TeamAdmin:  r.Admins,
+		rbac.TeamMember: r.Members,
+	} {
+		if granted, ok := groupFlag(groups, ruleGroups); ok {
+			roles[role] = granted
+		}
+	}
+	return roles
+}
+
+// inGroups returns whether one of the groups is in the rule groups,
+// groups are compared case insensitively like LDAP DNs
+func inGroups(groups []string, ruleGroups []string) bool {
+	for _, g := range groups {
+		for _, r := range ruleGroups {
+			if strings.EqualFold(g, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package jwt
+
+import (
+	"testing"
+
+	"github.com/pearsonappeng/tensor/models/common"
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupRoles(t *testing.T) {
+	admins := "cn=admins,ou=groups,dc=example,dc=com"
+	developers := "cn=developers,ou=groups,dc=example,dc=com"
+	groups := []string{"CN=Admins,ou=groups,dc=example,dc=com"}
+
+	superuser, ok := groupFlag(groups, []string{admins})
+	assert.True(t, ok)
+	assert.True(t, superuser)
+	auditor, ok := groupFlag(groups, []string{developers})
+	assert.True(t, ok)
+	assert.False(t, auditor)
+	_, ok = groupFlag(groups, nil)
+	assert.False(t, ok, "a flag without groups is not managed")
+
+	assert.Equal(t, map[string]bool{"admin": true, "member": false}, organizationRoles(util.OrganizationRule{
+		Organization: "Default",
+		Admins:       []string{admins},
+		Members:      []string{developers},
+	}, groups))
+
+	assert.Equal(t, map[string]bool{"member": true}, teamRoles(util.TeamRule{
+		Organization: "Default",
+		Team:         "Developers",
+		Members:      []string{developers, admins},
+	}, groups))
+}
+
+func TestExternalID(t *testing.T) {
+	var user common.User
+	setExternalID(&user, ldapField, "uid=alice,dc=example,dc=com")
+	assert.Equal(t, "uid=alice,dc=example,dc=com", externalID(user, ldapField))
+	assert.Equal(t, "", externalID(user, oidcField), "an LDAP user is not an OIDC user")
+	assert.Equal(t, "", externalID(common.User{}, ldapField), "a local user is not an LDAP user")
+}
@@ -0,0 +1,142 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// sessionClaim is the claim of the JWTs holding the ID of their session,
+// refreshed tokens keep the claim so they stay in the session of the login
+const sessionClaim = "jti"
+
+// cSession is the key of the session of the request in the Gin Context
+const cSession = "session_id"
+
+// sessionPayload creates the session of a login and returns its claim,
+// it is the PayloadFunc of the HeaderAuthMiddleware
+func sessionPayload(userID string) map[string]interface{} {
+	id, err := newSession(userID)
+	if err != nil {
+		// the token is refused by the Authorizator without a session
+		logrus.WithFields(logrus.Fields{
+			"User ID": userID,
+			"Error":   err.Error(),
+		}).Errorln("Auth: Failed to create session")
+		return nil
+	}
+	return map[string]interface{}{sessionClaim: id.Hex()}
+}
+
+// newSession creates a session of the user, the session expires
+// when its tokens can no longer be refreshed
+func newSession(userID string) (bson.ObjectId, error) {
+	if !bson.IsObjectIdHex(userID) {
+		return "", errors.New("Invalid user ID")
+	}
+
+	now := time.Now()
+	session := common.Session{
+		ID:      bson.NewObjectId(),
+		UserID:  bson.ObjectIdHex(userID),
+		Expires: now.Add(sessionLifetime()),
+		Created: now,
+	}
+	if err := db.Sessions().Insert(session); err != nil {
+		return "", err
+	}
+	return session.ID, nil
+}
+
+// sessionLifetime returns how long the tokens of a login are valid,
+// a token is refreshed up to MaxRefresh after the login
+func sessionLifetime() time.Duration {
+	return HeaderAuthMiddleware.MaxRefresh + HeaderAuthMiddleware.Timeout
+}
+
+// sessionID returns the ID of the session of the claims
+func sessionID(claims map[string]interface{}) (bson.ObjectId, bool) {
+	id, _ := claims[sessionClaim].(string)
+	if !bson.IsObjectIdHex(id) {
+		return "", false
+	}
+	return bson.ObjectIdHex(id), true
+}
+
+// checkSession returns an error when the token of the claims has no session
+// or its session is revoked, otherwise the use of the session is recorded
+// and its ID is set to the Gin Context
+func checkSession(c *gin.Context, claims map[string]interface{}) error {
+	id, ok := sessionID(claims)
+	if !ok {
+		return errors.New("Token without a session")
+	}
+
+	count, err := db.RevokedTokens().FindId(id).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("Session has been revoked")
+	}
+
+	if err := db.Sessions().UpdateId(id, bson.M{"$set": bson.M{
+		"last_used":    time.Now(),
+		"last_used_ip": c.ClientIP(),
+		"user_agent":   c.Request.UserAgent(),
+	}}); err != nil && err != mgo.ErrNotFound {
+		logrus.WithFields(logrus.Fields{
+			"Session ID": id.Hex(),
+			"Error":      err.Error(),
+		}).Errorln("Failed to update last use of session")
+	}
+
+	c.Set(cSession, id)
+	return nil
+}
+
+// SessionID returns the ID of the session the request is made within,
+// requests made with a personal access token or a job token have no session
+func SessionID(c *gin.Context) (bson.ObjectId, bool) {
+	id, ok := c.Get(cSession)
+	if !ok {
+		return "", false
+	}
+	return id.(bson.ObjectId), true
+}
+
+// RevokeSession adds the session to the revocation list, its tokens are refused
+// until they expire. The revoked session is removed from the sessions of the user
+func RevokeSession(session common.Session) error {
+	if _, err := db.RevokedTokens().UpsertId(session.ID, bson.M{"$set": bson.M{
+		"user_id": session.UserID,
+		"expires": session.Expires,
+	}}); err != nil {
+		return err
+	}
+	if err := db.Sessions().RemoveId(session.ID); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all the sessions of the user, it is used when
+// the password or the flags of the user change and when the user is removed
+func RevokeUserSessions(userID bson.ObjectId) error {
+	var sessions []common.Session
+	if err := db.Sessions().Find(bson.M{"user_id": userID}).All(&sessions); err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := RevokeSession(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
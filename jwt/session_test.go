@@ -0,0 +1,32 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSessionID(t *testing.T) {
+	id := bson.NewObjectId()
+	got, ok := sessionID(map[string]interface{}{"id": "user", sessionClaim: id.Hex()})
+	assert.True(t, ok)
+	assert.Equal(t, id, got)
+
+	_, ok = sessionID(map[string]interface{}{"id": "user"})
+	assert.False(t, ok, "a token issued without a session")
+	_, ok = sessionID(map[string]interface{}{sessionClaim: "session"})
+	assert.False(t, ok)
+}
+
+func TestSessionLifetime(t *testing.T) {
+	timeout, maxRefresh := HeaderAuthMiddleware.Timeout, HeaderAuthMiddleware.MaxRefresh
+	defer func() {
+		HeaderAuthMiddleware.Timeout, HeaderAuthMiddleware.MaxRefresh = timeout, maxRefresh
+	}()
+
+	HeaderAuthMiddleware.Timeout = time.Hour
+	HeaderAuthMiddleware.MaxRefresh = 24 * time.Hour
+	assert.Equal(t, 25*time.Hour, sessionLifetime(), "a token refreshed at the end of the refresh window")
+}
@@ -8,39 +8,74 @@ import (
 )
 
 type AdHocCommand struct {
-	ID            bson.ObjectId `bson:"_id" json:"id"`
-	ModuleName    string        `bson:"module_name" json:"module_name" binding:"required"`
-	Limit         string        `bson:"limit" json:"limit"`
-	ModuleArgs    string        `bson:"module_args" json:"module_args"`
-	JobType       string        `bson:"job_type" json:"job_type"`
-	Forks         uint8         `bson:"forks" json:"forks"`
-	Verbosity     uint8         `bson:"verbosity" json:"verbosity"`
-	BecomeEnabled bool          `bson:"become_enabled" json:"become_enabled"`
-	CredentialID  bson.ObjectId `bson:"credential_id" json:"credential"`
-	InventoryID   bson.ObjectId `bson:"inventory_id" json:"inventory"`
-	ExtraVars     gin.H         `bson:"extra_vars" json:"extra_vars"`
-	CreatedByID   bson.ObjectId `bson:"created_by_id" json:"created_by"`
-	ModifiedByID  bson.ObjectId `bson:"modified_by_id" json:"modified_by"`
-	Created       time.Time     `bson:"created" json:"created"`
-	Modified      time.Time     `bson:"modified" json:"modified"`
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	// required
+	ModuleName   string        `bson:"module_name" json:"module_name" binding:"required"`
+	CredentialID bson.ObjectId `bson:"credential_id" json:"credential" binding:"required"`
+	InventoryID  bson.ObjectId `bson:"inventory_id" json:"inventory"`
+
+	// Limit is the host pattern of the ad hoc command, default is all
+	Limit         string `bson:"limit" json:"limit" binding:"max=1024"`
+	ModuleArgs    string `bson:"module_args" json:"module_args"`
+	JobType       string `bson:"job_type" json:"job_type" binding:"omitempty,jobtype"`
+	Forks         uint8  `bson:"forks" json:"forks"`
+	Verbosity     uint8  `bson:"verbosity" json:"verbosity" binding:"omitempty,max=5"`
+	BecomeEnabled bool   `bson:"become_enabled" json:"become_enabled"`
+	ExtraVars     gin.H  `bson:"extra_vars" json:"extra_vars"`
+
+	// output only
+	Name           string    `bson:"name" json:"name" binding:"omitempty,naproperty"`
+	LaunchType     string    `bson:"launch_type" json:"launch_type" binding:"omitempty,naproperty"`
+	CancelFlag     bool      `bson:"cancel_flag" json:"cancel_flag" binding:"omitempty,naproperty"`
+	Status         string    `bson:"status" json:"status" binding:"omitempty,naproperty"`
+	Failed         bool      `bson:"failed" json:"failed" binding:"omitempty,naproperty"`
+	Started        time.Time `bson:"started" json:"started" binding:"omitempty,naproperty"`
+	Finished       time.Time `bson:"finished" json:"finished" binding:"omitempty,naproperty"`
+	Elapsed        uint32    `bson:"elapsed" json:"elapsed" binding:"omitempty,naproperty"`
+	ResultStdout   string    `bson:"result_stdout" json:"result_stdout" binding:"omitempty,naproperty"`
+	JobExplanation string    `bson:"job_explanation" json:"job_explanation" binding:"omitempty,naproperty"`
+
+	// system generated items
+	JobCWD  string   `bson:"job_cwd" json:"job_cwd" binding:"omitempty,naproperty"`
+	JobARGS []string `bson:"job_args" json:"job_args" binding:"omitempty,naproperty"`
+	JobENV  []string `bson:"job_env" json:"job_env" binding:"omitempty,naproperty"`
+	// ExecutionNode is the hostname of the instance running the command
+	ExecutionNode string `bson:"execution_node,omitempty" json:"execution_node" binding:"omitempty,naproperty"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"created_by"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"modified_by"`
+	Created      time.Time     `bson:"created" json:"created"`
+	Modified     time.Time     `bson:"modified" json:"modified"`
 
 	Type  string `bson:"-" json:"type"`
 	Links gin.H  `bson:"-" json:"links"`
 	Meta  gin.H  `bson:"-" json:"meta"`
 }
 
+func (AdHocCommand) GetType() string {
+	return "ad_hoc_command"
+}
+
+// AdHocCommandEvent is a single event of an ad hoc command recorded by the callback plugin
 type AdHocCommandEvent struct {
 	ID             bson.ObjectId `bson:"_id" json:"id"`
-	HostName       string        `bson:"host_name" json:"host_name" binding:"required"`
-	Event          string        `bson:"event" json:"event"`
-	EventData      string        `bson:"event_data" json:"event_data"`
-	Failed         bool          `bson:"failed" json:"failed"`
-	Changed        bool          `bson:"changed" json:"changed"`
-	Counter        uint8         `bson:"counter" json:"counter"`
-	HostID         bson.ObjectId `bson:"host_id" json:"host"`
-	AdHocCommandID bson.ObjectId `bson:"ad_hoc_command_id" json:"ad_hoc_command_id"`
+	AdHocCommandID bson.ObjectId `bson:"ad_hoc_command_id" json:"ad_hoc_command"`
+
+	Event     string         `bson:"event" json:"event" binding:"required"`
+	Counter   int            `bson:"counter" json:"counter"`
+	HostName  string         `bson:"host_name,omitempty" json:"host_name"`
+	HostID    *bson.ObjectId `bson:"host_id,omitempty" json:"host" binding:"omitempty,naproperty"`
+	Failed    bool           `bson:"failed" json:"failed"`
+	Changed   bool           `bson:"changed" json:"changed"`
+	EventData gin.H          `bson:"event_data,omitempty" json:"event_data"`
+	Created   time.Time      `bson:"created" json:"created" binding:"omitempty,naproperty"`
 
 	Type  string `bson:"-" json:"type"`
 	Links gin.H  `bson:"-" json:"links"`
 	Meta  gin.H  `bson:"-" json:"meta"`
 }
+
+func (AdHocCommandEvent) GetType() string {
+	return "ad_hoc_command_event"
+}
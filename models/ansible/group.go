@@ -22,6 +22,7 @@ type Group struct {
 	HasInventorySources      bool           `bson:"has_inventory_sources" json:"has_inventory_sources"`
 	InventoryID              bson.ObjectId  `bson:"inventory_id" json:"inventory"`
 	ParentGroupID            *bson.ObjectId `bson:"parent_group_id,omitempty" json:"parent_group,omitempty"`
+	InventorySourceID        *bson.ObjectId `bson:"inventory_source_id,omitempty" json:"inventory_source"`
 
 	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
@@ -20,6 +20,9 @@ type Host struct {
 	Variables   string         `bson:"variables,omitempty" json:"variables"`
 	Enabled     bool           `bson:"enabled,omitempty" json:"enabled"`
 
+	// InventorySourceID is the inventory source which imported the host
+	InventorySourceID *bson.ObjectId `bson:"inventory_source_id,omitempty" json:"inventory_source" binding:"omitempty,naproperty"`
+
 	LastJobID            *bson.ObjectId `bson:"last_job_id,omitempty" json:"last_job" binding:"omitempty,naproperty"`
 	LastJobHostSummaryID *bson.ObjectId `bson:"last_job_host_summary_id,omitempty" json:"last_job_host_summary" binding:"omitempty,naproperty"`
 
@@ -4,27 +4,56 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// InventoryScript is the model for organization collection
+// InventoryScript is the model for inventory_scripts collection.
+// Script is an executable which prints the inventory in
+// Ansible dynamic inventory format when it is called with --list
 type InventoryScript struct {
-	ID          bson.ObjectId `bson:"_id" json:"id"`
-	Name        string        `bson:"name" json:"name" binding:"required"`
-	Description string        `bson:"description" json:"description"`
-	Script      string        `bson:"script" json:"script" binding:"required"`
+	ID             bson.ObjectId `bson:"_id" json:"id"`
+	Name           string        `bson:"name" json:"name" binding:"required,min=1,max=500"`
+	Description    string        `bson:"description" json:"description"`
+	Script         string        `bson:"script" json:"script" binding:"required,inventory_script"`
+	OrganizationID bson.ObjectId `bson:"organization_id" json:"organization" binding:"required"`
 
-	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
-	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"created_by"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"modified_by"`
 
-	Created  time.Time `bson:"created" json:"created"`
-	Modified time.Time `bson:"modified" json:"modified"`
+	Created  time.Time `bson:"created" json:"created" binding:"omitempty,naproperty"`
+	Modified time.Time `bson:"modified" json:"modified" binding:"omitempty,naproperty"`
 
 	Type  string `bson:"-" json:"type"`
 	Links gin.H  `bson:"-" json:"links"`
 	Meta  gin.H  `bson:"-" json:"meta"`
+
+	Roles []common.AccessControl `bson:"roles" json:"-"`
 }
 
 func (InventoryScript) GetType() string {
 	return "inventory_script"
 }
+
+func (script InventoryScript) GetRoles() []common.AccessControl {
+	return script.Roles
+}
+
+// IsUnique checks whether an inventory script with the same name exists in the organization
+func (script InventoryScript) IsUnique() bool {
+	count, err := db.InventoryScripts().Find(bson.M{"name": script.Name, "organization_id": script.OrganizationID}).Count()
+	if err == nil && count > 0 {
+		return false
+	}
+
+	return true
+}
+
+func (script InventoryScript) OrganizationExist() bool {
+	count, err := db.Organizations().FindId(script.OrganizationID).Count()
+	if err == nil && count > 0 {
+		return true
+	}
+	return false
+}
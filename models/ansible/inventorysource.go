@@ -1,30 +1,79 @@
 package ansible
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
 	"gopkg.in/mgo.v2/bson"
 )
 
-// Inventory is the model for
-// Inventory collection
-// TODO: not implemented
+// Inventory source types, each source is synchronized using the
+// inventory script of the same name. Custom sources run an inventory
+// script of the organization, terraform sources import the latest
+// successful apply of a terraform job template
+const (
+	InventorySourceEC2       = "ec2"
+	InventorySourceGCE       = "gce"
+	InventorySourceAzureRM   = "azure_rm"
+	InventorySourceOpenStack = "openstack"
+	InventorySourceVMware    = "vmware"
+	InventorySourceRAX       = "rax"
+	InventorySourceForeman   = "foreman"
+	InventorySourceCustom    = "custom"
+	InventorySourceTerraform = "terraform"
+)
+
+// Data imported by terraform sources
+const (
+	TerraformImportState   = "state"
+	TerraformImportOutputs = "outputs"
+)
+
+// InventorySource is the model for
+// InventorySource collection
 type InventorySource struct {
 	ID bson.ObjectId `bson:"_id" json:"id"`
 
-	Source             string        `bson:"source" json:"source"`
-	SourcePath         string        `bson:"source_path" json:"source_path"`
-	SourceVars         string        `bson:"source_vars" json:"source_regions"`
-	SourceRegions      string        `bson:"source_regions" json:"has_active_failures"`
-	InstanceFilters    string        `bson:"instance_filters" json:"instance_filters"`
-	GroupBy            string        `bson:"group_by" json:"group_by"`
-	Overwrite          bool          `bson:"overwrite" json:"overwrite"`
-	OverwriteVars      bool          `bson:"overwrite_vars" json:"overwrite_vars"`
-	UpdateOnLaunch     bool          `bson:"update_on_launch" json:"update_on_launch"`
-	UpdateCacheTimeout uint32        `bson:"update_cache_timeout" json:"update_cache_timeout"`
-	CredentialID       bson.ObjectId `bson:"credential_id" json:"credential"`
-	GroupID            bson.ObjectId `bson:"group_id" json:"group"`
-	InventoryID        bson.ObjectId `bson:"inventory_id" json:"inventory"`
-	SourceScriptID     bson.ObjectId `bson:"source_script_id" json:"source_script"`
+	// required fields
+	Name        string        `bson:"name" json:"name" binding:"required,min=1,max=500"`
+	Source      string        `bson:"source" json:"source" binding:"required,inventory_source"`
+	InventoryID bson.ObjectId `bson:"inventory_id" json:"inventory" binding:"required"`
+
+	Description string `bson:"description,omitempty" json:"description"`
+	// SourceVars is the content of the configuration file of the inventory script
+	SourceVars         string         `bson:"source_vars,omitempty" json:"source_vars"`
+	SourceRegions      string         `bson:"source_regions,omitempty" json:"source_regions"`
+	InstanceFilters    string         `bson:"instance_filters,omitempty" json:"instance_filters"`
+	GroupBy            string         `bson:"group_by,omitempty" json:"group_by"`
+	Overwrite          bool           `bson:"overwrite" json:"overwrite"`
+	OverwriteVars      bool           `bson:"overwrite_vars" json:"overwrite_vars"`
+	UpdateOnLaunch     bool           `bson:"update_on_launch" json:"update_on_launch"`
+	UpdateCacheTimeout uint32         `bson:"update_cache_timeout" json:"update_cache_timeout"`
+	CredentialID       *bson.ObjectId `bson:"credential_id,omitempty" json:"credential"`
+	GroupID            *bson.ObjectId `bson:"group_id,omitempty" json:"group"`
+	SourceScriptID     *bson.ObjectId `bson:"source_script_id,omitempty" json:"source_script"`
+
+	// terraform sources import the resources in the state or the outputs of a terraform job template.
+	// HostnameAttributes are the resource attributes tried in order for the host name,
+	// HostVarAttributes are the resource attributes imported as host variables
+	TerraformJobTemplateID *bson.ObjectId `bson:"terraform_job_template_id,omitempty" json:"terraform_job_template"`
+	TerraformImport        string         `bson:"terraform_import,omitempty" json:"terraform_import" binding:"omitempty,terraform_import"`
+	HostnameAttributes     string         `bson:"hostname_attributes,omitempty" json:"hostname_attributes"`
+	HostVarAttributes      string         `bson:"host_var_attributes,omitempty" json:"host_var_attributes"`
+
+	// only output
+	Status           string         `bson:"status" json:"status" binding:"omitempty,naproperty"`
+	LastUpdated      time.Time      `bson:"last_updated,omitempty" json:"last_updated" binding:"omitempty,naproperty"`
+	LastUpdateFailed bool           `bson:"last_update_failed" json:"last_update_failed" binding:"omitempty,naproperty"`
+	LastUpdateID     *bson.ObjectId `bson:"last_update_id,omitempty" json:"last_update" binding:"omitempty,naproperty"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"created_by"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"modified_by"`
+
+	Created  time.Time `bson:"created" json:"created" binding:"omitempty,naproperty"`
+	Modified time.Time `bson:"modified" json:"modified" binding:"omitempty,naproperty"`
 
 	Type  string `bson:"-" json:"type"`
 	Links gin.H  `bson:"-" json:"links"`
@@ -34,3 +83,57 @@ type InventorySource struct {
 func (InventorySource) GetType() string {
 	return "inventory_source"
 }
+
+// IsUnique checks whether an inventory source with the same name exists in the inventory
+func (src InventorySource) IsUnique() bool {
+	count, err := db.InventorySources().Find(bson.M{"name": src.Name, "inventory_id": src.InventoryID}).Count()
+	if err == nil && count > 0 {
+		return false
+	}
+
+	return true
+}
+
+// GroupExist checks whether the group of the inventory source exists in the inventory
+func (src InventorySource) GroupExist() bool {
+	count, err := db.Groups().Find(bson.M{"_id": src.GroupID, "inventory_id": src.InventoryID}).Count()
+	if err == nil && count == 1 {
+		return true
+	}
+	return false
+}
+
+// credentialKinds are the cloud credential kinds used by each inventory source
+var credentialKinds = map[string]string{
+	InventorySourceEC2:       common.CredentialKindAWS,
+	InventorySourceGCE:       common.CredentialKindGCE,
+	InventorySourceAzureRM:   common.CredentialKindAZURE,
+	InventorySourceOpenStack: common.CredentialKindOPENSTACK,
+	InventorySourceVMware:    common.CredentialKindVMWARE,
+	InventorySourceRAX:       common.CredentialKindRAX,
+	InventorySourceForeman:   common.CredentialKindSATELLITE6,
+}
+
+// CredentialExist checks whether the credential of the inventory source exists
+// and is of the kind required by the source, custom sources accept any cloud credential
+func (src InventorySource) CredentialExist() bool {
+	query := bson.M{"_id": src.CredentialID, "kind": credentialKinds[src.Source]}
+	if src.Source == InventorySourceCustom {
+		query = bson.M{"_id": src.CredentialID, "cloud": true}
+	}
+	count, err := db.Credentials().Find(query).Count()
+	if err == nil && count == 1 {
+		return true
+	}
+	return false
+}
+
+// NeedsUpdate returns true if the last successful update of the inventory source
+// is older than the cache timeout
+func (src InventorySource) NeedsUpdate() bool {
+	if src.LastUpdateFailed || src.LastUpdated.IsZero() {
+		return true
+	}
+	timeout := time.Duration(src.UpdateCacheTimeout) * time.Second
+	return time.Since(src.LastUpdated) >= timeout
+}
@@ -0,0 +1,48 @@
+package ansible
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// InventoryUpdate is a job that synchronizes an inventory source
+// into its inventory
+type InventoryUpdate struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	Name              string        `bson:"name" json:"name"`
+	InventorySourceID bson.ObjectId `bson:"inventory_source_id" json:"inventory_source"`
+	InventoryID       bson.ObjectId `bson:"inventory_id" json:"inventory"`
+	Source            string        `bson:"source" json:"source"`
+	LaunchType        string        `bson:"launch_type" json:"launch_type"`
+	CancelFlag        bool          `bson:"cancel_flag" json:"cancel_flag"`
+	Status            string        `bson:"status" json:"status"`
+	Failed            bool          `bson:"failed" json:"failed"`
+	Started           time.Time     `bson:"started" json:"started"`
+	Finished          time.Time     `bson:"finished" json:"finished"`
+	Elapsed           uint32        `bson:"elapsed" json:"elapsed"`
+	ResultStdout      string        `bson:"result_stdout" json:"result_stdout"`
+	JobExplanation    string        `bson:"job_explanation" json:"job_explanation"`
+
+	// system generated items
+	JobCWD  string   `bson:"job_cwd" json:"job_cwd"`
+	JobARGS []string `bson:"job_args" json:"job_args"`
+	JobENV  []string `bson:"job_env" json:"job_env"`
+	// ExecutionNode is the hostname of the instance running the update
+	ExecutionNode string `bson:"execution_node,omitempty" json:"execution_node"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"created_by"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"modified_by"`
+	Created      time.Time     `bson:"created" json:"created"`
+	Modified     time.Time     `bson:"modified" json:"modified"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+	Meta  gin.H  `bson:"-" json:"meta"`
+}
+
+func (InventoryUpdate) GetType() string {
+	return "inventory_update"
+}
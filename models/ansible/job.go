@@ -13,8 +13,12 @@ const (
 	JOBTYPE_ANSIBLE_JOB = "ansible_job" // A ansible job
 	JOBTYPE_UPDATE_JOB  = "update_job"  // A project scm update job
 
-	JOB_LAUNCH_TYPE_MANUAL = "manual"
-	JOB_LAUNCH_TYPE_SYSTEM = "system"
+	JOB_LAUNCH_TYPE_MANUAL    = "manual"
+	JOB_LAUNCH_TYPE_SYSTEM    = "system"
+	JOB_LAUNCH_TYPE_SCHEDULED = "scheduled"
+	JOB_LAUNCH_TYPE_WORKFLOW  = "workflow"
+	// updates started by a job are dependencies of the job
+	JOB_LAUNCH_TYPE_DEPENDENCY = "dependency"
 )
 
 type Job struct {
@@ -46,6 +50,9 @@ type Job struct {
 	StartAtTask       string `bson:"start_at_task,omitempty" json:"start_at_task"`
 	AllowSimultaneous bool   `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
 
+	// SurveyPasswords are the extra variables holding encrypted survey password answers
+	SurveyPasswords []string `bson:"survey_passwords,omitempty" json:"-"`
+
 	InventoryID         bson.ObjectId  `bson:"inventory_id,omitempty" json:"inventory"`
 	JobTemplateID       bson.ObjectId  `bson:"job_template_id,omitempty" json:"job_template"`
 	ProjectID           bson.ObjectId  `bson:"project_id,omitempty" json:"project"`
@@ -66,6 +73,8 @@ type Job struct {
 	JobCWD  string   `bson:"job_cwd" json:"job_cwd"`
 	JobARGS []string `bson:"job_args" json:"job_args"`
 	JobENV  []string `bson:"job_env" json:"job_env"`
+	// ExecutionNode is the hostname of the instance running the job
+	ExecutionNode string `bson:"execution_node,omitempty" json:"execution_node"`
 
 	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
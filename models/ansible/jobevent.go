@@ -0,0 +1,99 @@
+package ansible
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Job event names sent by the tensor callback plugin
+const (
+	EventPlaybookOnStart     = "playbook_on_start"
+	EventPlaybookOnPlayStart = "playbook_on_play_start"
+	EventPlaybookOnTaskStart = "playbook_on_task_start"
+	EventPlaybookOnStats     = "playbook_on_stats"
+	EventRunnerOnOk          = "runner_on_ok"
+	EventRunnerOnFailed      = "runner_on_failed"
+	EventRunnerOnSkipped     = "runner_on_skipped"
+	EventRunnerOnUnreachable = "runner_on_unreachable"
+)
+
+// JobEvent is a single playbook event recorded by the callback plugin
+type JobEvent struct {
+	ID    bson.ObjectId `bson:"_id" json:"id"`
+	JobID bson.ObjectId `bson:"job_id" json:"job"`
+
+	Event     string         `bson:"event" json:"event" binding:"required"`
+	Counter   int            `bson:"counter" json:"counter"`
+	HostName  string         `bson:"host_name,omitempty" json:"host_name"`
+	HostID    *bson.ObjectId `bson:"host_id,omitempty" json:"host" binding:"omitempty,naproperty"`
+	Play      string         `bson:"play,omitempty" json:"play"`
+	Task      string         `bson:"task,omitempty" json:"task"`
+	Role      string         `bson:"role,omitempty" json:"role"`
+	Failed    bool           `bson:"failed" json:"failed"`
+	Changed   bool           `bson:"changed" json:"changed"`
+	EventData gin.H          `bson:"event_data,omitempty" json:"event_data"`
+	Created   time.Time      `bson:"created" json:"created" binding:"omitempty,naproperty"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+}
+
+func (JobEvent) GetType() string {
+	return "job_event"
+}
+
+// JobHostSummary holds the playbook stats of a single host in a job
+type JobHostSummary struct {
+	ID       bson.ObjectId  `bson:"_id" json:"id"`
+	JobID    bson.ObjectId  `bson:"job_id" json:"job"`
+	HostID   *bson.ObjectId `bson:"host_id,omitempty" json:"host"`
+	HostName string         `bson:"host_name" json:"host_name"`
+
+	Changed   int  `bson:"changed" json:"changed"`
+	Dark      int  `bson:"dark" json:"dark"`
+	Failures  int  `bson:"failures" json:"failures"`
+	Ok        int  `bson:"ok" json:"ok"`
+	Processed int  `bson:"processed" json:"processed"`
+	Skipped   int  `bson:"skipped" json:"skipped"`
+	Failed    bool `bson:"failed" json:"failed"`
+
+	Created  time.Time `bson:"created" json:"created"`
+	Modified time.Time `bson:"modified" json:"modified"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+}
+
+func (JobHostSummary) GetType() string {
+	return "job_host_summary"
+}
+
+// JobPlay is a play of a job, derived from the job events
+type JobPlay struct {
+	ID       bson.ObjectId `json:"id"`
+	Play     string        `json:"play"`
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Failed   bool          `json:"failed"`
+	Changed  bool          `json:"changed"`
+}
+
+// JobTask is a task of a job, derived from the job events
+type JobTask struct {
+	ID               bson.ObjectId `json:"id"`
+	Play             string        `json:"play"`
+	Task             string        `json:"task"`
+	Role             string        `json:"role"`
+	Started          time.Time     `json:"started"`
+	Finished         time.Time     `json:"finished"`
+	Failed           bool          `json:"failed"`
+	Changed          bool          `json:"changed"`
+	HostCount        int           `json:"host_count"`
+	SuccessfulCount  int           `json:"successful_count"`
+	ChangedCount     int           `json:"changed_count"`
+	FailedCount      int           `json:"failed_count"`
+	SkippedCount     int           `json:"skipped_count"`
+	UnreachableCount int           `json:"unreachable_count"`
+}
@@ -41,6 +41,10 @@ type JobTemplate struct {
 	PromptTags          bool           `bson:"prompt_tags,omitempty" json:"ask_tags_on_launch"`
 	PromptSkipTags      bool           `bson:"prompt_skip_tags,omitempty" json:"ask_skip_tags_on_launch"`
 	AllowSimultaneous   bool           `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
+	SurveyEnabled       bool           `bson:"survey_enabled,omitempty" json:"survey_enabled"`
+
+	// SurveySpec is managed through the survey_spec endpoint
+	SurveySpec *common.SurveySpec `bson:"survey_spec,omitempty" json:"-"`
 
 	PolymorphicCtypeID *bson.ObjectId `bson:"polymorphic_ctype_id,omitempty" json:"polymorphic_ctype"`
 
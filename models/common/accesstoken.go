@@ -0,0 +1,48 @@
+package common
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Scopes of personal access tokens, a read token can only read resources,
+// a launch token can also launch jobs and a write token can do what its user can do
+const (
+	TokenScopeRead   = "read"
+	TokenScopeLaunch = "launch"
+	TokenScopeWrite  = "write"
+)
+
+// AccessToken is a personal access token of a user. Only the hash of the token
+// is stored, the token is returned once when it is created
+type AccessToken struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	UserID      bson.ObjectId `bson:"user_id" json:"user"`
+	Description string        `bson:"description" json:"description" binding:"max=500"`
+	Scope       string        `bson:"scope" json:"scope" binding:"required,token_scope"`
+	Hash        string        `bson:"hash" json:"-"`
+	// Token is only set in the response of the creation
+	Token string `bson:"-" json:"token,omitempty"`
+
+	// Expires is optional, tokens without expiry are valid until they are revoked
+	Expires    *time.Time `bson:"expires,omitempty" json:"expires"`
+	LastUsed   *time.Time `bson:"last_used,omitempty" json:"last_used"`
+	LastUsedIP string     `bson:"last_used_ip,omitempty" json:"last_used_ip"`
+
+	Created time.Time `bson:"created" json:"created"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+}
+
+func (AccessToken) GetType() string {
+	return "access_token"
+}
+
+// Expired returns whether the token has expired
+func (t AccessToken) Expired() bool {
+	return t.Expires != nil && !t.Expires.After(time.Now())
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Statuses of an instance
+const (
+	InstanceActive  = "active"
+	InstanceLost    = "lost"
+	InstanceOffline = "offline"
+)
+
+// Instance is a tensord node registered in the database.
+// Nodes are identified by their hostname
+type Instance struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	Hostname         string   `bson:"hostname" json:"hostname"`
+	Version          string   `bson:"version" json:"version"`
+	Role             string   `bson:"role" json:"role"`
+	Status           string   `bson:"status" json:"status"`
+	Capacity         int      `bson:"capacity" json:"capacity"`
+	ConsumedCapacity int      `bson:"consumed_capacity" json:"consumed_capacity"`
+	JobTypes         []string `bson:"job_types" json:"job_types"`
+	// Workers are the worker pools of the instance, sent with the heartbeat
+	Workers []InstanceWorkers `bson:"workers" json:"workers"`
+	// Projects are the times the project checkouts of the instance were updated
+	Projects map[string]time.Time `bson:"projects,omitempty" json:"-"`
+
+	Started   time.Time `bson:"started" json:"started"`
+	Heartbeat time.Time `bson:"heartbeat" json:"heartbeat"`
+	Created   time.Time `bson:"created" json:"created"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+	Meta  gin.H  `bson:"-" json:"meta"`
+}
+
+// InstanceWorkers is the worker pool of an instance consuming a queue
+type InstanceWorkers struct {
+	Queue   string `bson:"queue" json:"queue"`
+	Workers int    `bson:"workers" json:"workers"`
+	Running int    `bson:"running" json:"running"`
+}
+
+func (Instance) GetType() string {
+	return "instance"
+}
@@ -7,20 +7,24 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+// Notification is a single delivery attempt of a notification template for a job
 type Notification struct {
 	ID bson.ObjectId `bson:"_id" json:"id"`
 
-	Status                 string `bson:"status" json:"status"`
-	Error                  string `bson:"error" json:"error"`
-	NotificationsSent      uint64 `bson:"notifications_sent" json:"notifications_sent"`
-	NotificationsType      string `bson:"notification_type" json:"notification_type"`
-	Recipients             string `bson:"recipients" json:"recipients"`
-	Subject                string `bson:"subject" json:"subject"`
-	Body                   string `bson:"body" json:"body"`
-	NotificationTemplateID string `bson:"notification_template_id" json:"notification_template_id"`
-
-	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
-	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+	Status                 string        `bson:"status" json:"status"`
+	Error                  string        `bson:"error" json:"error"`
+	NotificationsSent      uint64        `bson:"notifications_sent" json:"notifications_sent"`
+	NotificationsType      string        `bson:"notification_type" json:"notification_type"`
+	Recipients             string        `bson:"recipients" json:"recipients"`
+	Subject                string        `bson:"subject" json:"subject"`
+	Body                   string        `bson:"body" json:"body"`
+	NotificationTemplateID bson.ObjectId `bson:"notification_template_id" json:"notification_template"`
+
+	// JobID is the ID of a job or a terraform job depending on JobType
+	JobID   bson.ObjectId `bson:"job_id" json:"job"`
+	JobType string        `bson:"job_type" json:"job_type"`
+	Event   string        `bson:"event" json:"event"`
+	Attempt uint8         `bson:"attempt" json:"attempt"`
 
 	Created  time.Time `bson:"created" json:"created"`
 	Modified time.Time `bson:"modified" json:"modified"`
@@ -28,8 +32,6 @@ type Notification struct {
 	Type  string `bson:"-" json:"type"`
 	Links gin.H  `bson:"-" json:"links"`
 	Meta  gin.H  `bson:"-" json:"meta"`
-
-	Access []AccessControl `bson:"access" json:"-"`
 }
 
 func (Notification) GetType() string {
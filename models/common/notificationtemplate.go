@@ -4,29 +4,87 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
 	"gopkg.in/mgo.v2/bson"
 )
 
+// Notification types
+const (
+	NotificationTypeEmail      = "email"
+	NotificationTypeWebhook    = "webhook"
+	NotificationTypeSlack      = "slack"
+	NotificationTypeMattermost = "mattermost"
+)
+
+// Notification events, notification templates attached to the any event
+// are sent when a job succeeds or fails
+const (
+	NotificationEventStarted = "started"
+	NotificationEventSuccess = "success"
+	NotificationEventError   = "error"
+	NotificationEventAny     = "any"
+)
+
 type NotificationTemplate struct {
 	ID bson.ObjectId `bson:"_id" json:"id"`
 
-	Description               string `bson:"description" json:"description"`
-	Name                      string `bson:"name" json:"name"`
-	NotificationsType         string `bson:"notification_type" json:"notification_type"`
-	NotificationConfiguration string `bson:"notification_configuration" json:"notification_configuration"`
-	Subject                   string `bson:"subject" json:"subject"`
+	// required
+	Name              string        `bson:"name" json:"name" binding:"required,min=1,max=500"`
+	OrganizationID    bson.ObjectId `bson:"organization_id" json:"organization" binding:"required"`
+	NotificationsType string        `bson:"notification_type" json:"notification_type" binding:"required,notification_type"`
+
+	Description               string                    `bson:"description" json:"description"`
+	NotificationConfiguration NotificationConfiguration `bson:"notification_configuration" json:"notification_configuration"`
+	// Subject is the email subject and the first line of chat messages,
+	// a subject is generated from the job when it is empty
+	Subject string `bson:"subject" json:"subject"`
 
-	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
-	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+	// IDs of the organizations, job templates and terraform job templates
+	// the notification template is attached to for each event
+	StartedIDs []bson.ObjectId `bson:"started_ids" json:"-"`
+	SuccessIDs []bson.ObjectId `bson:"success_ids" json:"-"`
+	ErrorIDs   []bson.ObjectId `bson:"error_ids" json:"-"`
+	AnyIDs     []bson.ObjectId `bson:"any_ids" json:"-"`
 
-	Created  time.Time `bson:"created" json:"created"`
-	Modified time.Time `bson:"modified" json:"modified"`
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"created_by"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"modified_by"`
+
+	Created  time.Time `bson:"created" json:"created" binding:"omitempty,naproperty"`
+	Modified time.Time `bson:"modified" json:"modified" binding:"omitempty,naproperty"`
 
 	Type  string `bson:"-" json:"type"`
 	Links gin.H  `bson:"-" json:"links"`
 	Meta  gin.H  `bson:"-" json:"meta"`
 
-	Roles []AccessControl `bson:"access" json:"-"`
+	Roles []AccessControl `bson:"roles" json:"-"`
+}
+
+// NotificationConfiguration contains the configuration of every notification type.
+// Email notifications use the SMTP fields, webhook notifications post a JSON document
+// of the job to URL signed with Secret, slack and mattermost notifications post
+// a message to the incoming webhook URL
+type NotificationConfiguration struct {
+	// email
+	Host       string   `bson:"host,omitempty" json:"host,omitempty"`
+	Port       uint16   `bson:"port,omitempty" json:"port,omitempty"`
+	Username   string   `bson:"username,omitempty" json:"username,omitempty"`
+	Password   string   `bson:"password,omitempty" json:"password,omitempty"`
+	Sender     string   `bson:"sender,omitempty" json:"sender,omitempty" binding:"omitempty,email"`
+	Recipients []string `bson:"recipients,omitempty" json:"recipients,omitempty" binding:"omitempty,dive,email"`
+	UseTLS     bool     `bson:"use_tls,omitempty" json:"use_tls,omitempty"`
+	UseSSL     bool     `bson:"use_ssl,omitempty" json:"use_ssl,omitempty"`
+
+	// webhook, slack and mattermost
+	URL     string            `bson:"url,omitempty" json:"url,omitempty" binding:"omitempty,url"`
+	Headers map[string]string `bson:"headers,omitempty" json:"headers,omitempty"`
+	Secret  string            `bson:"secret,omitempty" json:"secret,omitempty"`
+	Channel string            `bson:"channel,omitempty" json:"channel,omitempty"`
+	IconURL string            `bson:"icon_url,omitempty" json:"icon_url,omitempty" binding:"omitempty,url"`
+
+	// Timeout of a delivery attempt in seconds
+	Timeout uint16 `bson:"timeout,omitempty" json:"timeout,omitempty"`
+	// Retries is the number of times a failed delivery is retried
+	Retries uint8 `bson:"retries,omitempty" json:"retries,omitempty" binding:"omitempty,max=10"`
 }
 
 func (NotificationTemplate) GetType() string {
@@ -36,3 +94,27 @@ func (NotificationTemplate) GetType() string {
 func (n NotificationTemplate) GetRoles() []AccessControl {
 	return n.Roles
 }
+
+// IsUnique checks whether a notification template with the same name exists in the organization
+func (n NotificationTemplate) IsUnique() bool {
+	count, err := db.NotificationTemplates().Find(bson.M{"name": n.Name, "organization_id": n.OrganizationID}).Count()
+	if err == nil && count > 0 {
+		return false
+	}
+
+	return true
+}
+
+func (n NotificationTemplate) OrganizationExist() bool {
+	count, err := db.Organizations().FindId(n.OrganizationID).Count()
+	if err == nil && count > 0 {
+		return true
+	}
+	return false
+}
+
+// NotificationEventField returns the field which contains the IDs of the objects
+// the notification template is attached to for the event
+func NotificationEventField(event string) string {
+	return event + "_ids"
+}
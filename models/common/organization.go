@@ -8,6 +8,14 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
+// DefaultAdHocModules are the modules allowed in ad hoc commands
+// of organizations without their own list of modules
+var DefaultAdHocModules = []string{
+	"command", "shell", "ping", "setup", "service", "yum", "apt",
+	"apt_key", "apt_repository", "group", "user", "mount", "selinux",
+	"win_ping", "win_service", "win_updates", "win_group", "win_user",
+}
+
 // Organization is the model for organization collection
 type Organization struct {
 	ID    bson.ObjectId `bson:"_id" json:"id"`
@@ -18,6 +26,10 @@ type Organization struct {
 	Name        string `bson:"name" json:"name" binding:"required,min=1,max=500"`
 	Description string `bson:"description" json:"description"`
 
+	// AdHocModules are the modules allowed in ad hoc commands
+	// on the inventories of the organization
+	AdHocModules []string `bson:"ad_hoc_modules,omitempty" json:"ad_hoc_modules"`
+
 	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
 
@@ -39,6 +51,20 @@ func (org Organization) GetOrganizationID() (bson.ObjectId, error) {
 	return org.ID, nil
 }
 
+// AdHocModuleAllowed returns true if ad hoc commands of the organization may run the module
+func (org Organization) AdHocModuleAllowed(module string) bool {
+	modules := org.AdHocModules
+	if len(modules) == 0 {
+		modules = DefaultAdHocModules
+	}
+	for _, m := range modules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
 func (org Organization) IsUnique() bool {
 	count, err := db.Organizations().Find(bson.M{"name": org.Name}).Count()
 	if err == nil && count > 0 {
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types of templates a schedule can launch
+const (
+	ScheduleJobTemplate          = "job_template"
+	ScheduleTerraformJobTemplate = "terraform_job_template"
+	ScheduleProject              = "project"
+)
+
+// Schedule launches a job template, terraform job template or a project update
+// at the occurrences of an RFC 5545 recurrence rule or a cron expression
+type Schedule struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	Name        string `bson:"name" json:"name" binding:"required,min=1,max=500"`
+	Description string `bson:"description,omitempty" json:"description"`
+	Enabled     bool   `bson:"enabled" json:"enabled"`
+
+	// one of RRule or Cron is required
+	RRule    string     `bson:"rrule,omitempty" json:"rrule" binding:"max=1024"`
+	Cron     string     `bson:"cron,omitempty" json:"cron" binding:"max=256"`
+	Timezone string     `bson:"timezone,omitempty" json:"timezone"`
+	DtStart  time.Time  `bson:"dtstart" json:"dtstart"`
+	DtEnd    *time.Time `bson:"dtend,omitempty" json:"dtend"`
+
+	// ExtraData overrides the extra variables of a job template
+	// or the variables of a terraform job template
+	ExtraData gin.H `bson:"extra_data,omitempty" json:"extra_data"`
+
+	// output only
+	TemplateID   bson.ObjectId  `bson:"template_id" json:"unified_job_template" binding:"omitempty,naproperty"`
+	TemplateType string         `bson:"template_type" json:"unified_job_template_type" binding:"omitempty,naproperty"`
+	NextRun      *time.Time     `bson:"next_run,omitempty" json:"next_run" binding:"omitempty,naproperty"`
+	LastRun      *time.Time     `bson:"last_run,omitempty" json:"last_run" binding:"omitempty,naproperty"`
+	LastJobID    *bson.ObjectId `bson:"last_job_id,omitempty" json:"last_job" binding:"omitempty,naproperty"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+
+	Created  time.Time `bson:"created" json:"created" binding:"omitempty,naproperty"`
+	Modified time.Time `bson:"modified" json:"modified" binding:"omitempty,naproperty"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+	Meta  gin.H  `bson:"-" json:"meta"`
+}
+
+func (Schedule) GetType() string {
+	return "schedule"
+}
@@ -0,0 +1,32 @@
+package common
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Session is a login of a user, the ID of the session is the jti claim
+// of the JWTs issued for the login and of the tokens they are refreshed with
+type Session struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	UserID     bson.ObjectId `bson:"user_id" json:"user"`
+	LastUsed   *time.Time    `bson:"last_used,omitempty" json:"last_used"`
+	LastUsedIP string        `bson:"last_used_ip,omitempty" json:"last_used_ip"`
+	UserAgent  string        `bson:"user_agent,omitempty" json:"user_agent"`
+	// Current tells whether the request is made within the session
+	Current bool `bson:"-" json:"current"`
+
+	// Expires is when the tokens of the session can no longer be refreshed
+	Expires time.Time `bson:"expires" json:"expires"`
+	Created time.Time `bson:"created" json:"created"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+}
+
+func (Session) GetType() string {
+	return "session"
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"bytes"
+
+	"github.com/pearsonappeng/tensor/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// StdoutChunk is a part of the output of a job, Start and End are
+// the byte offsets of the chunk in the output of the job
+type StdoutChunk struct {
+	ID      bson.ObjectId `bson:"_id"`
+	JobID   bson.ObjectId `bson:"job_id"`
+	Seq     int           `bson:"seq"`
+	Start   int           `bson:"start"`
+	End     int           `bson:"end"`
+	Content string        `bson:"content"`
+}
+
+// ReadStdout returns the output of the job stored after the byte offset and the
+// offset of its end. The output of a job started before the output was stored
+// in chunks is in the result_stdout field of the job
+func ReadStdout(jobID bson.ObjectId, offset int) (string, int, error) {
+	var chunks []StdoutChunk
+	if err := db.JobStdout().Find(bson.M{"job_id": jobID, "end": bson.M{"$gt": offset}}).
+		Sort("seq").All(&chunks); err != nil {
+		return "", offset, err
+	}
+
+	var out bytes.Buffer
+	for _, c := range chunks {
+		if c.Start < offset {
+			c.Content = c.Content[offset-c.Start:]
+		}
+		out.WriteString(c.Content)
+		offset = c.End
+	}
+	return out.String(), offset, nil
+}
+
+// HasStdout returns whether the output of the job is stored in chunks
+func HasStdout(jobID bson.ObjectId) bool {
+	count, err := db.JobStdout().Find(bson.M{"job_id": jobID}).Limit(1).Count()
+	return err == nil && count > 0
+}
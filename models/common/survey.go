@@ -0,0 +1,34 @@
+package common
+
+// Survey question types
+const (
+	SurveyTypeText           = "text"
+	SurveyTypeInteger        = "integer"
+	SurveyTypeFloat          = "float"
+	SurveyTypeMultipleChoice = "multiplechoice"
+	SurveyTypeMultiSelect    = "multiselect"
+	SurveyTypePassword       = "password"
+)
+
+// SurveySpec is a set of questions answered when a job template is launched,
+// the answers are passed to the job as variables
+type SurveySpec struct {
+	Name        string           `bson:"name" json:"name"`
+	Description string           `bson:"description" json:"description"`
+	Spec        []SurveyQuestion `bson:"spec" json:"spec" binding:"required,min=1,dive"`
+}
+
+// SurveyQuestion is a single question of a survey.
+// Min and Max are the length limits of text and password answers
+// and the value limits of integer and float answers
+type SurveyQuestion struct {
+	Variable    string      `bson:"variable" json:"variable" binding:"required,min=1,max=500"`
+	Question    string      `bson:"question_name" json:"question_name" binding:"required"`
+	Description string      `bson:"question_description" json:"question_description"`
+	Type        string      `bson:"type" json:"type" binding:"required,survey_type"`
+	Required    bool        `bson:"required" json:"required"`
+	Min         *float64    `bson:"min,omitempty" json:"min"`
+	Max         *float64    `bson:"max,omitempty" json:"max"`
+	Default     interface{} `bson:"default,omitempty" json:"default"`
+	Choices     []string    `bson:"choices,omitempty" json:"choices"`
+}
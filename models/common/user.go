@@ -21,11 +21,19 @@ type User struct {
 	IsSuperUser     bool   `bson:"is_superuser" json:"is_superuser"`
 	IsSystemAuditor bool   `bson:"is_system_auditor" json:"is_system_auditor"`
 	Password        string `bson:"password,omitempty" json:"password"`
+	// LDAPDN is the DN of the users created by the LDAP authentication
+	LDAPDN string `bson:"ldap_dn,omitempty" json:"ldap_dn"`
+	// OIDCSubject is the subject of the users created by the OpenID Connect login
+	OIDCSubject string `bson:"oidc_subject,omitempty" json:"oidc_subject"`
 
 	Created  time.Time `bson:"created" json:"created"`
 	Modified time.Time `bson:"modified" json:"modified"`
 
 	Roles []AccessControl `bson:"roles" json:"-"`
+
+	// TokenScope is the scope of the personal access token the user
+	// is authenticated with, it is empty for the other authentications
+	TokenScope string `bson:"-" json:"-"`
 }
 
 func (User) GetType() string {
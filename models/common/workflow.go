@@ -0,0 +1,163 @@
+package common
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Types of templates a workflow node can launch
+const (
+	WorkflowNodeJobTemplate          = "job_template"
+	WorkflowNodeTerraformJobTemplate = "terraform_job_template"
+	WorkflowNodeProject              = "project"
+)
+
+// Types of the jobs launched by workflow nodes
+const (
+	WorkflowJobTypeJob          = "job"
+	WorkflowJobTypeTerraformJob = "terraform_job"
+)
+
+// Workflow job and workflow node statuses
+const (
+	WorkflowStatusNew        = "new"
+	WorkflowStatusPending    = "pending"
+	WorkflowStatusRunning    = "running"
+	WorkflowStatusSuccessful = "successful"
+	WorkflowStatusFailed     = "failed"
+	WorkflowStatusError      = "error"
+	WorkflowStatusCanceled   = "canceled"
+	// WorkflowStatusDoNotRun marks nodes which will not run
+	// because none of the edges from their parents were followed
+	WorkflowStatusDoNotRun = "do_not_run"
+)
+
+// WorkflowNode is a node of a workflow job template graph.
+// The node launches a job template, a terraform job template or a project update,
+// and the nodes listed in SuccessNodes, FailureNodes and AlwaysNodes are run
+// when the launched job succeeds, fails or finishes
+type WorkflowNode struct {
+	// ID identifies the node within the workflow job template
+	ID           string        `bson:"id" json:"id" binding:"required,min=1,max=100"`
+	TemplateType string        `bson:"template_type" json:"unified_job_template_type" binding:"required"`
+	TemplateID   bson.ObjectId `bson:"template_id" json:"unified_job_template" binding:"required"`
+
+	SuccessNodes []string `bson:"success_nodes,omitempty" json:"success_nodes"`
+	FailureNodes []string `bson:"failure_nodes,omitempty" json:"failure_nodes"`
+	AlwaysNodes  []string `bson:"always_nodes,omitempty" json:"always_nodes"`
+}
+
+// WorkflowJobTemplate is the model for workflow_job_templates collection
+type WorkflowJobTemplate struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	// required
+	Name           string         `bson:"name" json:"name" binding:"required,min=1,max=500"`
+	OrganizationID bson.ObjectId  `bson:"organization_id" json:"organization" binding:"required"`
+	Nodes          []WorkflowNode `bson:"nodes" json:"nodes" binding:"required,min=1,dive"`
+
+	Description string `bson:"description,omitempty" json:"description"`
+	// ExtraVars are passed to the job templates of the workflow,
+	// and to the terraform job templates as variables
+	ExtraVars       gin.H `bson:"extra_vars,omitempty" json:"extra_vars"`
+	PromptVariables bool  `bson:"ask_variables_on_launch,omitempty" json:"ask_variables_on_launch"`
+
+	// output only
+	LastJobRun    *time.Time     `bson:"last_job_run,omitempty" json:"last_job_run" binding:"omitempty,naproperty"`
+	LastJobID     *bson.ObjectId `bson:"last_job_id,omitempty" json:"last_job" binding:"omitempty,naproperty"`
+	LastJobFailed bool           `bson:"last_job_failed,omitempty" json:"last_job_failed" binding:"omitempty,naproperty"`
+	Status        string         `bson:"status,omitempty" json:"status" binding:"omitempty,naproperty"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+
+	Created  time.Time `bson:"created" json:"created" binding:"omitempty,naproperty"`
+	Modified time.Time `bson:"modified" json:"modified" binding:"omitempty,naproperty"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+	Meta  gin.H  `bson:"-" json:"meta"`
+
+	Roles []AccessControl `bson:"roles" json:"-"`
+}
+
+func (WorkflowJobTemplate) GetType() string {
+	return "workflow_job_template"
+}
+
+func (wt WorkflowJobTemplate) GetRoles() []AccessControl {
+	return wt.Roles
+}
+
+func (wt WorkflowJobTemplate) IsUnique() bool {
+	count, err := db.WorkflowJobTemplates().Find(bson.M{"name": wt.Name, "organization_id": wt.OrganizationID}).Count()
+	if err == nil && count > 0 {
+		return false
+	}
+
+	return true
+}
+
+func (wt WorkflowJobTemplate) OrganizationExist() bool {
+	count, err := db.Organizations().FindId(wt.OrganizationID).Count()
+	if err == nil && count > 0 {
+		return true
+	}
+	return false
+}
+
+// WorkflowJobNode is a node of a workflow job.
+// It tracks the job launched for the node
+type WorkflowJobNode struct {
+	WorkflowNode `bson:",inline"`
+
+	Status string         `bson:"status" json:"status"`
+	JobID  *bson.ObjectId `bson:"job_id,omitempty" json:"job"`
+	// JobType is the type of the launched job, either job or terraform_job
+	JobType string `bson:"job_type,omitempty" json:"job_type"`
+	// Claimed is when a tensord node claimed the node to launch it
+	Claimed *time.Time `bson:"claimed,omitempty" json:"-"`
+}
+
+// WorkflowJob is the model for workflow_jobs collection
+type WorkflowJob struct {
+	ID bson.ObjectId `bson:"_id" json:"id"`
+
+	Name           string    `bson:"name" json:"name"`
+	Description    string    `bson:"description,omitempty" json:"description"`
+	LaunchType     string    `bson:"launch_type" json:"launch_type"`
+	CancelFlag     bool      `bson:"cancel_flag" json:"cancel_flag"`
+	Status         string    `bson:"status" json:"status"`
+	Failed         bool      `bson:"failed" json:"failed"`
+	Started        time.Time `bson:"started" json:"started"`
+	Finished       time.Time `bson:"finished" json:"finished"`
+	JobExplanation string    `bson:"job_explanation" json:"job_explanation"`
+
+	ExtraVars gin.H             `bson:"extra_vars,omitempty" json:"extra_vars"`
+	Nodes     []WorkflowJobNode `bson:"nodes" json:"nodes"`
+
+	WorkflowJobTemplateID bson.ObjectId `bson:"workflow_job_template_id" json:"workflow_job_template"`
+	OrganizationID        bson.ObjectId `bson:"organization_id" json:"organization"`
+
+	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
+	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
+
+	Created  time.Time `bson:"created" json:"created"`
+	Modified time.Time `bson:"modified" json:"modified"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+	Meta  gin.H  `bson:"-" json:"meta"`
+}
+
+func (WorkflowJob) GetType() string {
+	return "workflow_job"
+}
+
+// WorkflowLaunch is the request payload to launch a workflow job template
+type WorkflowLaunch struct {
+	ExtraVars gin.H `bson:"extra_vars,omitempty" json:"extra_vars,omitempty"`
+}
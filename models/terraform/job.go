@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"errors"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,9 +12,14 @@ import (
 
 // Job constants
 const (
-	JobTypeTerraformJob = "terraform_job" // A terraform job
-	JobLaunchTypeManual = "manual"
-	JobLaunchTypeSystem = "system"
+	JobTypeTerraformJob    = "terraform_job" // A terraform job
+	JobLaunchTypeManual    = "manual"
+	JobLaunchTypeSystem    = "system"
+	JobLaunchTypeScheduled = "scheduled"
+	JobLaunchTypeWorkflow  = "workflow"
+	JobLaunchTypeApproval  = "approval"
+	JobTypePlan            = "plan"
+	JobTypeApply           = "apply"
 )
 
 type Job struct {
@@ -39,6 +45,7 @@ type Job struct {
 	UpdateOnLaunch  bool      `bson:"update_on_launch" json:"update_on_launch"`
 	Target          string    `bson:"target" json:"target"`
 	Directory       string    `bson:"directory" json:"directory"`
+	Workspace       string    `bson:"workspace,omitempty" json:"workspace"`
 
 	MachineCredentialID *bson.ObjectId `bson:"credential_id,omitempty" json:"credential"`
 	JobTemplateID       bson.ObjectId  `bson:"job_template_id,omitempty" json:"job_template"`
@@ -52,10 +59,29 @@ type Job struct {
 	PromptVariables   bool `bson:"prompt_variables" json:"ask_variables_on_launch"`
 	AllowSimultaneous bool `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
 
+	// SurveyPasswords are the variables holding encrypted survey password answers
+	SurveyPasswords []string `bson:"survey_passwords,omitempty" json:"-"`
+
+	// StateTokenHash is the hash of the token the job uses to access the terraform state
+	StateTokenHash string `bson:"state_token_hash,omitempty" json:"-"`
+
+	// saved plan of a plan job and the state version the plan was made on
+	PlanFileID       *bson.ObjectId `bson:"plan_file_id,omitempty" json:"-"`
+	PlanStateVersion int            `bson:"plan_state_version,omitempty" json:"plan_state_version"`
+	AppliedJobID     *bson.ObjectId `bson:"applied_job_id,omitempty" json:"applied_job"`
+	// PlanJobID is the plan job whose saved plan is applied by an apply job
+	PlanJobID    *bson.ObjectId `bson:"plan_job_id,omitempty" json:"plan_job"`
+	ApprovedByID *bson.ObjectId `bson:"approved_by_id,omitempty" json:"approved_by"`
+
+	// Outputs are the terraform outputs recorded after a successful apply
+	Outputs map[string]Output `bson:"outputs,omitempty" json:"-"`
+
 	// system generated items
 	JobCWD  string   `bson:"job_cwd" json:"job_cwd"`
 	JobARGS []string `bson:"job_args" json:"job_args"`
 	JobENV  []string `bson:"job_env" json:"job_env"`
+	// ExecutionNode is the hostname of the instance running the job
+	ExecutionNode string `bson:"execution_node,omitempty" json:"execution_node"`
 
 	CreatedByID  bson.ObjectId `bson:"created_by_id" json:"-"`
 	ModifiedByID bson.ObjectId `bson:"modified_by_id" json:"-"`
@@ -78,6 +104,34 @@ func (job Job) GetRoles() []common.AccessControl {
 	return job.Roles
 }
 
+// HasPlan returns true if the job saved a plan
+func (job Job) HasPlan() bool {
+	return job.JobType == JobTypePlan && job.Status == "successful" && job.PlanFileID != nil
+}
+
+// ValidatePlan returns an error if the saved plan of the job can not be applied.
+// A plan is rejected if it is older than maxAge or if the state changed since the plan was made.
+// The error message is safe to be returned to the API client
+func (job Job) ValidatePlan(maxAge time.Duration) error {
+	if !job.HasPlan() {
+		return errors.New("Job has no saved plan")
+	}
+
+	if time.Since(job.Finished) > maxAge {
+		return errors.New("Plan is older than " + maxAge.String())
+	}
+
+	version, err := LatestStateVersion(job.JobTemplateID, job.Workspace)
+	if err != nil {
+		return errors.New("Could not get the terraform state")
+	}
+	if version != job.PlanStateVersion {
+		return errors.New("Terraform state changed since the plan was made")
+	}
+
+	return nil
+}
+
 func (job Job) GetJobTemplate() (JobTemplate, error) {
 	var jobt JobTemplate
 	err := db.TerrafromJobTemplates().FindId(job.JobTemplateID).One(&jobt)
@@ -27,10 +27,16 @@ type JobTemplate struct {
 	PromptCredential    bool           `bson:"prompt_credential,omitempty" json:"ask_credential_on_launch"`
 	PromptJobType       bool           `bson:"prompt_job_type,omitempty" json:"ask_job_type_on_launch"`
 	AllowSimultaneous   bool           `bson:"allow_simultaneous,omitempty" json:"allow_simultaneous"`
+	SurveyEnabled       bool           `bson:"survey_enabled,omitempty" json:"survey_enabled"`
 	Parallelism         uint8          `bson:"parallelism,omitempty" json:"parallelism"`
 	UpdateOnLaunch      bool           `bson:"update_on_launch" json:"update_on_launch"`
 	Target              string         `bson:"target" json:"target"`
 	Directory           string         `bson:"directory" json:"directory"`
+	Workspace           string         `bson:"workspace,omitempty" json:"workspace" binding:"omitempty,terraform_workspace"`
+
+	// SurveySpec is managed through the survey_spec endpoint
+	SurveySpec *common.SurveySpec `bson:"survey_spec,omitempty" json:"-"`
+
 	// output only
 	LastJobRun      *time.Time     `bson:"last_job_run,omitempty" json:"last_job_run" binding:"omitempty,naproperty"`
 	NextJobRun      *time.Time     `bson:"next_job_run,omitempty" json:"next_job_run" binding:"omitempty,naproperty"`
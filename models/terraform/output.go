@@ -0,0 +1,51 @@
+package terraform
+
+import (
+	"github.com/pearsonappeng/tensor/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Output is a terraform output of an apply job.
+// The value of a sensitive output is the encrypted JSON encoded value
+type Output struct {
+	Value     interface{} `bson:"value" json:"value"`
+	Type      interface{} `bson:"type,omitempty" json:"type"`
+	Sensitive bool        `bson:"sensitive" json:"sensitive"`
+}
+
+// MaskOutputs returns a copy of the outputs where the values
+// of sensitive outputs are replaced with $encrypted$
+func MaskOutputs(outputs map[string]Output) map[string]Output {
+	masked := map[string]Output{}
+	for k, o := range outputs {
+		if o.Sensitive {
+			o.Value = "$encrypted$"
+		}
+		masked[k] = o
+	}
+	return masked
+}
+
+// LatestApplyJob returns the latest successful apply job of the terraform job template
+func LatestApplyJob(templateID bson.ObjectId) (Job, error) {
+	var job Job
+	err := db.TerrafromJobs().Find(bson.M{
+		"job_template_id": templateID,
+		"job_type":        JobTypeApply,
+		"status":          "successful",
+	}).Sort("-finished").One(&job)
+	return job, err
+}
+
+// LatestOutputsJob returns the latest successful apply job
+// of the terraform job template that recorded outputs
+func LatestOutputsJob(templateID bson.ObjectId) (Job, error) {
+	var job Job
+	err := db.TerrafromJobs().Find(bson.M{
+		"job_template_id": templateID,
+		"job_type":        JobTypeApply,
+		"status":          "successful",
+		"outputs":         bson.M{"$exists": true},
+	}).Sort("-finished").One(&job)
+	return job, err
+}
@@ -0,0 +1,80 @@
+package terraform
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pearsonappeng/tensor/db"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultWorkspace is the workspace of terraform job templates without a workspace
+const DefaultWorkspace = "default"
+
+// Workspace returns the workspace or the default workspace if it is empty
+func Workspace(workspace string) string {
+	if len(workspace) == 0 {
+		return DefaultWorkspace
+	}
+	return workspace
+}
+
+// LatestStateVersion returns the latest state version of the terraform job template workspace,
+// 0 is returned if the workspace has no state
+func LatestStateVersion(templateID bson.ObjectId, workspace string) (int, error) {
+	var state State
+	err := db.TerraformStates().Find(bson.M{"job_template_id": templateID, "workspace": Workspace(workspace)}).
+		Select(bson.M{"version": 1}).Sort("-version").One(&state)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	}
+	return state.Version, err
+}
+
+// StateAt returns the latest version of the terraform state of the
+// job template workspace that was stored before the given time
+func StateAt(templateID bson.ObjectId, workspace string, t time.Time) (State, error) {
+	var state State
+	err := db.TerraformStates().Find(bson.M{
+		"job_template_id": templateID,
+		"workspace":       Workspace(workspace),
+		"created":         bson.M{"$lte": t},
+	}).Sort("-version").One(&state)
+	return state, err
+}
+
+// State is a version of the terraform state of a terraform job template workspace.
+// Every state pushed by terraform is stored as a new version
+type State struct {
+	ID            bson.ObjectId  `bson:"_id" json:"id"`
+	JobTemplateID bson.ObjectId  `bson:"job_template_id" json:"job_template"`
+	Workspace     string         `bson:"workspace" json:"workspace"`
+	Version       int            `bson:"version" json:"version"`
+	Serial        int64          `bson:"serial" json:"serial"`
+	Lineage       string         `bson:"lineage" json:"lineage"`
+	JobID         *bson.ObjectId `bson:"job_id,omitempty" json:"job"`
+	// State is the raw state document, it may contain secrets
+	State   string    `bson:"state" json:"-"`
+	Created time.Time `bson:"created" json:"created"`
+
+	Type  string `bson:"-" json:"type"`
+	Links gin.H  `bson:"-" json:"links"`
+	Meta  gin.H  `bson:"-" json:"meta"`
+}
+
+func (State) GetType() string {
+	return "terraform_state"
+}
+
+// StateLock is the lock of a terraform job template workspace held by terraform.
+// Info is the raw lock information sent by terraform
+type StateLock struct {
+	ID            bson.ObjectId  `bson:"_id" json:"id"`
+	JobTemplateID bson.ObjectId  `bson:"job_template_id" json:"job_template"`
+	Workspace     string         `bson:"workspace" json:"workspace"`
+	LockID        string         `bson:"lock_id" json:"lock_id"`
+	Info          string         `bson:"info" json:"info"`
+	JobID         *bson.ObjectId `bson:"job_id,omitempty" json:"job"`
+	Created       time.Time      `bson:"created" json:"created"`
+}
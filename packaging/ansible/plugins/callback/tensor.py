@@ -0,0 +1,138 @@
+# Tensor callback plugin
+#
+# Records playbook events of a Tensor job by sending them to the
+# Tensor REST API. The plugin is enabled for every job through
+# ANSIBLE_CALLBACK_PLUGINS and reads the job and API details from the
+# environment set by the job runner:
+#
+#   REST_API_URL       base url of the Tensor API
+#   REST_API_TOKEN     token used to authenticate to the API
+#   JOB_ID             id of the running job
+#   AD_HOC_COMMAND_ID  id of the running ad hoc command, set instead of
+#                      JOB_ID when the ansible command is run
+#
+# Failures while sending events are reported as warnings and never
+# fail the playbook.
+
+from __future__ import (absolute_import, division, print_function)
+__metaclass__ = type
+
+import json
+import os
+
+try:
+    import requests
+except ImportError:
+    requests = None
+
+from ansible.plugins.callback import CallbackBase
+
+
+class CallbackModule(CallbackBase):
+
+    CALLBACK_VERSION = 2.0
+    CALLBACK_TYPE = 'notification'
+    CALLBACK_NAME = 'tensor'
+    CALLBACK_NEEDS_WHITELIST = False
+
+    def __init__(self, display=None):
+        super(CallbackModule, self).__init__(display)
+
+        self.base_url = os.environ.get('REST_API_URL', '').rstrip('/')
+        self.token = os.environ.get('REST_API_TOKEN', '')
+        self.job_id = os.environ.get('JOB_ID', '')
+        self.ad_hoc_command_id = os.environ.get('AD_HOC_COMMAND_ID', '')
+
+        self.disabled = not (requests and self.base_url and self.token and
+                             (self.job_id or self.ad_hoc_command_id))
+        self.counter = 0
+        self.play = ''
+        self.task = ''
+        self.role = ''
+
+        if requests:
+            self.session = requests.Session()
+            self.session.headers.update({
+                'Authorization': 'Bearer %s' % self.token,
+                'Content-Type': 'application/json',
+            })
+
+    def _url(self):
+        if self.ad_hoc_command_id:
+            return '%s/v1/ad_hoc_commands/%s/events' % (self.base_url, self.ad_hoc_command_id)
+        return '%s/v1/jobs/%s/job_events' % (self.base_url, self.job_id)
+
+    def _send(self, event, host=None, result=None, failed=False, changed=False, data=None):
+        if self.disabled:
+            return
+
+        self.counter += 1
+        payload = {
+            'event': event,
+            'counter': self.counter,
+            'play': self.play,
+            'task': self.task,
+            'role': self.role,
+            'failed': failed,
+            'changed': changed,
+        }
+        if host is not None:
+            payload['host_name'] = host
+        if result is not None:
+            payload['event_data'] = {'res': result}
+        if data is not None:
+            payload['event_data'] = data
+
+        try:
+            r = self.session.post(self._url(), data=json.dumps(payload, default=str), timeout=30)
+            if r.status_code >= 300:
+                self._display.warning('Tensor: could not record %s event, status %d' % (event, r.status_code))
+        except Exception as e:
+            self._display.warning('Tensor: could not record %s event: %s' % (event, e))
+
+    def _runner_event(self, event, result, failed=False):
+        res = getattr(result, '_result', {}) or {}
+        self._send(event,
+                   host=result._host.get_name(),
+                   result=res,
+                   failed=failed,
+                   changed=bool(res.get('changed', False)))
+
+    def v2_playbook_on_start(self, playbook):
+        self._send('playbook_on_start', data={'playbook': getattr(playbook, '_file_name', '')})
+
+    def v2_playbook_on_play_start(self, play):
+        self.play = play.get_name().strip()
+        self.task = ''
+        self.role = ''
+        self._send('playbook_on_play_start')
+
+    def v2_playbook_on_task_start(self, task, is_conditional):
+        self.task = task.get_name().strip()
+        role = getattr(task, '_role', None)
+        self.role = role.get_name() if role else ''
+        self._send('playbook_on_task_start')
+
+    def v2_playbook_on_handler_task_start(self, task):
+        self.v2_playbook_on_task_start(task, False)
+
+    def v2_runner_on_ok(self, result):
+        self._runner_event('runner_on_ok', result)
+
+    def v2_runner_on_failed(self, result, ignore_errors=False):
+        self._runner_event('runner_on_failed', result, failed=not ignore_errors)
+
+    def v2_runner_on_skipped(self, result):
+        self._runner_event('runner_on_skipped', result)
+
+    def v2_runner_on_unreachable(self, result):
+        self._runner_event('runner_on_unreachable', result, failed=True)
+
+    def v2_playbook_on_stats(self, stats):
+        hosts = {}
+        for host in sorted(stats.processed.keys()):
+            hosts[host] = stats.summarize(host)
+        self.play = ''
+        self.task = ''
+        self.role = ''
+        self._send('playbook_on_stats', data={'hosts': hosts})
@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"sync"
+)
+
+// Memory is a Queue stored in the memory of the process,
+// it is used by single node installations and tests.
+// Messages are lost when the process exits
+type Memory struct {
+	mu     sync.Mutex
+	queues map[string]*memoryQueue
+	closed bool
+	done   chan struct{}
+}
+
+type memoryQueue struct {
+	mu       sync.Mutex
+	messages [][]byte
+	// ready is signaled when messages are available
+	ready chan struct{}
+}
+
+// NewMemory returns an empty in-memory queue
+func NewMemory() *Memory {
+	return &Memory{
+		queues: map[string]*memoryQueue{},
+		done:   make(chan struct{}),
+	}
+}
+
+func (m *Memory) queue(name string) *memoryQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[name]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{}, 1)}
+		m.queues[name] = q
+	}
+	return q
+}
+
+// Len returns the number of messages waiting in the queue
+func (m *Memory) Len(name string) int {
+	q := m.queue(name)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages)
+}
+
+func (q *memoryQueue) push(body []byte, front bool) {
+	q.mu.Lock()
+	if front {
+		q.messages = append([][]byte{body}, q.messages...)
+	} else {
+		q.messages = append(q.messages, body)
+	}
+	q.mu.Unlock()
+	q.signal()
+}
+
+func (q *memoryQueue) pop() ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.messages) == 0 {
+		return nil, false
+	}
+	body := q.messages[0]
+	q.messages = q.messages[1:]
+	// wake the next consumer
+	if len(q.messages) > 0 {
+		q.signal()
+	}
+	return body, true
+}
+
+func (q *memoryQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Publish appends the message to the queue
+func (m *Memory) Publish(name string, body []byte) error {
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return ErrNotConnected
+	}
+
+	m.queue(name).push(append([]byte{}, body...), false)
+	return nil
+}
+
+// Consume delivers the messages of the queue in order
+func (m *Memory) Consume(name string, prefetch int) (<-chan Delivery, error) {
+	if prefetch < 1 {
+		prefetch = 1
+	}
+	q := m.queue(name)
+	out := make(chan Delivery)
+	// unacknowledged deliveries
+	slots := make(chan struct{}, prefetch)
+
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case slots <- struct{}{}:
+			case <-m.done:
+				return
+			}
+
+			body, ok := q.pop()
+			for !ok {
+				select {
+				case <-q.ready:
+				case <-m.done:
+					return
+				}
+				body, ok = q.pop()
+			}
+
+			d := &memoryDelivery{body: body, memory: m, queue: q, name: name, slots: slots}
+			select {
+			case out <- d:
+			case <-m.done:
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Close stops the consumers, waiting messages are kept
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.done)
+	}
+	return nil
+}
+
+type memoryDelivery struct {
+	body   []byte
+	memory *Memory
+	queue  *memoryQueue
+	name   string
+	slots  chan struct{}
+	once   sync.Once
+}
+
+func (d *memoryDelivery) Body() []byte {
+	return d.body
+}
+
+func (d *memoryDelivery) settle(settle func()) error {
+	d.once.Do(func() {
+		settle()
+		<-d.slots
+	})
+	return nil
+}
+
+func (d *memoryDelivery) Ack() error {
+	return d.settle(func() {})
+}
+
+func (d *memoryDelivery) Reject() error {
+	return d.settle(func() {
+		d.queue.push(d.body, true)
+	})
+}
+
+func (d *memoryDelivery) DeadLetter() error {
+	return d.settle(func() {
+		d.memory.queue(d.name+deadLetterSuffix).push(d.body, false)
+	})
+}
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pearsonappeng/tensor/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func receive(t *testing.T, msgs <-chan Delivery) Delivery {
+	select {
+	case d := <-msgs:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no message delivered")
+	}
+	return nil
+}
+
+func nothing(t *testing.T, msgs <-chan Delivery) {
+	select {
+	case d := <-msgs:
+		t.Fatalf("unexpected message %s", d.Body())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMemoryPublishConsume(t *testing.T) {
+	q := NewMemory()
+	defer q.Close()
+
+	assert.NoError(t, q.Publish(Ansible, []byte("1")))
+	assert.NoError(t, q.Publish(Ansible, []byte("2")))
+	assert.NoError(t, q.Publish(Terraform, []byte("tf")))
+
+	msgs, err := q.Consume(Ansible, 1)
+	assert.NoError(t, err)
+
+	d := receive(t, msgs)
+	assert.Equal(t, "1", string(d.Body()))
+	// prefetch 1, the next message waits for the ack
+	nothing(t, msgs)
+	assert.NoError(t, d.Ack())
+
+	d = receive(t, msgs)
+	assert.Equal(t, "2", string(d.Body()))
+	assert.NoError(t, d.Ack())
+	assert.Equal(t, 0, q.Len(Ansible))
+	assert.Equal(t, 1, q.Len(Terraform))
+
+	// messages published while consuming are delivered
+	assert.NoError(t, q.Publish(Ansible, []byte("3")))
+	assert.Equal(t, "3", string(receive(t, msgs).Body()))
+}
+
+func TestMemoryPrefetch(t *testing.T) {
+	q := NewMemory()
+	defer q.Close()
+
+	for _, m := range []string{"1", "2", "3"} {
+		assert.NoError(t, q.Publish(Ansible, []byte(m)))
+	}
+
+	msgs, err := q.Consume(Ansible, 2)
+	assert.NoError(t, err)
+
+	first := receive(t, msgs)
+	receive(t, msgs)
+	nothing(t, msgs)
+
+	assert.NoError(t, first.Ack())
+	assert.Equal(t, "3", string(receive(t, msgs).Body()))
+}
+
+func TestMemoryRejectDeadLetter(t *testing.T) {
+	q := NewMemory()
+	defer q.Close()
+
+	assert.NoError(t, q.Publish(Ansible, []byte("1")))
+	assert.NoError(t, q.Publish(Ansible, []byte("2")))
+
+	msgs, err := q.Consume(Ansible, 1)
+	assert.NoError(t, err)
+
+	// rejected messages are delivered again first
+	d := receive(t, msgs)
+	assert.NoError(t, d.Reject())
+	d = receive(t, msgs)
+	assert.Equal(t, "1", string(d.Body()))
+
+	assert.NoError(t, d.DeadLetter())
+	// settling a delivery twice has no effect
+	assert.NoError(t, d.Reject())
+	assert.Equal(t, 1, q.Len(Ansible+deadLetterSuffix))
+
+	assert.Equal(t, "2", string(receive(t, msgs).Body()))
+	assert.Equal(t, 1, q.Len(Ansible+deadLetterSuffix))
+}
+
+func TestMemoryClose(t *testing.T) {
+	q := NewMemory()
+	msgs, err := q.Consume(Ansible, 1)
+	assert.NoError(t, err)
+
+	assert.NoError(t, q.Close())
+	select {
+	case _, ok := <-msgs:
+		assert.False(t, ok, "deliveries are closed")
+	case <-time.After(time.Second):
+		t.Fatal("deliveries are not closed")
+	}
+	assert.Error(t, q.Publish(Ansible, []byte("1")))
+}
+
+func TestNotConnected(t *testing.T) {
+	broker = nil
+	assert.Equal(t, ErrNotConnected, Publish(Ansible, []byte("1")))
+	_, err := Consume(Ansible, 1)
+	assert.Equal(t, ErrNotConnected, err)
+}
+
+func TestConnectMemoryRole(t *testing.T) {
+	queue, role := util.Config.Queue, util.Config.Role
+	defer func() {
+		util.Config.Queue, util.Config.Role = queue, role
+		broker = nil
+	}()
+
+	util.Config.Queue = BackendMemory
+	for _, r := range []string{util.RoleAPI, util.RoleWorker} {
+		util.Config.Role = r
+		assert.Error(t, Connect(), r)
+	}
+
+	util.Config.Role = util.RoleAll
+	assert.NoError(t, Connect())
+	assert.NoError(t, Close())
+}
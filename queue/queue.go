@@ -1,9 +1,9 @@
 package queue
 
 import (
-	"github.com/Sirupsen/logrus"
+	"errors"
+
 	"github.com/pearsonappeng/tensor/util"
-	"github.com/streadway/amqp"
 )
 
 const (
@@ -11,86 +11,95 @@ const (
 	Ansible = "ansible"
 	// Terraform is the redis queue which stores jobs
 	Terraform = "terraform"
+	// AdHoc is the queue which stores ad hoc commands
+	AdHoc = "ad_hoc"
+	// InventoryUpdate is the queue which stores inventory source updates
+	InventoryUpdate = "inventory_update"
 )
 
-// TestConnect will test the connectivity to rabbitmq
-func TestConnect() (err error) {
-	conn, err := amqp.Dial(util.Config.RabbitMQ)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
+// Queue backends
+const (
+	BackendRabbitMQ = "rabbitmq"
+	BackendMemory   = "memory"
+)
 
-	ch, err := conn.Channel()
-	if err != nil {
-		return
-	}
-	defer ch.Close()
-	return
-}
+// deadLetterSuffix is appended to the name of a queue to get
+// the queue storing its dead-lettered messages
+const deadLetterSuffix = ".dead"
 
-// Publish publishes a given json message to a given queue
-// accepts string and array of bytes and returns a cleanup function and error
-func Publish(name string, job []byte) (err error) {
-	conn, err := amqp.Dial(util.Config.RabbitMQ)
+// Queue is a message broker storing the messages of named queues.
+// Queues are declared when they are first used
+type Queue interface {
+	// Publish stores a persistent message in the queue
+	Publish(name string, body []byte) error
+	// Consume delivers the messages of the queue, at most prefetch messages
+	// are delivered without being acknowledged. The channel is closed
+	// only when the queue is closed, lost connections are reestablished
+	Consume(name string, prefetch int) (<-chan Delivery, error)
+	// Close stops the consumers and closes the connections
+	Close() error
+}
 
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Queue": name,
-			"Error": err.Error(),
-		}).Infoln("Could not contact RabbitMQ server")
-		return
-	}
+// Delivery is a message delivered by a consumer,
+// every delivery must be acknowledged, rejected or dead-lettered
+type Delivery interface {
+	Body() []byte
+	// Ack removes the message from the queue
+	Ack() error
+	// Reject requeues the message
+	Reject() error
+	// DeadLetter moves the message to the dead letter queue,
+	// it is used for messages that can never be processed
+	DeadLetter() error
+}
 
-	defer conn.Close()
+// ErrNotConnected is returned when the queue is used before Connect
+var ErrNotConnected = errors.New("queue is not connected")
 
-	ch, err := conn.Channel()
+var broker Queue
 
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Queue": name,
-			"Error": err.Error(),
-		}).Infoln("Failed to open a channel")
-		return
+// Connect connects to the queue backend set in the configuration.
+// The memory backend is only shared inside the process, therefore it
+// requires the node to run both the API and the workers
+func Connect() error {
+	switch util.Config.Queue {
+	case BackendMemory:
+		if util.Config.Role != util.RoleAll {
+			return errors.New("queue backend " + BackendMemory + " requires role " + util.RoleAll)
+		}
+		broker = NewMemory()
+		return nil
+	case BackendRabbitMQ, "":
+		q, err := NewRabbitMQ(util.Config.RabbitMQ)
+		if err != nil {
+			return err
+		}
+		broker = q
+		return nil
 	}
+	return errors.New("unknown queue backend " + util.Config.Queue)
+}
 
-	defer ch.Close()
-
-	q, err := ch.QueueDeclare(
-		name,  // name
-		true,  // durable
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Queue": name,
-			"Error": err.Error(),
-		}).Infoln("Failed to declare a queue")
-		return
+// Close closes the connected queue
+func Close() error {
+	if broker == nil {
+		return ErrNotConnected
 	}
+	return broker.Close()
+}
 
-	err = ch.Publish(
-		"",     // exchange
-		q.Name, // routing key
-		false,  // mandatory
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "text/plain",
-			Body:         job,
-		})
-
-	if err != nil {
-		logrus.WithFields(logrus.Fields{
-			"Queue": name,
-			"Error": err.Error(),
-		}).Infoln("Failed to publish a message")
-		return
+// Publish publishes a given json message to a given queue
+func Publish(name string, job []byte) error {
+	if broker == nil {
+		return ErrNotConnected
 	}
+	return broker.Publish(name, job)
+}
 
-	return
+// Consume returns the deliveries of a given queue
+func Consume(name string, prefetch int) (<-chan Delivery, error) {
+	if broker == nil {
+		return nil, ErrNotConnected
+	}
+	return broker.Consume(name, prefetch)
 }
@@ -0,0 +1,306 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// poolSize is the number of idle channels kept for publishing
+const poolSize = 8
+
+// maxReconnectDelay is the maximum delay between reconnection attempts
+const maxReconnectDelay = 30 * time.Second
+
+// RabbitMQ is a Queue stored by a RabbitMQ server.
+// A single connection is shared by the publishers and the consumers,
+// it is reestablished when it is lost. Publishing channels are pooled
+type RabbitMQ struct {
+	url string
+
+	mu     sync.Mutex
+	conn   *amqp.Connection
+	lost   chan *amqp.Error
+	pool   []pooledChannel
+	closed bool
+	done   chan struct{}
+}
+
+type pooledChannel struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+// NewRabbitMQ connects to the RabbitMQ server
+func NewRabbitMQ(url string) (*RabbitMQ, error) {
+	r := &RabbitMQ{url: url, done: make(chan struct{})}
+	if _, err := r.connection(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// connection returns the open connection, the server is dialed
+// if there is no connection or the connection is lost
+func (r *RabbitMQ) connection() (*amqp.Connection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	if r.conn != nil {
+		select {
+		case <-r.lost:
+			r.conn = nil
+			r.pool = nil
+		default:
+			return r.conn, nil
+		}
+	}
+
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return nil, err
+	}
+	r.conn = conn
+	r.lost = conn.NotifyClose(make(chan *amqp.Error, 1))
+	return conn, nil
+}
+
+// channel returns an idle channel of the open connection
+func (r *RabbitMQ) channel() (pooledChannel, error) {
+	conn, err := r.connection()
+	if err != nil {
+		return pooledChannel{}, err
+	}
+
+	r.mu.Lock()
+	for len(r.pool) > 0 {
+		pc := r.pool[len(r.pool)-1]
+		r.pool = r.pool[:len(r.pool)-1]
+		if pc.conn == conn {
+			r.mu.Unlock()
+			return pc, nil
+		}
+	}
+	r.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return pooledChannel{}, err
+	}
+	return pooledChannel{conn: conn, ch: ch}, nil
+}
+
+// release returns the channel to the pool
+func (r *RabbitMQ) release(pc pooledChannel) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || pc.conn != r.conn || len(r.pool) >= poolSize {
+		pc.ch.Close()
+		return
+	}
+	r.pool = append(r.pool, pc)
+}
+
+// Publish publishes the message, it is retried once
+// on a new connection if the connection was lost
+func (r *RabbitMQ) Publish(name string, body []byte) (err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = r.publish(name, body); err == nil {
+			return nil
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"Queue": name,
+		"Error": err.Error(),
+	}).Infoln("Failed to publish a message")
+	return err
+}
+
+func (r *RabbitMQ) publish(name string, body []byte) error {
+	pc, err := r.channel()
+	if err != nil {
+		return err
+	}
+
+	if _, err := declare(pc.ch, name); err != nil {
+		pc.ch.Close()
+		return err
+	}
+
+	err = pc.ch.Publish(
+		"",    // exchange
+		name,  // routing key
+		false, // mandatory
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "text/plain",
+			Body:         body,
+		})
+	if err != nil {
+		pc.ch.Close()
+		return err
+	}
+
+	r.release(pc)
+	return nil
+}
+
+// Consume starts a consumer of the queue. The consumer is started again
+// with increasing delays if the connection or the channel is lost
+func (r *RabbitMQ) Consume(name string, prefetch int) (<-chan Delivery, error) {
+	out := make(chan Delivery)
+
+	go func() {
+		defer close(out)
+		delay := time.Second
+		for {
+			started, err := r.consume(name, prefetch, out)
+			if started {
+				delay = time.Second
+			}
+
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+
+			fields := logrus.Fields{"Queue": name, "Retry": delay.String()}
+			if err != nil {
+				fields["Error"] = err.Error()
+			}
+			logrus.WithFields(fields).Warningln("Consumer stopped, reconnecting")
+
+			select {
+			case <-r.done:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// consume delivers the messages of the queue until the channel is closed,
+// it returns whether the consumer was started
+func (r *RabbitMQ) consume(name string, prefetch int, out chan<- Delivery) (bool, error) {
+	conn, err := r.connection()
+	if err != nil {
+		return false, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+
+	if _, err := declare(ch, name); err != nil {
+		return false, err
+	}
+
+	if err := ch.Qos(
+		prefetch, // prefetch count
+		0,        // prefetch size
+		false,    // global
+	); err != nil {
+		return false, err
+	}
+
+	msgs, err := ch.Consume(
+		name,  // queue
+		"",    // consumer
+		false, // auto-ack
+		false, // exclusive
+		false, // no-local
+		false, // no-wait
+		nil,   // args
+	)
+	if err != nil {
+		return false, err
+	}
+
+	for {
+		select {
+		case <-r.done:
+			return true, nil
+		case d, ok := <-msgs:
+			if !ok {
+				return true, nil
+			}
+			select {
+			case out <- &rabbitDelivery{d: d, queue: r, name: name}:
+			case <-r.done:
+				return true, nil
+			}
+		}
+	}
+}
+
+// Close stops the consumers and closes the connection
+func (r *RabbitMQ) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	r.pool = nil
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
+}
+
+func declare(ch *amqp.Channel, name string) (amqp.Queue, error) {
+	return ch.QueueDeclare(
+		name,  // name
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+}
+
+type rabbitDelivery struct {
+	d     amqp.Delivery
+	queue *RabbitMQ
+	name  string
+}
+
+func (d *rabbitDelivery) Body() []byte {
+	return d.d.Body
+}
+
+func (d *rabbitDelivery) Ack() error {
+	return d.d.Ack(false)
+}
+
+func (d *rabbitDelivery) Reject() error {
+	return d.d.Reject(true)
+}
+
+// DeadLetter publishes the message to the dead letter queue and removes it from the queue.
+// The message is published since the arguments of existing queues can not be changed
+// to use a dead letter exchange
+func (d *rabbitDelivery) DeadLetter() error {
+	if err := d.queue.Publish(d.name+deadLetterSuffix, d.d.Body); err != nil {
+		d.d.Reject(false)
+		return err
+	}
+	return d.d.Ack(false)
+}
@@ -62,6 +62,10 @@ func (Credential) Read(user common.User, credential common.Credential) bool {
 }
 
 func (Credential) Write(user common.User, credential common.Credential) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
@@ -69,3 +69,14 @@ func HasGlobalRead(user common.User) bool {
 func HasGlobalWrite(user common.User) bool {
 	return user.IsSuperUser
 }
+
+// HasWriteScope returns whether the user may change resources. Users authenticated
+// with a personal access token are limited by the scope of the token
+func HasWriteScope(user common.User) bool {
+	return user.TokenScope == "" || user.TokenScope == common.TokenScopeWrite
+}
+
+// HasLaunchScope returns whether the user may launch jobs
+func HasLaunchScope(user common.User) bool {
+	return HasWriteScope(user) || user.TokenScope == common.TokenScopeLaunch
+}
@@ -13,6 +13,7 @@ const (
 	InventoryAdmin  = "admin"
 	InventoryUse    = "use"
 	InventoryUpdate = "update"
+	InventoryAdHoc  = "ad_hoc"
 )
 
 type Inventory struct{}
@@ -59,6 +60,10 @@ func (Inventory) Read(user common.User, inventory ansible.Inventory) bool {
 }
 
 func (Inventory) Write(user common.User, inventory ansible.Inventory) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// Allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
@@ -99,6 +104,41 @@ func (Inventory) Write(user common.User, inventory ansible.Inventory) bool {
 	return false
 }
 
+// AdHoc checks whether the user can run ad hoc commands on the hosts of the inventory
+func (Inventory) AdHoc(user common.User, inventory ansible.Inventory) bool {
+	if !HasLaunchScope(user) {
+		return false
+	}
+
+	if HasGlobalWrite(user) {
+		return true
+	}
+
+	// organization admins can run ad hoc commands on all inventories of the organization
+	if IsOrganizationAdmin(inventory.OrganizationID, user.ID) {
+		return true
+	}
+
+	var teams []bson.ObjectId
+	for _, v := range inventory.Roles {
+		if v.Type == RoleTypeTeam && (v.Role == InventoryAdmin || v.Role == InventoryAdHoc) {
+			teams = append(teams, v.GranteeID)
+		}
+
+		if v.Type == RoleTypeUser && v.GranteeID == user.ID && (v.Role == InventoryAdmin || v.Role == InventoryAdHoc) {
+			return true
+		}
+	}
+
+	// check team permissions of the user,
+	// and team has admin and ad hoc privileges
+	if IsInTeams(user.ID, teams) {
+		return true
+	}
+
+	return false
+}
+
 func (i Inventory) ReadByID(user common.User, inventoryID bson.ObjectId) bool {
 	var inventory ansible.Inventory
 	if err := db.Inventories().FindId(inventoryID).One(&inventory); err != nil {
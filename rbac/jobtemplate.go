@@ -83,6 +83,10 @@ func (JobTemplate) Read(user common.User, jtemplate ansible.JobTemplate) bool {
 }
 
 func (JobTemplate) Write(user common.User, jtemplate ansible.JobTemplate) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// Allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
@@ -0,0 +1,127 @@
+package rbac
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	NotificationTemplateAdmin = "admin"
+	NotificationTemplateRead  = "read"
+)
+
+type NotificationTemplate struct{}
+
+func (NotificationTemplate) Read(user common.User, template common.NotificationTemplate) bool {
+	// Allow access if the user is super user or
+	// a system auditor
+	if HasGlobalRead(user) {
+		return true
+	}
+
+	// any member of the organization can read the notification template
+	if HasOrganizationRead(template.OrganizationID, user.ID) {
+		return true
+	}
+
+	var teams []bson.ObjectId
+	// check whether the user has access to object
+	// using roles list
+	// if object has granted team get those teams to list
+	for _, v := range template.GetRoles() {
+		if v.Type == RoleTypeTeam {
+			teams = append(teams, v.GranteeID)
+		}
+
+		if v.Type == RoleTypeUser && v.GranteeID == user.ID {
+			return true
+		}
+	}
+
+	// check team permissions of the user
+	if IsInTeams(user.ID, teams) {
+		return true
+	}
+
+	return false
+}
+
+func (NotificationTemplate) Write(user common.User, template common.NotificationTemplate) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
+	// Allow access if the user is super user
+	if HasGlobalWrite(user) {
+		return true
+	}
+
+	// check whether the user is an member of the objects' organization
+	// since this is write permission it is must user need to be an admin
+	if IsOrganizationAdmin(template.OrganizationID, user.ID) {
+		return true
+	}
+
+	var teams []bson.ObjectId
+	// check whether the user has access to object
+	// using roles list
+	// if object has granted team get those teams to list
+	for _, v := range template.GetRoles() {
+		if v.Type == RoleTypeTeam && v.Role == NotificationTemplateAdmin {
+			teams = append(teams, v.GranteeID)
+		}
+
+		if v.Type == RoleTypeUser && v.GranteeID == user.ID && v.Role == NotificationTemplateAdmin {
+			return true
+		}
+	}
+
+	// check team permissions of the user,
+	// and team has admin privileges
+	if IsInTeams(user.ID, teams) {
+		return true
+	}
+
+	return false
+}
+
+func (n NotificationTemplate) ReadByID(user common.User, templateID bson.ObjectId) bool {
+	var template common.NotificationTemplate
+	if err := db.NotificationTemplates().FindId(templateID).One(&template); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		})
+		return false
+	}
+	return n.Read(user, template)
+}
+
+func (NotificationTemplate) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
+	access := bson.M{"$addToSet": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
+
+	if err = db.NotificationTemplates().UpdateId(resourceID, access); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Resource ID": resourceID,
+			"Role Type":   roleType,
+			"Error":       err.Error(),
+		}).Errorln("Unable to assign the role, an error occured")
+	}
+
+	return
+}
+
+func (NotificationTemplate) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
+	access := bson.M{"$pull": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
+
+	if err = db.NotificationTemplates().UpdateId(resourceID, access); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Resource ID": resourceID,
+			"Role Type":   roleType,
+			"Error":       err.Error(),
+		}).Errorln("Unable to disassociate role")
+	}
+
+	return
+}
@@ -33,6 +33,10 @@ func (Organization) Read(user common.User, organization common.Organization) boo
 }
 
 func (Organization) Write(user common.User, organization common.Organization) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// Allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
@@ -61,6 +61,10 @@ func (Project) Read(user common.User, project common.Project) bool {
 }
 
 func (Project) Write(user common.User, project common.Project) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
@@ -105,6 +109,10 @@ func (Project) Write(user common.User, project common.Project) bool {
 }
 
 func (Project) Update(user common.User, project common.Project) bool {
+	if !HasLaunchScope(user) {
+		return false
+	}
+
 	// allow access if the user is super user or
 	// a system auditor
 	if user.IsSuperUser {
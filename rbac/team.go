@@ -45,6 +45,10 @@ func (Team) Read(user common.User, team common.Team) bool {
 }
 
 func (Team) Write(user common.User, team common.Team) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
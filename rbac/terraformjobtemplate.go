@@ -74,6 +74,10 @@ func (TerraformJobTemplate) Read(user common.User, jtemplate terraform.JobTempla
 }
 
 func (TerraformJobTemplate) Write(user common.User, jtemplate terraform.JobTemplate) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// Allow access if the user is super user or
 	// a system auditor
 	if HasGlobalWrite(user) {
@@ -141,6 +145,12 @@ func (j TerraformJobTemplate) WriteByID(user common.User, templateID bson.Object
 	return j.Write(user, template)
 }
 
+// ReadState returns true if the user can read the terraform state of the job template.
+// The state may contain secrets, it can only be read by users with write permission
+func (j TerraformJobTemplate) ReadState(user common.User, template terraform.JobTemplate) bool {
+	return j.Write(user, template)
+}
+
 func (TerraformJobTemplate) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
 	access := bson.M{"$addToSet": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
 
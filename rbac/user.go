@@ -25,6 +25,10 @@ func (User) Read(user common.User, object common.User) bool {
 }
 
 func (User) Write(user common.User, object common.User) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
 	// allow access if the user is super user or
 	// a system auditor
 	if user.IsSuperUser || user.IsSystemAuditor || user.ID == object.ID {
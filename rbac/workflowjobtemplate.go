@@ -0,0 +1,156 @@
+package rbac
+
+import (
+	"github.com/Sirupsen/logrus"
+	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/models/common"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	WorkflowJobTemplateAdmin   = "admin"
+	WorkflowJobTemplateExecute = "execute"
+)
+
+type WorkflowJobTemplate struct{}
+
+func (WorkflowJobTemplate) Read(user common.User, wtemplate common.WorkflowJobTemplate) bool {
+	// Allow access if the user is super user or
+	// a system auditor
+	if HasGlobalRead(user) {
+		return true
+	}
+
+	// any member of the organization can read the workflow job template
+	if HasOrganizationRead(wtemplate.OrganizationID, user.ID) {
+		return true
+	}
+
+	var teams []bson.ObjectId
+	// check whether the user has access to object
+	// using roles list
+	// if object has granted team get those teams to list
+	for _, v := range wtemplate.GetRoles() {
+		if v.Type == RoleTypeTeam {
+			teams = append(teams, v.GranteeID)
+		}
+
+		if v.Type == RoleTypeUser && v.GranteeID == user.ID {
+			return true
+		}
+	}
+
+	// check team permissions of the user
+	if IsInTeams(user.ID, teams) {
+		return true
+	}
+
+	return false
+}
+
+func (WorkflowJobTemplate) Write(user common.User, wtemplate common.WorkflowJobTemplate) bool {
+	if !HasWriteScope(user) {
+		return false
+	}
+
+	// Allow access if the user is super user
+	if HasGlobalWrite(user) {
+		return true
+	}
+
+	// check whether the user is an member of the objects' organization
+	// since this is write permission it is must user need to be an admin
+	if IsOrganizationAdmin(wtemplate.OrganizationID, user.ID) {
+		return true
+	}
+
+	var teams []bson.ObjectId
+	// check whether the user has access to object
+	// using roles list
+	// if object has granted team get those teams to list
+	for _, v := range wtemplate.GetRoles() {
+		if v.Type == RoleTypeTeam && (v.Role == WorkflowJobTemplateAdmin || v.Role == WorkflowJobTemplateExecute) {
+			teams = append(teams, v.GranteeID)
+		}
+
+		if v.Type == RoleTypeUser && v.GranteeID == user.ID && (v.Role == WorkflowJobTemplateAdmin || v.Role == WorkflowJobTemplateExecute) {
+			return true
+		}
+	}
+
+	// check team permissions of the user,
+	// and team has admin and execute privileges
+	if IsInTeams(user.ID, teams) {
+		return true
+	}
+
+	return false
+}
+
+func (w WorkflowJobTemplate) ReadByID(user common.User, templateID bson.ObjectId) bool {
+	var template common.WorkflowJobTemplate
+	if err := db.WorkflowJobTemplates().FindId(templateID).One(&template); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		})
+		return false
+	}
+	return w.Read(user, template)
+}
+
+// Nodes checks whether the user can run every node of the workflow.
+// Job templates and terraform job templates require execute permission
+// and projects require update permission
+func (WorkflowJobTemplate) Nodes(user common.User, nodes []common.WorkflowNode) bool {
+	for _, node := range nodes {
+		switch node.TemplateType {
+		case common.WorkflowNodeJobTemplate:
+			if !new(JobTemplate).WriteByID(user, node.TemplateID) {
+				return false
+			}
+		case common.WorkflowNodeTerraformJobTemplate:
+			if !new(TerraformJobTemplate).WriteByID(user, node.TemplateID) {
+				return false
+			}
+		case common.WorkflowNodeProject:
+			var project common.Project
+			if err := db.Projects().FindId(node.TemplateID).One(&project); err != nil {
+				return false
+			}
+			if !new(Project).Update(user, project) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (WorkflowJobTemplate) Associate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
+	access := bson.M{"$addToSet": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
+
+	if err = db.WorkflowJobTemplates().UpdateId(resourceID, access); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Resource ID": resourceID,
+			"Role Type":   roleType,
+			"Error":       err.Error(),
+		}).Errorln("Unable to assign the role, an error occured")
+	}
+
+	return
+}
+
+func (WorkflowJobTemplate) Disassociate(resourceID bson.ObjectId, grantee bson.ObjectId, roleType string, role string) (err error) {
+	access := bson.M{"$pull": bson.M{"roles": common.AccessControl{Type: roleType, GranteeID: grantee, Role: role}}}
+
+	if err = db.WorkflowJobTemplates().UpdateId(resourceID, access); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Resource ID": resourceID,
+			"Role Type":   roleType,
+			"Error":       err.Error(),
+		}).Errorln("Unable to disassociate role")
+	}
+
+	return
+}
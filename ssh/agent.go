@@ -5,21 +5,31 @@ import (
 	"github.com/ScaleFT/sshkeys"
 	"github.com/Sirupsen/logrus"
 	"golang.org/x/crypto/ssh/agent"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 )
 
 // startAgent executes ssh-agent, and returns a Agent interface to it.
-func StartAgent() (client agent.Agent, socket string, pid int, cleanup func()) {
+// The socket and the pid of the agent are stored in a directory
+// of /tmp whose name starts with prefix
+func StartAgent(prefix string) (client agent.Agent, socket string, pid int, cleanup func()) {
 	bin, err := exec.LookPath("ssh-agent")
 	if err != nil {
 		logrus.Errorln("could not find ssh-agent")
 	}
 
-	cmd := exec.Command(bin, "-s")
+	dir, err := ioutil.TempDir("/tmp", prefix)
+	if err != nil {
+		logrus.Errorf("ioutil.TempDir: %v", err)
+	}
+
+	cmd := exec.Command(bin, "-s", "-a", filepath.Join(dir, "agent.sock"))
 	out, err := cmd.Output()
 	if err != nil {
 		logrus.Errorf("cmd.Output: %v", err)
@@ -48,6 +58,9 @@ func StartAgent() (client agent.Agent, socket string, pid int, cleanup func()) {
 	if err != nil {
 		logrus.Infof("Atoi(%q): %v", pidStr, err)
 	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "agent.pid"), pidStr, 0600); err != nil {
+		logrus.Infof("ioutil.WriteFile: %v", err)
+	}
 
 	conn, err := net.Dial("unix", string(socket))
 	if err != nil {
@@ -66,6 +79,44 @@ func StartAgent() (client agent.Agent, socket string, pid int, cleanup func()) {
 	return
 }
 
+// CleanupAgents kills the agents started in the given directories by a node which
+// was stopped while jobs were running and removes their sockets. Directories not
+// created by StartAgent are skipped. It returns the number of killed agents
+func CleanupAgents(dirs []string) int {
+	killed := 0
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "agent.pid")); err != nil {
+			continue
+		}
+		if pid, ok := agentPid(dir); ok {
+			if err := syscall.Kill(pid, syscall.SIGKILL); err == nil {
+				killed++
+			}
+		}
+		os.RemoveAll(dir)
+	}
+	return killed
+}
+
+// agentPid returns the pid of the agent started in the directory
+// if the agent is still running
+func agentPid(dir string) (int, bool) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "agent.pid"))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, false
+	}
+	// the pid may have been reused by another process
+	cmdline, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/cmdline")
+	if err != nil || !strings.Contains(string(cmdline), "ssh-agent") {
+		return 0, false
+	}
+	return pid, true
+}
+
 func GetKey(key []byte, secret []byte) (addedkey agent.AddedKey, err error) {
 	addedkey = agent.AddedKey{}
 	addedkey.PrivateKey, err = sshkeys.ParseEncryptedRawPrivateKey(key, secret)
@@ -5,6 +5,7 @@ package ssh
 import (
 	"github.com/stretchr/testify/suite"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -13,7 +14,7 @@ type AgentTestSuite struct {
 }
 
 func (suite *AgentTestSuite) TestAgent() {
-	client, socket, pid, clean := StartAgent()
+	client, socket, pid, clean := StartAgent("tensor_agent_")
 
 	suite.NotEmpty(client, "Client should not empty")
 	suite.NotEmpty(socket, "Socket should not empty")
@@ -24,6 +25,20 @@ func (suite *AgentTestSuite) TestAgent() {
 	suite.Error(err, "Stat should return error")
 }
 
+func (suite *AgentTestSuite) TestCleanupAgents() {
+	_, socket, _, _ := StartAgent("tensor_agent_")
+	_, other, _, clean := StartAgent("tensor_agent_")
+	defer clean()
+	dirs := []string{filepath.Dir(socket)}
+
+	suite.Equal(1, CleanupAgents(dirs), "Agent should be killed")
+	_, err := os.Stat(socket)
+	suite.Error(err, "Stat should return error")
+	suite.Equal(0, CleanupAgents(dirs), "No agent should be left")
+	_, err = os.Stat(other)
+	suite.NoError(err, "Agents of other directories should be kept")
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestAgentTestSuite(t *testing.T) {
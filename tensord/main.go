@@ -13,26 +13,45 @@ import (
 	"time"
 
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
 	"github.com/pearsonappeng/tensor/api"
 	"github.com/pearsonappeng/tensor/db"
+	"github.com/pearsonappeng/tensor/exec/adhoc"
 	"github.com/pearsonappeng/tensor/exec/ansible"
+	"github.com/pearsonappeng/tensor/exec/instance"
+	"github.com/pearsonappeng/tensor/exec/inventory"
+	"github.com/pearsonappeng/tensor/exec/misc"
+	"github.com/pearsonappeng/tensor/exec/scheduler"
 	"github.com/pearsonappeng/tensor/exec/terraform"
+	"github.com/pearsonappeng/tensor/exec/worker"
+	"github.com/pearsonappeng/tensor/exec/workflow"
 	"github.com/pearsonappeng/tensor/log"
 	"github.com/pearsonappeng/tensor/queue"
+	"github.com/pearsonappeng/tensor/ssh"
 	"github.com/pearsonappeng/tensor/util"
 	"github.com/pearsonappeng/tensor/validate"
 	"gopkg.in/gin-gonic/gin.v1/binding"
 )
 
+// terminateTimeout is the time given to the terminated jobs to record their status
+const terminateTimeout = 30 * time.Second
+
 func main() {
 
 	if util.Config.Debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 	logrus.Infoln("Tensor:", util.Version)
+	logrus.Infoln("Role:", util.Config.Role)
+	switch util.Config.Role {
+	case util.RoleAPI, util.RoleWorker, util.RoleAll:
+	default:
+		logrus.Fatalln("Invalid role", util.Config.Role, "the role must be api, worker or all")
+	}
 	logrus.Infoln("Port:", util.Config.Host)
 	logrus.Infoln("MongoDB:", util.Config.MongoDB.Username, util.Config.MongoDB.Hosts, util.Config.MongoDB.DbName)
 	logrus.Infoln("Projects Home:", util.Config.ProjectsHome)
@@ -44,13 +63,42 @@ func main() {
 	}
 	defer db.MongoDb.Session.Close()
 
-	// Test Connectivity to RabbitMQ
-	if err := queue.TestConnect(); err != nil {
+	logrus.Infoln("Queue:", util.Config.Queue)
+	if err := queue.Connect(); err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err.Error(),
-		}).Fatalln("Unable to initialize a connection to RabbitMQ")
+		}).Fatalln("Unable to initialize a connection to the queue")
 		os.Exit(1)
 	}
+	defer queue.Close()
+
+	// register the node, the heartbeat is sent until the node stops
+	if err := instance.Register(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Fatalln("Unable to register the instance")
+		os.Exit(1)
+	}
+	go instance.Run()
+	go shutdown()
+
+	if util.Config.Role != util.RoleAPI {
+		// clean up after a previous run of the node stopped while jobs were running
+		instance.Reconcile()
+		stale := misc.StaleTempFiles()
+		logrus.Infoln("Stale ssh agents killed:", ssh.CleanupAgents(stale))
+		logrus.Infoln("Stale temporary files removed:", misc.RemoveTempFiles(stale))
+
+		go ansible.Run()
+		go terraform.Run()
+		go adhoc.Run()
+		go inventory.Run()
+	}
+
+	// worker nodes do not serve the API
+	if util.Config.Role == util.RoleWorker {
+		select {}
+	}
 
 	// Define custom validator
 	binding.Validator = &validate.Validator{}
@@ -67,8 +115,8 @@ func main() {
 	api.Route(r)
 
 	//Background tasks
-	go ansible.Run()
-	go terraform.Run()
+	go scheduler.Run()
+	go workflow.Run()
 
 	if util.Config.TLSEnabled {
 		if err := r.RunTLS(util.Config.GetAddress(), util.Config.SSLCertificate, util.Config.SSLCertificateKey); err != nil {
@@ -84,3 +132,33 @@ func main() {
 		}
 	}
 }
+
+// shutdown waits for SIGTERM or SIGINT and stops consuming the queues. The running jobs
+// are given the shutdown timeout to finish, then they are terminated and marked as error
+func shutdown() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	s := <-sig
+
+	logrus.WithFields(logrus.Fields{
+		"Signal":  s.String(),
+		"Timeout": util.Config.ShutdownTimeout,
+	}).Infoln("Shutting down, waiting for the running jobs")
+
+	worker.Stop()
+	if !worker.Wait(time.Duration(util.Config.ShutdownTimeout) * time.Second) {
+		logrus.Warningln("Shutdown timeout expired, terminated jobs:", misc.TerminateJobs())
+		if !worker.Wait(terminateTimeout) {
+			logrus.Errorln("Jobs still running after they were terminated")
+		}
+	}
+
+	if err := instance.Deregister(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err.Error(),
+		}).Errorln("Unable to deregister the instance")
+	}
+	queue.Close()
+	db.MongoDb.Session.Close()
+	os.Exit(0)
+}
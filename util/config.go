@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"strings"
 
 	"strconv"
@@ -21,6 +22,14 @@ import (
 var InteractiveSetup bool
 var Secrets bool
 
+// Roles of a tensord node, api nodes serve the REST API and
+// worker nodes run the jobs
+const (
+	RoleAPI    = "api"
+	RoleWorker = "worker"
+	RoleAll    = "all"
+)
+
 type MongoDBConfig struct {
 	Hosts      []string `yaml:"hosts"`
 	Username   string   `yaml:"user"`
@@ -29,24 +38,134 @@ type MongoDBConfig struct {
 	ReplicaSet string   `yaml:"replica_set"`
 }
 
+// LDAPConfig configures the LDAP authentication backend
+type LDAPConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// URL of the server, ldap://host:389 or ldaps://host:636
+	URL                string `yaml:"url"`
+	StartTLS           bool   `yaml:"start_tls"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+	// CACertificate is a PEM file used to verify the server certificate
+	CACertificate string `yaml:"ca_certificate"`
+
+	// BindDN and BindPassword are used to search users and groups
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+
+	UserSearchBase string `yaml:"user_search_base"`
+	// UserFilter finds the user, %s is replaced with the login
+	UserFilter         string `yaml:"user_filter"`
+	UsernameAttribute  string `yaml:"username_attribute"`
+	EmailAttribute     string `yaml:"email_attribute"`
+	FirstNameAttribute string `yaml:"first_name_attribute"`
+	LastNameAttribute  string `yaml:"last_name_attribute"`
+
+	GroupSearchBase string `yaml:"group_search_base"`
+	// GroupFilter finds the groups of the user, %s is replaced with the user DN
+	GroupFilter string `yaml:"group_filter"`
+
+	// Members of these groups are super users and system auditors,
+	// the flags are left unchanged when no groups are set
+	SuperUserGroups []string `yaml:"superuser_groups"`
+	AuditorGroups   []string `yaml:"auditor_groups"`
+
+	Organizations []OrganizationRule `yaml:"organizations"`
+	Teams         []TeamRule         `yaml:"teams"`
+}
+
+// OIDCConfig configures the OpenID Connect login
+type OIDCConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Issuer is the URL of the provider, its configuration
+	// is discovered at /.well-known/openid-configuration
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL is the callback registered with the provider
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+
+	// claims of the ID token used to provision the users
+	UsernameClaim  string `yaml:"username_claim"`
+	EmailClaim     string `yaml:"email_claim"`
+	FirstNameClaim string `yaml:"first_name_claim"`
+	LastNameClaim  string `yaml:"last_name_claim"`
+	GroupsClaim    string `yaml:"groups_claim"`
+
+	// Members of these groups are super users and system auditors,
+	// the flags are left unchanged when no groups are set
+	SuperUserGroups []string `yaml:"superuser_groups"`
+	AuditorGroups   []string `yaml:"auditor_groups"`
+
+	Organizations []OrganizationRule `yaml:"organizations"`
+	Teams         []TeamRule         `yaml:"teams"`
+}
+
+// OrganizationRule maps LDAP or OpenID Connect groups to the roles of an organization,
+// roles without groups are left unchanged
+type OrganizationRule struct {
+	Organization string   `yaml:"organization"`
+	Admins       []string `yaml:"admins"`
+	Auditors     []string `yaml:"auditors"`
+	Members      []string `yaml:"members"`
+}
+
+// TeamRule maps LDAP or OpenID Connect groups to the roles of a team of an organization,
+// roles without groups are left unchanged
+type TeamRule struct {
+	Organization string   `yaml:"organization"`
+	Team         string   `yaml:"team"`
+	Admins       []string `yaml:"admins"`
+	Members      []string `yaml:"members"`
+}
+
 type configType struct {
 	MongoDB MongoDBConfig `yaml:"mongodb"`
 
 	RabbitMQ string `yaml:"rabbitmq"`
+	// Queue is the queue backend, rabbitmq or memory.
+	// The memory queue can only be used by a single tensord with role all
+	Queue string `yaml:"queue"`
 
 	// TCP address to listen on, ":http" if empty
 	Host string `yaml:"host"`
 	Port string `yaml:"port"`
 
-	// Tensor stores projects here
+	// Tensor stores projects here, every node keeps its own checkouts
+	// and updates them before it runs a job of the project
 	ProjectsHome string `yaml:"projects_home"`
 
 	// cookie hashing & encryption
 	Salt string `yaml:"salt"`
 
-	AnsibleJobTimeOut   int `yaml:"ansible_job_timeout"`
-	SyncJobTimeOut      int `yaml:"sync_job_timeout"`
-	TerraformJobTimeOut int `yaml:"terraform_job_timeout"`
+	AnsibleJobTimeOut      int `yaml:"ansible_job_timeout"`
+	SyncJobTimeOut         int `yaml:"sync_job_timeout"`
+	TerraformJobTimeOut    int `yaml:"terraform_job_timeout"`
+	InventoryUpdateTimeOut int `yaml:"inventory_update_timeout"`
+
+	// TerraformPlanMaxAge is the age in seconds after which
+	// a saved terraform plan can no longer be applied
+	TerraformPlanMaxAge int `yaml:"terraform_plan_max_age"`
+
+	// number of jobs of each type run concurrently by the node
+	AnsibleWorkers   int `yaml:"ansible_workers"`
+	TerraformWorkers int `yaml:"terraform_workers"`
+	AdHocWorkers     int `yaml:"ad_hoc_workers"`
+	InventoryWorkers int `yaml:"inventory_workers"`
+	// Capacity limits the total impact of the jobs running on the node,
+	// the impact of a job is based on its forks or parallelism
+	Capacity int `yaml:"capacity"`
+
+	// Role of the node, api, worker or all
+	Role string `yaml:"role"`
+	// Hostname identifies the node in the registered instances
+	Hostname string `yaml:"hostname"`
+	// InstanceTimeout is the time in seconds after which a node that
+	// has not sent a heartbeat is lost and its running jobs are failed
+	InstanceTimeout int `yaml:"instance_timeout"`
+	// ShutdownTimeout is the time in seconds given to the running jobs
+	// to finish after SIGTERM before they are terminated
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
 
 	JWTTimeout        int `yaml:"jwt_timeout"`
 	JWTRefreshTimeout int `yaml:"jwt_refresh_timeout"`
@@ -55,6 +174,9 @@ type configType struct {
 	SSLCertificate    string `yaml:"ssl_certificate"`
 	SSLCertificateKey string `yaml:"ssl_certificate_key"`
 
+	LDAP LDAPConfig `yaml:"ldap"`
+	OIDC OIDCConfig `yaml:"oidc"`
+
 	Debug bool `yaml:"debug"`
 }
 
@@ -77,6 +199,8 @@ func init() {
 	flag.BoolVar(&Secrets, "secrets", false, "generate salt")
 	var pwd string
 	flag.StringVar(&pwd, "hash", "", "generate hash of given password")
+	var role string
+	flag.StringVar(&role, "role", "", "role of the node: api, worker or all")
 
 	flag.Parse()
 
@@ -147,6 +271,83 @@ func init() {
 		Config.SyncJobTimeOut = 3600
 	}
 
+	if len(os.Getenv("TENSOR_INVENTORY_UPDATE_TIMEOUT")) > 0 {
+		time, _ := strconv.Atoi(os.Getenv("TENSOR_INVENTORY_UPDATE_TIMEOUT"))
+		Config.InventoryUpdateTimeOut = time
+	} else if Config.InventoryUpdateTimeOut == 0 {
+		Config.InventoryUpdateTimeOut = 3600
+	}
+
+	if len(os.Getenv("TENSOR_TERRAFORM_PLAN_MAX_AGE")) > 0 {
+		age, _ := strconv.Atoi(os.Getenv("TENSOR_TERRAFORM_PLAN_MAX_AGE"))
+		Config.TerraformPlanMaxAge = age
+	} else if Config.TerraformPlanMaxAge == 0 {
+		Config.TerraformPlanMaxAge = 86400
+	}
+
+	if len(os.Getenv("TENSOR_ANSIBLE_WORKERS")) > 0 {
+		workers, _ := strconv.Atoi(os.Getenv("TENSOR_ANSIBLE_WORKERS"))
+		Config.AnsibleWorkers = workers
+	} else if Config.AnsibleWorkers == 0 {
+		Config.AnsibleWorkers = 4
+	}
+
+	if len(os.Getenv("TENSOR_TERRAFORM_WORKERS")) > 0 {
+		workers, _ := strconv.Atoi(os.Getenv("TENSOR_TERRAFORM_WORKERS"))
+		Config.TerraformWorkers = workers
+	} else if Config.TerraformWorkers == 0 {
+		Config.TerraformWorkers = 2
+	}
+
+	if len(os.Getenv("TENSOR_AD_HOC_WORKERS")) > 0 {
+		workers, _ := strconv.Atoi(os.Getenv("TENSOR_AD_HOC_WORKERS"))
+		Config.AdHocWorkers = workers
+	} else if Config.AdHocWorkers == 0 {
+		Config.AdHocWorkers = 2
+	}
+
+	if len(os.Getenv("TENSOR_INVENTORY_WORKERS")) > 0 {
+		workers, _ := strconv.Atoi(os.Getenv("TENSOR_INVENTORY_WORKERS"))
+		Config.InventoryWorkers = workers
+	} else if Config.InventoryWorkers == 0 {
+		Config.InventoryWorkers = 2
+	}
+
+	if len(os.Getenv("TENSOR_CAPACITY")) > 0 {
+		capacity, _ := strconv.Atoi(os.Getenv("TENSOR_CAPACITY"))
+		Config.Capacity = capacity
+	} else if Config.Capacity == 0 {
+		Config.Capacity = runtime.NumCPU() * 10
+	}
+
+	if len(role) > 0 {
+		Config.Role = role
+	} else if len(os.Getenv("TENSOR_ROLE")) > 0 {
+		Config.Role = os.Getenv("TENSOR_ROLE")
+	} else if len(Config.Role) == 0 {
+		Config.Role = RoleAll
+	}
+
+	if len(os.Getenv("TENSOR_HOSTNAME")) > 0 {
+		Config.Hostname = os.Getenv("TENSOR_HOSTNAME")
+	} else if len(Config.Hostname) == 0 {
+		Config.Hostname, _ = os.Hostname()
+	}
+
+	if len(os.Getenv("TENSOR_INSTANCE_TIMEOUT")) > 0 {
+		timeout, _ := strconv.Atoi(os.Getenv("TENSOR_INSTANCE_TIMEOUT"))
+		Config.InstanceTimeout = timeout
+	} else if Config.InstanceTimeout == 0 {
+		Config.InstanceTimeout = 60
+	}
+
+	if len(os.Getenv("TENSOR_SHUTDOWN_TIMEOUT")) > 0 {
+		timeout, _ := strconv.Atoi(os.Getenv("TENSOR_SHUTDOWN_TIMEOUT"))
+		Config.ShutdownTimeout = timeout
+	} else if Config.ShutdownTimeout == 0 {
+		Config.ShutdownTimeout = 60
+	}
+
 	if len(os.Getenv("TENSOR_JWT_TIMEOUT")) > 0 {
 		time, _ := strconv.Atoi(os.Getenv("TENSOR_JWT_TIMEOUT"))
 		Config.JWTTimeout = time
@@ -185,6 +386,12 @@ func init() {
 		Config.RabbitMQ = os.Getenv("TENSOR_RABBITMQ")
 	}
 
+	if len(os.Getenv("TENSOR_QUEUE")) > 0 {
+		Config.Queue = os.Getenv("TENSOR_QUEUE")
+	} else if len(Config.Queue) == 0 {
+		Config.Queue = "rabbitmq"
+	}
+
 	// TLS configuration
 	if os.Getenv("TENSOR_TLS_ENABLED") == "true" {
 		Config.TLSEnabled = true
@@ -198,6 +405,94 @@ func init() {
 		Config.SSLCertificateKey = os.Getenv("TENSOR_SSL_CERTIFICATE_KEY")
 	}
 
+	// LDAP configuration
+	if os.Getenv("TENSOR_LDAP_ENABLED") == "true" {
+		Config.LDAP.Enabled = true
+	}
+
+	if len(os.Getenv("TENSOR_LDAP_URL")) > 0 {
+		Config.LDAP.URL = os.Getenv("TENSOR_LDAP_URL")
+	}
+
+	if len(os.Getenv("TENSOR_LDAP_BIND_DN")) > 0 {
+		Config.LDAP.BindDN = os.Getenv("TENSOR_LDAP_BIND_DN")
+	}
+
+	if len(os.Getenv("TENSOR_LDAP_BIND_PASSWORD")) > 0 {
+		Config.LDAP.BindPassword = os.Getenv("TENSOR_LDAP_BIND_PASSWORD")
+	}
+
+	if len(Config.LDAP.UserFilter) == 0 {
+		Config.LDAP.UserFilter = "(uid=%s)"
+	}
+
+	if len(Config.LDAP.UsernameAttribute) == 0 {
+		Config.LDAP.UsernameAttribute = "uid"
+	}
+
+	if len(Config.LDAP.EmailAttribute) == 0 {
+		Config.LDAP.EmailAttribute = "mail"
+	}
+
+	if len(Config.LDAP.FirstNameAttribute) == 0 {
+		Config.LDAP.FirstNameAttribute = "givenName"
+	}
+
+	if len(Config.LDAP.LastNameAttribute) == 0 {
+		Config.LDAP.LastNameAttribute = "sn"
+	}
+
+	if len(Config.LDAP.GroupFilter) == 0 {
+		Config.LDAP.GroupFilter = "(member=%s)"
+	}
+
+	// OpenID Connect configuration
+	if os.Getenv("TENSOR_OIDC_ENABLED") == "true" {
+		Config.OIDC.Enabled = true
+	}
+
+	if len(os.Getenv("TENSOR_OIDC_ISSUER")) > 0 {
+		Config.OIDC.Issuer = os.Getenv("TENSOR_OIDC_ISSUER")
+	}
+
+	if len(os.Getenv("TENSOR_OIDC_CLIENT_ID")) > 0 {
+		Config.OIDC.ClientID = os.Getenv("TENSOR_OIDC_CLIENT_ID")
+	}
+
+	if len(os.Getenv("TENSOR_OIDC_CLIENT_SECRET")) > 0 {
+		Config.OIDC.ClientSecret = os.Getenv("TENSOR_OIDC_CLIENT_SECRET")
+	}
+
+	if len(os.Getenv("TENSOR_OIDC_REDIRECT_URL")) > 0 {
+		Config.OIDC.RedirectURL = os.Getenv("TENSOR_OIDC_REDIRECT_URL")
+	} else if len(Config.OIDC.RedirectURL) == 0 {
+		Config.OIDC.RedirectURL = Config.GetUrl() + "/v1/auth/oidc/callback"
+	}
+
+	if len(Config.OIDC.Scopes) == 0 {
+		Config.OIDC.Scopes = []string{"openid", "profile", "email"}
+	}
+
+	if len(Config.OIDC.UsernameClaim) == 0 {
+		Config.OIDC.UsernameClaim = "preferred_username"
+	}
+
+	if len(Config.OIDC.EmailClaim) == 0 {
+		Config.OIDC.EmailClaim = "email"
+	}
+
+	if len(Config.OIDC.FirstNameClaim) == 0 {
+		Config.OIDC.FirstNameClaim = "given_name"
+	}
+
+	if len(Config.OIDC.LastNameClaim) == 0 {
+		Config.OIDC.LastNameClaim = "family_name"
+	}
+
+	if len(Config.OIDC.GroupsClaim) == 0 {
+		Config.OIDC.GroupsClaim = "groups"
+	}
+
 	// Debug configuration
 	if os.Getenv("TENSOR_DEBUG") == "true" {
 		Config.Debug = true
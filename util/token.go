@@ -0,0 +1,22 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// HashToken returns the hex encoded SHA-256 hash of the token.
+// Random tokens are stored hashed, the token itself is only known to the holder
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenMatches compares the token with the stored hash in constant time
+func TokenMatches(token string, hash string) bool {
+	if len(token) == 0 || len(hash) == 0 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
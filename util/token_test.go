@@ -0,0 +1,17 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenMatches(t *testing.T) {
+	token := UniqueNewLen(32)
+	hash := HashToken(token)
+
+	assert.NotEqual(t, token, hash)
+	assert.True(t, TokenMatches(token, hash))
+	assert.False(t, TokenMatches(token+"x", hash))
+	assert.False(t, TokenMatches("", HashToken("")), "empty tokens never match")
+}
@@ -19,13 +19,20 @@ import (
 )
 
 const (
-	Become           string = "^(sudo|su|pbrun|pfexec|runas|doas|dzdo)$"
-	CredentialKind   string = "^(windows|ssh|net|scm|aws|rax|vmware|satellite6|cloudforms|gce|azure|openstack)$"
-	ScmType          string = "^(manual|git|hg|svn)$"
-	JobType          string = "^(run|check|scan)$"
-	ProjectKind      string = "^(ansible|terraform)$"
-	TerraformJobType string = "^(plan|apply|destroy|destroy_plan)$"
-	ResourceType     string = "^(credential|organization|team|project|job_template|terraform_job_template|inventory)$"
+	Become             string = "^(sudo|su|pbrun|pfexec|runas|doas|dzdo)$"
+	CredentialKind     string = "^(windows|ssh|net|scm|aws|rax|vmware|satellite6|cloudforms|gce|azure|openstack)$"
+	ScmType            string = "^(manual|git|hg|svn)$"
+	JobType            string = "^(run|check|scan)$"
+	ProjectKind        string = "^(ansible|terraform)$"
+	TerraformJobType   string = "^(plan|apply|destroy|destroy_plan)$"
+	ResourceType       string = "^(credential|organization|team|project|job_template|terraform_job_template|inventory)$"
+	InventorySource    string = "^(ec2|gce|azure_rm|openstack|vmware|rax|foreman|custom|terraform)$"
+	InventoryScript    string = "^#!"
+	NotificationType   string = "^(email|webhook|slack|mattermost)$"
+	SurveyType         string = "^(text|integer|float|multiplechoice|multiselect|password)$"
+	TerraformWorkspace string = "^[a-zA-Z0-9_-]{1,90}$"
+	TerraformImport    string = "^(state|outputs)$"
+	TokenScope         string = "^(read|launch|write)$"
 
 	DNSName      string = `^([a-zA-Z0-9]{1}[a-zA-Z0-9_-]{1,62}){1}(\.[a-zA-Z0-9]{1}[a-zA-Z0-9_-]{1,62})*$`
 	IP           string = `(([0-9a-fA-F]{1,4}:){7,7}[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,7}:|([0-9a-fA-F]{1,4}:){1,6}:[0-9a-fA-F]{1,4}|([0-9a-fA-F]{1,4}:){1,5}(:[0-9a-fA-F]{1,4}){1,2}|([0-9a-fA-F]{1,4}:){1,4}(:[0-9a-fA-F]{1,4}){1,3}|([0-9a-fA-F]{1,4}:){1,3}(:[0-9a-fA-F]{1,4}){1,4}|([0-9a-fA-F]{1,4}:){1,2}(:[0-9a-fA-F]{1,4}){1,5}|[0-9a-fA-F]{1,4}:((:[0-9a-fA-F]{1,4}){1,6})|:((:[0-9a-fA-F]{1,4}){1,7}|:)|fe80:(:[0-9a-fA-F]{0,4}){0,4}%[0-9a-zA-Z]{1,}|::(ffff(:0{1,4}){0,1}:){0,1}((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])|([0-9a-fA-F]{1,4}:){1,4}:((25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9])\.){3,3}(25[0-5]|(2[0-4]|1{0,1}[0-9]){0,1}[0-9]))`
@@ -43,15 +50,22 @@ var Uni *ut.UniversalTranslator
 var trans ut.Translator
 
 var (
-	rxBecome           = regexp.MustCompile(Become)
-	rxDNSName          = regexp.MustCompile(DNSName)
-	rxURL              = regexp.MustCompile(URL)
-	rxCredentialKind   = regexp.MustCompile(CredentialKind)
-	rxScmType          = regexp.MustCompile(ScmType)
-	rxJobType          = regexp.MustCompile(JobType)
-	rxProjectKind      = regexp.MustCompile(ProjectKind)
-	rxTerraformJobType = regexp.MustCompile(TerraformJobType)
-	rxResourceType     = regexp.MustCompile(ResourceType)
+	rxBecome             = regexp.MustCompile(Become)
+	rxDNSName            = regexp.MustCompile(DNSName)
+	rxURL                = regexp.MustCompile(URL)
+	rxCredentialKind     = regexp.MustCompile(CredentialKind)
+	rxScmType            = regexp.MustCompile(ScmType)
+	rxJobType            = regexp.MustCompile(JobType)
+	rxProjectKind        = regexp.MustCompile(ProjectKind)
+	rxTerraformJobType   = regexp.MustCompile(TerraformJobType)
+	rxResourceType       = regexp.MustCompile(ResourceType)
+	rxInventorySource    = regexp.MustCompile(InventorySource)
+	rxInventoryScript    = regexp.MustCompile(InventoryScript)
+	rxNotificationType   = regexp.MustCompile(NotificationType)
+	rxSurveyType         = regexp.MustCompile(SurveyType)
+	rxTerraformWorkspace = regexp.MustCompile(TerraformWorkspace)
+	rxTerraformImport    = regexp.MustCompile(TerraformImport)
+	rxTokenScope         = regexp.MustCompile(TokenScope)
 )
 
 type Validator struct {
@@ -92,6 +106,13 @@ func (v *Validator) lazyinit() {
 		v.validate.RegisterValidation("project_kind", isProjectKind)
 		v.validate.RegisterValidation("terraform_jobtype", isTerraformJobType)
 		v.validate.RegisterValidation("resource_type", isResourceType)
+		v.validate.RegisterValidation("inventory_source", isInventorySource)
+		v.validate.RegisterValidation("inventory_script", isInventoryScript)
+		v.validate.RegisterValidation("notification_type", isNotificationType)
+		v.validate.RegisterValidation("survey_type", isSurveyType)
+		v.validate.RegisterValidation("terraform_workspace", isTerraformWorkspace)
+		v.validate.RegisterValidation("terraform_import", isTerraformImport)
+		v.validate.RegisterValidation("token_scope", isTokenScope)
 
 		//translations
 		v.validate.RegisterTranslation("credential_kind", trans, func(ut ut.Translator) error {
@@ -166,9 +187,66 @@ func (v *Validator) lazyinit() {
 			return t
 		})
 
+		v.validate.RegisterTranslation("inventory_source", trans, func(ut ut.Translator) error {
+			return ut.Add("inventory_source", "{0} must have either one of ec2,gce,azure_rm,openstack,vmware,rax,foreman,custom,terraform", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("inventory_source", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("inventory_script", trans, func(ut ut.Translator) error {
+			return ut.Add("inventory_script", "{0} must begin with an interpreter directive such as #!/usr/bin/env python", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("inventory_script", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("notification_type", trans, func(ut ut.Translator) error {
+			return ut.Add("notification_type", "{0} must have either one of email,webhook,slack,mattermost", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("notification_type", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("survey_type", trans, func(ut ut.Translator) error {
+			return ut.Add("survey_type", "{0} must have either one of text,integer,float,multiplechoice,multiselect,password", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("survey_type", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("terraform_workspace", trans, func(ut ut.Translator) error {
+			return ut.Add("terraform_workspace", "{0} must only contain letters, digits, dashes and underscores", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("terraform_workspace", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("terraform_import", trans, func(ut ut.Translator) error {
+			return ut.Add("terraform_import", "{0} must have either one of state,outputs", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("terraform_import", fe.Field())
+
+			return t
+		})
+
+		v.validate.RegisterTranslation("token_scope", trans, func(ut ut.Translator) error {
+			return ut.Add("token_scope", "{0} must have either one of read,launch,write", true)
+		}, func(ut ut.Translator, fe validator.FieldError) string {
+			t, _ := ut.T("token_scope", fe.Field())
+
+			return t
+		})
+
 		//struct level validations
 		v.validate.RegisterStructValidation(credentialStructLevelValidation, common.Credential{})
 		v.validate.RegisterStructValidation(projectStructLevelValidation, common.Project{})
+		v.validate.RegisterStructValidation(notificationTemplateStructLevelValidation, common.NotificationTemplate{})
 		v.validate.RegisterStructValidation(roleObjStructLevelValidation, common.RoleObj{})
 	})
 }
@@ -229,6 +307,34 @@ func isResourceType(fl validator.FieldLevel) bool {
 	return rxResourceType.MatchString(fl.Field().String())
 }
 
+func isInventorySource(fl validator.FieldLevel) bool {
+	return rxInventorySource.MatchString(fl.Field().String())
+}
+
+func isInventoryScript(fl validator.FieldLevel) bool {
+	return rxInventoryScript.MatchString(fl.Field().String())
+}
+
+func isNotificationType(fl validator.FieldLevel) bool {
+	return rxNotificationType.MatchString(fl.Field().String())
+}
+
+func isSurveyType(fl validator.FieldLevel) bool {
+	return rxSurveyType.MatchString(fl.Field().String())
+}
+
+func isTerraformWorkspace(fl validator.FieldLevel) bool {
+	return rxTerraformWorkspace.MatchString(fl.Field().String())
+}
+
+func isTerraformImport(fl validator.FieldLevel) bool {
+	return rxTerraformImport.MatchString(fl.Field().String())
+}
+
+func isTokenScope(fl validator.FieldLevel) bool {
+	return rxTokenScope.MatchString(fl.Field().String())
+}
+
 // fail all
 func naProperty(fl validator.FieldLevel) bool {
 	if fl.Field().String() == "" {
@@ -370,12 +476,18 @@ func roleObjStructLevelValidation(sl validator.StructLevel) {
 				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,member", "")
 			}
 		}
-	case "project", "inventory":
+	case "project":
 		{
 			if roleobj.Role != "admin" && roleobj.Role != "update" && roleobj.Role != "use" {
 				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,update,use", "")
 			}
 		}
+	case "inventory":
+		{
+			if roleobj.Role != "admin" && roleobj.Role != "update" && roleobj.Role != "use" && roleobj.Role != "ad_hoc" {
+				sl.ReportError(roleobj.Role, "Role", "Role", "Role must be either one of admin,update,use,ad_hoc", "")
+			}
+		}
 	case "job_template", "terraform_job_template":
 		{
 			if roleobj.Role != "admin" && roleobj.Role != "execute" {
@@ -384,3 +496,35 @@ func roleObjStructLevelValidation(sl validator.StructLevel) {
 		}
 	}
 }
+
+func notificationTemplateStructLevelValidation(sl validator.StructLevel) {
+
+	template := sl.Current().Interface().(common.NotificationTemplate)
+	config := template.NotificationConfiguration
+
+	if template.NotificationsType == common.NotificationTypeEmail {
+		if len(config.Host) == 0 {
+			sl.ReportError(config.Host, "Host", "Host", "required", "")
+		}
+
+		if len(config.Sender) == 0 {
+			sl.ReportError(config.Sender, "Sender", "Sender", "required", "")
+		}
+
+		if len(config.Recipients) == 0 {
+			sl.ReportError(config.Recipients, "Recipients", "Recipients", "required", "")
+		}
+
+		if config.UseTLS && config.UseSSL {
+			sl.ReportError(config.UseTLS, "UseTLS", "Use TLS", "Use TLS and Use SSL can not be enabled together", "")
+		}
+	}
+
+	if template.NotificationsType == common.NotificationTypeWebhook ||
+		template.NotificationsType == common.NotificationTypeSlack ||
+		template.NotificationsType == common.NotificationTypeMattermost {
+		if len(config.URL) == 0 {
+			sl.ReportError(config.URL, "URL", "URL", "required", "")
+		}
+	}
+}